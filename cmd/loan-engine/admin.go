@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/zainulbr/simple-loan-engine/container"
+	modelAPIKey "github.com/zainulbr/simple-loan-engine/models/apikey"
+	modelLoan "github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	apiKeyService "github.com/zainulbr/simple-loan-engine/services/apikey"
+	"github.com/zainulbr/simple-loan-engine/services/loan"
+	userService "github.com/zainulbr/simple-loan-engine/services/user"
+	"github.com/zainulbr/simple-loan-engine/settings"
+)
+
+// Output formats of the admin commands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// adminServices are the services used by the admin commands, built once the database is open
+type adminServices struct {
+	users   userService.UserService
+	loans   loan.LoanService
+	apiKeys apiKeyService.APIKeyService
+}
+
+// withActor returns ctx acting as the user actorID, recorded as responsible for the changes
+func (svc *adminServices) withActor(ctx context.Context, actorID string) (context.Context, error) {
+	id, err := uuid.Parse(actorID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid actor id: %w", err)
+	}
+	u, err := svc.users.GetUser(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("actor %s: %w", id, err)
+	}
+	return user.ContextWithActor(ctx, user.Actor{UserId: u.UserId, Role: u.Role}), nil
+}
+
+// newAdminCmd groups the operational commands, they go through the service layer like the API
+func newAdminCmd(config *settings.Settings) *cobra.Command {
+	var output string
+	adminCmd := &cobra.Command{
+		Use:   "admin",
+		Short: "operational tasks for platform staff",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if output != outputTable && output != outputJSON {
+				return fmt.Errorf("unknown output format %q, use %s or %s", output, outputTable, outputJSON)
+			}
+			return nil
+		},
+	}
+	adminCmd.PersistentFlags().StringVarP(&output, "output", "o", outputTable, "output format, table or json")
+
+	// withServices opens the connections around an admin subcommand
+	withServices := func(run func(cmd *cobra.Command, args []string, svc *adminServices) error) func(*cobra.Command, []string) error {
+		return func(cmd *cobra.Command, args []string) error {
+			c, err := container.New(config)
+			if err != nil {
+				return err
+			}
+			defer c.Stop(context.Background())
+
+			return run(cmd, args, &adminServices{users: c.Services.Users, loans: c.Services.Loans, apiKeys: c.Services.APIKeys})
+		}
+	}
+
+	// render prints v as JSON or as the table written by table
+	render := func(v interface{}, table func(w io.Writer)) error {
+		if output == outputJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(v)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	}
+
+	adminCmd.AddCommand(
+		newAdminUserCmd(withServices, render),
+		newAdminLoanCmd(withServices, render),
+		newAdminAPIKeyCmd(withServices, render),
+	)
+	return adminCmd
+}
+
+type (
+	adminRunner func(run func(cmd *cobra.Command, args []string, svc *adminServices) error) func(*cobra.Command, []string) error
+	adminRender func(v interface{}, table func(w io.Writer)) error
+)
+
+// newAdminUserCmd manages staff accounts and tokens
+func newAdminUserCmd(withServices adminRunner, render adminRender) *cobra.Command {
+	userCmd := &cobra.Command{
+		Use:   "user",
+		Short: "manage staff users",
+	}
+
+	var email, role string
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "create a staff user",
+		RunE: withServices(func(cmd *cobra.Command, args []string, svc *adminServices) error {
+			u, err := svc.users.CreateStaff(cmd.Context(), email, user.UserRole(role))
+			if err != nil {
+				return err
+			}
+			return render(u, func(w io.Writer) {
+				fmt.Fprintln(w, "USER ID\tEMAIL\tROLE")
+				fmt.Fprintf(w, "%s\t%s\t%s\n", u.UserId, u.Email, u.Role)
+			})
+		}),
+	}
+	createCmd.Flags().StringVar(&email, "email", "", "email of the user")
+	createCmd.Flags().StringVar(&role, "role", "", "admin, field_validator, field_officer, credit_officer or service")
+	createCmd.MarkFlagRequired("email")
+	createCmd.MarkFlagRequired("role")
+
+	tokenCmd := &cobra.Command{
+		Use:   "token <user-id>",
+		Short: "issue an API token for a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: withServices(func(cmd *cobra.Command, args []string, svc *adminServices) error {
+			userID, err := uuid.Parse(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid user id: %w", err)
+			}
+			token, err := svc.users.IssueToken(cmd.Context(), userID)
+			if err != nil {
+				return err
+			}
+			return render(map[string]string{"user_id": userID.String(), "token": token}, func(w io.Writer) {
+				fmt.Fprintln(w, token)
+			})
+		}),
+	}
+
+	userCmd.AddCommand(createCmd, tokenCmd)
+	return userCmd
+}
+
+// newAdminLoanCmd inspects and repairs loans
+func newAdminLoanCmd(withServices adminRunner, render adminRender) *cobra.Command {
+	loanCmd := &cobra.Command{
+		Use:   "loan",
+		Short: "inspect and repair loans",
+	}
+
+	// withLoan parses the loan id argument
+	withLoan := func(run func(ctx context.Context, loanID uuid.UUID, svc *adminServices) error) func(*cobra.Command, []string) error {
+		return withServices(func(cmd *cobra.Command, args []string, svc *adminServices) error {
+			loanID, err := uuid.Parse(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid loan id: %w", err)
+			}
+			return run(cmd.Context(), loanID, svc)
+		})
+	}
+
+	inspectCmd := &cobra.Command{
+		Use:   "inspect <loan-id>",
+		Short: "show a loan with its approvals, investments and change history",
+		Args:  cobra.ExactArgs(1),
+		RunE: withLoan(func(ctx context.Context, loanID uuid.UUID, svc *adminServices) error {
+			inspection, err := svc.loans.InspectLoan(ctx, loanID)
+			if err != nil {
+				return err
+			}
+			return render(inspection, func(w io.Writer) { printInspection(w, inspection) })
+		}),
+	}
+
+	var to, reason, actor string
+	transitionCmd := &cobra.Command{
+		Use:   "transition <loan-id>",
+		Short: "force a loan into a state",
+		Long: "Move a loan to any state bypassing the lifecycle, the reason and acting admin are recorded in the change history.\n" +
+			"Side effects of the regular action, e.g. voiding investments, are not applied.",
+		Args: cobra.ExactArgs(1),
+		RunE: withLoan(func(ctx context.Context, loanID uuid.UUID, svc *adminServices) error {
+			ctx, err := svc.withActor(ctx, actor)
+			if err != nil {
+				return err
+			}
+			change, err := svc.loans.ForceTransition(ctx, loanID, modelLoan.LoanState(to), reason)
+			if err != nil {
+				return err
+			}
+			return render(change, func(w io.Writer) {
+				fmt.Fprintf(w, "loan %s moved from %s to %s\n", loanID, change.OldValue, change.NewValue)
+			})
+		}),
+	}
+	transitionCmd.Flags().StringVar(&to, "to", "", "target state")
+	transitionCmd.Flags().StringVar(&reason, "reason", "", "why the lifecycle is bypassed")
+	transitionCmd.Flags().StringVar(&actor, "actor", "", "user id of the admin responsible")
+	transitionCmd.MarkFlagRequired("to")
+	transitionCmd.MarkFlagRequired("reason")
+	transitionCmd.MarkFlagRequired("actor")
+
+	resendCmd := &cobra.Command{
+		Use:   "resend-agreement <loan-id>",
+		Short: "mail the agreement to the investors again",
+		Args:  cobra.ExactArgs(1),
+		RunE: withLoan(func(ctx context.Context, loanID uuid.UUID, svc *adminServices) error {
+			sent, err := svc.loans.ResendAgreement(ctx, loanID)
+			if rerr := render(map[string]interface{}{"loan_id": loanID, "sent": sent}, func(w io.Writer) {
+				fmt.Fprintln(w, "SENT TO")
+				for _, email := range sent {
+					fmt.Fprintln(w, email)
+				}
+			}); rerr != nil {
+				return rerr
+			}
+			return err
+		}),
+	}
+
+	regenerateCmd := &cobra.Command{
+		Use:   "regenerate-agreement <loan-id>",
+		Short: "generate the agreement PDF of a funded loan again",
+		Args:  cobra.ExactArgs(1),
+		RunE: withLoan(func(ctx context.Context, loanID uuid.UUID, svc *adminServices) error {
+			fileID, err := svc.loans.RegenerateAgreement(ctx, loanID)
+			if err != nil {
+				return err
+			}
+			return render(map[string]uuid.UUID{"loan_id": loanID, "file_id": fileID}, func(w io.Writer) {
+				fmt.Fprintf(w, "agreement of loan %s is file %s\n", loanID, fileID)
+			})
+		}),
+	}
+
+	loanCmd.AddCommand(inspectCmd, transitionCmd, resendCmd, regenerateCmd)
+	return loanCmd
+}
+
+// newAdminAPIKeyCmd manages the API keys of service accounts
+func newAdminAPIKeyCmd(withServices adminRunner, render adminRender) *cobra.Command {
+	apiKeyCmd := &cobra.Command{
+		Use:   "apikey",
+		Short: "manage API keys of service accounts",
+	}
+
+	// renderIssued prints a new key, its secret is not shown again
+	renderIssued := func(issued *apiKeyService.Issued) error {
+		return render(issued, func(w io.Writer) {
+			printAPIKeys(w, []modelAPIKey.APIKey{*issued.APIKey})
+			fmt.Fprintf(w, "\nSECRET\t%s\n", issued.Secret)
+		})
+	}
+
+	var name, actor, expires string
+	var scopes []string
+	createCmd := &cobra.Command{
+		Use:   "create <user-id>",
+		Short: "issue an API key to a service account",
+		Args:  cobra.ExactArgs(1),
+		RunE: withServices(func(cmd *cobra.Command, args []string, svc *adminServices) error {
+			userID, err := uuid.Parse(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid user id: %w", err)
+			}
+			ctx, err := svc.withActor(cmd.Context(), actor)
+			if err != nil {
+				return err
+			}
+
+			key := &modelAPIKey.APIKey{UserId: userID, Name: name}
+			for _, scope := range scopes {
+				key.Scopes = append(key.Scopes, modelAPIKey.Scope(scope))
+			}
+			if expires != "" {
+				ttl, err := time.ParseDuration(expires)
+				if err != nil {
+					return fmt.Errorf("invalid expiry: %w", err)
+				}
+				expiresAt := time.Now().Add(ttl)
+				key.ExpiresAt = &expiresAt
+			}
+
+			issued, err := svc.apiKeys.CreateKey(ctx, key)
+			if err != nil {
+				return err
+			}
+			return renderIssued(issued)
+		}),
+	}
+	createCmd.Flags().StringVar(&name, "name", "", "what the key is used for")
+	createCmd.Flags().StringSliceVar(&scopes, "scope", nil, "granted scopes, e.g. loans:read,repayments:write")
+	createCmd.Flags().StringVar(&expires, "expires-in", "", "lifetime of the key, e.g. 2160h, never expires when empty")
+	createCmd.Flags().StringVar(&actor, "actor", "", "user id of the admin responsible")
+	createCmd.MarkFlagRequired("name")
+	createCmd.MarkFlagRequired("scope")
+	createCmd.MarkFlagRequired("actor")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list API keys",
+		RunE: withServices(func(cmd *cobra.Command, args []string, svc *adminServices) error {
+			keys, err := svc.apiKeys.ListKeys(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return render(keys, func(w io.Writer) { printAPIKeys(w, keys) })
+		}),
+	}
+
+	// withKey parses the key id argument
+	withKey := func(run func(ctx context.Context, keyID uuid.UUID, svc *adminServices) error) func(*cobra.Command, []string) error {
+		return withServices(func(cmd *cobra.Command, args []string, svc *adminServices) error {
+			keyID, err := uuid.Parse(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid api key id: %w", err)
+			}
+			return run(cmd.Context(), keyID, svc)
+		})
+	}
+
+	var grace time.Duration
+	rotateCmd := &cobra.Command{
+		Use:   "rotate <key-id>",
+		Short: "replace an API key, the old key keeps working for the grace period",
+		Args:  cobra.ExactArgs(1),
+		RunE: withKey(func(ctx context.Context, keyID uuid.UUID, svc *adminServices) error {
+			ctx, err := svc.withActor(ctx, actor)
+			if err != nil {
+				return err
+			}
+			issued, err := svc.apiKeys.RotateKey(ctx, keyID, grace)
+			if err != nil {
+				return err
+			}
+			return renderIssued(issued)
+		}),
+	}
+	rotateCmd.Flags().DurationVar(&grace, "grace", 0, "how long the old key stays valid, revoked at once when zero")
+	rotateCmd.Flags().StringVar(&actor, "actor", "", "user id of the admin responsible")
+	rotateCmd.MarkFlagRequired("actor")
+
+	revokeCmd := &cobra.Command{
+		Use:   "revoke <key-id>",
+		Short: "revoke an API key",
+		Args:  cobra.ExactArgs(1),
+		RunE: withKey(func(ctx context.Context, keyID uuid.UUID, svc *adminServices) error {
+			if err := svc.apiKeys.RevokeKey(ctx, keyID); err != nil {
+				return err
+			}
+			return render(map[string]uuid.UUID{"key_id": keyID}, func(w io.Writer) {
+				fmt.Fprintf(w, "api key %s revoked\n", keyID)
+			})
+		}),
+	}
+
+	apiKeyCmd.AddCommand(createCmd, listCmd, rotateCmd, revokeCmd)
+	return apiKeyCmd
+}
+
+// printAPIKeys writes keys as a table, never their secrets
+func printAPIKeys(w io.Writer, keys []modelAPIKey.APIKey) {
+	optional := func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+		return t.Format(time.RFC3339)
+	}
+
+	fmt.Fprintln(w, "KEY ID\tPREFIX\tNAME\tUSER ID\tSCOPES\tEXPIRES\tLAST USED\tREVOKED")
+	for _, k := range keys {
+		scopes := make([]string, len(k.Scopes))
+		for i, scope := range k.Scopes {
+			scopes[i] = string(scope)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k.KeyId, k.Prefix, k.Name, k.UserId,
+			strings.Join(scopes, ","), optional(k.ExpiresAt), optional(k.LastUsedAt), optional(k.RevokedAt))
+	}
+}
+
+// printInspection writes the sections of a loan inspection as tables
+func printInspection(w io.Writer, inspection *modelLoan.LoanInspection) {
+	d := inspection.Detail
+	fmt.Fprintf(w, "LOAN\t%s\n", d.LoanId)
+	fmt.Fprintf(w, "STATE\t%s\n", d.State)
+	fmt.Fprintf(w, "DESCRIPTION\t%s\n", d.Description)
+	fmt.Fprintf(w, "PROPOSED BY\t%s\n", d.ProposedBy)
+	fmt.Fprintf(w, "AMOUNT\t%.2f\n", d.Amount)
+	fmt.Fprintf(w, "INVESTED\t%.2f\n", d.TotalInvestment)
+	fmt.Fprintf(w, "RATE / ROI\t%.4f / %.4f\n", d.Rate, d.ROI)
+	fmt.Fprintf(w, "DURATION\t%d months\n", d.DurationMonth)
+	fmt.Fprintf(w, "AGREEMENT\t%s\n", d.AggrementFile)
+	fmt.Fprintf(w, "CREATED\t%s\n", d.CreatedAt.Format(time.RFC3339))
+
+	fmt.Fprintln(w, "\nAPPROVALS")
+	fmt.Fprintln(w, "STAGE\tAPPROVED BY\tDATE\tRATE\tCOMMENT")
+	for _, a := range inspection.Approvals {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.4f\t%s\n", a.Stage, a.ApprovedBy, a.ApprovalDate.Format(time.RFC3339), a.Rate, a.Comment)
+	}
+
+	fmt.Fprintln(w, "\nINVESTMENTS")
+	fmt.Fprintln(w, "INVESTMENT ID\tINVESTOR\tAMOUNT\tROI\tCREATED\tVOIDED")
+	for _, inv := range inspection.Investments {
+		voided := ""
+		if inv.VoidedAt != nil {
+			voided = inv.VoidedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.2f\t%.4f\t%s\t%s\n", inv.InvestmentId, inv.InvestedBy, inv.Amount, inv.ROI,
+			inv.CreatedAt.Format(time.RFC3339), voided)
+	}
+
+	fmt.Fprintln(w, "\nDOCUMENTS")
+	fmt.Fprintln(w, "TYPE\tFILE ID\tUPLOADED BY")
+	for _, doc := range d.Documents {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", doc.DocumentType, doc.FileId, doc.UploadedBy)
+	}
+
+	fmt.Fprintln(w, "\nEVENTS")
+	fmt.Fprintln(w, "DATE\tFIELD\tCHANGE\tBY\tREASON")
+	for _, c := range inspection.Changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.CreatedAt.Format(time.RFC3339), c.Field,
+			strings.TrimSpace(c.OldValue+" -> "+c.NewValue), c.ChangedBy, c.Reason)
+	}
+}
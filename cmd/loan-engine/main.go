@@ -3,25 +3,290 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/zainulbr/simple-loan-engine/container"
+	"github.com/zainulbr/simple-loan-engine/fixtures"
+	"github.com/zainulbr/simple-loan-engine/libs/clock"
+	"github.com/zainulbr/simple-loan-engine/libs/db/migrate"
 	"github.com/zainulbr/simple-loan-engine/libs/db/pgsql"
-	"github.com/zainulbr/simple-loan-engine/libs/notification/mail"
+	"github.com/zainulbr/simple-loan-engine/libs/scheduler"
+	"github.com/zainulbr/simple-loan-engine/migrations"
 	"github.com/zainulbr/simple-loan-engine/registry"
+	_ "github.com/zainulbr/simple-loan-engine/routes/apikey"
+	_ "github.com/zainulbr/simple-loan-engine/routes/auth"
+	_ "github.com/zainulbr/simple-loan-engine/routes/borrower"
 	_ "github.com/zainulbr/simple-loan-engine/routes/file"
+	_ "github.com/zainulbr/simple-loan-engine/routes/investor"
 	_ "github.com/zainulbr/simple-loan-engine/routes/loan"
+	_ "github.com/zainulbr/simple-loan-engine/routes/product"
 
 	"github.com/zainulbr/simple-loan-engine/settings"
 )
 
-func start(config *settings.Settings) error {
+// newScheduler registers the background jobs, jobs are locked across replicas
+func newScheduler(c *container.Container) *scheduler.Scheduler {
+	config := c.Settings
+	s := scheduler.New(clock.Real(), pgsql.NewAdvisoryLocker(c.DB))
+	s.Register(scheduler.Job{
+		Name:     "loan.expiry",
+		Interval: config.App.Loan.ExpiryInterval,
+		Run: func(ctx context.Context, now time.Time) error {
+			expired, err := c.Services.Loans.ExpireLoans(ctx, now)
+			if expired > 0 {
+				log.Printf("expired %d unfunded loans", expired)
+			}
+			return err
+		},
+	})
+
+	s.Register(scheduler.Job{
+		Name:     "file.gc",
+		Interval: config.App.File.GCInterval,
+		Run: func(ctx context.Context, now time.Time) error {
+			removed, err := c.Services.Files.CollectOrphans(ctx, now.Add(-config.App.File.PendingTTL), false)
+			if len(removed) > 0 {
+				log.Printf("removed %d orphaned uploads", len(removed))
+			}
+			return err
+		},
+	})
+	return s
+}
+
+// newFilesCmd manages uploaded files
+func newFilesCmd(config *settings.Settings) *cobra.Command {
+	filesCmd := &cobra.Command{
+		Use:   "files",
+		Short: "manage uploaded files",
+	}
+
+	var dryRun bool
+	var olderThan time.Duration
+	gcCmd := &cobra.Command{
+		Use:   "gc",
+		Short: "remove orphaned uploads",
+		Long:  "Remove pending uploads never committed by a loan action from storage and the database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := container.New(config)
+			if err != nil {
+				return err
+			}
+			defer c.Stop(context.Background())
+
+			files, err := c.Services.Files.CollectOrphans(cmd.Context(), time.Now().Add(-olderThan), dryRun)
+
+			for _, f := range files {
+				fmt.Printf("%s\t%s\t%s\t%s\n", f.FileID, f.CreatedAt.Format(time.RFC3339), f.Location, f.Label)
+			}
+			if dryRun {
+				fmt.Printf("%d orphaned uploads found\n", len(files))
+			} else {
+				fmt.Printf("%d orphaned uploads removed\n", len(files))
+			}
+			return err
+		},
+	}
+	gcCmd.Flags().BoolVar(&dryRun, "dry-run", false, "only report orphaned uploads")
+	gcCmd.Flags().DurationVar(&olderThan, "older-than", config.App.File.PendingTTL, "age after which a pending upload is an orphan")
+
+	filesCmd.AddCommand(gcCmd)
+	return filesCmd
+}
+
+// newMigrator loads the embedded migrations for the open database
+func newMigrator() (*migrate.Migrator, error) {
+	list, err := migrate.Load(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(pgsql.DB(), list), nil
+}
+
+// newMigrateCmd manages the database schema
+func newMigrateCmd(config *settings.Settings) *cobra.Command {
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "manage the database schema",
+		Long:  "Apply and revert the numbered schema migrations embedded in the binary",
+	}
+
+	// withMigrator opens the database around a migrate subcommand
+	withMigrator := func(run func(cmd *cobra.Command, args []string, m *migrate.Migrator) error) func(*cobra.Command, []string) error {
+		return func(cmd *cobra.Command, args []string) error {
+			if err := pgsql.Open(config); err != nil {
+				return err
+			}
+			defer pgsql.Close()
+
+			m, err := newMigrator()
+			if err != nil {
+				return err
+			}
+			return run(cmd, args, m)
+		}
+	}
+
+	var upSteps int
+	upCmd := &cobra.Command{
+		Use:   "up",
+		Short: "apply pending migrations",
+		RunE: withMigrator(func(cmd *cobra.Command, args []string, m *migrate.Migrator) error {
+			applied, err := m.Up(cmd.Context(), upSteps)
+			for _, migration := range applied {
+				fmt.Printf("applied %03d_%s\n", migration.Version, migration.Name)
+			}
+			if err == nil && len(applied) == 0 {
+				fmt.Println("no pending migrations")
+			}
+			return err
+		}),
+	}
+	upCmd.Flags().IntVar(&upSteps, "steps", 0, "number of migrations to apply, all when 0")
+
+	var downSteps int
+	downCmd := &cobra.Command{
+		Use:   "down",
+		Short: "revert the latest migrations",
+		RunE: withMigrator(func(cmd *cobra.Command, args []string, m *migrate.Migrator) error {
+			reverted, err := m.Down(cmd.Context(), downSteps)
+			for _, migration := range reverted {
+				fmt.Printf("reverted %03d_%s\n", migration.Version, migration.Name)
+			}
+			return err
+		}),
+	}
+	downCmd.Flags().IntVar(&downSteps, "steps", 1, "number of migrations to revert")
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "list applied and pending migrations",
+		RunE: withMigrator(func(cmd *cobra.Command, args []string, m *migrate.Migrator) error {
+			statuses, err := m.Status(cmd.Context())
+			if err != nil {
+				return err
+			}
+			for _, s := range statuses {
+				applied := "pending"
+				if s.AppliedAt != nil {
+					applied = s.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Printf("%03d\t%-30s\t%s\n", s.Version, s.Name, applied)
+			}
+			return nil
+		}),
+	}
+
+	var dir string
+	createCmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "create empty up and down files for a new migration",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			up, down, err := migrate.Create(dir, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println(up)
+			fmt.Println(down)
+			return nil
+		},
+	}
+	createCmd.Flags().StringVar(&dir, "dir", "migrations", "migrations source directory")
+
+	migrateCmd.AddCommand(upCmd, downCmd, statusCmd, createCmd)
+	return migrateCmd
+}
+
+// newSeedCmd loads demo users and loans and prints a token or API key per user
+func newSeedCmd(config *settings.Settings) *cobra.Command {
+	var file string
+	seedCmd := &cobra.Command{
+		Use:   "seed",
+		Short: "load demo users and loans",
+		Long: "Create the users and loans of a YAML or JSON fixture, by default one user per role and a loan in every state.\n" +
+			"Users are matched by email, loans and the API keys of service accounts are created on every run.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fixture, err := fixtures.Default()
+			if file != "" {
+				fixture, err = fixtures.Load(file)
+			}
+			if err != nil {
+				return err
+			}
+
+			c, err := container.New(config)
+			if err != nil {
+				return err
+			}
+			defer c.Stop(context.Background())
+
+			seeder := fixtures.NewSeeder(c.Repositories.Users, c.Repositories.Loans, c.Repositories.Files,
+				c.Repositories.APIKeys, c.UploadDir)
+			result, err := seeder.Seed(cmd.Context(), fixture)
+			if result == nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tEMAIL\tROLE\tUSER ID\tTOKEN")
+			for _, u := range result.Users {
+				// service accounts authenticate with their API key
+				token := u.APIKey
+				if token == "" {
+					token = c.Tokens.GenerateToken(u.UserId.String(), string(u.Role), time.Now())
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", u.Key, u.Email, u.Role, u.UserId, token)
+			}
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "KEY\tSTATE\tAMOUNT\tLOAN ID")
+			for _, l := range result.Loans {
+				fmt.Fprintf(w, "%s\t%s\t%.0f\t%s\n", l.Key, l.State, l.Amount, l.LoanId)
+			}
+			w.Flush()
+			fmt.Println("tokens are valid for one hour, API keys until they are revoked")
+			return err
+		},
+	}
+	seedCmd.Flags().StringVarP(&file, "file", "f", "", "fixture file, the embedded demo scenario when empty")
+	return seedCmd
+}
+
+// autoMigrate applies pending migrations on startup in dev
+func autoMigrate(ctx context.Context, config *settings.Settings) error {
+	if !config.Conn.Postgres.AutoMigrate {
+		return nil
+	}
+	if settings.Env() != settings.EnvDev {
+		log.Printf("auto migrate is only applied in %s, run `migrate up` instead", settings.EnvDev)
+		return nil
+	}
+
+	m, err := newMigrator()
+	if err != nil {
+		return err
+	}
+	applied, err := m.Up(ctx, 0)
+	for _, migration := range applied {
+		log.Printf("applied migration %03d_%s", migration.Version, migration.Name)
+	}
+	return err
+}
+
+// newServer serves the registered routers, it is started and stopped as a container hook
+func newServer(c *container.Container) container.Hook {
 	ginModeMapper := map[string]string{
 		settings.EnvDev:  gin.DebugMode,
 		settings.EnvTest: gin.TestMode,
@@ -31,43 +296,115 @@ func start(config *settings.Settings) error {
 	gin.SetMode(ginModeMapper[settings.Env()])
 
 	router := gin.Default()
-	base := router.Group(config.App.Server.APIBase)
-
-	for _, api := range registry.Routers() {
-		instance := api()
-		instance.RegisterRoutes(base)
-	}
+	registry.RegisterRoutes(router.Group(c.Settings.App.Server.APIBase), c.Dependencies())
 
 	server := &http.Server{
-		Addr:    config.App.Server.HTTPAddress,
+		Addr:    c.Settings.App.Server.HTTPAddress,
 		Handler: router,
 	}
 
-	go func() {
-		log.Println("server running on", config.App.Server.HTTPAddress)
-		if err := server.ListenAndServe(); err != nil {
-			log.Printf("listen: %s\n", err)
-		}
+	return container.Hook{
+		Name: "http",
+		OnStart: func(ctx context.Context) error {
+			go func() {
+				log.Println("server running on", server.Addr)
+				if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.Printf("listen: %s\n", err)
+				}
+			}()
+			return nil
+		},
+		OnStop: server.Shutdown,
+	}
+}
+
+// shutdownTimeout bounds the graceful shutdown of the server and the background jobs
+const shutdownTimeout = 30 * time.Second
+
+func start(config *settings.Settings) error {
+	c, err := container.New(config)
+	if err != nil {
+		return err
+	}
+	if err := autoMigrate(context.Background(), config); err != nil {
+		c.Stop(context.Background())
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	// background jobs stop after the server and before the connections
+	jobs := newScheduler(c)
+	c.Append(container.Hook{
+		Name:    "scheduler",
+		OnStart: func(ctx context.Context) error { jobs.Start(context.Background()); return nil },
+		OnStop:  func(ctx context.Context) error { jobs.Stop(); return nil },
+	})
+	c.Append(newServer(c))
 
-	}()
+	if err := c.Start(context.Background()); err != nil {
+		return err
+	}
 
 	// Wait for interrupt signal to gracefully shutdown the server with
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 
 	<-quit
 
-	server.Shutdown(context.Background())
 	log.Println("Shutdown Server ...")
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return c.Stop(ctx)
+}
+
+// configFlags are the flags every command accepts to configure the application
+type configFlags struct {
+	file string
+	set  []string
+}
+
+func (f *configFlags) register(flags *pflag.FlagSet) {
+	flags.StringVarP(&f.file, "config", "c", "", "YAML configuration file, overridden by the environment")
+	flags.StringArrayVar(&f.set, "set", nil, "set a configuration key, e.g. --set SERVER_HTTP_ADDRESS=:9090 or --set smtp.port=587")
+}
+
+// loadSettings reads the configuration flags before the commands are built,
+// since the commands take their defaults from the settings
+func loadSettings(args []string) (*settings.Settings, *configFlags, error) {
+	f := &configFlags{}
+	fs := pflag.NewFlagSet("config", pflag.ContinueOnError)
+	fs.ParseErrorsWhitelist.UnknownFlags = true
+	fs.Usage = func() {}
+	f.register(fs)
+	if err := fs.Parse(args); err != nil && !errors.Is(err, pflag.ErrHelp) {
+		return nil, nil, err
+	}
+
+	opts := []settings.LoadOption{}
+	if f.file != "" {
+		opts = append(opts, settings.WithFile(f.file))
+	}
+	if len(f.set) > 0 {
+		values := make(map[string]string, len(f.set))
+		for _, kv := range f.set {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				return nil, nil, fmt.Errorf("invalid --set %q, expected KEY=VALUE", kv)
+			}
+			values[k] = v
+		}
+		opts = append(opts, settings.WithFlags(values))
+	}
+
+	config, err := settings.Load(opts...)
+	return config, f, err
 }
 
 func main() {
-	config, err := settings.Load()
+	config, flags, err := loadSettings(os.Args[1:])
 	if err != nil {
-		log.Fatalln("error loading config", err)
+		log.Fatalln("error loading config:", err)
 	}
-	fmt.Println(config)
+	log.Printf("config loaded: %s", config)
 
 	config.App.Version = fmt.Sprintf("v%d.%d", 0, 1)
 	rootCmd := &cobra.Command{
@@ -75,46 +412,27 @@ func main() {
 		Short: config.App.Name,
 		Long:  config.App.Description,
 		Run: func(cmd *cobra.Command, args []string) {
-			// open connection
-			err := pgsql.Open(config)
-			if err != nil {
-				log.Fatalln(err)
-				return
-			}
-			err = mail.Open(config)
-			if err != nil {
-				log.Fatalln(err)
-				return
-			}
-
-			// start server
-			start(config)
-
-			// close connection
-			err = pgsql.Close()
-			if err != nil {
+			if err := start(config); err != nil {
 				log.Fatalln(err)
-				return
 			}
-			err = mail.Close()
-			if err != nil {
-				log.Fatalln(err)
-				return
-			}
-
 		},
 	}
+	flags.register(rootCmd.PersistentFlags())
 
 	configCmd := &cobra.Command{
 		Use:   "config",
 		Short: "list all available configs",
-		Long:  "List all available configurations in the application",
+		Long:  "List the resolved configuration of the application, secrets are redacted",
 		Run: func(cmd *cobra.Command, args []string) {
-			c, _ := json.Marshal(config)
+			c, _ := json.MarshalIndent(config.Redacted(), "", "  ")
 			fmt.Println(string(c))
 		},
 	}
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(newFilesCmd(config))
+	rootCmd.AddCommand(newMigrateCmd(config))
+	rootCmd.AddCommand(newSeedCmd(config))
+	rootCmd.AddCommand(newAdminCmd(config))
 
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatalln(err)
@@ -0,0 +1,291 @@
+// Package container builds the dependencies of the application once from the
+// settings and shuts them down in order
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/zainulbr/simple-loan-engine/libs/cache"
+	"github.com/zainulbr/simple-loan-engine/libs/db/pgsql"
+	"github.com/zainulbr/simple-loan-engine/libs/fee"
+	"github.com/zainulbr/simple-loan-engine/libs/notification/mail"
+	"github.com/zainulbr/simple-loan-engine/libs/scanner"
+	libToken "github.com/zainulbr/simple-loan-engine/libs/token"
+	"github.com/zainulbr/simple-loan-engine/registry"
+	repoAPIKey "github.com/zainulbr/simple-loan-engine/repositories/apikey"
+	repoFile "github.com/zainulbr/simple-loan-engine/repositories/filemanager"
+	repoLoan "github.com/zainulbr/simple-loan-engine/repositories/loan"
+	repoProduct "github.com/zainulbr/simple-loan-engine/repositories/product"
+	"github.com/zainulbr/simple-loan-engine/repositories/uow"
+	repoUser "github.com/zainulbr/simple-loan-engine/repositories/user"
+	apiKeyService "github.com/zainulbr/simple-loan-engine/services/apikey"
+	fileService "github.com/zainulbr/simple-loan-engine/services/filemanager"
+	loanService "github.com/zainulbr/simple-loan-engine/services/loan"
+	productService "github.com/zainulbr/simple-loan-engine/services/product"
+	userService "github.com/zainulbr/simple-loan-engine/services/user"
+	"github.com/zainulbr/simple-loan-engine/settings"
+)
+
+// reportDir is the directory under the upload path generated agreements are stored in
+const reportDir = "reports"
+
+// Repositories are the repositories the services are built on
+type Repositories struct {
+	Loans      repoLoan.LoanRepository
+	Files      repoFile.FileRepository
+	Products   repoProduct.ProductRepository
+	Users      repoUser.UserRepository
+	APIKeys    repoAPIKey.APIKeyRepository
+	UnitOfWork uow.UnitOfWork
+}
+
+// Services are shared by the routers, the background jobs and the commands
+type Services struct {
+	Loans    loanService.LoanService
+	Files    fileService.FileService
+	Products productService.ProductService
+	Users    userService.UserService
+	APIKeys  apiKeyService.APIKeyService
+}
+
+// Hook is a step of the application lifecycle, either function may be nil
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// Container holds the dependencies of the application
+type Container struct {
+	Settings *settings.Settings
+
+	DB      *pg.DB // nil when the repositories are injected
+	Cache   cache.Cache
+	Mailer  mail.MailService
+	Scanner scanner.Scanner
+	Tokens  libToken.TokenService
+
+	UploadDir string // Uploaded files
+	ReportDir string // Generated agreements
+
+	Repositories Repositories
+	Services     Services
+
+	hooks   []Hook
+	started int // number of hooks started
+}
+
+// Option replaces a dependency built from the settings, for tests
+type Option func(*Container)
+
+// WithRepositories uses repos instead of opening the database
+func WithRepositories(repos Repositories) Option {
+	return func(c *Container) {
+		c.Repositories = repos
+	}
+}
+
+// WithMailer uses mailer instead of the SMTP connection
+func WithMailer(mailer mail.MailService) Option {
+	return func(c *Container) {
+		c.Mailer = mailer
+	}
+}
+
+// WithScanner uses sc instead of the configured scanner
+func WithScanner(sc scanner.Scanner) Option {
+	return func(c *Container) {
+		c.Scanner = sc
+	}
+}
+
+// New builds the container from config, the connections it opens are closed by Stop
+func New(config *settings.Settings, opts ...Option) (_ *Container, err error) {
+	c := &Container{Settings: config}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// connections opened so far are closed when a later step fails
+	defer func() {
+		if err != nil {
+			c.Stop(context.Background())
+		}
+	}()
+
+	if err := c.openStorage(); err != nil {
+		return nil, err
+	}
+	if err := c.openDB(); err != nil {
+		return nil, err
+	}
+	if err := c.openMail(); err != nil {
+		return nil, err
+	}
+
+	if c.Scanner == nil {
+		c.Scanner, err = scanner.New(config.App.File.ScannerAddress, config.App.File.ScanTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file scanner: %w", err)
+		}
+	}
+
+	c.Cache = cache.NewMemoryCache()
+	c.Append(Hook{Name: "cache", OnStop: func(ctx context.Context) error { return c.Cache.Flush() }})
+
+	if err := c.openTokens(); err != nil {
+		return nil, err
+	}
+	c.buildServices()
+	return c, nil
+}
+
+// openStorage creates the upload and report directories
+func (c *Container) openStorage() error {
+	c.UploadDir = c.Settings.App.UploadDir
+	if c.UploadDir == "" {
+		c.UploadDir = "uploads"
+	}
+	c.ReportDir = filepath.Join(c.UploadDir, reportDir)
+
+	for _, dir := range []string{c.UploadDir, c.ReportDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create storage directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// openDB opens the database and builds the repositories on it, unless they are injected
+func (c *Container) openDB() error {
+	if c.Repositories.Loans != nil {
+		return nil
+	}
+
+	if err := pgsql.Open(c.Settings); err != nil {
+		return err
+	}
+	c.Append(Hook{Name: "postgres", OnStop: func(ctx context.Context) error { return pgsql.Close() }})
+
+	c.DB = pgsql.DB()
+	c.Repositories = Repositories{
+		Loans:      repoLoan.NewLoanRepository(c.DB),
+		Files:      repoFile.NewFileRepository(c.DB),
+		Products:   repoProduct.NewProductRepository(c.DB),
+		Users:      repoUser.NewuserRepository(c.DB),
+		APIKeys:    repoAPIKey.NewAPIKeyRepository(c.DB),
+		UnitOfWork: uow.NewUnitOfWork(c.DB),
+	}
+	return nil
+}
+
+// openMail opens the SMTP connection, unless a mailer is injected
+func (c *Container) openMail() error {
+	if c.Mailer != nil {
+		return nil
+	}
+
+	if err := mail.Open(c.Settings); err != nil {
+		return err
+	}
+	c.Append(Hook{Name: "mail", OnStop: func(ctx context.Context) error { return mail.Close() }})
+
+	c.Mailer = mail.Mail()
+	return nil
+}
+
+// openTokens builds the token service from AUTH_ENCRYPT_KEYS, outside prd a random key
+// is used when none is configured
+func (c *Container) openTokens() error {
+	keys, err := libToken.ParseKeys(c.Settings.App.Auth.EncryptKeys)
+	if err != nil {
+		return fmt.Errorf("failed to read AUTH_ENCRYPT_KEYS: %w", err)
+	}
+	if len(keys) == 0 {
+		if settings.Env() == settings.EnvProd {
+			return fmt.Errorf("AUTH_ENCRYPT_KEYS is required in %s: %w", settings.EnvProd, libToken.ErrNoKeys)
+		}
+		log.Println("AUTH_ENCRYPT_KEYS is empty, tokens are signed with a random key and invalid after a restart")
+		keys = append(keys, libToken.RandomKey())
+	}
+
+	c.Tokens, err = libToken.NewService(keys...)
+	return err
+}
+
+func (c *Container) buildServices() {
+	config := c.Settings.App
+	repos := c.Repositories
+	c.Services = Services{
+		Loans: loanService.NewLoanService(repos.Loans, repos.Files, repos.Products, repos.UnitOfWork,
+			loanService.WithFundingWindow(config.Loan.FundingWindow),
+			loanService.WithVisitMaxDrift(config.Loan.VisitMaxDrift),
+			loanService.WithFeeRule(fee.Rule{Type: fee.RuleType(config.Fee.Type), Value: config.Fee.Value}),
+			loanService.WithMailer(c.Mailer),
+			loanService.WithReportDir(c.ReportDir),
+		),
+		Files: fileService.NewFileService(repos.Files, c.UploadDir,
+			fileService.WithMaxFileSize(config.File.MaxFileSize),
+			fileService.WithScanner(c.Scanner),
+		),
+		Products: productService.NewProductService(repos.Products),
+		Users:    userService.NewUserService(repos.Users, c.Tokens),
+		APIKeys:  apiKeyService.NewAPIKeyService(repos.APIKeys, repos.Users, repos.UnitOfWork),
+	}
+}
+
+// Dependencies returns the dependencies of the router factories
+func (c *Container) Dependencies() *registry.Dependencies {
+	return &registry.Dependencies{
+		Settings: c.Settings,
+		Loans:    c.Services.Loans,
+		Files:    c.Services.Files,
+		Products: c.Services.Products,
+		Tokens:   c.Tokens,
+		APIKeys:  c.Services.APIKeys,
+	}
+}
+
+// Append adds a hook, hooks start in the order they are added and stop in reverse
+func (c *Container) Append(hook Hook) {
+	c.hooks = append(c.hooks, hook)
+}
+
+// Start runs the start hooks in order, the hooks already started are stopped when one fails
+func (c *Container) Start(ctx context.Context) error {
+	for c.started < len(c.hooks) {
+		hook := c.hooks[c.started]
+		if hook.OnStart != nil {
+			if err := hook.OnStart(ctx); err != nil {
+				return errors.Join(fmt.Errorf("start %s: %w", hook.Name, err), c.Stop(ctx))
+			}
+		}
+		c.started++
+	}
+	return nil
+}
+
+// Stop runs the stop hooks in reverse order, every hook runs even when an earlier one fails.
+// Hooks of connections opened by New are stopped even if Start was never called.
+func (c *Container) Stop(ctx context.Context) error {
+	var errs []error
+	for i := len(c.hooks) - 1; i >= 0; i-- {
+		hook := c.hooks[i]
+		if hook.OnStop == nil || (hook.OnStart != nil && i >= c.started) {
+			continue
+		}
+		log.Printf("stopping %s", hook.Name)
+		if err := hook.OnStop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stop %s: %w", hook.Name, err))
+		}
+	}
+	c.hooks = nil
+	c.started = 0
+	return errors.Join(errs...)
+}
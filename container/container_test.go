@@ -0,0 +1,144 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zainulbr/simple-loan-engine/libs/notification/mail"
+	libToken "github.com/zainulbr/simple-loan-engine/libs/token"
+	"github.com/zainulbr/simple-loan-engine/repositories/memory"
+	"github.com/zainulbr/simple-loan-engine/settings"
+)
+
+func newTestContainer(t *testing.T) *Container {
+	store := memory.NewStore()
+	config := &settings.Settings{App: settings.AppSettings{UploadDir: filepath.Join(t.TempDir(), "uploads")}}
+	c, err := New(config,
+		WithRepositories(Repositories{
+			Loans:      store.Loans(),
+			Files:      store.Files(),
+			Products:   store.Products(),
+			Users:      store.Users(),
+			APIKeys:    store.APIKeys(),
+			UnitOfWork: store.UnitOfWork(),
+		}),
+		WithMailer(&mail.Fake{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestNew(t *testing.T) {
+	c := newTestContainer(t)
+
+	assert.Nil(t, c.DB, "the database is not opened for injected repositories")
+	assert.DirExists(t, c.UploadDir)
+	assert.DirExists(t, c.ReportDir)
+	assert.Equal(t, filepath.Join(c.UploadDir, "reports"), c.ReportDir)
+	assert.NotNil(t, c.Scanner)
+
+	deps := c.Dependencies()
+	assert.Same(t, c.Settings, deps.Settings)
+	assert.NotNil(t, deps.Loans)
+	assert.NotNil(t, deps.Files)
+	assert.NotNil(t, deps.Products)
+
+	assert.NoError(t, c.Stop(context.Background()))
+}
+
+func TestTokensFromSettings(t *testing.T) {
+	store := memory.NewStore()
+	newContainer := func(keys string) (*Container, error) {
+		config := &settings.Settings{App: settings.AppSettings{
+			UploadDir: t.TempDir(),
+			Auth:      settings.AuthOptions{EncryptKeys: keys},
+		}}
+		return New(config, WithRepositories(Repositories{Loans: store.Loans()}), WithMailer(&mail.Fake{}))
+	}
+
+	previous, err := newContainer("2024-01:old secret")
+	require.NoError(t, err)
+	issued := previous.Tokens.GenerateToken("userId", "admin", time.Now())
+
+	// rotated, the old key still verifies
+	c, err := newContainer("2024-02:new secret,2024-01:old secret")
+	require.NoError(t, err)
+	_, err = c.Tokens.ValidateToken(issued)
+	assert.NoError(t, err)
+	assert.Same(t, c.Tokens, c.Dependencies().Tokens)
+
+	_, err = newContainer("a:one,a:two")
+	assert.ErrorIs(t, err, libToken.ErrDuplicateKid)
+
+	// outside prd a missing key is replaced by a random one
+	c, err = newContainer("")
+	require.NoError(t, err)
+	_, err = c.Tokens.ValidateToken(issued)
+	assert.Error(t, err)
+}
+
+// recordHook appends its start and stop to events
+func recordHook(name string, events *[]string, startErr error) Hook {
+	return Hook{
+		Name: name,
+		OnStart: func(ctx context.Context) error {
+			*events = append(*events, "start "+name)
+			return startErr
+		},
+		OnStop: func(ctx context.Context) error {
+			*events = append(*events, "stop "+name)
+			return nil
+		},
+	}
+}
+
+func TestLifecycleOrder(t *testing.T) {
+	c := newTestContainer(t)
+	var events []string
+	c.Append(Hook{Name: "connection", OnStop: func(ctx context.Context) error {
+		events = append(events, "stop connection")
+		return nil
+	}})
+	c.Append(recordHook("jobs", &events, nil))
+	c.Append(recordHook("server", &events, nil))
+
+	assert.NoError(t, c.Start(context.Background()))
+	assert.NoError(t, c.Stop(context.Background()))
+	assert.Equal(t, []string{
+		"start jobs", "start server",
+		"stop server", "stop jobs", "stop connection",
+	}, events)
+}
+
+func TestStartFailureStopsStartedHooks(t *testing.T) {
+	c := newTestContainer(t)
+	failed := errors.New("address in use")
+	var events []string
+	c.Append(recordHook("jobs", &events, nil))
+	c.Append(recordHook("server", &events, failed))
+	c.Append(recordHook("never", &events, nil))
+
+	err := c.Start(context.Background())
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, []string{"start jobs", "start server", "stop jobs"}, events)
+}
+
+func TestStopRunsEveryHook(t *testing.T) {
+	c := newTestContainer(t)
+	failed := errors.New("timeout")
+	var events []string
+	c.Append(recordHook("jobs", &events, nil))
+	c.Append(Hook{Name: "server", OnStop: func(ctx context.Context) error { return failed }})
+
+	assert.NoError(t, c.Start(context.Background()))
+	err := c.Stop(context.Background())
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, []string{"start jobs", "stop jobs"}, events)
+}
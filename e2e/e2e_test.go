@@ -0,0 +1,419 @@
+// Package e2e drives the HTTP API of the registered routers end to end, the
+// container is built on in-memory repositories, a fake mailer and temporary directories
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zainulbr/simple-loan-engine/container"
+	"github.com/zainulbr/simple-loan-engine/libs/notification/mail"
+	"github.com/zainulbr/simple-loan-engine/libs/scanner"
+	libToken "github.com/zainulbr/simple-loan-engine/libs/token"
+	"github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	"github.com/zainulbr/simple-loan-engine/registry"
+	"github.com/zainulbr/simple-loan-engine/repositories/memory"
+	_ "github.com/zainulbr/simple-loan-engine/routes/apikey"
+	_ "github.com/zainulbr/simple-loan-engine/routes/auth"
+	_ "github.com/zainulbr/simple-loan-engine/routes/borrower"
+	_ "github.com/zainulbr/simple-loan-engine/routes/file"
+	_ "github.com/zainulbr/simple-loan-engine/routes/investor"
+	_ "github.com/zainulbr/simple-loan-engine/routes/loan"
+	_ "github.com/zainulbr/simple-loan-engine/routes/product"
+	apiKeyService "github.com/zainulbr/simple-loan-engine/services/apikey"
+	"github.com/zainulbr/simple-loan-engine/settings"
+)
+
+// app is the engine under test with its injected dependencies
+type app struct {
+	t       *testing.T
+	engine  *gin.Engine
+	store   *memory.Store
+	mailer  *mail.Fake
+	scanner *scanner.Fake
+	c       *container.Container
+	tokens  map[user.UserRole]string
+	users   map[user.UserRole]uuid.UUID
+}
+
+func newApp(t *testing.T) *app {
+	store := memory.NewStore()
+	a := &app{
+		t:       t,
+		store:   store,
+		mailer:  &mail.Fake{},
+		scanner: &scanner.Fake{},
+		tokens:  map[user.UserRole]string{},
+		users:   map[user.UserRole]uuid.UUID{},
+	}
+
+	config := &settings.Settings{App: settings.AppSettings{
+		UploadDir: t.TempDir(),
+		Server:    settings.ServerOptions{APIBase: "/api"},
+		Loan:      settings.LoanOptions{FundingWindow: 24 * time.Hour, VisitMaxDrift: 48 * time.Hour},
+		Fee:       settings.FeeOptions{Type: "percentage", Value: 0.2},
+		File: settings.FileOptions{
+			MaxFileSize:         1 << 20,
+			MaxApprovalSize:     4 << 20,
+			MaxDisbursementSize: 4 << 20,
+			MaxDocumentsSize:    4 << 20,
+		},
+	}}
+	c, err := container.New(config,
+		container.WithRepositories(container.Repositories{
+			Loans:      store.Loans(),
+			Files:      store.Files(),
+			Products:   store.Products(),
+			Users:      store.Users(),
+			APIKeys:    store.APIKeys(),
+			UnitOfWork: store.UnitOfWork(),
+		}),
+		container.WithMailer(a.mailer),
+		container.WithScanner(a.scanner),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, c.Stop(context.Background())) })
+	a.c = c
+
+	gin.SetMode(gin.TestMode)
+	a.engine = gin.New()
+	registry.RegisterRoutes(a.engine.Group(config.App.Server.APIBase), c.Dependencies())
+
+	// one user and token per role
+	for _, role := range user.Roles {
+		userID, err := store.Users().Create(t.Context(), user.User{Email: string(role) + "@example.com", Role: role})
+		require.NoError(t, err)
+		a.users[role] = userID
+		a.tokens[role] = c.Tokens.GenerateToken(userID.String(), string(role), time.Now())
+	}
+	return a
+}
+
+// do sends a request as role and decodes the JSON response into out
+func (a *app) do(role user.UserRole, method, target string, body io.Reader, contentType string, out any) int {
+	a.t.Helper()
+	req := httptest.NewRequest(method, target, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token, ok := a.tokens[role]; ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	a.engine.ServeHTTP(rec, req)
+
+	success := rec.Code == http.StatusOK || rec.Code == http.StatusCreated
+	if out != nil && success {
+		require.NoError(a.t, json.Unmarshal(rec.Body.Bytes(), out), rec.Body.String())
+	}
+	if !success {
+		a.t.Logf("%s %s as %s: %d %s", method, target, role, rec.Code, rec.Body.String())
+	}
+	return rec.Code
+}
+
+func (a *app) json(role user.UserRole, method, target string, in, out any) int {
+	a.t.Helper()
+	body, err := json.Marshal(in)
+	require.NoError(a.t, err)
+	return a.do(role, method, target, bytes.NewReader(body), "application/json", out)
+}
+
+// formFile is a file part of a multipart request
+type formFile struct {
+	field, name string
+	content     []byte
+}
+
+func (a *app) multipart(role user.UserRole, target string, fields map[string]string, files ...formFile) int {
+	a.t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		require.NoError(a.t, w.WriteField(k, v))
+	}
+	for _, f := range files {
+		part, err := w.CreateFormFile(f.field, f.name)
+		require.NoError(a.t, err)
+		_, err = part.Write(f.content)
+		require.NoError(a.t, err)
+	}
+	require.NoError(a.t, w.Close())
+	return a.do(role, http.MethodPost, target, &body, w.FormDataContentType(), nil)
+}
+
+func (a *app) loanDetail(loanID uuid.UUID) loan.LoanDetail {
+	a.t.Helper()
+	var detail loan.LoanDetail
+	require.Equal(a.t, http.StatusOK, a.do(user.RoleAdmin, http.MethodGet, "/api/loans/"+loanID.String(), nil, "", &detail))
+	return detail
+}
+
+func photo(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 48; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 5), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, nil))
+	return buf.Bytes()
+}
+
+var receipt = []byte("%PDF-1.4\n% disbursement receipt\n%%EOF\n")
+
+// storedFiles lists the files written to dir, thumbnails and quarantine included
+func storedFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func TestLoanLifecycle(t *testing.T) {
+	a := newApp(t)
+
+	// admin defines the product
+	var product struct {
+		ProductId uuid.UUID `json:"product_id"`
+	}
+	status := a.json(user.RoleAdmin, http.MethodPost, "/api/products", map[string]any{
+		"code":       "micro",
+		"name":       "Micro loan",
+		"max_amount": 5000000,
+		"durations":  []int{6, 12},
+		"max_rate":   0.2,
+		"fee_rule":   map[string]any{"type": "percentage", "value": 0.2},
+	}, &product)
+	require.Equal(t, http.StatusOK, status)
+
+	// borrower proposes
+	var proposed loan.Loan
+	status = a.json(user.RoleBorrower, http.MethodPost, "/api/loans", map[string]any{
+		"product_id":     product.ProductId,
+		"description":    "Warung stock",
+		"amount":         1000000,
+		"duration_month": 12,
+	}, &proposed)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, loan.StateProposed, a.loanDetail(proposed.LoanId).State)
+	base := "/api/loans/" + proposed.LoanId.String()
+
+	// only staff approve
+	status = a.multipart(user.RoleInvestor, base+"/approve", map[string]string{"approval_date": time.Now().Format(time.RFC3339)})
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// field validator approves with the visit photo
+	status = a.multipart(user.RoleFiledValidator, base+"/approve",
+		map[string]string{"approval_date": time.Now().Format(time.RFC3339), "rate": "0.12"},
+		formFile{"visited_file", "visit.jpg", photo(t)})
+	require.Equal(t, http.StatusOK, status)
+
+	detail := a.loanDetail(proposed.LoanId)
+	assert.Equal(t, loan.StateApproved, detail.State)
+	assert.Equal(t, 0.12, detail.Rate)
+	assert.InDelta(t, 0.096, detail.ROI, 0.0001)
+
+	// the investor funds the loan in two parts, the agreement is sent once it is fully funded
+	status = a.json(user.RoleInvestor, http.MethodPost, base+"/invest", map[string]any{"amount": 600000}, nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, loan.StateApproved, a.loanDetail(proposed.LoanId).State)
+
+	status = a.json(user.RoleInvestor, http.MethodPost, base+"/invest", map[string]any{"amount": 500000}, nil)
+	assert.Equal(t, http.StatusInternalServerError, status, "investments can not exceed the loan amount")
+
+	status = a.json(user.RoleInvestor, http.MethodPost, base+"/invest", map[string]any{"amount": 400000}, nil)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, loan.StateInvested, a.loanDetail(proposed.LoanId).State)
+
+	require.Eventually(t, func() bool { return len(a.mailer.Sent()) == 1 }, 5*time.Second, 10*time.Millisecond,
+		"the investor receives the agreement")
+	sent := a.mailer.Sent()[0]
+	assert.Equal(t, []string{"investor@example.com"}, sent.To)
+	assert.Equal(t, "Investment Agreement", sent.Subject)
+	assert.Contains(t, sent.Body, proposed.LoanId.String())
+
+	require.Eventually(t, func() bool { return a.loanDetail(proposed.LoanId).AggrementFile != "" }, 5*time.Second, 10*time.Millisecond)
+	agreement := a.loanDetail(proposed.LoanId).AggrementFile
+	assert.Contains(t, sent.Body, agreement)
+	assert.FileExists(t, filepath.Join(a.c.ReportDir, proposed.LoanId.String()+".pdf"))
+
+	// field officer disburses with the signed receipt
+	status = a.multipart(user.RoleFieldOfficer, base+"/disburse",
+		map[string]string{"disbursment_date": time.Now().Format(time.RFC3339)})
+	assert.Equal(t, http.StatusBadRequest, status, "the receipt is required")
+
+	status = a.multipart(user.RoleFieldOfficer, base+"/disburse",
+		map[string]string{"disbursment_date": time.Now().Format(time.RFC3339)},
+		formFile{"disbursed_file", "receipt.pdf", receipt})
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, loan.StateDisbursed, a.loanDetail(proposed.LoanId).State)
+
+	// both uploads were scanned, stored and committed by the loan actions
+	assert.Equal(t, 2, a.scanner.Scanned())
+	documents, err := a.store.Loans().GetLoanDocuments(t.Context(), proposed.LoanId)
+	require.NoError(t, err)
+	types := map[loan.DocumentType]bool{}
+	for _, d := range documents {
+		types[d.DocumentType] = true
+
+		file, err := a.store.Files().GetByID(t.Context(), d.FileId)
+		if assert.NoError(t, err) {
+			assert.Equal(t, filemanager.StatusCommitted, file.Status)
+			assert.FileExists(t, file.Location)
+		}
+	}
+	assert.True(t, types[loan.DocumentVisitedPhoto])
+	assert.True(t, types[loan.DocumentDisbursementProof])
+	assert.True(t, types[loan.DocumentAgreement])
+
+	uploads := storedFiles(t, a.c.UploadDir)
+	assert.Contains(t, strings.Join(uploads, "\n"), ".jpg")
+	assert.Contains(t, strings.Join(uploads, "\n"), ".pdf")
+
+	// the investor downloads the agreement they were mailed, the receipt is for staff
+	var receiptID uuid.UUID
+	for _, d := range documents {
+		if d.DocumentType == loan.DocumentDisbursementProof {
+			receiptID = d.FileId
+		}
+	}
+	assert.Equal(t, http.StatusForbidden, a.do(user.RoleInvestor, http.MethodGet, "/api/files/"+receiptID.String(), nil, "", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/files/"+agreement, nil)
+	req.Header.Set("Authorization", "Bearer "+a.tokens[user.RoleInvestor])
+	rec := httptest.NewRecorder()
+	a.engine.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, bytes.HasPrefix(rec.Body.Bytes(), []byte("%PDF")))
+}
+
+func TestInfectedUploadIsRejected(t *testing.T) {
+	a := newApp(t)
+	loanID := uuid.New()
+	err := a.store.Loans().CreateLoan(t.Context(), &loan.Loan{
+		LoanId: loanID, ProposedBy: a.users[user.RoleBorrower], Amount: 1000000, DurationMonth: 12,
+	})
+	require.NoError(t, err)
+
+	status := a.multipart(user.RoleFiledValidator, "/api/loans/"+loanID.String()+"/approve",
+		map[string]string{"approval_date": time.Now().Format(time.RFC3339), "rate": "0.12"},
+		formFile{"visited_file", "visit.pdf", []byte("%PDF-1.4\n" + scanner.EICAR)})
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, loan.StateProposed, a.loanDetail(loanID).State)
+	assert.Empty(t, a.mailer.Sent())
+}
+
+func TestPortfolioStateFilter(t *testing.T) {
+	a := newApp(t)
+
+	var portfolio struct {
+		Data loan.Portfolio `json:"data"`
+	}
+	assert.Equal(t, http.StatusOK, a.do(user.RoleInvestor, http.MethodGet, "/api/investors/me/portfolio?state=disbursed", nil, "", &portfolio))
+	assert.Equal(t, http.StatusBadRequest, a.do(user.RoleInvestor, http.MethodGet, "/api/investors/me/portfolio?state=paid", nil, "", nil))
+}
+
+func TestTokenOfUnknownKeyIsRejected(t *testing.T) {
+	a := newApp(t)
+
+	var jwks libToken.JWKSet
+	assert.Equal(t, http.StatusOK, a.do("", http.MethodGet, "/api/.well-known/jwks.json", nil, "", &jwks))
+	assert.Empty(t, jwks.Keys, "HMAC secrets are not published")
+
+	other, err := libToken.NewService(libToken.RandomKey())
+	require.NoError(t, err)
+	a.tokens[user.RoleAdmin] = other.GenerateToken(a.users[user.RoleAdmin].String(), string(user.RoleAdmin), time.Now())
+	assert.Equal(t, http.StatusUnauthorized, a.do(user.RoleAdmin, http.MethodGet, "/api/products", nil, "", nil))
+}
+
+func TestServiceAccountAPIKey(t *testing.T) {
+	a := newApp(t)
+	service := a.users[user.RoleService]
+	loanID := uuid.New()
+	require.NoError(t, a.store.Loans().CreateLoan(t.Context(), &loan.Loan{
+		LoanId: loanID, ProposedBy: a.users[user.RoleBorrower], Amount: 1000000, DurationMonth: 12,
+		State: string(loan.StateDisbursed),
+	}))
+	base := "/api/loans/" + loanID.String()
+	request := map[string]any{"user_id": service, "name": "payment gateway",
+		"scopes": []string{"loans:read", "repayments:write"}}
+
+	// admins issue keys to service accounts only
+	assert.Equal(t, http.StatusForbidden, a.json(user.RoleFieldOfficer, http.MethodPost, "/api/api-keys", request, nil))
+	assert.Equal(t, http.StatusBadRequest, a.json(user.RoleAdmin, http.MethodPost, "/api/api-keys",
+		map[string]any{"user_id": a.users[user.RoleFieldOfficer], "name": "x", "scopes": []string{"loans:read"}}, nil))
+
+	var issued apiKeyService.Issued
+	require.Equal(t, http.StatusCreated, a.json(user.RoleAdmin, http.MethodPost, "/api/api-keys", request, &issued))
+	require.NotEmpty(t, issued.Secret)
+	assert.True(t, strings.HasPrefix(issued.Secret, issued.APIKey.Prefix+"_"))
+
+	// the key acts as the service account within its scopes
+	a.tokens[user.RoleService] = issued.Secret
+	assert.Equal(t, http.StatusOK, a.do(user.RoleService, http.MethodGet, base, nil, "", nil))
+	assert.Equal(t, http.StatusForbidden, a.do(user.RoleService, http.MethodGet, "/api/products", nil, "", nil))
+	assert.Equal(t, http.StatusForbidden, a.json(user.RoleService, http.MethodPost, base+"/invest", map[string]any{"amount": 1000}, nil))
+	assert.Equal(t, http.StatusForbidden, a.json(user.RoleService, http.MethodPost, "/api/api-keys", request, nil))
+
+	var repayment struct {
+		Data loan.LoanRepayment `json:"data"`
+	}
+	require.Equal(t, http.StatusOK, a.json(user.RoleService, http.MethodPost, base+"/repayments",
+		map[string]any{"principal": 100000, "interest": 10000, "paid_at": time.Now()}, &repayment))
+	assert.Equal(t, service, repayment.Data.RecordedBy)
+
+	// the last use is tracked, the secret is never returned again
+	var stored map[string]any
+	require.Equal(t, http.StatusOK, a.do(user.RoleAdmin, http.MethodGet, "/api/api-keys/"+issued.APIKey.KeyId.String(), nil, "", &stored))
+	assert.NotNil(t, stored["last_used_at"])
+	assert.NotContains(t, stored, "hash")
+	assert.NotContains(t, stored, "secret")
+
+	// the old key keeps working during the grace period of a rotation
+	var rotated apiKeyService.Issued
+	require.Equal(t, http.StatusCreated, a.json(user.RoleAdmin, http.MethodPost,
+		"/api/api-keys/"+issued.APIKey.KeyId.String()+"/rotate", map[string]any{"grace_period": "1h"}, &rotated))
+	assert.Equal(t, http.StatusOK, a.do(user.RoleService, http.MethodGet, base, nil, "", nil))
+	a.tokens[user.RoleService] = rotated.Secret
+	assert.Equal(t, http.StatusOK, a.do(user.RoleService, http.MethodGet, base, nil, "", nil))
+
+	// revoked keys are refused at once
+	for _, key := range []apiKeyService.Issued{issued, rotated} {
+		require.Equal(t, http.StatusOK, a.do(user.RoleAdmin, http.MethodPost,
+			"/api/api-keys/"+key.APIKey.KeyId.String()+"/revoke", nil, "", nil))
+		a.tokens[user.RoleService] = key.Secret
+		assert.Equal(t, http.StatusUnauthorized, a.do(user.RoleService, http.MethodGet, base, nil, "", nil))
+	}
+
+	var keys struct {
+		Data []map[string]any `json:"data"`
+	}
+	require.Equal(t, http.StatusOK, a.do(user.RoleAdmin, http.MethodGet, "/api/api-keys", nil, "", &keys))
+	assert.Len(t, keys.Data, 2)
+}
@@ -0,0 +1,258 @@
+// Package fixtures describes demo and test scenarios declaratively and seeds
+// them into the database, see `loan-engine seed`
+package fixtures
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed demo.yaml
+var demo []byte
+
+// defaultRate of approved loans without a rate
+const defaultRate = 0.1
+
+// Fixture is a scenario of users and loans
+type Fixture struct {
+	Users []User `json:"users" yaml:"users"`
+	Loans []Loan `json:"loans" yaml:"loans"`
+}
+
+// User is referenced by its key from loans, service accounts are issued an API key with Scopes
+type User struct {
+	Key    string         `json:"key" yaml:"key"`
+	Email  string         `json:"email" yaml:"email"`
+	Role   user.UserRole  `json:"role" yaml:"role"`
+	Scopes []apikey.Scope `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+}
+
+// Loan is brought to State through the regular lifecycle: approval with a visit
+// photo, investments, an agreement once fully funded and a disbursement proof
+type Loan struct {
+	Key           string       `json:"key" yaml:"key"`
+	Borrower      string       `json:"borrower" yaml:"borrower"`
+	Description   string       `json:"description" yaml:"description"`
+	Amount        float64      `json:"amount" yaml:"amount"`
+	DurationMonth int          `json:"duration_month" yaml:"duration_month"`
+	Rate          float64      `json:"rate,omitempty" yaml:"rate,omitempty"`
+	State         string       `json:"state" yaml:"state"`
+	ApprovedBy    string       `json:"approved_by,omitempty" yaml:"approved_by,omitempty"`
+	DisbursedBy   string       `json:"disbursed_by,omitempty" yaml:"disbursed_by,omitempty"`
+	Investments   []Investment `json:"investments,omitempty" yaml:"investments,omitempty"`
+}
+
+// Investment of an investor user in a loan
+type Investment struct {
+	Investor string  `json:"investor" yaml:"investor"`
+	Amount   float64 `json:"amount" yaml:"amount"`
+}
+
+// Default returns the embedded demo scenario
+func Default() (*Fixture, error) {
+	return Parse(demo, ".yaml")
+}
+
+// Load reads a YAML or JSON fixture file
+func Load(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, filepath.Ext(path))
+}
+
+// Parse decodes a fixture, ext selects JSON for .json and YAML otherwise.
+// Missing approvers, officers and investments are filled in and the result is validated.
+func Parse(data []byte, ext string) (*Fixture, error) {
+	f := &Fixture{}
+	var err error
+	if strings.EqualFold(ext, ".json") {
+		err = json.Unmarshal(data, f)
+	} else {
+		err = yaml.Unmarshal(data, f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture: %w", err)
+	}
+
+	f.setDefaults()
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// User returns the user with key
+func (f *Fixture) User(key string) (User, bool) {
+	for _, u := range f.Users {
+		if u.Key == key {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+// firstUser returns the key of the first user with role
+func (f *Fixture) firstUser(role user.UserRole) string {
+	for _, u := range f.Users {
+		if u.Role == role {
+			return u.Key
+		}
+	}
+	return ""
+}
+
+func (f *Fixture) setDefaults() {
+	for i := range f.Loans {
+		l := &f.Loans[i]
+		if !l.approved() {
+			continue
+		}
+		if l.Rate == 0 {
+			l.Rate = defaultRate
+		}
+		if l.ApprovedBy == "" {
+			l.ApprovedBy = f.firstUser(user.RoleFiledValidator)
+		}
+		if l.funded() && len(l.Investments) == 0 {
+			l.Investments = []Investment{{Investor: f.firstUser(user.RoleInvestor), Amount: l.Amount}}
+		}
+		if loan.LoanState(l.State) == loan.StateDisbursed && l.DisbursedBy == "" {
+			l.DisbursedBy = f.firstUser(user.RoleFieldOfficer)
+		}
+	}
+}
+
+// approved reports whether the loan passes the approval to reach its state
+func (l Loan) approved() bool {
+	switch loan.LoanState(l.State) {
+	case loan.StateApproved, loan.StateExpired, loan.StateInvested, loan.StateDisbursed:
+		return true
+	}
+	return false
+}
+
+// funded reports whether the loan is fully invested in its state
+func (l Loan) funded() bool {
+	state := loan.LoanState(l.State)
+	return state == loan.StateInvested || state == loan.StateDisbursed
+}
+
+// Validate lists every problem of the fixture at once
+func (f *Fixture) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	keys := map[string]bool{}
+	emails := map[string]bool{}
+	for i, u := range f.Users {
+		switch {
+		case u.Key == "":
+			add("users[%d]: key is required", i)
+		case keys[u.Key]:
+			add("users[%d]: duplicate key %s", i, u.Key)
+		}
+		keys[u.Key] = true
+
+		switch {
+		case u.Email == "":
+			add("users[%d]: email is required", i)
+		case emails[u.Email]:
+			add("users[%d]: duplicate email %s", i, u.Email)
+		}
+		emails[u.Email] = true
+
+		if !slices.Contains(user.Roles, u.Role) {
+			add("users[%d]: unknown role %q", i, u.Role)
+		}
+
+		switch {
+		case u.Role == user.RoleService:
+			if err := apikey.ValidateScopes(u.Scopes); err != nil {
+				add("users[%d]: scopes: %w", i, err)
+			}
+		case len(u.Scopes) > 0:
+			add("users[%d]: only service accounts have scopes", i)
+		}
+	}
+
+	// checkUser validates a reference from loan i to a user with one of roles
+	checkUser := func(i int, field, key string, roles ...user.UserRole) {
+		u, ok := f.User(key)
+		switch {
+		case key == "":
+			add("loans[%d]: %s is required, no user with role %s", i, field, roles[0])
+		case !ok:
+			add("loans[%d]: %s refers to unknown user %s", i, field, key)
+		case !slices.Contains(roles, u.Role):
+			add("loans[%d]: %s must be a %s, %s is a %s", i, field, roles[0], key, u.Role)
+		}
+	}
+
+	loanKeys := map[string]bool{}
+	for i, l := range f.Loans {
+		if l.Key != "" && loanKeys[l.Key] {
+			add("loans[%d]: duplicate key %s", i, l.Key)
+		}
+		loanKeys[l.Key] = true
+
+		checkUser(i, "borrower", l.Borrower, user.RoleBorrower)
+		if l.Amount <= 0 {
+			add("loans[%d]: amount must be positive", i)
+		}
+		if l.DurationMonth <= 0 {
+			add("loans[%d]: duration_month must be positive", i)
+		}
+		if !slices.Contains(loan.States, loan.LoanState(l.State)) {
+			add("loans[%d]: unknown state %q", i, l.State)
+			continue
+		}
+
+		if !l.approved() {
+			if len(l.Investments) > 0 {
+				add("loans[%d]: a %s loan can not have investments", i, l.State)
+			}
+			continue
+		}
+
+		checkUser(i, "approved_by", l.ApprovedBy, user.RoleFiledValidator, user.RoleCreditOfficer, user.RoleAdmin)
+		if l.Rate < 0 || l.Rate > 1 {
+			add("loans[%d]: rate must be between 0 and 1", i)
+		}
+
+		total := 0.0
+		for j, inv := range l.Investments {
+			checkUser(i, fmt.Sprintf("investments[%d].investor", j), inv.Investor, user.RoleInvestor)
+			if inv.Amount <= 0 {
+				add("loans[%d]: investments[%d].amount must be positive", i, j)
+			}
+			total += inv.Amount
+		}
+		switch {
+		case l.funded() && total != l.Amount:
+			add("loans[%d]: investments of a %s loan must add up to its amount", i, l.State)
+		case !l.funded() && total >= l.Amount:
+			add("loans[%d]: investments of a %s loan must stay below its amount", i, l.State)
+		}
+
+		if loan.LoanState(l.State) == loan.StateDisbursed {
+			checkUser(i, "disbursed_by", l.DisbursedBy, user.RoleFieldOfficer)
+		}
+	}
+
+	return errors.Join(errs...)
+}
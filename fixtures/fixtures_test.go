@@ -0,0 +1,126 @@
+package fixtures
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	"github.com/zainulbr/simple-loan-engine/repositories/memory"
+)
+
+func TestDefault(t *testing.T) {
+	f, err := Default()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	roles := map[user.UserRole]bool{}
+	for _, u := range f.Users {
+		roles[u.Role] = true
+	}
+	for _, r := range user.Roles {
+		assert.True(t, roles[r], "no user with role %s", r)
+	}
+
+	states := map[loan.LoanState]bool{}
+	for _, l := range f.Loans {
+		states[loan.LoanState(l.State)] = true
+	}
+	for _, s := range loan.States {
+		assert.True(t, states[s], "no loan in state %s", s)
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	f, err := Parse([]byte(`{
+		"users": [
+			{"key": "b", "email": "b@test", "role": "borrower"},
+			{"key": "v", "email": "v@test", "role": "field_validator"},
+			{"key": "o", "email": "o@test", "role": "field_officer"},
+			{"key": "i", "email": "i@test", "role": "investor"}
+		],
+		"loans": [
+			{"key": "l", "borrower": "b", "description": "d", "amount": 1000, "duration_month": 6, "state": "disbursed"}
+		]
+	}`), ".json")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	l := f.Loans[0]
+	assert.Equal(t, defaultRate, l.Rate)
+	assert.Equal(t, "v", l.ApprovedBy)
+	assert.Equal(t, "o", l.DisbursedBy)
+	assert.Equal(t, []Investment{{Investor: "i", Amount: 1000}}, l.Investments)
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse([]byte(`
+users:
+  - {key: b, email: b@test, role: borrower}
+  - {key: b, email: b@test, role: pilot}
+  - {key: i, email: i@test, role: investor, scopes: [loans:read]}
+  - {key: g, email: g@test, role: service, scopes: [loans:delete]}
+loans:
+  - {key: l1, borrower: i, amount: 0, duration_month: 6, state: proposed}
+  - {key: l2, borrower: b, amount: 100, duration_month: 6, state: lost}
+  - {key: l3, borrower: b, amount: 100, duration_month: 6, state: approved, investments: [{investor: i, amount: 100}]}
+`), ".yaml")
+	if !assert.Error(t, err) {
+		return
+	}
+
+	for _, msg := range []string{
+		"users[1]: duplicate key b",
+		"users[1]: duplicate email b@test",
+		`users[1]: unknown role "pilot"`,
+		"users[2]: only service accounts have scopes",
+		"users[3]: scopes: unknown api key scope: loans:delete",
+		"loans[0]: borrower must be a borrower, i is a investor",
+		"loans[0]: amount must be positive",
+		`loans[1]: unknown state "lost"`,
+		"loans[2]: approved_by is required, no user with role field_validator",
+		"loans[2]: investments of a approved loan must stay below its amount",
+	} {
+		assert.Contains(t, err.Error(), msg)
+	}
+}
+
+func TestSeedServiceAccount(t *testing.T) {
+	f, err := Default()
+	require.NoError(t, err)
+	store := memory.NewStore()
+	seeder := NewSeeder(store.Users(), store.Loans(), store.Files(), store.APIKeys(), t.TempDir())
+
+	seed := func() SeededUser {
+		result, err := seeder.Seed(context.Background(), f)
+		require.NoError(t, err)
+		for _, u := range result.Users {
+			if u.Role == user.RoleService {
+				return u
+			}
+			assert.Empty(t, u.APIKey, u.Key)
+		}
+		t.Fatal("no service account seeded")
+		return SeededUser{}
+	}
+
+	first := seed()
+	prefix, err := apikey.ParsePrefix(first.APIKey)
+	require.NoError(t, err)
+	key, err := store.APIKeys().GetByPrefix(context.Background(), prefix)
+	require.NoError(t, err)
+	assert.True(t, key.Matches(first.APIKey))
+	assert.Equal(t, first.UserId, key.UserId)
+	assert.ElementsMatch(t, first.Scopes, key.Scopes)
+
+	// seeding again reuses the account with a new key
+	second := seed()
+	assert.Equal(t, first.UserId, second.UserId)
+	assert.False(t, second.Created)
+	assert.NotEqual(t, first.APIKey, second.APIKey)
+}
@@ -0,0 +1,329 @@
+package fixtures
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/libs/checksum"
+	"github.com/zainulbr/simple-loan-engine/libs/fee"
+	"github.com/zainulbr/simple-loan-engine/libs/report/pdf"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+	modelFile "github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	repoAPIKey "github.com/zainulbr/simple-loan-engine/repositories/apikey"
+	repoFile "github.com/zainulbr/simple-loan-engine/repositories/filemanager"
+	repoLoan "github.com/zainulbr/simple-loan-engine/repositories/loan"
+	repoUser "github.com/zainulbr/simple-loan-engine/repositories/user"
+)
+
+// feeRule of seeded loans, the platform keeps 20% of the interest
+var feeRule = fee.Rule{Type: fee.RuleTypePercentage, Value: 0.2}
+
+// fundingWindow of seeded approvals
+const fundingWindow = 30 * 24 * time.Hour
+
+// SeededUser is a fixture user with its database id
+type SeededUser struct {
+	User
+	UserId  uuid.UUID
+	Created bool   // false when a user with the email already existed
+	APIKey  string // secret of the key issued to a service account on this run
+}
+
+// SeededLoan is a fixture loan with its database id
+type SeededLoan struct {
+	Loan
+	LoanId uuid.UUID
+}
+
+// Result lists what was seeded in fixture order
+type Result struct {
+	Users []SeededUser
+	Loans []SeededLoan
+}
+
+// Seeder writes fixtures through the repositories, files are stored in uploadDir
+type Seeder struct {
+	userRepo   repoUser.UserRepository
+	loanRepo   repoLoan.LoanRepository
+	fileRepo   repoFile.FileRepository
+	apiKeyRepo repoAPIKey.APIKeyRepository
+	uploadDir  string
+}
+
+func NewSeeder(userRepo repoUser.UserRepository, loanRepo repoLoan.LoanRepository,
+	fileRepo repoFile.FileRepository, apiKeyRepo repoAPIKey.APIKeyRepository, uploadDir string) *Seeder {
+	return &Seeder{
+		userRepo:   userRepo,
+		loanRepo:   loanRepo,
+		fileRepo:   fileRepo,
+		apiKeyRepo: apiKeyRepo,
+		uploadDir:  uploadDir,
+	}
+}
+
+// Seed creates the users and loans of f. Users are matched by email so seeding
+// again reuses them, loans and the API keys of service accounts are always created.
+func (s *Seeder) Seed(ctx context.Context, f *Fixture) (*Result, error) {
+	if err := os.MkdirAll(s.uploadDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	ids := map[string]uuid.UUID{}
+	for _, u := range f.Users {
+		seeded, err := s.seedUser(ctx, u)
+		if err != nil {
+			return result, fmt.Errorf("user %s: %w", u.Key, err)
+		}
+		ids[u.Key] = seeded.UserId
+		result.Users = append(result.Users, seeded)
+	}
+
+	for _, l := range f.Loans {
+		loanID, err := s.seedLoan(ctx, l, ids)
+		if err != nil {
+			return result, fmt.Errorf("loan %s: %w", l.Key, err)
+		}
+		result.Loans = append(result.Loans, SeededLoan{Loan: l, LoanId: loanID})
+	}
+	return result, nil
+}
+
+func (s *Seeder) seedUser(ctx context.Context, u User) (SeededUser, error) {
+	seeded := SeededUser{User: u}
+	existing, err := s.userRepo.GetByEmail(ctx, u.Email)
+	switch {
+	case err == nil:
+		if existing.Role != u.Role {
+			return SeededUser{}, fmt.Errorf("%s already exists as %s", u.Email, existing.Role)
+		}
+		seeded.UserId = existing.UserId
+	case errors.Is(err, pg.ErrNoRows):
+		seeded.UserId, err = s.userRepo.Create(ctx, user.User{Email: u.Email, Role: u.Role})
+		if err != nil {
+			return SeededUser{}, err
+		}
+		seeded.Created = true
+	default:
+		return SeededUser{}, err
+	}
+
+	if u.Role == user.RoleService {
+		seeded.APIKey, err = s.issueKey(ctx, seeded.UserId, u)
+		if err != nil {
+			return SeededUser{}, err
+		}
+	}
+	return seeded, nil
+}
+
+// issueKey creates an API key of a service account, the secret is only known to the caller
+func (s *Seeder) issueKey(ctx context.Context, userID uuid.UUID, u User) (string, error) {
+	key := &apikey.APIKey{
+		KeyId:  uuid.New(),
+		UserId: userID,
+		Name:   "seeded " + u.Key,
+		Scopes: u.Scopes,
+	}
+	secret, err := key.Generate()
+	if err != nil {
+		return "", err
+	}
+	if err := s.apiKeyRepo.Create(ctx, key); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// seedLoan proposes the loan and walks it through the lifecycle up to its state
+func (s *Seeder) seedLoan(ctx context.Context, l Loan, ids map[string]uuid.UUID) (uuid.UUID, error) {
+	rule := feeRule
+	data := &loan.Loan{
+		LoanId:        uuid.New(),
+		Description:   l.Description,
+		ProposedBy:    ids[l.Borrower],
+		Amount:        l.Amount,
+		DurationMonth: l.DurationMonth,
+		FeeRule:       &rule,
+		ApprovalChain: loan.DefaultApprovalChain,
+		State:         string(loan.StateProposed),
+	}
+	if err := s.loanRepo.CreateLoan(ctx, data); err != nil {
+		return uuid.Nil, err
+	}
+	loanID := data.LoanId
+
+	switch loan.LoanState(l.State) {
+	case loan.StateProposed:
+		return loanID, nil
+	case loan.StateRejected:
+		return loanID, s.loanRepo.UpdateState(ctx, loanID, loan.StateProposed, loan.StateRejected)
+	case loan.StateCancelled:
+		return loanID, s.loanRepo.CancelLoan(ctx, &loan.LoanCancellation{
+			LoanId:      loanID,
+			CancelledBy: ids[l.Borrower],
+			Reason:      "No longer needed",
+		}, loan.StateProposed)
+	}
+
+	if err := s.approve(ctx, l, loanID, ids[l.ApprovedBy]); err != nil {
+		return loanID, err
+	}
+
+	for _, inv := range l.Investments {
+		err := s.loanRepo.CreateInvestment(ctx, &loan.LoanInvestment{
+			LoanId:     loanID,
+			InvestedBy: ids[inv.Investor],
+			Amount:     inv.Amount,
+		})
+		if err != nil {
+			return loanID, err
+		}
+	}
+
+	switch loan.LoanState(l.State) {
+	case loan.StateExpired:
+		return loanID, s.loanRepo.ExpireLoan(ctx, loanID, loan.StateApproved)
+	case loan.StateInvested:
+		return loanID, s.agreement(ctx, l, loanID)
+	case loan.StateDisbursed:
+		if err := s.agreement(ctx, l, loanID); err != nil {
+			return loanID, err
+		}
+		return loanID, s.disburse(ctx, l, loanID, ids[l.DisbursedBy])
+	}
+	return loanID, nil
+}
+
+// approve signs off the field visit with a visit photo
+func (s *Seeder) approve(ctx context.Context, l Loan, loanID, approver uuid.UUID) error {
+	photo, err := s.storeFile(ctx, l.Key+"-visit.jpg", approver, writePhoto)
+	if err != nil {
+		return err
+	}
+
+	rule := feeRule
+	now := time.Now()
+	return s.loanRepo.Approve(ctx, &loan.LoanApproval{
+		LoanId:       loanID,
+		Stage:        loan.DefaultApprovalChain[0].Name,
+		ApprovedBy:   approver,
+		ApprovalDate: now,
+		VisitedFile:  photo.FileID,
+		Documents: []loan.LoanDocument{
+			{FileId: photo.FileID, DocumentType: loan.DocumentVisitedPhoto},
+		},
+		Comment:         "Seeded field visit",
+		Rate:            l.Rate,
+		FundingDeadline: now.Add(fundingWindow),
+		ROI:             rule.ROI(l.Amount, l.Rate),
+		FeeRule:         &rule,
+	})
+}
+
+// agreement attaches the agreement letter of a fully funded loan
+func (s *Seeder) agreement(ctx context.Context, l Loan, loanID uuid.UUID) error {
+	file, err := s.storeFile(ctx, l.Key+"-agreement.pdf", uuid.Nil, writePDF(l, "Agreement"))
+	if err != nil {
+		return err
+	}
+	return s.loanRepo.SetAgreementFile(ctx, loanID, file.FileID)
+}
+
+// disburse records the disbursement with a signed agreement as proof
+func (s *Seeder) disburse(ctx context.Context, l Loan, loanID, officer uuid.UUID) error {
+	file, err := s.storeFile(ctx, l.Key+"-disbursement.pdf", officer, writePDF(l, "Disbursement"))
+	if err != nil {
+		return err
+	}
+	return s.loanRepo.CreateDisbursement(ctx, &loan.LoanDisbursement{
+		LoanId:          loanID,
+		DisbursementBy:  officer,
+		DisbursedFile:   file.FileID,
+		DisbursmentDate: time.Now(),
+		Documents: []loan.LoanDocument{
+			{FileId: file.FileID, DocumentType: loan.DocumentDisbursementProof},
+		},
+	})
+}
+
+// storeFile writes a file to the upload directory and records it as a clean
+// pending upload, the loan action using it commits it
+func (s *Seeder) storeFile(ctx context.Context, label string, uploadedBy uuid.UUID,
+	write func(path string) error) (*modelFile.File, error) {
+	ext := filepath.Ext(label)
+	fileID := uuid.New()
+	path := filepath.Join(s.uploadDir, fileID.String()+ext)
+	if err := write(path); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", label, err)
+	}
+
+	sum, err := checksum.SHA256File(path)
+	if err != nil {
+		return nil, err
+	}
+
+	scannedAt := time.Now()
+	file := &modelFile.File{
+		FileID:       fileID,
+		Label:        label,
+		Location:     path,
+		LocationType: modelFile.LocationTypeLocal,
+		FileType:     ext,
+		Status:       modelFile.StatusPending,
+		Sha256:       sum,
+		UploadedBy:   uploadedBy,
+		ScanStatus:   modelFile.ScanClean,
+		ScannedAt:    &scannedAt,
+	}
+	if err := s.fileRepo.Create(ctx, file); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return file, nil
+}
+
+// writePhoto writes a small plain JPEG standing in for a visit photo
+func writePhoto(path string) error {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 48; y++ {
+			img.Set(x, y, color.RGBA{R: 90, G: 140, B: 90, A: 255})
+		}
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(out, img, nil); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writePDF returns a writer of a loan summary PDF
+func writePDF(l Loan, title string) func(path string) error {
+	return func(path string) error {
+		return pdf.NewService().GeneratePDF(pdf.ReportParam{
+			FilePath: path,
+			Data: pdf.Data{
+				Lender:   title + " " + l.Key,
+				Rate:     fmt.Sprintf("%.2f%%", l.Rate*100),
+				Duration: fmt.Sprintf("%d months", l.DurationMonth),
+			},
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package checksum
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSHA256(t *testing.T) {
+	sum, err := SHA256(strings.NewReader("abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", sum)
+
+	path := filepath.Join(t.TempDir(), "abc.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("abc"), 0o600))
+
+	fileSum, err := SHA256File(path)
+	assert.NoError(t, err)
+	assert.Equal(t, sum, fileSum)
+
+	_, err = SHA256File(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
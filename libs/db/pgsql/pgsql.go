@@ -1,6 +1,7 @@
 package pgsql
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sync"
@@ -97,3 +98,30 @@ func DB(dbKey ...string) *pg.DB {
 func init() {
 	store = sync.Map{}
 }
+
+// AdvisoryLocker serializes work across replicas using postgres advisory locks
+type AdvisoryLocker struct {
+	db *pg.DB
+}
+
+// NewAdvisoryLocker creates a locker on the given connection
+func NewAdvisoryLocker(db *pg.DB) *AdvisoryLocker {
+	return &AdvisoryLocker{db: db}
+}
+
+// WithLock runs fn while holding a transaction scoped advisory lock for key,
+// returns false without calling fn when another session holds the lock
+func (l *AdvisoryLocker) WithLock(ctx context.Context, key string, fn func(ctx context.Context) error) (bool, error) {
+	acquired := false
+	err := l.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if _, err := tx.QueryOneContext(ctx, pg.Scan(&acquired),
+			"SELECT pg_try_advisory_xact_lock(hashtext(?))", key); err != nil {
+			return err
+		}
+		if !acquired {
+			return nil
+		}
+		return fn(ctx)
+	})
+	return acquired, err
+}
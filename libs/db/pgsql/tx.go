@@ -0,0 +1,17 @@
+package pgsql
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// RunInTransaction runs fn in db when it already is a transaction, otherwise in a new one.
+// Nesting pg transactions commits the outer one when the inner returns, repositories
+// bound to a unit of work must join its transaction instead.
+func RunInTransaction(ctx context.Context, db pg.DBI, fn func(tx *pg.Tx) error) error {
+	if tx, ok := db.(*pg.Tx); ok {
+		return fn(tx)
+	}
+	return db.RunInTransaction(ctx, fn)
+}
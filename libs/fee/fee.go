@@ -0,0 +1,116 @@
+package fee
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// RuleType is the way the platform fee is charged on borrower interest
+type RuleType string
+
+const (
+	RuleTypePercentage RuleType = "percentage" // share of every interest payment
+	RuleTypeFlat       RuleType = "flat"       // fixed amount per interest payment, capped at the interest
+	RuleTypeTiered     RuleType = "tiered"     // marginal percentage per interest band
+)
+
+// Tier is a marginal band of a tiered rule, the last tier may leave UpTo empty
+type Tier struct {
+	UpTo  float64 `json:"up_to,omitempty"`
+	Value float64 `json:"value"`
+}
+
+// Rule describes how a borrower interest payment is split between investors and the platform
+type Rule struct {
+	Type  RuleType `json:"type"`
+	Value float64  `json:"value,omitempty"`
+	Tiers []Tier   `json:"tiers,omitempty"`
+}
+
+// Split is the result of applying a rule to an interest payment
+type Split struct {
+	InvestorReturn  float64 `json:"investor_return"`
+	PlatformRevenue float64 `json:"platform_revenue"`
+}
+
+// Validate checks the rule is well formed
+func (r Rule) Validate() error {
+	switch r.Type {
+	case RuleTypePercentage:
+		if r.Value < 0 || r.Value > 1 {
+			return errors.New("percentage fee must be between 0 and 1")
+		}
+	case RuleTypeFlat:
+		if r.Value < 0 {
+			return errors.New("flat fee must not be negative")
+		}
+	case RuleTypeTiered:
+		if len(r.Tiers) == 0 {
+			return errors.New("tiered fee requires at least one tier")
+		}
+		prev := 0.0
+		for i, t := range r.Tiers {
+			if t.Value < 0 || t.Value > 1 {
+				return fmt.Errorf("tier %d: percentage must be between 0 and 1", i)
+			}
+			last := i == len(r.Tiers)-1
+			if !last && t.UpTo <= prev {
+				return fmt.Errorf("tier %d: up_to must be increasing", i)
+			}
+			prev = t.UpTo
+		}
+	default:
+		return fmt.Errorf("unknown fee rule type: %q", r.Type)
+	}
+	return nil
+}
+
+// Fee returns the platform revenue of an interest payment
+func (r Rule) Fee(interest float64) float64 {
+	if interest <= 0 {
+		return 0
+	}
+
+	switch r.Type {
+	case RuleTypePercentage:
+		return interest * r.Value
+	case RuleTypeFlat:
+		return math.Min(r.Value, interest)
+	case RuleTypeTiered:
+		fee, lower := 0.0, 0.0
+		for i, t := range r.Tiers {
+			upper := t.UpTo
+			if i == len(r.Tiers)-1 || upper <= 0 {
+				upper = math.Inf(1)
+			}
+			if interest <= lower {
+				break
+			}
+			fee += (math.Min(interest, upper) - lower) * t.Value
+			lower = upper
+		}
+		return fee
+	}
+	return 0
+}
+
+// Split divides an interest payment into investor return and platform revenue
+func (r Rule) Split(interest float64) Split {
+	fee := r.Fee(interest)
+	return Split{
+		InvestorReturn:  interest - fee,
+		PlatformRevenue: fee,
+	}
+}
+
+// ROI returns the annual return promised to investors: the borrower rate minus the
+// platform margin the rule takes from an expected monthly interest payment
+func (r Rule) ROI(amount, rate float64) float64 {
+	monthlyInterest := amount * rate / 12
+	if monthlyInterest <= 0 {
+		return rate
+	}
+	margin := rate * r.Fee(monthlyInterest) / monthlyInterest
+	return rate - margin
+}
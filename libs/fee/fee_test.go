@@ -0,0 +1,57 @@
+package fee
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentage(t *testing.T) {
+	r := Rule{Type: RuleTypePercentage, Value: 0.2}
+	assert.NoError(t, r.Validate())
+
+	split := r.Split(100)
+	assert.InDelta(t, 80, split.InvestorReturn, 1e-9)
+	assert.InDelta(t, 20, split.PlatformRevenue, 1e-9)
+
+	// 12% borrower rate, 20% of interest to the platform
+	assert.InDelta(t, 0.096, r.ROI(1000000, 0.12), 1e-9)
+}
+
+func TestFlat(t *testing.T) {
+	r := Rule{Type: RuleTypeFlat, Value: 5}
+	assert.NoError(t, r.Validate())
+
+	assert.InDelta(t, 5, r.Fee(100), 1e-9)
+	// capped at the interest payment
+	assert.InDelta(t, 3, r.Fee(3), 1e-9)
+}
+
+func TestTiered(t *testing.T) {
+	r := Rule{Type: RuleTypeTiered, Tiers: []Tier{
+		{UpTo: 100, Value: 0.1},
+		{UpTo: 1000, Value: 0.2},
+		{Value: 0.3},
+	}}
+	assert.NoError(t, r.Validate())
+
+	assert.InDelta(t, 5, r.Fee(50), 1e-9)
+	// 100*0.1 + 400*0.2
+	assert.InDelta(t, 90, r.Fee(500), 1e-9)
+	// 100*0.1 + 900*0.2 + 1000*0.3
+	assert.InDelta(t, 490, r.Fee(2000), 1e-9)
+}
+
+func TestValidate(t *testing.T) {
+	assert.Error(t, Rule{Type: "unknown"}.Validate())
+	assert.Error(t, Rule{Type: RuleTypePercentage, Value: 1.5}.Validate())
+	assert.Error(t, Rule{Type: RuleTypeFlat, Value: -1}.Validate())
+	assert.Error(t, Rule{Type: RuleTypeTiered}.Validate())
+	assert.Error(t, Rule{Type: RuleTypeTiered, Tiers: []Tier{{UpTo: 100, Value: 0.1}, {UpTo: 50, Value: 0.1}, {Value: 0.1}}}.Validate())
+}
+
+func TestZeroInterest(t *testing.T) {
+	r := Rule{Type: RuleTypeFlat, Value: 5}
+	assert.Zero(t, r.Fee(0))
+	assert.Equal(t, 0.1, r.ROI(0, 0.1))
+}
@@ -0,0 +1,318 @@
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotJPEG = errors.New("not a jpeg image")
+	ErrNoEXIF  = errors.New("image has no exif metadata")
+)
+
+// Metadata is the proof of visit information read from a photo
+type Metadata struct {
+	CapturedAt  time.Time // zero when the camera did not record it
+	Latitude    float64
+	Longitude   float64
+	HasLocation bool
+}
+
+const (
+	markerSOI  = 0xD8
+	markerEOI  = 0xD9
+	markerSOS  = 0xDA
+	markerAPP1 = 0xE1
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// exif tags used by ReadEXIF
+const (
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagGPSLatitudeRef     = 0x0001
+	tagGPSLatitude        = 0x0002
+	tagGPSLongitudeRef    = 0x0003
+	tagGPSLongitude       = 0x0004
+)
+
+// exif field types
+const (
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeSRational = 10
+)
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// ReadEXIF reads the capture time and GPS position of a JPEG.
+// Capture times without an offset are read as UTC.
+func ReadEXIF(r io.Reader) (*Metadata, error) {
+	br := bufio.NewReader(r)
+
+	if err := readSOI(br); err != nil {
+		return nil, err
+	}
+
+	for {
+		marker, err := readMarker(br)
+		if err != nil {
+			return nil, err
+		}
+		if marker == markerSOS || marker == markerEOI {
+			return nil, ErrNoEXIF
+		}
+		if !hasLength(marker) {
+			continue
+		}
+
+		payload, err := readSegment(br)
+		if err != nil {
+			return nil, err
+		}
+		if marker == markerAPP1 && bytes.HasPrefix(payload, exifHeader) {
+			return parseTIFF(payload[len(exifHeader):])
+		}
+	}
+}
+
+func readSOI(br *bufio.Reader) error {
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi[0] != 0xFF || soi[1] != markerSOI {
+		return ErrNotJPEG
+	}
+	return nil
+}
+
+// readMarker returns the next marker, skipping fill bytes
+func readMarker(br *bufio.Reader) (byte, error) {
+	b, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xFF {
+		return 0, ErrNotJPEG
+	}
+	for {
+		b, err = br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != 0xFF {
+			return b, nil
+		}
+	}
+}
+
+// hasLength reports whether a marker is followed by a length and payload
+func hasLength(marker byte) bool {
+	return !(marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7))
+}
+
+// readSegment reads a segment payload, the length includes its own two bytes
+func readSegment(br *bufio.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(br, size[:]); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint16(size[:]))
+	if n < 2 {
+		return nil, ErrNotJPEG
+	}
+	payload := make([]byte, n-2)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// ifdEntry is a raw exif directory entry
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value []byte // 4 byte value or offset field
+}
+
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func parseTIFF(data []byte) (*Metadata, error) {
+	if len(data) < 8 {
+		return nil, ErrNoEXIF
+	}
+
+	t := &tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, ErrNoEXIF
+	}
+	if t.order.Uint16(data[2:4]) != 42 {
+		return nil, ErrNoEXIF
+	}
+
+	ifd0, err := t.readIFD(t.order.Uint32(data[4:8]))
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &Metadata{}
+
+	// capture time of the exif sub directory, falling back to the file time
+	captured, _ := t.ascii(ifd0[tagDateTime])
+	offset := ""
+	if e, ok := ifd0[tagExifIFD]; ok {
+		if exifIFD, err := t.readIFD(t.uint32(e)); err == nil {
+			if original, ok := t.ascii(exifIFD[tagDateTimeOriginal]); ok {
+				captured = original
+			}
+			offset, _ = t.ascii(exifIFD[tagOffsetTimeOriginal])
+		}
+	}
+	meta.CapturedAt = parseExifTime(captured, offset)
+
+	if e, ok := ifd0[tagGPSIFD]; ok {
+		if gps, err := t.readIFD(t.uint32(e)); err == nil {
+			lat, latOK := t.coordinate(gps[tagGPSLatitude])
+			lon, lonOK := t.coordinate(gps[tagGPSLongitude])
+			if latOK && lonOK {
+				if ref, _ := t.ascii(gps[tagGPSLatitudeRef]); ref == "S" {
+					lat = -lat
+				}
+				if ref, _ := t.ascii(gps[tagGPSLongitudeRef]); ref == "W" {
+					lon = -lon
+				}
+				meta.Latitude, meta.Longitude, meta.HasLocation = lat, lon, true
+			}
+		}
+	}
+
+	if meta.CapturedAt.IsZero() && !meta.HasLocation {
+		return nil, ErrNoEXIF
+	}
+	return meta, nil
+}
+
+func (t *tiff) readIFD(offset uint32) (map[uint16]ifdEntry, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, ErrNoEXIF
+	}
+	n := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+	if start+n*12 > len(t.data) {
+		return nil, ErrNoEXIF
+	}
+
+	entries := make(map[uint16]ifdEntry, n)
+	for i := 0; i < n; i++ {
+		e := t.data[start+i*12 : start+(i+1)*12]
+		entries[t.order.Uint16(e[0:2])] = ifdEntry{
+			typ:   t.order.Uint16(e[2:4]),
+			count: t.order.Uint32(e[4:8]),
+			value: e[8:12],
+		}
+	}
+	return entries, nil
+}
+
+// bytes returns the value of an entry, stored inline when it fits in 4 bytes
+func (t *tiff) bytes(e ifdEntry) ([]byte, bool) {
+	var size uint64
+	switch e.typ {
+	case typeASCII:
+		size = 1
+	case typeShort:
+		size = 2
+	case typeLong:
+		size = 4
+	case typeRational, typeSRational:
+		size = 8
+	default:
+		return nil, false
+	}
+
+	total := size * uint64(e.count)
+	if total <= 4 {
+		return e.value[:total], true
+	}
+
+	offset := uint64(t.order.Uint32(e.value))
+	if offset+total > uint64(len(t.data)) {
+		return nil, false
+	}
+	return t.data[offset : offset+total], true
+}
+
+func (t *tiff) uint32(e ifdEntry) uint32 {
+	switch e.typ {
+	case typeShort:
+		return uint32(t.order.Uint16(e.value))
+	default:
+		return t.order.Uint32(e.value)
+	}
+}
+
+func (t *tiff) ascii(e ifdEntry) (string, bool) {
+	if e.typ != typeASCII {
+		return "", false
+	}
+	b, ok := t.bytes(e)
+	if !ok {
+		return "", false
+	}
+	return strings.TrimRight(string(b), "\x00 "), true
+}
+
+// coordinate reads degrees, minutes and seconds rationals as decimal degrees
+func (t *tiff) coordinate(e ifdEntry) (float64, bool) {
+	if e.typ != typeRational || e.count != 3 {
+		return 0, false
+	}
+	b, ok := t.bytes(e)
+	if !ok {
+		return 0, false
+	}
+
+	var parts [3]float64
+	for i := range parts {
+		num := t.order.Uint32(b[i*8:])
+		den := t.order.Uint32(b[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+	return parts[0] + parts[1]/60 + parts[2]/3600, true
+}
+
+func parseExifTime(value, offset string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	if offset != "" {
+		if tm, err := time.Parse(exifTimeLayout+"-07:00", value+offset); err == nil {
+			return tm
+		}
+	}
+	tm, err := time.Parse(exifTimeLayout, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return tm
+}
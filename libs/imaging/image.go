@@ -0,0 +1,121 @@
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // png decoder for thumbnails
+	"io"
+)
+
+var xmpHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// StripEXIF copies a JPEG without its EXIF and XMP segments
+func StripEXIF(w io.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+	if err := readSOI(br); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{0xFF, markerSOI}); err != nil {
+		return err
+	}
+
+	for {
+		marker, err := readMarker(br)
+		if err != nil {
+			return err
+		}
+
+		if !hasLength(marker) || marker == markerEOI {
+			if _, err := w.Write([]byte{0xFF, marker}); err != nil {
+				return err
+			}
+			if marker == markerEOI {
+				return nil
+			}
+			continue
+		}
+
+		payload, err := readSegment(br)
+		if err != nil {
+			return err
+		}
+		if marker == markerAPP1 && (bytes.HasPrefix(payload, exifHeader) || bytes.HasPrefix(payload, xmpHeader)) {
+			continue
+		}
+
+		if err := writeSegment(w, marker, payload); err != nil {
+			return err
+		}
+
+		// entropy coded image data follows the scan header, copied as is
+		if marker == markerSOS {
+			_, err := io.Copy(w, br)
+			return err
+		}
+	}
+}
+
+func writeSegment(w io.Writer, marker byte, payload []byte) error {
+	header := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(payload)+2))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// WriteThumbnail decodes a JPEG or PNG and writes it as a JPEG fitting in
+// maxSize x maxSize. The thumbnail carries no metadata.
+func WriteThumbnail(w io.Writer, r io.Reader, maxSize int) error {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return err
+	}
+	return jpeg.Encode(w, Resize(src, maxSize), &jpeg.Options{Quality: 80})
+}
+
+// Resize scales an image down to fit in maxSize x maxSize keeping the aspect
+// ratio, each pixel is the average of the source pixels it covers
+func Resize(src image.Image, maxSize int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSize && h <= maxSize || w == 0 || h == 0 {
+		return src
+	}
+
+	tw, th := maxSize, maxSize
+	if w > h {
+		th = max(1, h*maxSize/w)
+	} else {
+		tw = max(1, w*maxSize/h)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
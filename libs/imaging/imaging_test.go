@@ -0,0 +1,167 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tiffBuilder lays out little endian exif directories for tests
+type tiffBuilder struct {
+	buf bytes.Buffer
+}
+
+type testEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte // inline when it fits in 4 bytes
+}
+
+func rational(values ...uint32) []byte {
+	b := make([]byte, 0, len(values)*4)
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+// ifd appends a directory at the end of the buffer and returns its offset
+func (t *tiffBuilder) ifd(entries []testEntry) uint32 {
+	offset := uint32(t.buf.Len())
+	dataOffset := offset + 2 + uint32(len(entries))*12 + 4
+
+	var dir, data bytes.Buffer
+	binary.Write(&dir, binary.LittleEndian, uint16(len(entries)))
+	for _, e := range entries {
+		binary.Write(&dir, binary.LittleEndian, e.tag)
+		binary.Write(&dir, binary.LittleEndian, e.typ)
+		binary.Write(&dir, binary.LittleEndian, e.count)
+		if len(e.data) <= 4 {
+			value := make([]byte, 4)
+			copy(value, e.data)
+			dir.Write(value)
+			continue
+		}
+		binary.Write(&dir, binary.LittleEndian, dataOffset+uint32(data.Len()))
+		data.Write(e.data)
+	}
+	binary.Write(&dir, binary.LittleEndian, uint32(0)) // no next directory
+
+	t.buf.Write(dir.Bytes())
+	t.buf.Write(data.Bytes())
+	return offset
+}
+
+func testEXIF() []byte {
+	t := &tiffBuilder{}
+	t.buf.WriteString("II")
+	binary.Write(&t.buf, binary.LittleEndian, uint16(42))
+	binary.Write(&t.buf, binary.LittleEndian, uint32(8))
+
+	// IFD0 pointers are patched once the sub directories are written
+	ifd0 := t.ifd([]testEntry{
+		{tag: tagExifIFD, typ: typeLong, count: 1, data: rational(0)},
+		{tag: tagGPSIFD, typ: typeLong, count: 1, data: rational(0)},
+	})
+	exifIFD := t.ifd([]testEntry{
+		{tag: tagDateTimeOriginal, typ: typeASCII, count: 20, data: []byte("2024:03:13 15:04:05\x00")},
+		{tag: tagOffsetTimeOriginal, typ: typeASCII, count: 7, data: []byte("+07:00\x00")},
+	})
+	gpsIFD := t.ifd([]testEntry{
+		{tag: tagGPSLatitudeRef, typ: typeASCII, count: 2, data: []byte("S\x00")},
+		{tag: tagGPSLatitude, typ: typeRational, count: 3, data: rational(6, 1, 12, 1, 36, 1)},
+		{tag: tagGPSLongitudeRef, typ: typeASCII, count: 2, data: []byte("E\x00")},
+		{tag: tagGPSLongitude, typ: typeRational, count: 3, data: rational(106, 1, 49, 1, 0, 1)},
+	})
+
+	data := t.buf.Bytes()
+	binary.LittleEndian.PutUint32(data[ifd0+2+8:], exifIFD)
+	binary.LittleEndian.PutUint32(data[ifd0+2+12+8:], gpsIFD)
+	return data
+}
+
+// testJPEG encodes an image and inserts an exif segment after SOI
+func testJPEG(t *testing.T, width, height int, exif []byte) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+
+	var encoded bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&encoded, img, nil))
+	if exif == nil {
+		return encoded.Bytes()
+	}
+
+	var out bytes.Buffer
+	out.Write(encoded.Bytes()[:2])
+	assert.NoError(t, writeSegment(&out, markerAPP1, append(append([]byte{}, exifHeader...), exif...)))
+	out.Write(encoded.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestReadEXIF(t *testing.T) {
+	meta, err := ReadEXIF(bytes.NewReader(testJPEG(t, 16, 16, testEXIF())))
+	assert.NoError(t, err)
+
+	expected := time.Date(2024, 3, 13, 8, 4, 5, 0, time.UTC)
+	assert.True(t, expected.Equal(meta.CapturedAt), "captured at %s", meta.CapturedAt)
+	assert.True(t, meta.HasLocation)
+	assert.InDelta(t, -6.21, meta.Latitude, 0.0001)
+	assert.InDelta(t, 106.8166, meta.Longitude, 0.0001)
+}
+
+func TestReadEXIFMissing(t *testing.T) {
+	_, err := ReadEXIF(bytes.NewReader(testJPEG(t, 16, 16, nil)))
+	assert.ErrorIs(t, err, ErrNoEXIF)
+
+	_, err = ReadEXIF(bytes.NewReader([]byte("%PDF-1.4")))
+	assert.ErrorIs(t, err, ErrNotJPEG)
+
+	// truncated directories must not panic
+	exif := testEXIF()
+	_, err = ReadEXIF(bytes.NewReader(testJPEG(t, 16, 16, exif[:20])))
+	assert.Error(t, err)
+}
+
+func TestStripEXIF(t *testing.T) {
+	original := testJPEG(t, 16, 16, testEXIF())
+
+	var stripped bytes.Buffer
+	assert.NoError(t, StripEXIF(&stripped, bytes.NewReader(original)))
+	assert.Less(t, stripped.Len(), len(original))
+
+	_, err := ReadEXIF(bytes.NewReader(stripped.Bytes()))
+	assert.ErrorIs(t, err, ErrNoEXIF)
+
+	// the image itself is untouched
+	img, err := jpeg.Decode(bytes.NewReader(stripped.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 16, img.Bounds().Dx())
+}
+
+func TestWriteThumbnail(t *testing.T) {
+	var thumb bytes.Buffer
+	assert.NoError(t, WriteThumbnail(&thumb, bytes.NewReader(testJPEG(t, 400, 200, testEXIF())), 100))
+
+	img, err := jpeg.Decode(bytes.NewReader(thumb.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 100, img.Bounds().Dx())
+	assert.Equal(t, 50, img.Bounds().Dy())
+
+	_, err = ReadEXIF(bytes.NewReader(thumb.Bytes()))
+	assert.ErrorIs(t, err, ErrNoEXIF)
+
+	// small images are not scaled up
+	small := image.NewRGBA(image.Rect(0, 0, 10, 20))
+	assert.Equal(t, small, Resize(small, 100))
+}
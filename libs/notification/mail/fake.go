@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"slices"
+	"sync"
+)
+
+// Message is an email recorded by Fake
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Fake records sent emails instead of delivering them, for tests
+type Fake struct {
+	Err error // returned by every send when set
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+// Send records the email
+func (f *Fake) Send(to []string, subject, body string) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, Message{To: slices.Clone(to), Subject: subject, Body: body})
+	return nil
+}
+
+// Sent returns the recorded emails in the order they were sent
+func (f *Fake) Sent() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.sent)
+}
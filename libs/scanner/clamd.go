@@ -0,0 +1,121 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// chunkSize of INSTREAM writes, well below clamd's default StreamMaxLength
+const chunkSize = 32 << 10
+
+type clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamd creates a scanner streaming content to a clamd daemon, network is tcp or unix
+func NewClamd(network, address string, timeout time.Duration) Scanner {
+	return &clamd{network: network, address: address, timeout: timeout}
+}
+
+// Scan sends the content with the INSTREAM command and parses the verdict
+func (c *clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Result{}, fmt.Errorf("%w: %s", ErrScanFailed, err)
+	}
+
+	// each chunk is prefixed by its length, a zero length ends the stream
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return Result{}, fmt.Errorf("%w: %s", ErrScanFailed, werr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return Result{}, fmt.Errorf("%w: %s", ErrScanFailed, err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %s", ErrScanFailed, err)
+	}
+	return parseReply(strings.TrimRight(reply, "\x00"))
+}
+
+// Ping checks the daemon is reachable
+func (c *clamd) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return fmt.Errorf("%w: %s", ErrScanFailed, err)
+	}
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrScanFailed, err)
+	}
+	if !bytes.Equal(reply, []byte("PONG\x00")) {
+		return fmt.Errorf("%w: unexpected reply %q", ErrScanFailed, reply)
+	}
+	return nil
+}
+
+func (c *clamd) dial(ctx context.Context) (net.Conn, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrScanFailed, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else if c.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	return conn, nil
+}
+
+// parseReply reads "stream: OK", "stream: <signature> FOUND" or "<message> ERROR"
+func parseReply(reply string) (Result, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("%w: %s", ErrScanFailed, reply)
+	}
+}
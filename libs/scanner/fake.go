@@ -0,0 +1,45 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// EICAR is the standard antivirus test file, every scanner flags it
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// Fake flags content containing the EICAR test string, for tests
+type Fake struct {
+	Err error // returned by every scan when set
+
+	mu      sync.Mutex
+	scanned int
+}
+
+// Scan reads the content and reports it infected when it contains EICAR
+func (f *Fake) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	f.mu.Lock()
+	f.scanned++
+	f.mu.Unlock()
+
+	if f.Err != nil {
+		return Result{}, f.Err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+	if bytes.Contains(data, []byte(EICAR)) {
+		return Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return Result{}, nil
+}
+
+// Scanned returns the number of scans performed
+func (f *Fake) Scanned() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.scanned
+}
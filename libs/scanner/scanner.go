@@ -0,0 +1,53 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+// ErrScanFailed is returned when the scanner could not give a verdict
+var ErrScanFailed = errors.New("malware scan failed")
+
+// Result is the verdict of a scan
+type Result struct {
+	Infected  bool
+	Signature string // name of the matched signature when infected
+}
+
+// Scanner checks content for malware before it is served to other users
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// New returns the scanner for address, tcp://host:port or unix:///path/clamd.ctl
+// speak the clamd protocol, an empty address disables scanning
+func New(address string, timeout time.Duration) (Scanner, error) {
+	if address == "" {
+		return Noop{}, nil
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scanner address: %w", err)
+	}
+	switch u.Scheme {
+	case "tcp":
+		return NewClamd("tcp", u.Host, timeout), nil
+	case "unix":
+		return NewClamd("unix", u.Path, timeout), nil
+	default:
+		return nil, fmt.Errorf("unsupported scanner address: %s", address)
+	}
+}
+
+// Noop accepts every file, used when no scanner is configured
+type Noop struct{}
+
+// Scan reports the content as clean without reading it
+func (Noop) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return Result{}, nil
+}
@@ -0,0 +1,132 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClamd answers INSTREAM like clamd, flagging the EICAR string
+func fakeClamd(t *testing.T, l net.Listener) {
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				cmd, err := r.ReadString(0)
+				if err != nil {
+					return
+				}
+				if cmd == "zPING\x00" {
+					conn.Write([]byte("PONG\x00"))
+					return
+				}
+
+				var data bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+						return
+					}
+				}
+
+				switch {
+				case bytes.Contains(data.Bytes(), []byte(EICAR)):
+					conn.Write([]byte("stream: Win.Test.EICAR_HDB-1 FOUND\x00"))
+				case data.Len() > 100<<10:
+					conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+				default:
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			}()
+		}
+	}()
+}
+
+func testScanner(t *testing.T, s Scanner) {
+	ctx := context.Background()
+
+	res, err := s.Scan(ctx, strings.NewReader("%PDF-1.4 loan agreement"))
+	assert.NoError(t, err)
+	assert.False(t, res.Infected)
+
+	// spans several chunks
+	infected := strings.Repeat("x", 40<<10) + EICAR
+	res, err = s.Scan(ctx, strings.NewReader(infected))
+	assert.NoError(t, err)
+	assert.True(t, res.Infected)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", res.Signature)
+
+	_, err = s.Scan(ctx, strings.NewReader(strings.Repeat("x", 200<<10)))
+	assert.ErrorIs(t, err, ErrScanFailed)
+
+	assert.NoError(t, s.(*clamd).Ping(ctx))
+}
+
+func TestClamdTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	fakeClamd(t, l)
+
+	s, err := New("tcp://"+l.Addr().String(), time.Second)
+	assert.NoError(t, err)
+	testScanner(t, s)
+}
+
+func TestClamdUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clamd.ctl")
+	l, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	fakeClamd(t, l)
+
+	s, err := New("unix://"+path, time.Second)
+	assert.NoError(t, err)
+	testScanner(t, s)
+}
+
+func TestClamdUnavailable(t *testing.T) {
+	s := NewClamd("unix", filepath.Join(t.TempDir(), "missing.ctl"), time.Second)
+	_, err := s.Scan(context.Background(), strings.NewReader("data"))
+	assert.ErrorIs(t, err, ErrScanFailed)
+}
+
+func TestNew(t *testing.T) {
+	s, err := New("", 0)
+	assert.NoError(t, err)
+	assert.IsType(t, Noop{}, s)
+
+	_, err = New("http://localhost:3310", 0)
+	assert.Error(t, err)
+}
+
+func TestFake(t *testing.T) {
+	f := &Fake{}
+	res, err := f.Scan(context.Background(), strings.NewReader("clean"))
+	assert.NoError(t, err)
+	assert.False(t, res.Infected)
+
+	res, err = f.Scan(context.Background(), strings.NewReader(EICAR))
+	assert.NoError(t, err)
+	assert.True(t, res.Infected)
+	assert.Equal(t, 2, f.Scanned())
+}
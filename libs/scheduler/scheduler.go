@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/zainulbr/simple-loan-engine/libs/clock"
+)
+
+// Locker guarantees a job runs on a single replica at a time.
+// WithLock reports false without calling fn when the lock is held elsewhere.
+type Locker interface {
+	WithLock(ctx context.Context, key string, fn func(ctx context.Context) error) (bool, error)
+}
+
+// Job is a periodic background task
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context, now time.Time) error
+}
+
+// Scheduler runs registered jobs periodically
+type Scheduler struct {
+	clock  clock.Clock
+	locker Locker
+	jobs   []Job
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a scheduler, a nil locker runs jobs without locking
+func New(c clock.Clock, locker Locker) *Scheduler {
+	if locker == nil {
+		locker = noopLocker{}
+	}
+	return &Scheduler{clock: c, locker: locker}
+}
+
+// Register adds a job, must be called before Start
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Start runs every job on its own interval until Stop is called
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, job := range s.jobs {
+		if job.Interval <= 0 {
+			log.Printf("job %s: disabled, interval must be positive", job.Name)
+			continue
+		}
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+}
+
+// Stop stops all jobs and waits for running ones to finish
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+// Run executes a job once under its lock, reports whether the job ran
+func (s *Scheduler) Run(ctx context.Context, job Job) (bool, error) {
+	return s.locker.WithLock(ctx, job.Name, func(ctx context.Context) error {
+		return job.Run(ctx, s.clock.Now())
+	})
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Run(ctx, job); err != nil {
+				log.Printf("job %s: %s", job.Name, err)
+			}
+		}
+	}
+}
+
+type noopLocker struct{}
+
+func (noopLocker) WithLock(ctx context.Context, _ string, fn func(ctx context.Context) error) (bool, error) {
+	return true, fn(ctx)
+}
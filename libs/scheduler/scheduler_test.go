@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zainulbr/simple-loan-engine/libs/clock"
+)
+
+type fakeLocker struct {
+	held bool
+}
+
+func (l *fakeLocker) WithLock(ctx context.Context, _ string, fn func(ctx context.Context) error) (bool, error) {
+	if l.held {
+		return false, nil
+	}
+	return true, fn(ctx)
+}
+
+func TestRunUsesClock(t *testing.T) {
+	now := time.Date(2024, 3, 13, 15, 4, 5, 0, time.UTC)
+	s := New(clock.NewFake(now), nil)
+
+	var got time.Time
+	ran, err := s.Run(context.Background(), Job{
+		Name: "test",
+		Run: func(ctx context.Context, at time.Time) error {
+			got = at
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	assert.Equal(t, now, got)
+}
+
+func TestRunSkippedWhenLocked(t *testing.T) {
+	locker := &fakeLocker{held: true}
+	s := New(clock.Real(), locker)
+
+	called := false
+	ran, err := s.Run(context.Background(), Job{
+		Name: "test",
+		Run: func(ctx context.Context, at time.Time) error {
+			called = true
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.False(t, ran)
+	assert.False(t, called)
+}
+
+func TestStartStop(t *testing.T) {
+	s := New(clock.Real(), nil)
+
+	var count int32
+	s.Register(Job{
+		Name:     "tick",
+		Interval: 10 * time.Millisecond,
+		Run: func(ctx context.Context, at time.Time) error {
+			atomic.AddInt32(&count, 1)
+			return nil
+		},
+	})
+
+	s.Start(context.Background())
+	time.Sleep(55 * time.Millisecond)
+	s.Stop()
+
+	assert.Greater(t, atomic.LoadInt32(&count), int32(1))
+}
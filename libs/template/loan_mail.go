@@ -47,3 +47,81 @@ func TemplateEmailAgreement(data EmailData) (string, error) {
 
 	return tpl.String(), nil
 }
+
+type CancellationData struct {
+	InvestorName string
+	LoanID       string
+	Reason       string
+}
+
+// TemplateEmailLoanCancelled function for render template email of voided investment
+func TemplateEmailLoanCancelled(data CancellationData) (string, error) {
+	tmpl := `
+		<!DOCTYPE html>
+		<html>
+		<head>
+			<title>Loan Cancelled</title>
+		</head>
+		<body>
+			<p>Dear {{ .InvestorName }},</p>
+			<p>The loan <strong>{{ .LoanID }}</strong> you invested in has been cancelled before it was fully funded.</p>
+			{{ if .Reason }}<p>Reason: {{ .Reason }}</p>{{ end }}
+			<p>Your investment has been voided and the invested amount will be refunded.</p>
+			<br>
+			<p>Best Regards,</p>
+			<p><strong>Your Loan Platform Team</strong></p>
+		</body>
+		</html>
+	`
+
+	t, err := template.New("email").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	var tpl bytes.Buffer
+	if err := t.Execute(&tpl, data); err != nil {
+		return "", err
+	}
+
+	return tpl.String(), nil
+}
+
+type ExpiryData struct {
+	RecipientName string
+	LoanID        string
+	IsBorrower    bool
+}
+
+// TemplateEmailLoanExpired function for render template email of expired loan
+func TemplateEmailLoanExpired(data ExpiryData) (string, error) {
+	tmpl := `
+		<!DOCTYPE html>
+		<html>
+		<head>
+			<title>Loan Expired</title>
+		</head>
+		<body>
+			<p>Dear {{ .RecipientName }},</p>
+			<p>The funding window of Loan ID <strong>{{ .LoanID }}</strong> has ended before the loan was fully funded.</p>
+			{{ if .IsBorrower }}<p>Your loan request has expired, you may submit a new loan request.</p>
+			{{ else }}<p>Your investment has been voided and the invested amount will be refunded.</p>{{ end }}
+			<br>
+			<p>Best Regards,</p>
+			<p><strong>Your Loan Platform Team</strong></p>
+		</body>
+		</html>
+	`
+
+	t, err := template.New("email").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	var tpl bytes.Buffer
+	if err := t.Execute(&tpl, data); err != nil {
+		return "", err
+	}
+
+	return tpl.String(), nil
+}
@@ -3,6 +3,7 @@ package template
 import (
 	"fmt"
 	"log"
+	"strings"
 	"testing"
 )
 
@@ -23,3 +24,18 @@ func Test(t *testing.T) {
 	// Cetak hasil email
 	fmt.Println(emailBody)
 }
+
+func TestLoanCancelled(t *testing.T) {
+	emailBody, err := TemplateEmailLoanCancelled(CancellationData{
+		InvestorName: "John Doe",
+		LoanID:       "12345-67890",
+		Reason:       "borrower withdrew",
+	})
+	if err != nil {
+		t.Fatal("Error generating email:", err)
+	}
+
+	if !strings.Contains(emailBody, "borrower withdrew") {
+		t.Errorf("expected reason in email body")
+	}
+}
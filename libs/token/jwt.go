@@ -2,7 +2,6 @@ package token
 
 import (
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -17,8 +16,9 @@ type Claims struct {
 }
 
 type jwtServices struct {
-	secretKey string
-	issure    string
+	signer Key            // signs new tokens
+	keys   map[string]Key // verify tokens by kid, the signer included
+	issure string
 }
 
 // GenerateToken generates a new token
@@ -33,43 +33,52 @@ func (service *jwtServices) GenerateToken(userId, role string, timestamp time.Ti
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(service.signer.Method, claims)
+	token.Header["kid"] = service.signer.ID
 
 	//encoded string
-	t, err := token.SignedString([]byte(service.secretKey))
+	t, err := token.SignedString(service.signer.signKey)
 	if err != nil {
 		panic(err)
 	}
 	return t
 }
 
-// ValidateToken validates a token
+// ValidateToken validates a token with the key named by its kid header,
+// tokens without kid are verified with the signing key
 func (service *jwtServices) ValidateToken(encodedToken string) (*jwt.Token, error) {
 	return jwt.Parse(encodedToken, func(token *jwt.Token) (interface{}, error) {
-		if _, isvalid := token.Method.(*jwt.SigningMethodHMAC); !isvalid {
+		key := service.signer
+		if kid, ok := token.Header["kid"]; ok {
+			id, _ := kid.(string)
+			if key, ok = service.keys[id]; !ok {
+				return nil, fmt.Errorf("Invalid token, unknown key %v", kid)
+			}
+		}
+		// the algorithm is bound to the key, never taken from the token
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("Invalid token %v", token.Header["alg"])
-
 		}
-		return []byte(service.secretKey), nil
+		return key.verifyKey, nil
 	})
 
 }
 
-// NewService creates a new token service
-func NewService(secretKey ...string) TokenService {
-	_secretKey := getSecretKey()
-	if len(secretKey) > 0 {
-		_secretKey = secretKey[0]
+// NewService creates a new token service, the first key signs new tokens
+// and every key verifies, so a retired key stays listed until its tokens expire
+func NewService(keys ...Key) (TokenService, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
 	}
-	return &jwtServices{
-		secretKey: _secretKey,
+	service := &jwtServices{
+		signer: keys[0],
+		keys:   make(map[string]Key, len(keys)),
 	}
-}
-
-func getSecretKey() string {
-	secret := os.Getenv("SECRET_KEY")
-	if secret == "" {
-		secret = "8D20809F3F8A1E8371B3D7DB989393A0E228B55EF3D845FF6B7F1A79C632FF80"
+	for _, key := range keys {
+		if _, ok := service.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%w %s", ErrDuplicateKid, key.ID)
+		}
+		service.keys[key.ID] = key
 	}
-	return secret
+	return service, nil
 }
@@ -0,0 +1,130 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoKeys       = errors.New("no token signing key configured")
+	ErrDuplicateKid = errors.New("duplicate key id")
+)
+
+// keyFilePrefix marks a key read from a PEM file instead of an HMAC secret
+const keyFilePrefix = "@"
+
+// Key signs and verifies tokens, it is identified by the kid header of the tokens it signs
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	signKey   interface{} // []byte, *rsa.PrivateKey or ed25519.PrivateKey
+	verifyKey interface{} // []byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// HMACKey signs tokens with HS256, the secret is never published
+func HMACKey(id string, secret []byte) Key {
+	return Key{ID: id, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// PrivateKey signs tokens with RS256 for an RSA key or EdDSA for an Ed25519 key,
+// the public key is published in the JWKS
+func PrivateKey(id string, key crypto.Signer) (Key, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return Key{ID: id, Method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return Key{ID: id, Method: jwt.SigningMethodEdDSA, signKey: key, verifyKey: key.Public()}, nil
+	default:
+		return Key{}, fmt.Errorf("key %s: unsupported private key type %T", id, key)
+	}
+}
+
+// RandomKey returns an HMAC key that only lives as long as the process,
+// tokens it signs are invalid after a restart and on other replicas
+func RandomKey() Key {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return HMACKey("ephemeral", secret)
+}
+
+// ParseKeys reads a comma separated list of kid:key entries, the first entry signs new tokens
+// and every entry verifies. A key is an HMAC secret, or @path to a PEM encoded RSA or Ed25519
+// private key. An entry without kid is an HMAC secret identified by its fingerprint.
+func ParseKeys(spec string) ([]Key, error) {
+	var keys []Key
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, value, ok := strings.Cut(entry, ":")
+		if !ok {
+			value = entry
+			sum := sha256.Sum256([]byte(value))
+			id = hex.EncodeToString(sum[:4])
+		}
+		if id == "" || value == "" {
+			return nil, fmt.Errorf("invalid key entry, expected kid:key")
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("%w %s", ErrDuplicateKid, id)
+		}
+		seen[id] = true
+
+		if !strings.HasPrefix(value, keyFilePrefix) {
+			keys = append(keys, HMACKey(id, []byte(value)))
+			continue
+		}
+		key, err := readPrivateKey(id, strings.TrimPrefix(value, keyFilePrefix))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// readPrivateKey loads a PKCS#8 or PKCS#1 PEM private key
+func readPrivateKey(id, path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, fmt.Errorf("key %s: %w", id, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, fmt.Errorf("key %s: %s is not PEM encoded", id, path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return Key{}, fmt.Errorf("key %s: %w", id, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return Key{}, fmt.Errorf("key %s: unsupported private key type %T", id, key)
+	}
+	return PrivateKey(id, signer)
+}
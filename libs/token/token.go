@@ -10,4 +10,6 @@ import (
 type TokenService interface {
 	GenerateToken(userId, role string, timestamp time.Time) string
 	ValidateToken(token string) (*jwt.Token, error)
+	// JWKS returns the public keys other services verify tokens with
+	JWKS() JWKSet
 }
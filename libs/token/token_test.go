@@ -1,16 +1,145 @@
 package token
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func newService(t *testing.T, keys ...Key) TokenService {
+	t.Helper()
+	svc, err := NewService(keys...)
+	require.NoError(t, err)
+	return svc
+}
+
 func TestGenToken(t *testing.T) {
-	svc := NewService()
+	svc := newService(t, HMACKey("2024-01", []byte("secret")))
 
-	_, err := svc.ValidateToken(svc.GenerateToken("userId", "admin", time.Now()))
+	token, err := svc.ValidateToken(svc.GenerateToken("userId", "admin", time.Now()))
 	if err != nil {
 		t.Error("validate token", err)
 		return
 	}
+	assert.Equal(t, "2024-01", token.Header["kid"])
+	assert.Equal(t, "admin", token.Claims.(jwt.MapClaims)["loan.role"])
+}
+
+func TestNoKeys(t *testing.T) {
+	_, err := NewService()
+	assert.ErrorIs(t, err, ErrNoKeys)
+
+	_, err = NewService(HMACKey("a", []byte("one")), HMACKey("a", []byte("two")))
+	assert.ErrorIs(t, err, ErrDuplicateKid)
+}
+
+func TestRotation(t *testing.T) {
+	old := HMACKey("old", []byte("old secret"))
+	current := HMACKey("new", []byte("new secret"))
+
+	before := newService(t, old)
+	issued := before.GenerateToken("userId", "admin", time.Now())
+
+	// the new key signs, the old one still verifies the tokens it signed
+	during := newService(t, current, old)
+	_, err := during.ValidateToken(issued)
+	assert.NoError(t, err)
+	token, err := during.ValidateToken(during.GenerateToken("userId", "admin", time.Now()))
+	require.NoError(t, err)
+	assert.Equal(t, "new", token.Header["kid"])
+
+	// once the old key is removed its tokens are refused
+	after := newService(t, current)
+	_, err = after.ValidateToken(issued)
+	assert.Error(t, err)
+}
+
+func TestAsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	rs, err := PrivateKey("rs", rsaKey)
+	require.NoError(t, err)
+	ed, err := PrivateKey("ed", edKey)
+	require.NoError(t, err)
+
+	for _, key := range []Key{rs, ed} {
+		svc := newService(t, key, HMACKey("hs", []byte("secret")))
+		token, err := svc.ValidateToken(svc.GenerateToken("userId", "admin", time.Now()))
+		if assert.NoError(t, err, key.ID) {
+			assert.Equal(t, key.Method.Alg(), token.Method.Alg())
+		}
+	}
+
+	jwks := newService(t, rs, ed, HMACKey("hs", []byte("secret"))).JWKS()
+	if assert.Len(t, jwks.Keys, 2, "HMAC secrets are not published") {
+		assert.Equal(t, JWK{Kty: "OKP", Kid: "ed", Use: "sig", Alg: "EdDSA", Crv: "Ed25519",
+			X: jwks.Keys[0].X}, jwks.Keys[0])
+		assert.Equal(t, "RSA", jwks.Keys[1].Kty)
+		assert.Equal(t, "RS256", jwks.Keys[1].Alg)
+		assert.Equal(t, "AQAB", jwks.Keys[1].E)
+	}
+}
+
+func TestAlgorithmBoundToKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rs, err := PrivateKey("rs", rsaKey)
+	require.NoError(t, err)
+	svc := newService(t, rs)
+
+	// an HS256 token claiming the RSA kid, signed with the public key
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"loan.role": "admin"})
+	forged.Header["kid"] = "rs"
+	signed, err := forged.SignedString(x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey))
+	require.NoError(t, err)
+
+	_, err = svc.ValidateToken(signed)
+	assert.Error(t, err)
+}
+
+func TestParseKeys(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "ed.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	keys, err := ParseKeys("2024-02:@" + path + ", 2024-01:old secret")
+	require.NoError(t, err)
+	if assert.Len(t, keys, 2) {
+		assert.Equal(t, "2024-02", keys[0].ID)
+		assert.Equal(t, jwt.SigningMethodEdDSA, keys[0].Method)
+		assert.Equal(t, "2024-01", keys[1].ID)
+		assert.Equal(t, jwt.SigningMethodHS256, keys[1].Method)
+	}
+
+	keys, err = ParseKeys("mysecretkey")
+	require.NoError(t, err)
+	if assert.Len(t, keys, 1) {
+		assert.Len(t, keys[0].ID, 8, "a key without kid is named by its fingerprint")
+	}
+
+	keys, err = ParseKeys("")
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	_, err = ParseKeys("a:one,a:two")
+	assert.ErrorIs(t, err, ErrDuplicateKid)
+
+	_, err = ParseKeys("a:@" + filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
 }
@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	libToken "github.com/zainulbr/simple-loan-engine/libs/token"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+)
+
+const apiKeyHeader = "X-API-Key"
+const claimKeyIdKey = "loan.key_id"
+const claimScopesKey = "loan.scopes"
+
+// APIKeyAuthenticator resolves an API key secret to the key, see the apikey service
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, secret string) (*apikey.APIKey, error)
+}
+
+// Authorize accepts an API key from the X-API-Key header or as bearer token, and a JWT otherwise.
+// Both set the same claims so RolePermission, ScopePermission and GetClaim work for users and machines.
+func Authorize(tokens libToken.TokenService, keys APIKeyAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if secret := requestAPIKey(c); secret != "" {
+			authorizeAPIKey(c, keys, secret)
+			return
+		}
+		authorizeJWT(c, tokens, requestToken(c))
+	}
+}
+
+// AuthorizeAPIKey only accepts API keys
+func AuthorizeAPIKey(keys APIKeyAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorizeAPIKey(c, keys, requestAPIKey(c))
+	}
+}
+
+// requestAPIKey reads the X-API-Key header, then a bearer token shaped like an API key
+func requestAPIKey(c *gin.Context) string {
+	if secret := c.GetHeader(apiKeyHeader); secret != "" {
+		return secret
+	}
+	if token := requestToken(c); apikey.IsKey(token) {
+		return token
+	}
+	return ""
+}
+
+func authorizeAPIKey(c *gin.Context, keys APIKeyAuthenticator, secret string) {
+	if keys == nil || secret == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, apikey.ErrInvalidAPIKey.Error())
+		return
+	}
+	key, err := keys.Authenticate(c.Request.Context(), secret)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, err.Error())
+		log.Println(err)
+		return
+	}
+
+	scopes := make([]string, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = string(scope)
+	}
+	setClaims(c, jwt.MapClaims{
+		claimUserIdKey: key.UserId.String(),
+		claimRoleKey:   string(user.RoleService),
+		claimKeyIdKey:  key.KeyId.String(),
+		claimScopesKey: scopes,
+	})
+}
+
+// ScopePermission passes API key callers granted scope, and users whose role is
+// any of roles, or every user when no roles are given
+func ScopePermission(scope apikey.Scope, roles ...user.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := GetClaim(c)
+
+		role, _ := claims[claimRoleKey].(string)
+		if role == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, ("Permission dined"))
+			return
+		}
+
+		if role == string(user.RoleService) {
+			scopes, _ := claims[claimScopesKey].([]string)
+			for _, s := range scopes {
+				if s == string(scope) {
+					return
+				}
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, ("Permission dined"))
+			return
+		}
+
+		if len(roles) == 0 {
+			return
+		}
+		for _, r := range roles {
+			if role == string(r) {
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, ("Permission dined"))
+	}
+}
@@ -0,0 +1,92 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	libToken "github.com/zainulbr/simple-loan-engine/libs/token"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+)
+
+type fakeKeys map[string]*apikey.APIKey
+
+func (k fakeKeys) Authenticate(_ context.Context, secret string) (*apikey.APIKey, error) {
+	key, ok := k[secret]
+	if !ok {
+		return nil, apikey.ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+func authorizeRouter(t *testing.T, tokens libToken.TokenService, keys APIKeyAuthenticator) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Authorize(tokens, keys))
+	actor := func(c *gin.Context) {
+		a, _ := user.ActorFromContext(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"user_id": a.UserId, "role": a.Role})
+	}
+	r.GET("/loans", ScopePermission(apikey.ScopeLoansRead), actor)
+	r.POST("/repayments", ScopePermission(apikey.ScopeRepaymentsWrite, user.RoleFieldOfficer), actor)
+	r.POST("/approve", RolePermission(user.RoleFiledValidator), actor)
+	return r
+}
+
+func TestAuthorize(t *testing.T) {
+	tokens, err := libToken.NewService(libToken.HMACKey("test", []byte("secret")))
+	require.NoError(t, err)
+	service := uuid.New()
+	keys := fakeKeys{"sle_00000001_read": {KeyId: uuid.New(), UserId: service, Scopes: []apikey.Scope{apikey.ScopeLoansRead}}}
+	r := authorizeRouter(t, tokens, keys)
+
+	serve := func(method, path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+	bearer := func(token string) map[string]string { return map[string]string{"Authorization": "Bearer " + token} }
+
+	// an API key in either header acts as its service account
+	rec := serve(http.MethodGet, "/loans", map[string]string{"X-API-Key": "sle_00000001_read"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), service.String())
+	assert.Contains(t, rec.Body.String(), `"role":"service"`)
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/loans", bearer("sle_00000001_read")).Code)
+
+	// scopes and roles not granted to the key are denied
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/repayments", bearer("sle_00000001_read")).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/approve", bearer("sle_00000001_read")).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/loans", bearer("sle_00000001_other")).Code)
+
+	// users pass scope checks by role
+	officer := tokens.GenerateToken(uuid.NewString(), string(user.RoleFieldOfficer), time.Now())
+	investor := tokens.GenerateToken(uuid.NewString(), string(user.RoleInvestor), time.Now())
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/loans", bearer(investor)).Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/repayments", bearer(officer)).Code)
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/repayments", bearer(investor)).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/loans", nil).Code)
+}
+
+func TestAuthorizeWithoutKeys(t *testing.T) {
+	tokens, err := libToken.NewService(libToken.HMACKey("test", []byte("secret")))
+	require.NoError(t, err)
+	r := authorizeRouter(t, tokens, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/loans", nil)
+	req.Header.Set("X-API-Key", "sle_00000001_read")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
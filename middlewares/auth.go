@@ -7,45 +7,61 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	libToken "github.com/zainulbr/simple-loan-engine/libs/token"
+	"github.com/zainulbr/simple-loan-engine/models/user"
 )
 
 const BEARER_SCHEMA = "Bearer"
 const contextClaimKey = "ctx.mw.auth.claim"
+const claimUserIdKey = "loan.user_id"
 
-func AuthorizeJWT() gin.HandlerFunc {
+// AuthorizeJWT verifies the bearer token of a request with tokens and exposes its claims
+func AuthorizeJWT(tokens libToken.TokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var tokenString string
-		authHeader := c.GetHeader("Authorization")
-		if authHeader != "" && strings.Contains(authHeader, BEARER_SCHEMA) {
-			tokenString = authHeader[len(BEARER_SCHEMA):]
-		}
-
-		if tokenString == "" {
-			tokenString, _ = c.Cookie("token")
-		}
-
-		if tokenString == "" {
-			tokenString = c.Query("token")
-		}
-		tokenString = strings.TrimSpace(tokenString)
-		// TBD passsing encrypted via setting
-		token, err := libToken.NewService().ValidateToken(tokenString)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, err.Error())
-			log.Println(err)
-			return
-		}
-
-		if token.Valid {
-			claims := token.Claims.(jwt.MapClaims)
-			c.Set(contextClaimKey, claims)
-		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, "Token invalid")
-		}
+		authorizeJWT(c, tokens, requestToken(c))
 	}
 }
 
+// requestToken reads the bearer token, then the token cookie, then the token query parameter
+func requestToken(c *gin.Context) string {
+	var tokenString string
+	authHeader := c.GetHeader("Authorization")
+	if authHeader != "" && strings.Contains(authHeader, BEARER_SCHEMA) {
+		tokenString = authHeader[len(BEARER_SCHEMA):]
+	}
+
+	if tokenString == "" {
+		tokenString, _ = c.Cookie("token")
+	}
+
+	if tokenString == "" {
+		tokenString = c.Query("token")
+	}
+	return strings.TrimSpace(tokenString)
+}
+
+func authorizeJWT(c *gin.Context, tokens libToken.TokenService, tokenString string) {
+	token, err := tokens.ValidateToken(tokenString)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, err.Error())
+		log.Println(err)
+		return
+	}
+
+	if token.Valid {
+		setClaims(c, token.Claims.(jwt.MapClaims))
+	} else {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, "Token invalid")
+	}
+}
+
+// setClaims exposes the caller to the handlers and, as actor, to the service layer
+func setClaims(c *gin.Context, claims jwt.MapClaims) {
+	c.Set(contextClaimKey, claims)
+	c.Request = c.Request.WithContext(user.ContextWithActor(c.Request.Context(), actorFromClaims(claims)))
+}
+
 func GetClaim(c *gin.Context) jwt.MapClaims {
 	out, ok := c.Get(contextClaimKey)
 	if !ok {
@@ -54,3 +70,14 @@ func GetClaim(c *gin.Context) jwt.MapClaims {
 
 	return out.(jwt.MapClaims)
 }
+
+func actorFromClaims(claims jwt.MapClaims) user.Actor {
+	actor := user.Actor{}
+	if v, ok := claims[claimUserIdKey].(string); ok {
+		actor.UserId, _ = uuid.Parse(v)
+	}
+	if v, ok := claims[claimRoleKey].(string); ok {
+		actor.Role = user.UserRole(v)
+	}
+	return actor
+}
@@ -1,7 +1,6 @@
 package middlewares
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,13 +9,12 @@ import (
 
 const claimRoleKey = "loan.role"
 
-// simple role validation
-func RolePermission(role user.UserRole) gin.HandlerFunc {
+// simple role validation, passes when the claim matches any of roles
+func RolePermission(roles ...user.UserRole) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		claims := GetClaim(c)
 
 		v, ok := claims[claimRoleKey]
-		fmt.Println(v)
 		if !ok {
 			c.AbortWithStatusJSON(http.StatusForbidden, ("Permission dined"))
 			return
@@ -27,11 +25,12 @@ func RolePermission(role user.UserRole) gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusForbidden, ("Permission dined"))
 			return
 		}
-		fmt.Println(vv, role)
 
-		if vv != string(role) {
-			c.AbortWithStatusJSON(http.StatusForbidden, ("Permission dined"))
-			return
+		for _, role := range roles {
+			if vv == string(role) {
+				return
+			}
 		}
+		c.AbortWithStatusJSON(http.StatusForbidden, ("Permission dined"))
 	}
 }
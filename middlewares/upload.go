@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartMemory is the part of a multipart form kept in memory, larger
+// files are streamed to temporary files while the form is read
+const multipartMemory = 1 << 20
+
+// MaxBodySize rejects request bodies larger than limit bytes with 413, zero disables the limit.
+// Multipart forms are parsed here so the limit is enforced while the upload streams in,
+// handlers read the parsed form as usual.
+func MaxBodySize(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			return
+		}
+
+		// declared sizes are refused before anything is read
+		if c.Request.ContentLength > limit {
+			abortTooLarge(c, limit)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+
+		if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			return
+		}
+		if err := c.Request.ParseMultipartForm(multipartMemory); err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				abortTooLarge(c, limit)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid multipart form: " + err.Error()})
+		}
+	}
+}
+
+func abortTooLarge(c *gin.Context, limit int64) {
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error": "request body exceeds the maximum upload size",
+		"limit": limit,
+	})
+}
@@ -0,0 +1,79 @@
+package middlewares
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func multipartBody(t *testing.T, size int) (*bytes.Buffer, string) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	part, err := w.CreateFormFile("files", "photo.jpg")
+	assert.NoError(t, err)
+	_, err = part.Write(bytes.Repeat([]byte{'x'}, size))
+	assert.NoError(t, err)
+	assert.NoError(t, w.WriteField("comment", "visited"))
+	assert.NoError(t, w.Close())
+	return body, w.FormDataContentType()
+}
+
+func uploadRouter(limit int64) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/upload", MaxBodySize(limit), func(c *gin.Context) {
+		header, err := c.FormFile("files")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"size": header.Size, "comment": c.PostForm("comment")})
+	})
+	return r
+}
+
+func TestMaxBodySize(t *testing.T) {
+	r := uploadRouter(4 << 10)
+
+	body, contentType := multipartBody(t, 1<<10)
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"comment":"visited"`)
+
+	// declared length above the limit
+	body, contentType = multipartBody(t, 8<<10)
+	req = httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	// chunked upload without a length is cut off while streaming
+	body, contentType = multipartBody(t, 8<<10)
+	req = httptest.NewRequest(http.MethodPost, "/upload", io.MultiReader(body))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", contentType)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestMaxBodySizeDisabled(t *testing.T) {
+	r := uploadRouter(0)
+
+	body, contentType := multipartBody(t, 8<<10)
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS loan.disbursments;
+DROP TABLE IF EXISTS loan.investments;
+DROP TABLE IF EXISTS loan.approvals;
+DROP TABLE IF EXISTS loan.loans;
+DROP TABLE IF EXISTS file.files;
+DROP TABLE IF EXISTS "user".users;
+
+DROP TYPE IF EXISTS "user".user_role;
+DROP TYPE IF EXISTS loan.loan_state;
@@ -3,8 +3,20 @@ CREATE schema if not EXISTS "user";
 CREATE schema if not EXISTS loan;
 CREATE schema if not EXISTS "file";
 
-CREATE  TYPE loan.loan_state AS ENUM ('proposed', 'approved', 'invested', 'disbursed', 'rejected');
-CREATE  TYPE "user".user_role AS ENUM ('admin', 'investor', 'borrower', 'field_validator','field_officer');
+-- Types are created only once, databases set up from the former ddl scripts
+-- already have them
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace
+                 WHERE n.nspname = 'loan' AND t.typname = 'loan_state') THEN
+    CREATE TYPE loan.loan_state AS ENUM ('proposed', 'approved', 'invested', 'disbursed', 'rejected');
+  END IF;
+  IF NOT EXISTS (SELECT 1 FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace
+                 WHERE n.nspname = 'user' AND t.typname = 'user_role') THEN
+    CREATE TYPE "user".user_role AS ENUM ('admin', 'investor', 'borrower', 'field_validator','field_officer');
+  END IF;
+END
+$$;
 
 CREATE TABLE IF NOT EXISTS "user".users (
   user_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -65,7 +77,5 @@ CREATE TABLE IF NOT EXISTS loan.disbursments (
   updated_at timestamp default current_timestamp
 );
 
-ALTER TABLE loan.investments ADD CONSTRAINT check_total_investment
-CHECK 
-    ((SELECT SUM(amount) FROM loan.investment WHERE loan_id = loan.investment.loan_id) 
-    <= (SELECT amount FROM loan.loans WHERE loan_id = loan.investment.loan_id));
+-- The total investment of a loan can not exceed its amount, a CHECK constraint
+-- can not query other rows so it is enforced by the trigger of 002_investment_total
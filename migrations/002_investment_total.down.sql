@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS enforce_total_investment ON loan.investments;
+DROP FUNCTION IF EXISTS check_total_investment();
@@ -1,3 +1,5 @@
+-- The 'cancelled' loan state stays, postgres can not drop enum values
+
 CREATE OR REPLACE FUNCTION check_total_investment()
 RETURNS TRIGGER AS $$
 DECLARE
@@ -29,7 +31,5 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql;
 
-CREATE TRIGGER enforce_total_investment
-BEFORE INSERT OR UPDATE ON loan.investments
-FOR EACH ROW
-EXECUTE FUNCTION check_total_investment();
\ No newline at end of file
+ALTER TABLE loan.investments DROP COLUMN IF EXISTS voided_at;
+DROP TABLE IF EXISTS loan.loan_changes;
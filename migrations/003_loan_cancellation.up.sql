@@ -0,0 +1,52 @@
+ALTER TYPE loan.loan_state ADD VALUE IF NOT EXISTS 'cancelled';
+
+-- Field level change history of a loan
+CREATE TABLE IF NOT EXISTS loan.loan_changes (
+  change_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  loan_id UUID not null REFERENCES loan.loans (loan_id),
+  field varchar not null,
+  old_value varchar,
+  new_value varchar,
+  reason varchar,
+  changed_by UUID not null REFERENCES "user".users (user_id),
+  created_at timestamp default current_timestamp
+);
+
+-- Investments of a cancelled loan are kept but voided
+ALTER TABLE loan.investments ADD COLUMN IF NOT EXISTS voided_at timestamp;
+
+CREATE OR REPLACE FUNCTION check_total_investment()
+RETURNS TRIGGER AS $$
+DECLARE
+    total_investment INT;
+    loan_amount INT;
+BEGIN
+    -- Voiding an investment does not need the funding check
+    IF NEW.voided_at IS NOT NULL THEN
+        RETURN NEW;
+    END IF;
+
+    -- Ambil total investasi yang sudah ada + investasi baru
+    SELECT COALESCE(SUM(amount), 0) + NEW.amount INTO total_investment
+    FROM loan.investments
+    WHERE loan_id = NEW.loan_id AND voided_at IS NULL;
+
+    -- Ambil amount dari loan
+    SELECT amount INTO loan_amount
+    FROM loan.loans
+    WHERE loan_id = NEW.loan_id;
+
+    -- Jika total investasi melebihi loan amount, batalkan transaksi
+    IF total_investment > loan_amount THEN
+        RAISE EXCEPTION 'Total investment exceeds loan amount';
+    END IF;
+
+    if total_investment = loan_amount THEN
+        UPDATE loan.loans
+        SET state = 'invested'
+        WHERE loan_id = NEW.loan_id;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
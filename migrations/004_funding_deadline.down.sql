@@ -0,0 +1,3 @@
+-- The 'expired' loan state stays, postgres can not drop enum values
+DROP INDEX IF EXISTS loan.loans_funding_deadline_idx;
+ALTER TABLE loan.loans DROP COLUMN IF EXISTS funding_deadline;
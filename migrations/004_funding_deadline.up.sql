@@ -0,0 +1,7 @@
+ALTER TYPE loan.loan_state ADD VALUE IF NOT EXISTS 'expired';
+
+ALTER TABLE loan.loans ADD COLUMN IF NOT EXISTS funding_deadline timestamp;
+CREATE INDEX IF NOT EXISTS loans_funding_deadline_idx ON loan.loans (funding_deadline) WHERE state = 'approved';
+
+-- System changes such as expiry have no user
+ALTER TABLE loan.loan_changes ALTER COLUMN changed_by DROP NOT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS loan.investments_invested_by_idx;
+DROP TABLE IF EXISTS loan.repayments;
@@ -0,0 +1,13 @@
+-- Borrower repayments, investors receive payouts pro rata of their investment
+CREATE TABLE IF NOT EXISTS loan.repayments (
+  repayment_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  loan_id UUID not null REFERENCES loan.loans (loan_id),
+  principal float not null default 0,
+  interest float not null default 0,
+  paid_at timestamp not null,
+  created_at timestamp default current_timestamp,
+  updated_at timestamp default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS repayments_loan_id_idx ON loan.repayments (loan_id);
+CREATE INDEX IF NOT EXISTS investments_invested_by_idx ON loan.investments (invested_by);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS loan.loans_proposed_by_idx;
+ALTER TABLE loan.disbursments DROP COLUMN IF EXISTS disbursed_file;
@@ -0,0 +1,4 @@
+-- Signed agreement / disbursement proof uploaded on disbursement
+ALTER TABLE loan.disbursments ADD COLUMN IF NOT EXISTS disbursed_file UUID REFERENCES file.files (file_id);
+
+CREATE INDEX IF NOT EXISTS loans_proposed_by_idx ON loan.loans (proposed_by);
@@ -0,0 +1,6 @@
+ALTER TABLE loan.repayments DROP COLUMN IF EXISTS recorded_by;
+ALTER TABLE loan.repayments DROP COLUMN IF EXISTS platform_fee;
+ALTER TABLE loan.repayments DROP COLUMN IF EXISTS investor_interest;
+ALTER TABLE loan.investments DROP COLUMN IF EXISTS roi;
+ALTER TABLE loan.loans DROP COLUMN IF EXISTS fee_rule;
+ALTER TABLE loan.loans DROP COLUMN IF EXISTS roi;
@@ -0,0 +1,9 @@
+-- Investor ROI set at approval, snapshot on each investment
+ALTER TABLE loan.loans ADD COLUMN IF NOT EXISTS roi float;
+ALTER TABLE loan.loans ADD COLUMN IF NOT EXISTS fee_rule jsonb;
+ALTER TABLE loan.investments ADD COLUMN IF NOT EXISTS roi float;
+
+-- Split of each borrower interest payment
+ALTER TABLE loan.repayments ADD COLUMN IF NOT EXISTS investor_interest float;
+ALTER TABLE loan.repayments ADD COLUMN IF NOT EXISTS platform_fee float;
+ALTER TABLE loan.repayments ADD COLUMN IF NOT EXISTS recorded_by UUID REFERENCES "user".users (user_id);
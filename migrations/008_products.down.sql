@@ -0,0 +1,2 @@
+ALTER TABLE loan.loans DROP COLUMN IF EXISTS product_id;
+DROP TABLE IF EXISTS loan.products;
@@ -0,0 +1,20 @@
+-- Loan product catalog, durations / fee rule / required documents are stored as json
+CREATE TABLE IF NOT EXISTS loan.products (
+  product_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  code varchar not null unique,
+  name varchar not null,
+  description varchar,
+  min_amount float not null default 0,
+  max_amount float not null,
+  durations jsonb not null,
+  min_rate float not null default 0,
+  max_rate float not null,
+  interest_method varchar not null default 'flat',
+  fee_rule jsonb not null,
+  required_documents jsonb,
+  active boolean not null default true,
+  created_at timestamp default current_timestamp,
+  updated_at timestamp default current_timestamp
+);
+
+ALTER TABLE loan.loans ADD COLUMN IF NOT EXISTS product_id UUID REFERENCES loan.products (product_id);
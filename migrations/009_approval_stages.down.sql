@@ -0,0 +1,11 @@
+-- The 'credit_officer' role stays, postgres can not drop enum values
+DROP INDEX IF EXISTS loan.approvals_loan_approver_key;
+DROP INDEX IF EXISTS loan.approvals_loan_stage_key;
+
+ALTER TABLE loan.approvals DROP COLUMN IF EXISTS rate;
+ALTER TABLE loan.approvals DROP COLUMN IF EXISTS comment;
+ALTER TABLE loan.approvals DROP COLUMN IF EXISTS approval_date;
+ALTER TABLE loan.approvals DROP COLUMN IF EXISTS stage;
+
+ALTER TABLE loan.loans DROP COLUMN IF EXISTS approval_chain;
+ALTER TABLE loan.products DROP COLUMN IF EXISTS approval_chain;
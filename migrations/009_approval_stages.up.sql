@@ -0,0 +1,19 @@
+-- Multi-stage maker-checker approval
+ALTER TYPE "user".user_role ADD VALUE IF NOT EXISTS 'credit_officer';
+
+-- Approval chain configured per product, snapshot on each loan at proposal
+ALTER TABLE loan.products ADD COLUMN IF NOT EXISTS approval_chain jsonb;
+ALTER TABLE loan.loans ADD COLUMN IF NOT EXISTS approval_chain jsonb;
+
+-- One row per approval stage
+ALTER TABLE loan.approvals ADD COLUMN IF NOT EXISTS stage varchar;
+ALTER TABLE loan.approvals ADD COLUMN IF NOT EXISTS approval_date timestamp;
+ALTER TABLE loan.approvals ADD COLUMN IF NOT EXISTS comment varchar;
+ALTER TABLE loan.approvals ADD COLUMN IF NOT EXISTS rate float;
+
+-- Approvals recorded before stages existed were a single field visit
+UPDATE loan.approvals SET stage = 'field_visit' WHERE stage IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS approvals_loan_stage_key ON loan.approvals (loan_id, stage);
+-- The same user must not approve two stages of a loan
+CREATE UNIQUE INDEX IF NOT EXISTS approvals_loan_approver_key ON loan.approvals (loan_id, approved_by);
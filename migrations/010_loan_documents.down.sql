@@ -0,0 +1,2 @@
+-- The single file columns kept by this migration still hold the first document
+DROP TABLE IF EXISTS loan.documents;
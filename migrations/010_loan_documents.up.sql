@@ -0,0 +1,32 @@
+-- Files attached to a loan, optionally through an approval stage or a disbursement
+CREATE TABLE IF NOT EXISTS loan.documents (
+  document_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  loan_id UUID not null REFERENCES loan.loans (loan_id),
+  file_id UUID not null REFERENCES file.files (file_id),
+  document_type varchar not null,
+  approval_id UUID REFERENCES loan.approvals (approval_id),
+  disbursement_id UUID REFERENCES loan.disbursments (disbursment_id),
+  uploaded_by UUID REFERENCES "user".users (user_id),
+  created_at timestamp default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS documents_loan_id_idx ON loan.documents (loan_id);
+
+-- Backfill the single file columns
+INSERT INTO loan.documents (loan_id, file_id, document_type, approval_id, uploaded_by, created_at)
+SELECT a.loan_id, a.visited_file, 'visited_photo', a.approval_id, a.approved_by, a.created_at
+FROM loan.approvals a
+WHERE a.visited_file IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM loan.documents d WHERE d.approval_id = a.approval_id AND d.file_id = a.visited_file);
+
+INSERT INTO loan.documents (loan_id, file_id, document_type, disbursement_id, uploaded_by, created_at)
+SELECT d.loan_id, d.disbursed_file, 'disbursement_proof', d.disbursment_id, d.disbursment_by, d.created_at
+FROM loan.disbursments d
+WHERE d.disbursed_file IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM loan.documents x WHERE x.disbursement_id = d.disbursment_id AND x.file_id = d.disbursed_file);
+
+INSERT INTO loan.documents (loan_id, file_id, document_type)
+SELECT l.loan_id, l.aggrement_file, 'agreement'
+FROM loan.loans l
+WHERE l.aggrement_file IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM loan.documents x WHERE x.loan_id = l.loan_id AND x.file_id = l.aggrement_file);
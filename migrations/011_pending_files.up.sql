@@ -0,0 +1,5 @@
+-- Uploads are pending until the loan action using them commits,
+-- pending files older than FILE_PENDING_TTL are removed by the file gc
+ALTER TABLE file.files ADD COLUMN IF NOT EXISTS status varchar not null default 'committed';
+
+CREATE INDEX IF NOT EXISTS files_pending_idx ON file.files (created_at) WHERE status = 'pending';
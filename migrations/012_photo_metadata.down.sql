@@ -0,0 +1,6 @@
+ALTER TABLE loan.approvals DROP COLUMN IF EXISTS warnings;
+
+ALTER TABLE file.files DROP COLUMN IF EXISTS thumbnail_location;
+ALTER TABLE file.files DROP COLUMN IF EXISTS longitude;
+ALTER TABLE file.files DROP COLUMN IF EXISTS latitude;
+ALTER TABLE file.files DROP COLUMN IF EXISTS captured_at;
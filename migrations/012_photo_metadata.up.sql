@@ -0,0 +1,8 @@
+-- EXIF capture time and GPS position of uploaded photos, and their thumbnail
+ALTER TABLE file.files ADD COLUMN IF NOT EXISTS captured_at timestamptz;
+ALTER TABLE file.files ADD COLUMN IF NOT EXISTS latitude float;
+ALTER TABLE file.files ADD COLUMN IF NOT EXISTS longitude float;
+ALTER TABLE file.files ADD COLUMN IF NOT EXISTS thumbnail_location varchar;
+
+-- Visit photos not matching the approval date
+ALTER TABLE loan.approvals ADD COLUMN IF NOT EXISTS warnings jsonb;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS file.files_sha256_idx;
+ALTER TABLE file.files DROP COLUMN IF EXISTS sha256;
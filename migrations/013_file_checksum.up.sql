@@ -0,0 +1,4 @@
+-- SHA-256 of the file content, used for deduplication and tamper evidence
+ALTER TABLE file.files ADD COLUMN IF NOT EXISTS sha256 varchar(64);
+
+CREATE INDEX IF NOT EXISTS files_sha256_idx ON file.files (sha256);
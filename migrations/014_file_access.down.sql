@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS file.access_logs;
+ALTER TABLE file.files DROP COLUMN IF EXISTS uploaded_by;
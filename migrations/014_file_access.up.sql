@@ -0,0 +1,15 @@
+-- Uploader of a file, unlinked files are only readable by them and admins
+ALTER TABLE file.files ADD COLUMN IF NOT EXISTS uploaded_by UUID REFERENCES "user".users (user_id);
+
+-- Every request to read a file, granted or not
+CREATE TABLE IF NOT EXISTS file.access_logs (
+  log_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  file_id UUID NOT NULL REFERENCES file.files (file_id) ON DELETE CASCADE,
+  user_id UUID REFERENCES "user".users (user_id),
+  role "user".user_role,
+  action varchar NOT NULL,
+  granted boolean NOT NULL,
+  created_at timestamp default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS access_logs_file_idx ON file.access_logs (file_id, created_at);
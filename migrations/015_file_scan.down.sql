@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS file.files_quarantined_idx;
+ALTER TABLE file.files DROP COLUMN IF EXISTS scanned_at;
+ALTER TABLE file.files DROP COLUMN IF EXISTS scan_signature;
+ALTER TABLE file.files DROP COLUMN IF EXISTS scan_status;
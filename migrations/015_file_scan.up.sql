@@ -0,0 +1,7 @@
+-- Malware scan verdict of uploads, only clean files are served.
+-- Files stored before scanning keep a NULL status.
+ALTER TABLE file.files ADD COLUMN IF NOT EXISTS scan_status varchar;
+ALTER TABLE file.files ADD COLUMN IF NOT EXISTS scan_signature varchar;
+ALTER TABLE file.files ADD COLUMN IF NOT EXISTS scanned_at timestamptz;
+
+CREATE INDEX IF NOT EXISTS files_quarantined_idx ON file.files (created_at) WHERE scan_status = 'quarantined';
@@ -0,0 +1,3 @@
+-- The 'service' role stays, postgres can not drop enum values
+DROP INDEX IF EXISTS "user".api_keys_user_idx;
+DROP TABLE IF EXISTS "user".api_keys;
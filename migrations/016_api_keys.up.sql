@@ -0,0 +1,20 @@
+-- Service accounts call the API with keys instead of user tokens
+ALTER TYPE "user".user_role ADD VALUE IF NOT EXISTS 'service';
+
+-- Only the sha256 of a key is stored, the prefix identifies it
+CREATE TABLE IF NOT EXISTS "user".api_keys (
+  key_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES "user".users (user_id),
+  name varchar NOT NULL,
+  prefix varchar NOT NULL UNIQUE,
+  hash varchar NOT NULL,
+  scopes jsonb NOT NULL,
+  expires_at timestamptz,
+  last_used_at timestamptz,
+  revoked_at timestamptz,
+  created_by UUID REFERENCES "user".users (user_id),
+  created_at timestamptz default current_timestamp,
+  updated_at timestamptz default current_timestamp
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_idx ON "user".api_keys (user_id);
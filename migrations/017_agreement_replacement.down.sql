@@ -0,0 +1 @@
+ALTER TABLE loan.documents DROP COLUMN IF EXISTS replaced_by;
@@ -0,0 +1,2 @@
+-- A regenerated agreement replaces the current one, the replaced file stays verifiable
+ALTER TABLE loan.documents ADD COLUMN IF NOT EXISTS replaced_by UUID REFERENCES file.files (file_id);
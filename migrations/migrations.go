@@ -0,0 +1,11 @@
+// Package migrations embeds the numbered schema migrations applied by
+// `loan-engine migrate`. Each version has a NNN_name.up.sql and a
+// NNN_name.down.sql file, new ones are created with `loan-engine migrate create`.
+package migrations
+
+import "embed"
+
+// FS holds the migration files
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,140 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidAPIKey  = errors.New("api key is invalid")
+	ErrAPIKeyRevoked  = errors.New("api key is revoked")
+	ErrAPIKeyExpired  = errors.New("api key is expired")
+	ErrInvalidScope   = errors.New("unknown api key scope")
+	ErrNoScopes       = errors.New("at least one scope is required")
+)
+
+// Scope is an operation an API key may perform, resource:action
+type Scope string
+
+const (
+	ScopeLoansRead       Scope = "loans:read"
+	ScopeRepaymentsWrite Scope = "repayments:write"
+	ScopeProductsRead    Scope = "products:read"
+)
+
+// Scopes lists every scope a key may be granted
+var Scopes = []Scope{
+	ScopeLoansRead,
+	ScopeRepaymentsWrite,
+	ScopeProductsRead,
+}
+
+// keyPrefix starts every API key so it is recognised in headers and by secret scanners
+const keyPrefix = "sle"
+
+// APIKey authenticates a service account, only the hash of the secret is stored
+type APIKey struct {
+	KeyId      uuid.UUID  `json:"key_id,omitempty"`
+	UserId     uuid.UUID  `json:"user_id"` // service account the key acts as
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // public part identifying the key, e.g. sle_3f9a1c2b
+	Hash       string     `json:"-"`      // sha256 of the full key
+	Scopes     []Scope    `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy  uuid.UUID  `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at,omitempty"`
+}
+
+// ValidateScopes checks every scope is known
+func ValidateScopes(scopes []Scope) error {
+	if len(scopes) == 0 {
+		return ErrNoScopes
+	}
+	for _, s := range scopes {
+		known := false
+		for _, k := range Scopes {
+			known = known || s == k
+		}
+		if !known {
+			return fmt.Errorf("%w: %s", ErrInvalidScope, s)
+		}
+	}
+	return nil
+}
+
+// HasScope reports whether the key was granted scope
+func (k *APIKey) HasScope(scope Scope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns why the key may not be used at now, nil when it may
+func (k *APIKey) Check(now time.Time) error {
+	if k.RevokedAt != nil {
+		return ErrAPIKeyRevoked
+	}
+	if k.ExpiresAt != nil && !now.Before(*k.ExpiresAt) {
+		return ErrAPIKeyExpired
+	}
+	return nil
+}
+
+// Generate returns a new secret key of the form sle_<prefix>_<secret> and sets
+// the prefix and hash of k, the secret is only known to the caller
+func (k *APIKey) Generate() (string, error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	k.Prefix = keyPrefix + "_" + hex.EncodeToString(id)
+	key := k.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	k.Hash = Hash(key)
+	return key, nil
+}
+
+// Matches compares key to the stored hash in constant time
+func (k *APIKey) Matches(key string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(key)), []byte(k.Hash)) == 1
+}
+
+// Hash is the stored form of a key, keys are random so a fast hash is enough
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsKey reports whether s looks like an API key rather than a JWT
+func IsKey(s string) bool {
+	return strings.HasPrefix(s, keyPrefix+"_")
+}
+
+// ParsePrefix returns the prefix identifying the key
+func ParsePrefix(key string) (string, error) {
+	parts := strings.SplitN(key, "_", 3) // the secret may contain _
+	if len(parts) != 3 || parts[0] != keyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", ErrInvalidAPIKey
+	}
+	return parts[0] + "_" + parts[1], nil
+}
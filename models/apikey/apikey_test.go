@@ -0,0 +1,66 @@
+package apikey
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	k := &APIKey{}
+	key, err := k.Generate()
+	require.NoError(t, err)
+
+	assert.True(t, IsKey(key))
+	assert.Regexp(t, `^sle_[0-9a-f]{8}$`, k.Prefix)
+	assert.NotContains(t, k.Hash, key)
+
+	prefix, err := ParsePrefix(key)
+	require.NoError(t, err)
+	assert.Equal(t, k.Prefix, prefix)
+
+	assert.True(t, k.Matches(key))
+	assert.False(t, k.Matches(key+"x"))
+
+	// the base64url secret may contain the separator
+	assert.True(t, (&APIKey{Hash: Hash("sle_00ff00ff_a_b-c")}).Matches("sle_00ff00ff_a_b-c"))
+	prefix, err = ParsePrefix("sle_00ff00ff_a_b-c")
+	require.NoError(t, err)
+	assert.Equal(t, "sle_00ff00ff", prefix)
+
+	other := &APIKey{}
+	otherKey, err := other.Generate()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, otherKey)
+	assert.NotEqual(t, k.Prefix, other.Prefix)
+}
+
+func TestParsePrefix(t *testing.T) {
+	for _, key := range []string{"", "sle_", "sle_abc", "sle__secret", "pk_abc_secret", "eyJhbGciOi.eyJsb2Fu.sig"} {
+		_, err := ParsePrefix(key)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey, key)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	assert.NoError(t, (&APIKey{}).Check(now))
+	assert.NoError(t, (&APIKey{ExpiresAt: &future}).Check(now))
+	assert.ErrorIs(t, (&APIKey{ExpiresAt: &past}).Check(now), ErrAPIKeyExpired)
+	assert.ErrorIs(t, (&APIKey{ExpiresAt: &now}).Check(now), ErrAPIKeyExpired)
+	assert.ErrorIs(t, (&APIKey{RevokedAt: &past, ExpiresAt: &future}).Check(now), ErrAPIKeyRevoked)
+}
+
+func TestScopes(t *testing.T) {
+	assert.NoError(t, ValidateScopes([]Scope{ScopeLoansRead, ScopeRepaymentsWrite}))
+	assert.ErrorIs(t, ValidateScopes(nil), ErrNoScopes)
+	assert.ErrorIs(t, ValidateScopes([]Scope{"loans:delete"}), ErrInvalidScope)
+
+	k := &APIKey{Scopes: []Scope{ScopeRepaymentsWrite}}
+	assert.True(t, k.HasScope(ScopeRepaymentsWrite))
+	assert.False(t, k.HasScope(ScopeLoansRead))
+}
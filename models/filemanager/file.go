@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/user"
 )
 
 type LocationType string
@@ -11,12 +12,75 @@ type LocationType string
 const LocationTypeS3 LocationType = "s3"
 const LocationTypeLocal LocationType = "local"
 
+// Status of a file record, uploads stay pending until the loan action using them commits
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusCommitted Status = "committed"
+)
+
+// ScanStatus is the malware scan verdict of a file, only clean files are served.
+// Files stored before scanning was introduced have no status.
+type ScanStatus string
+
+const (
+	ScanPending     ScanStatus = "pending"     // stored, verdict not known yet
+	ScanClean       ScanStatus = "clean"       // no malware found
+	ScanFailed      ScanStatus = "failed"      // the scanner gave no verdict
+	ScanQuarantined ScanStatus = "quarantined" // malware found, moved out of the upload directory
+)
+
+// Servable reports whether a file with this status may be served
+func (s ScanStatus) Servable() bool {
+	return s == ScanClean || s == ""
+}
+
 type File struct {
 	FileID       uuid.UUID    `json:"file_id"`
 	Label        string       `json:"label"`
 	Location     string       `json:"location"`
 	LocationType LocationType `json:"location_type"`
 	FileType     string       `json:"file_type"`
-	CreatedAt    time.Time    `json:"created_at"`
-	UpdatedAt    time.Time    `json:"updated_at"`
+	Status       Status       `json:"status"`
+	Sha256       string       `json:"sha256,omitempty"` // Content digest, files served must still match it
+	UploadedBy   uuid.UUID    `json:"uploaded_by,omitempty"`
+	// Malware scan verdict, the signature names the malware found
+	ScanStatus    ScanStatus `json:"scan_status,omitempty"`
+	ScanSignature string     `json:"scan_signature,omitempty"`
+	ScannedAt     *time.Time `json:"scanned_at,omitempty"`
+	// EXIF capture time and GPS position of uploaded photos, proof of a field visit
+	CapturedAt        *time.Time `json:"captured_at,omitempty"`
+	Latitude          *float64   `json:"latitude,omitempty"`
+	Longitude         *float64   `json:"longitude,omitempty"`
+	ThumbnailLocation string     `json:"-"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// Verification is the result of checking a file against the digest we issued
+type Verification struct {
+	FileID   uuid.UUID `json:"file_id"`
+	Match    bool      `json:"match"`  // the given digest is the one recorded at upload
+	Intact   bool      `json:"intact"` // the stored content still has the recorded digest
+	IssuedAt time.Time `json:"issued_at"`
+}
+
+// AccessAction is the way a file was requested
+type AccessAction string
+
+const (
+	AccessPreview   AccessAction = "preview"
+	AccessThumbnail AccessAction = "thumbnail"
+)
+
+// AccessLog records who requested which file and whether it was served
+type AccessLog struct {
+	LogId     uuid.UUID     `json:"log_id,omitempty"`
+	FileId    uuid.UUID     `json:"file_id"`
+	UserId    uuid.UUID     `json:"user_id"`
+	Role      user.UserRole `json:"role"`
+	Action    AccessAction  `json:"action"`
+	Granted   bool          `json:"granted"`
+	CreatedAt time.Time     `json:"created_at,omitempty"`
 }
@@ -0,0 +1,53 @@
+package loan
+
+import (
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+)
+
+// DocumentLink is a loan a file is attached to, as seen by the requesting user
+type DocumentLink struct {
+	LoanId       uuid.UUID    `json:"loan_id"`
+	DocumentType DocumentType `json:"document_type"`
+	ProposedBy   uuid.UUID    `json:"proposed_by"`
+	Investor     bool         `json:"investor"` // requesting user holds a non voided investment in the loan
+}
+
+// staffDocumentTypes lists the document types each staff role may open
+var staffDocumentTypes = map[user.UserRole][]DocumentType{
+	user.RoleFiledValidator: {DocumentVisitedPhoto, DocumentSignedForm, DocumentSupporting},
+	user.RoleCreditOfficer:  DocumentTypes,
+	user.RoleFieldOfficer:   DocumentTypes,
+}
+
+// CanAccessFile reports whether actor may open a file uploaded by uploadedBy
+// and attached to the given loans. Unlinked files are visible to the uploader
+// and admins only.
+func CanAccessFile(uploadedBy uuid.UUID, links []DocumentLink, actor user.Actor) bool {
+	if actor.Role == user.RoleAdmin {
+		return true
+	}
+	if uploadedBy != uuid.Nil && uploadedBy == actor.UserId {
+		return true
+	}
+
+	for _, link := range links {
+		switch actor.Role {
+		case user.RoleBorrower:
+			if link.ProposedBy == actor.UserId {
+				return true
+			}
+		case user.RoleInvestor:
+			if link.Investor && link.DocumentType == DocumentAgreement {
+				return true
+			}
+		default:
+			for _, t := range staffDocumentTypes[actor.Role] {
+				if t == link.DocumentType {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package loan
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+)
+
+func TestCanAccessFile(t *testing.T) {
+	uploader := user.Actor{UserId: uuid.New(), Role: user.RoleFiledValidator}
+	borrower := user.Actor{UserId: uuid.New(), Role: user.RoleBorrower}
+	otherBorrower := user.Actor{UserId: uuid.New(), Role: user.RoleBorrower}
+	investor := user.Actor{UserId: uuid.New(), Role: user.RoleInvestor}
+	validator := user.Actor{UserId: uuid.New(), Role: user.RoleFiledValidator}
+	officer := user.Actor{UserId: uuid.New(), Role: user.RoleFieldOfficer}
+	admin := user.Actor{UserId: uuid.New(), Role: user.RoleAdmin}
+
+	// unlinked files
+	assert.True(t, CanAccessFile(uploader.UserId, nil, uploader))
+	assert.True(t, CanAccessFile(uploader.UserId, nil, admin))
+	assert.False(t, CanAccessFile(uploader.UserId, nil, validator))
+	assert.False(t, CanAccessFile(uuid.Nil, nil, user.Actor{Role: user.RoleBorrower}))
+
+	photo := []DocumentLink{{LoanId: uuid.New(), DocumentType: DocumentVisitedPhoto, ProposedBy: borrower.UserId}}
+	assert.True(t, CanAccessFile(uploader.UserId, photo, borrower))
+	assert.False(t, CanAccessFile(uploader.UserId, photo, otherBorrower))
+	assert.True(t, CanAccessFile(uploader.UserId, photo, validator))
+	assert.True(t, CanAccessFile(uploader.UserId, photo, officer))
+	assert.False(t, CanAccessFile(uploader.UserId, photo, investor))
+
+	agreement := []DocumentLink{{LoanId: uuid.New(), DocumentType: DocumentAgreement, ProposedBy: borrower.UserId}}
+	assert.False(t, CanAccessFile(uuid.Nil, agreement, investor))
+	assert.False(t, CanAccessFile(uuid.Nil, agreement, validator))
+	assert.True(t, CanAccessFile(uuid.Nil, agreement, officer))
+
+	agreement[0].Investor = true
+	assert.True(t, CanAccessFile(uuid.Nil, agreement, investor))
+}
@@ -0,0 +1,172 @@
+package loan
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+)
+
+var (
+	ErrDuplicateApprover = errors.New("the same user can not approve two stages of a loan")
+	ErrApprovalComplete  = errors.New("all approval stages are already passed")
+	ErrVisitRequired     = errors.New("visited_file is required for this approval stage")
+	ErrRateRequired      = errors.New("rate is required before the final approval stage")
+	ErrApprovalStarted   = errors.New("loan can not be edited once an approval stage is signed off")
+)
+
+// ApprovalStage is one maker-checker step of a loan approval chain
+type ApprovalStage struct {
+	Name         string        `json:"name"`
+	Role         user.UserRole `json:"role"`
+	MinAmount    float64       `json:"min_amount,omitempty"`    // stage only applies to loans from this amount
+	RequireVisit bool          `json:"require_visit,omitempty"` // stage must attach a visited location file
+}
+
+// ApprovalChain lists the stages a loan passes, in order, before it is approved
+type ApprovalChain []ApprovalStage
+
+// DefaultApprovalChain is a single field visit by a field validator
+var DefaultApprovalChain = ApprovalChain{
+	{Name: "field_visit", Role: user.RoleFiledValidator, RequireVisit: true},
+}
+
+// Validate checks the chain has at least one stage, unique stage names and staff roles
+func (c ApprovalChain) Validate() error {
+	if len(c) == 0 {
+		return errors.New("approval chain requires at least one stage")
+	}
+
+	names := make(map[string]bool, len(c))
+	for _, stage := range c {
+		if stage.Name == "" {
+			return errors.New("approval stage name is required")
+		}
+		if names[stage.Name] {
+			return fmt.Errorf("duplicate approval stage: %s", stage.Name)
+		}
+		names[stage.Name] = true
+
+		switch stage.Role {
+		case user.RoleFiledValidator, user.RoleCreditOfficer, user.RoleAdmin:
+		default:
+			return fmt.Errorf("role %q can not approve stage %s", stage.Role, stage.Name)
+		}
+		if stage.MinAmount < 0 {
+			return fmt.Errorf("invalid min_amount for stage %s", stage.Name)
+		}
+	}
+
+	// the first stage always applies, otherwise small loans would skip approval
+	if c[0].MinAmount > 0 {
+		return errors.New("the first approval stage can not have a min_amount")
+	}
+	return nil
+}
+
+// Stages returns the stages applicable to a loan of amount
+func (c ApprovalChain) Stages(amount float64) ApprovalChain {
+	stages := ApprovalChain{}
+	for _, stage := range c {
+		if amount >= stage.MinAmount {
+			stages = append(stages, stage)
+		}
+	}
+	return stages
+}
+
+// Next returns the first applicable stage without an approval
+func (c ApprovalChain) Next(amount float64, approvals []LoanApproval) (ApprovalStage, bool) {
+	passed := make(map[string]bool, len(approvals))
+	for _, a := range approvals {
+		passed[a.Stage] = true
+	}
+
+	for _, stage := range c.Stages(amount) {
+		if !passed[stage.Name] {
+			return stage, true
+		}
+	}
+	return ApprovalStage{}, false
+}
+
+// Check returns the stage the actor may approve next and whether it is the final stage
+func (c ApprovalChain) Check(amount float64, approvals []LoanApproval, actor user.Actor) (ApprovalStage, bool, error) {
+	stage, ok := c.Next(amount, approvals)
+	if !ok {
+		return ApprovalStage{}, false, ErrApprovalComplete
+	}
+
+	if actor.Role != stage.Role {
+		return ApprovalStage{}, false, fmt.Errorf("%w: stage %s requires %s", ErrActionNotPermitted, stage.Name, stage.Role)
+	}
+
+	for _, a := range approvals {
+		if a.ApprovedBy == actor.UserId {
+			return ApprovalStage{}, false, ErrDuplicateApprover
+		}
+	}
+
+	stages := c.Stages(amount)
+	final := stages[len(stages)-1].Name == stage.Name
+	return stage, final, nil
+}
+
+// ApprovalProgress is the approval state of a loan
+type ApprovalProgress struct {
+	Stages    ApprovalChain  `json:"stages"`
+	Approvals []LoanApproval `json:"approvals"`
+	Next      *ApprovalStage `json:"next,omitempty"`
+}
+
+// NewApprovalProgress creates the progress of a loan through the chain
+func NewApprovalProgress(chain ApprovalChain, amount float64, approvals []LoanApproval) *ApprovalProgress {
+	progress := &ApprovalProgress{
+		Stages:    chain.Stages(amount),
+		Approvals: approvals,
+	}
+	if progress.Approvals == nil {
+		progress.Approvals = []LoanApproval{}
+	}
+	if next, ok := chain.Next(amount, approvals); ok {
+		progress.Next = &next
+	}
+	return progress
+}
+
+// LatestRate returns the most recent rate set by an approval stage
+func LatestRate(approvals []LoanApproval) float64 {
+	for i := len(approvals) - 1; i >= 0; i-- {
+		if approvals[i].Rate > 0 {
+			return approvals[i].Rate
+		}
+	}
+	return 0
+}
+
+// VisitWarnings flags visit photos that do not prove a visit around the approval date
+func VisitWarnings(photos []filemanager.File, approvalDate time.Time, maxDrift time.Duration) []string {
+	warnings := []string{}
+	for _, photo := range photos {
+		if photo.CapturedAt == nil {
+			warnings = append(warnings, fmt.Sprintf("photo %s has no capture time", photo.Label))
+			continue
+		}
+
+		drift := photo.CapturedAt.Sub(approvalDate)
+		if drift < 0 {
+			drift = -drift
+		}
+		if drift > maxDrift {
+			warnings = append(warnings, fmt.Sprintf("photo %s was taken %s, %s away from the approval date",
+				photo.Label, photo.CapturedAt.Format(time.RFC3339), drift.Round(time.Minute)))
+		}
+
+		if photo.Latitude == nil || photo.Longitude == nil {
+			warnings = append(warnings, fmt.Sprintf("photo %s has no GPS position", photo.Label))
+		}
+	}
+	return warnings
+}
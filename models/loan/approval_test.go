@@ -0,0 +1,122 @@
+package loan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+)
+
+var testChain = ApprovalChain{
+	{Name: "field_visit", Role: user.RoleFiledValidator, RequireVisit: true},
+	{Name: "credit_review", Role: user.RoleCreditOfficer},
+	{Name: "admin_signoff", Role: user.RoleAdmin, MinAmount: 50000000},
+}
+
+func TestApprovalChainValidate(t *testing.T) {
+	assert.NoError(t, testChain.Validate())
+	assert.NoError(t, DefaultApprovalChain.Validate())
+
+	assert.Error(t, ApprovalChain{}.Validate())
+	assert.Error(t, ApprovalChain{{Name: "a", Role: user.RoleInvestor}}.Validate())
+	assert.Error(t, ApprovalChain{
+		{Name: "a", Role: user.RoleAdmin},
+		{Name: "a", Role: user.RoleCreditOfficer},
+	}.Validate())
+	assert.Error(t, ApprovalChain{{Name: "a", Role: user.RoleAdmin, MinAmount: 10}}.Validate())
+}
+
+func TestApprovalChainStages(t *testing.T) {
+	assert.Len(t, testChain.Stages(1000000), 2)
+	assert.Len(t, testChain.Stages(50000000), 3)
+}
+
+func TestApprovalChainCheck(t *testing.T) {
+	validator := user.Actor{UserId: uuid.New(), Role: user.RoleFiledValidator}
+	officer := user.Actor{UserId: uuid.New(), Role: user.RoleCreditOfficer}
+	admin := user.Actor{UserId: uuid.New(), Role: user.RoleAdmin}
+
+	// stages are approved in order
+	_, _, err := testChain.Check(1000000, nil, officer)
+	assert.ErrorIs(t, err, ErrActionNotPermitted)
+
+	stage, final, err := testChain.Check(1000000, nil, validator)
+	assert.NoError(t, err)
+	assert.Equal(t, "field_visit", stage.Name)
+	assert.False(t, final)
+
+	approvals := []LoanApproval{{Stage: "field_visit", ApprovedBy: validator.UserId}}
+
+	// below the threshold the credit review is the last stage
+	stage, final, err = testChain.Check(1000000, approvals, officer)
+	assert.NoError(t, err)
+	assert.Equal(t, "credit_review", stage.Name)
+	assert.True(t, final)
+
+	_, final, err = testChain.Check(50000000, approvals, officer)
+	assert.NoError(t, err)
+	assert.False(t, final)
+
+	approvals = append(approvals, LoanApproval{Stage: "credit_review", ApprovedBy: officer.UserId})
+	stage, final, err = testChain.Check(50000000, approvals, admin)
+	assert.NoError(t, err)
+	assert.Equal(t, "admin_signoff", stage.Name)
+	assert.True(t, final)
+
+	_, _, err = testChain.Check(1000000, approvals, admin)
+	assert.ErrorIs(t, err, ErrApprovalComplete)
+}
+
+func TestApprovalChainDuplicateApprover(t *testing.T) {
+	chain := ApprovalChain{
+		{Name: "credit_review", Role: user.RoleCreditOfficer},
+		{Name: "second_review", Role: user.RoleCreditOfficer},
+	}
+	officer := user.Actor{UserId: uuid.New(), Role: user.RoleCreditOfficer}
+	approvals := []LoanApproval{{Stage: "credit_review", ApprovedBy: officer.UserId}}
+
+	_, _, err := chain.Check(1000, approvals, officer)
+	assert.ErrorIs(t, err, ErrDuplicateApprover)
+
+	_, _, err = chain.Check(1000, approvals, user.Actor{UserId: uuid.New(), Role: user.RoleCreditOfficer})
+	assert.NoError(t, err)
+}
+
+func TestApprovalProgress(t *testing.T) {
+	progress := NewApprovalProgress(testChain, 1000000, nil)
+	assert.Len(t, progress.Stages, 2)
+	assert.Empty(t, progress.Approvals)
+	assert.Equal(t, "field_visit", progress.Next.Name)
+
+	progress = NewApprovalProgress(testChain, 1000000, []LoanApproval{
+		{Stage: "field_visit", Rate: 0.1},
+		{Stage: "credit_review"},
+	})
+	assert.Nil(t, progress.Next)
+	assert.Equal(t, 0.1, LatestRate(progress.Approvals))
+}
+
+func TestVisitWarnings(t *testing.T) {
+	approvalDate := time.Date(2024, 3, 13, 10, 0, 0, 0, time.UTC)
+	near := approvalDate.Add(-3 * time.Hour)
+	far := approvalDate.Add(-10 * 24 * time.Hour)
+	lat, lon := -6.2, 106.8
+
+	warnings := VisitWarnings([]filemanager.File{
+		{Label: "near.jpg", CapturedAt: &near, Latitude: &lat, Longitude: &lon},
+	}, approvalDate, 48*time.Hour)
+	assert.Empty(t, warnings)
+
+	warnings = VisitWarnings([]filemanager.File{
+		{Label: "far.jpg", CapturedAt: &far, Latitude: &lat, Longitude: &lon},
+		{Label: "scan.jpg"},
+		{Label: "nogps.jpg", CapturedAt: &near},
+	}, approvalDate, 48*time.Hour)
+	assert.Len(t, warnings, 3)
+	assert.Contains(t, warnings[0], "far.jpg")
+	assert.Contains(t, warnings[1], "no capture time")
+	assert.Contains(t, warnings[2], "no GPS position")
+}
@@ -0,0 +1,70 @@
+package loan
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BorrowerLoan is a loan as shown on the borrower dashboard
+type BorrowerLoan struct {
+	LoanId             uuid.UUID      `json:"loan_id"`
+	Description        string         `json:"description"`
+	Amount             float64        `json:"amount"`
+	Rate               float64        `json:"rate"`
+	DurationMonth      int            `json:"duration_month"`
+	State              LoanState      `json:"state"`
+	TotalInvestment    float64        `json:"total_investment"`
+	FundingProgress    float64        `json:"funding_progress"` // 0..1 of the principal
+	DisbursementDate   time.Time      `json:"disbursement_date,omitempty"`
+	TotalPaid          float64        `json:"total_paid"`
+	InstallmentAmount  float64        `json:"installment_amount"`
+	NextInstallmentDue *time.Time     `json:"next_installment_due,omitempty"`
+	OutstandingBalance float64        `json:"outstanding_balance"`
+	Documents          []LoanDocument `json:"documents"`
+	CreatedAt          time.Time      `json:"created_at"`
+
+	VisitedFile   uuid.UUID `json:"-"`
+	AggrementFile uuid.UUID `json:"-"`
+	DisbursedFile uuid.UUID `json:"-"`
+}
+
+// Compute fills the funding progress and the repayment schedule fields.
+// Installments are flat monthly payments starting one month after disbursement.
+func (l *BorrowerLoan) Compute() {
+	if l.Amount > 0 {
+		l.FundingProgress = l.TotalInvestment / l.Amount
+	}
+
+	if l.State != StateDisbursed || l.DurationMonth <= 0 {
+		return
+	}
+
+	totalPayment := l.Amount + l.Amount*l.Rate*float64(l.DurationMonth)/12
+	l.InstallmentAmount = totalPayment / float64(l.DurationMonth)
+	l.OutstandingBalance = totalPayment - l.TotalPaid
+	if l.OutstandingBalance <= 0 {
+		l.OutstandingBalance = 0
+		return
+	}
+
+	paidInstallments := int(l.TotalPaid / l.InstallmentAmount)
+	if paidInstallments < l.DurationMonth {
+		due := l.DisbursementDate.AddDate(0, paidInstallments+1, 0)
+		l.NextInstallmentDue = &due
+	}
+}
+
+// DocumentFiles returns the files attached to the loan by document type
+func (l *BorrowerLoan) DocumentFiles() []LoanDocument {
+	documents := []LoanDocument{}
+	add := func(fileId uuid.UUID, documentType DocumentType) {
+		if fileId != uuid.Nil {
+			documents = append(documents, LoanDocument{FileId: fileId, DocumentType: documentType})
+		}
+	}
+	add(l.VisitedFile, DocumentVisitedPhoto)
+	add(l.AggrementFile, DocumentAgreement)
+	add(l.DisbursedFile, DocumentDisbursementProof)
+	return documents
+}
@@ -0,0 +1,57 @@
+package loan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBorrowerLoanCompute(t *testing.T) {
+	disbursed := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	l := &BorrowerLoan{
+		Amount:           1200,
+		Rate:             0.1,
+		DurationMonth:    12,
+		State:            StateDisbursed,
+		TotalInvestment:  1200,
+		DisbursementDate: disbursed,
+		TotalPaid:        220, // two installments of 110
+	}
+	l.Compute()
+
+	assert.InDelta(t, 1, l.FundingProgress, 1e-9)
+	assert.InDelta(t, 110, l.InstallmentAmount, 1e-9)
+	assert.InDelta(t, 1100, l.OutstandingBalance, 1e-9)
+	if assert.NotNil(t, l.NextInstallmentDue) {
+		assert.Equal(t, time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC), *l.NextInstallmentDue)
+	}
+}
+
+func TestBorrowerLoanComputeNotDisbursed(t *testing.T) {
+	l := &BorrowerLoan{Amount: 1000, Rate: 0.1, DurationMonth: 12, State: StateApproved, TotalInvestment: 250}
+	l.Compute()
+
+	assert.InDelta(t, 0.25, l.FundingProgress, 1e-9)
+	assert.Nil(t, l.NextInstallmentDue)
+	assert.Zero(t, l.OutstandingBalance)
+}
+
+func TestBorrowerLoanComputePaidOff(t *testing.T) {
+	l := &BorrowerLoan{Amount: 1200, Rate: 0.1, DurationMonth: 12, State: StateDisbursed, TotalPaid: 1320}
+	l.Compute()
+
+	assert.Zero(t, l.OutstandingBalance)
+	assert.Nil(t, l.NextInstallmentDue)
+}
+
+func TestBorrowerLoanDocumentFiles(t *testing.T) {
+	visited, agreement := uuid.New(), uuid.New()
+	l := &BorrowerLoan{VisitedFile: visited, AggrementFile: agreement}
+
+	assert.Equal(t, []LoanDocument{
+		{FileId: visited, DocumentType: DocumentVisitedPhoto},
+		{FileId: agreement, DocumentType: DocumentAgreement},
+	}, l.DocumentFiles())
+}
@@ -0,0 +1,63 @@
+package loan
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DocumentType is the purpose of a file attached to a loan
+type DocumentType string
+
+const (
+	DocumentVisitedPhoto      DocumentType = "visited_photo"
+	DocumentSignedForm        DocumentType = "signed_form"
+	DocumentAgreement         DocumentType = "agreement"
+	DocumentDisbursementProof DocumentType = "disbursement_proof"
+	DocumentSupporting        DocumentType = "supporting"
+)
+
+// DocumentTypes lists every document type known by the engine
+var DocumentTypes = []DocumentType{
+	DocumentVisitedPhoto,
+	DocumentSignedForm,
+	DocumentAgreement,
+	DocumentDisbursementProof,
+	DocumentSupporting,
+}
+
+// ParseDocumentType returns the document type named s
+func ParseDocumentType(s string) (DocumentType, error) {
+	for _, t := range DocumentTypes {
+		if string(t) == s {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown document type: %s", s)
+}
+
+// LoanDocument is a file attached to a loan with its download link.
+// Documents uploaded with an approval stage or a disbursement reference it.
+type LoanDocument struct {
+	DocumentId     uuid.UUID    `json:"document_id,omitempty"`
+	LoanId         uuid.UUID    `json:"loan_id,omitempty"`
+	FileId         uuid.UUID    `json:"file_id"`
+	DocumentType   DocumentType `json:"document_type"`
+	ApprovalId     uuid.UUID    `json:"approval_id,omitempty"`
+	DisbursementId uuid.UUID    `json:"disbursement_id,omitempty"`
+	UploadedBy     uuid.UUID    `json:"uploaded_by,omitempty"`
+	ReplacedBy     uuid.UUID    `json:"replaced_by,omitempty"` // file of the agreement issued in place of this one
+	URL            string       `json:"url,omitempty"`
+	CreatedAt      time.Time    `json:"created_at,omitempty"`
+}
+
+// FirstDocument returns the first file of documentType, uuid.Nil when there is none
+func FirstDocument(documents []LoanDocument, documentType DocumentType) uuid.UUID {
+	for _, d := range documents {
+		if d.DocumentType == documentType {
+			return d.FileId
+		}
+	}
+	return uuid.Nil
+}
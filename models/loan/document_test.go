@@ -0,0 +1,32 @@
+package loan
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDocumentType(t *testing.T) {
+	for _, documentType := range DocumentTypes {
+		parsed, err := ParseDocumentType(string(documentType))
+		assert.NoError(t, err)
+		assert.Equal(t, documentType, parsed)
+	}
+
+	_, err := ParseDocumentType("selfie")
+	assert.Error(t, err)
+}
+
+func TestFirstDocument(t *testing.T) {
+	photo, form := uuid.New(), uuid.New()
+	documents := []LoanDocument{
+		{FileId: form, DocumentType: DocumentSignedForm},
+		{FileId: photo, DocumentType: DocumentVisitedPhoto},
+		{FileId: uuid.New(), DocumentType: DocumentVisitedPhoto},
+	}
+
+	assert.Equal(t, photo, FirstDocument(documents, DocumentVisitedPhoto))
+	assert.Equal(t, form, FirstDocument(documents, DocumentSignedForm))
+	assert.Equal(t, uuid.Nil, FirstDocument(documents, DocumentDisbursementProof))
+}
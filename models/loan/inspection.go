@@ -0,0 +1,45 @@
+package loan
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrReasonRequired = errors.New("a reason is required")
+	ErrNoAgreement    = errors.New("loan has no agreement")
+)
+
+// NewForcedTransition validates an admin override of the loan state and returns
+// the audited state change. Investments are voided when forced into a state that
+// voids them, other side effects of the regular action (e.g. notifications) are not applied.
+func NewForcedTransition(loanID uuid.UUID, from, to LoanState, reason string, actor uuid.UUID) (*LoanChange, error) {
+	if !slices.Contains(States, to) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownState, to)
+	}
+	if from == to {
+		return nil, ErrInvalidTransition
+	}
+	if reason == "" {
+		return nil, ErrReasonRequired
+	}
+	return &LoanChange{
+		LoanId:    loanID,
+		Field:     "state",
+		OldValue:  string(from),
+		NewValue:  string(to),
+		Reason:    reason,
+		ChangedBy: actor,
+	}, nil
+}
+
+// LoanInspection is everything recorded about a loan, changes are its event history
+type LoanInspection struct {
+	Detail      *LoanDetail      `json:"detail"`
+	Approvals   []LoanApproval   `json:"approvals"`
+	Investments []LoanInvestment `json:"investments"`
+	Changes     []LoanChange     `json:"changes"`
+}
@@ -0,0 +1,30 @@
+package loan
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewForcedTransition(t *testing.T) {
+	loanID, actor := uuid.New(), uuid.New()
+
+	change, err := NewForcedTransition(loanID, StateInvested, StateApproved, "investor refunded", actor)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "state", change.Field)
+		assert.Equal(t, "invested", change.OldValue)
+		assert.Equal(t, "approved", change.NewValue)
+		assert.Equal(t, "investor refunded", change.Reason)
+		assert.Equal(t, actor, change.ChangedBy)
+	}
+
+	_, err = NewForcedTransition(loanID, StateInvested, "paid", "reason", actor)
+	assert.EqualError(t, err, "unknown loan state: paid")
+
+	_, err = NewForcedTransition(loanID, StateInvested, StateInvested, "reason", actor)
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+
+	_, err = NewForcedTransition(loanID, StateInvested, StateApproved, "", actor)
+	assert.ErrorIs(t, err, ErrReasonRequired)
+}
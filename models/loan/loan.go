@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/libs/fee"
 )
 
 type LoanState string
@@ -14,64 +15,133 @@ const (
 	StateInvested  LoanState = "invested"
 	StateRejected  LoanState = "rejected"
 	StateDisbursed LoanState = "disbursed"
+	StateCancelled LoanState = "cancelled"
+	StateExpired   LoanState = "expired"
 )
 
+// VoidsInvestments reports whether the investments of a loan entering the state are voided
+func (s LoanState) VoidsInvestments() bool {
+	return s == StateCancelled || s == StateExpired
+}
+
 type Loan struct {
-	LoanId        uuid.UUID `json:"loan_id,omitempty"`
-	Description   string    `json:"description,omitempty" binding:"required"`
-	ProposedBy    uuid.UUID `json:"proposed_by,omitempty"`
-	Amount        float64   `json:"amount,omitempty" binding:"required"`
-	DurationMonth int       `json:"duration_month,omitempty" binding:"required"`
-	Rate          float64   `json:"rate,omitempty"`
-	State         string    `json:"state,omitempty"`
-	ApprovalDate  time.Time `json:"approval_date,omitempty"`
-	AggrementFile uuid.UUID `json:"aggrement_file,omitempty"`
-	CreatedAt     time.Time `json:"created_at,omitempty"`
-	UpdatedAt     time.Time `json:"updated_at,omitempty"`
+	LoanId          uuid.UUID     `json:"loan_id,omitempty"`
+	ProductId       uuid.UUID     `json:"product_id,omitempty" binding:"required"`
+	Description     string        `json:"description,omitempty" binding:"required"`
+	ProposedBy      uuid.UUID     `json:"proposed_by,omitempty"`
+	Amount          float64       `json:"amount,omitempty" binding:"required"`
+	DurationMonth   int           `json:"duration_month,omitempty" binding:"required"`
+	Rate            float64       `json:"rate,omitempty"`
+	ROI             float64       `json:"roi,omitempty"` // Investor return, rate minus platform margin
+	FeeRule         *fee.Rule     `json:"fee_rule,omitempty"`
+	ApprovalChain   ApprovalChain `json:"approval_chain,omitempty"` // Snapshot of the product chain at proposal
+	State           string        `json:"state,omitempty"`
+	ApprovalDate    time.Time     `json:"approval_date,omitempty"`
+	FundingDeadline time.Time     `json:"funding_deadline,omitempty"`
+	AggrementFile   uuid.UUID     `json:"aggrement_file,omitempty"`
+	CreatedAt       time.Time     `json:"created_at,omitempty"`
+	UpdatedAt       time.Time     `json:"updated_at,omitempty"`
 }
 
 type LoanDetail struct {
-	LoanId           uuid.UUID `json:"loan_id,omitempty"`
-	Description      string    `json:"description,omitempty"`
-	ProposedBy       uuid.UUID `json:"proposed_by,omitempty"`
-	Amount           float64   `json:"amount,omitempty"`
-	Rate             float64   `json:"rate,omitempty"` // Interest rate
-	DurationMonth    int       `json:"duration_month,omitempty"`
-	ApprovalDate     time.Time `json:"approval_date,omitempty"`
-	DisbursementDate time.Time `json:"disbursement_date,omitempty"`
-	State            LoanState `json:"state,omitempty"`
-	AggrementFile    string    `json:"aggrement_file,omitempty"` // Draft / Signed aggrement file
-	ValidationFile   string    `json:"-,omitempty"`
-	TotalInvestment  float64   `json:"total_investment,omitempty"`
-	CreatedAt        time.Time `json:"created_at,omitempty"`
-	UpdatedAt        time.Time `json:"updated_at,omitempty"`
+	LoanId           uuid.UUID      `json:"loan_id,omitempty"`
+	ProductId        uuid.UUID      `json:"product_id,omitempty"`
+	Description      string         `json:"description,omitempty"`
+	ProposedBy       uuid.UUID      `json:"proposed_by,omitempty"`
+	Amount           float64        `json:"amount,omitempty"`
+	Rate             float64        `json:"rate,omitempty"` // Interest rate
+	ROI              float64        `json:"roi,omitempty"`  // Investor return, rate minus platform margin
+	FeeRule          *fee.Rule      `json:"fee_rule,omitempty"`
+	ApprovalChain    ApprovalChain  `json:"approval_chain,omitempty"`
+	DurationMonth    int            `json:"duration_month,omitempty"`
+	ApprovalDate     time.Time      `json:"approval_date,omitempty"`
+	DisbursementDate time.Time      `json:"disbursement_date,omitempty"`
+	FundingDeadline  time.Time      `json:"funding_deadline,omitempty"`
+	State            LoanState      `json:"state,omitempty"`
+	AggrementFile    string         `json:"aggrement_file,omitempty"` // Draft / Signed aggrement file
+	ValidationFile   string         `json:"-,omitempty"`
+	TotalInvestment  float64        `json:"total_investment,omitempty"`
+	Documents        []LoanDocument `json:"documents,omitempty"`
+	CreatedAt        time.Time      `json:"created_at,omitempty"`
+	UpdatedAt        time.Time      `json:"updated_at,omitempty"`
+}
+
+// LoanUpdate holds the fields a borrower may change while the loan is proposed
+type LoanUpdate struct {
+	Description   *string  `json:"description,omitempty"`
+	Amount        *float64 `json:"amount,omitempty"`
+	DurationMonth *int     `json:"duration_month,omitempty"`
+}
+
+// LoanChange is a field level change history entry of a loan
+type LoanChange struct {
+	ChangeId  uuid.UUID `json:"change_id,omitempty"`
+	LoanId    uuid.UUID `json:"loan_id,omitempty"`
+	Field     string    `json:"field,omitempty"`
+	OldValue  string    `json:"old_value"`
+	NewValue  string    `json:"new_value"`
+	Reason    string    `json:"reason,omitempty"`
+	ChangedBy uuid.UUID `json:"changed_by,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+type LoanCancellation struct {
+	LoanId      uuid.UUID `json:"loan_id,omitempty"`
+	CancelledBy uuid.UUID `json:"cancelled_by,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
 }
 
+// LoanApproval is the sign-off of one approval stage, the final stage approves the loan
 type LoanApproval struct {
-	ApprovalId   uuid.UUID `json:"approval_id,omitempty"`
-	LoanId       uuid.UUID `json:"loan_id,omitempty"`
-	ApprovedBy   uuid.UUID `json:"approved_by,omitempty"`
-	ApprovalDate time.Time `json:"approval_date,omitempty" binding:"required"`
-	VisitedFile  uuid.UUID `json:"visited_file,omitempty" binding:"required"` // File of visited location
-	Rate         float64   `json:"rate,omitempty" binding:"required"`         // Interest rate
+	ApprovalId      uuid.UUID      `json:"approval_id,omitempty"`
+	LoanId          uuid.UUID      `json:"loan_id,omitempty"`
+	Stage           string         `json:"stage,omitempty"`
+	ApprovedBy      uuid.UUID      `json:"approved_by,omitempty"`
+	ApprovalDate    time.Time      `json:"approval_date,omitempty" binding:"required"`
+	VisitedFile     uuid.UUID      `json:"visited_file,omitempty"` // File of visited location
+	Documents       []LoanDocument `json:"documents,omitempty"`    // Photos, signed forms and supporting documents of the stage
+	Comment         string         `json:"comment,omitempty"`
+	Warnings        []string       `json:"warnings,omitempty"`         // Visit photos not matching the approval date
+	Rate            float64        `json:"rate,omitempty"`             // Interest rate, the latest stage rate is applied
+	FundingDeadline time.Time      `json:"funding_deadline,omitempty"` // Defaults to approval date + funding window
+	ROI             float64        `json:"roi,omitempty"`
+	FeeRule         *fee.Rule      `json:"fee_rule,omitempty"`
+	CreatedAt       time.Time      `json:"created_at,omitempty"`
 }
 
 type LoanInvestment struct {
-	InvestmentId uuid.UUID `json:"investment_id,omitempty"`
-	LoanId       uuid.UUID `json:"loan_id,omitempty"`
-	InvestedBy   uuid.UUID `json:"invested_by,omitempty"`
-	Amount       float64   `json:"amount,omitempty" binding:"required"`
-	ROI          float64   `json:"roi,omitempty"` // Return of Investment
+	InvestmentId uuid.UUID  `json:"investment_id,omitempty"`
+	LoanId       uuid.UUID  `json:"loan_id,omitempty"`
+	InvestedBy   uuid.UUID  `json:"invested_by,omitempty"`
+	Amount       float64    `json:"amount,omitempty" binding:"required"`
+	ROI          float64    `json:"roi,omitempty"`       // Return of Investment
+	VoidedAt     *time.Time `json:"voided_at,omitempty"` // Set when the loan was cancelled or expired
+	CreatedAt    time.Time  `json:"created_at,omitempty"`
+}
+
+// LoanRepayment is a borrower payment, interest is split between investors and the platform
+type LoanRepayment struct {
+	RepaymentId      uuid.UUID `json:"repayment_id,omitempty"`
+	LoanId           uuid.UUID `json:"loan_id,omitempty"`
+	Amount           float64   `json:"amount,omitempty" pg:"-"` // split into principal and interest when both are left out
+	Principal        float64   `json:"principal"`
+	Interest         float64   `json:"interest"`
+	InvestorInterest float64   `json:"investor_interest"`
+	PlatformFee      float64   `json:"platform_fee"`
+	PaidAt           time.Time `json:"paid_at" binding:"required"`
+	RecordedBy       uuid.UUID `json:"recorded_by,omitempty"`
+	CreatedAt        time.Time `json:"created_at,omitempty"`
 }
 
 type LoanDisbursement struct {
-	DisbursmentId   uuid.UUID `json:"disbursment_id,omitempty"`
-	LoanId          uuid.UUID `json:"loan_id,omitempty"`
-	DisbursementBy  uuid.UUID `json:"disbursement_by,omitempty"`
-	DisbursedFile   uuid.UUID `json:"disbursed_file,omitempty" binding:"required"` // Signed aggrement file
-	DisbursmentDate time.Time `json:"disbursment_date,omitempty" binding:"required"`
-	CreatedAt       time.Time `json:"created_at,omitempty"`
-	UpdatedAt       time.Time `json:"updated_at,omitempty"`
+	DisbursmentId   uuid.UUID      `json:"disbursment_id,omitempty"`
+	LoanId          uuid.UUID      `json:"loan_id,omitempty"`
+	DisbursementBy  uuid.UUID      `json:"disbursement_by,omitempty"`
+	DisbursedFile   uuid.UUID      `json:"disbursed_file,omitempty" binding:"required"` // Signed aggrement file
+	Documents       []LoanDocument `json:"documents,omitempty"`
+	DisbursmentDate time.Time      `json:"disbursment_date,omitempty" binding:"required"`
+	CreatedAt       time.Time      `json:"created_at,omitempty"`
+	UpdatedAt       time.Time      `json:"updated_at,omitempty"`
 }
 
 type InvestorProfit struct {
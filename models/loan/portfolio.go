@@ -0,0 +1,69 @@
+package loan
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PortfolioItem is a single investment of an investor
+type PortfolioItem struct {
+	InvestmentId         uuid.UUID `json:"investment_id"`
+	LoanId               uuid.UUID `json:"loan_id"`
+	LoanState            LoanState `json:"loan_state"`
+	Amount               float64   `json:"amount"`
+	ROI                  float64   `json:"roi"`
+	DurationMonth        int       `json:"duration_month"`
+	ExpectedReturn       float64   `json:"expected_return"`
+	ReceivedPrincipal    float64   `json:"received_principal"`
+	ReceivedInterest     float64   `json:"received_interest"`
+	ReceivedPayout       float64   `json:"received_payout"`
+	OutstandingPrincipal float64   `json:"outstanding_principal"`
+	Voided               bool      `json:"voided"`
+	InvestedAt           time.Time `json:"invested_at"`
+}
+
+// PortfolioTotals aggregates the active investments of a portfolio
+type PortfolioTotals struct {
+	Invested             float64 `json:"invested"`
+	ExpectedReturn       float64 `json:"expected_return"`
+	ReceivedPayout       float64 `json:"received_payout"`
+	OutstandingPrincipal float64 `json:"outstanding_principal"`
+	WeightedAverageYield float64 `json:"weighted_average_yield"` // ROI weighted by invested amount
+}
+
+type Portfolio struct {
+	Items  []PortfolioItem `json:"items"`
+	Totals PortfolioTotals `json:"totals"`
+}
+
+// NewPortfolio computes the derived fields of each item and the portfolio totals.
+// Voided investments are listed but excluded from the totals.
+func NewPortfolio(items []PortfolioItem) *Portfolio {
+	p := &Portfolio{Items: make([]PortfolioItem, 0, len(items))}
+
+	weighted := 0.0
+	for _, item := range items {
+		item.ExpectedReturn = item.Amount * item.ROI * float64(item.DurationMonth) / 12
+		item.ReceivedPayout = item.ReceivedPrincipal + item.ReceivedInterest
+		item.OutstandingPrincipal = item.Amount - item.ReceivedPrincipal
+		if item.Voided || item.OutstandingPrincipal < 0 {
+			item.OutstandingPrincipal = 0
+		}
+		p.Items = append(p.Items, item)
+
+		if item.Voided {
+			continue
+		}
+		p.Totals.Invested += item.Amount
+		p.Totals.ExpectedReturn += item.ExpectedReturn
+		p.Totals.ReceivedPayout += item.ReceivedPayout
+		p.Totals.OutstandingPrincipal += item.OutstandingPrincipal
+		weighted += item.Amount * item.ROI
+	}
+
+	if p.Totals.Invested > 0 {
+		p.Totals.WeightedAverageYield = weighted / p.Totals.Invested
+	}
+	return p
+}
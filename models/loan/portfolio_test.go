@@ -0,0 +1,35 @@
+package loan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPortfolio(t *testing.T) {
+	p := NewPortfolio([]PortfolioItem{
+		{Amount: 1000, ROI: 0.1, DurationMonth: 12, ReceivedPrincipal: 250, ReceivedInterest: 25},
+		{Amount: 3000, ROI: 0.2, DurationMonth: 6},
+		{Amount: 500, ROI: 0.5, DurationMonth: 12, Voided: true},
+	})
+
+	assert.Len(t, p.Items, 3)
+	assert.InDelta(t, 100, p.Items[0].ExpectedReturn, 1e-9)
+	assert.InDelta(t, 275, p.Items[0].ReceivedPayout, 1e-9)
+	assert.InDelta(t, 750, p.Items[0].OutstandingPrincipal, 1e-9)
+	assert.InDelta(t, 300, p.Items[1].ExpectedReturn, 1e-9)
+	assert.Zero(t, p.Items[2].OutstandingPrincipal)
+
+	assert.InDelta(t, 4000, p.Totals.Invested, 1e-9)
+	assert.InDelta(t, 400, p.Totals.ExpectedReturn, 1e-9)
+	assert.InDelta(t, 275, p.Totals.ReceivedPayout, 1e-9)
+	assert.InDelta(t, 3750, p.Totals.OutstandingPrincipal, 1e-9)
+	// (1000*0.1 + 3000*0.2) / 4000
+	assert.InDelta(t, 0.175, p.Totals.WeightedAverageYield, 1e-9)
+}
+
+func TestNewPortfolioEmpty(t *testing.T) {
+	p := NewPortfolio(nil)
+	assert.NotNil(t, p.Items)
+	assert.Zero(t, p.Totals.WeightedAverageYield)
+}
@@ -0,0 +1,248 @@
+package loan
+
+import (
+	"errors"
+
+	"github.com/zainulbr/simple-loan-engine/models/user"
+)
+
+var (
+	ErrInvalidTransition  = errors.New("loan is not in a valid state for this action")
+	ErrActionNotPermitted = errors.New("action is not permitted for this user")
+	ErrLoanFullyFunded    = errors.New("loan is already fully funded")
+	ErrLoanNotFullyFunded = errors.New("loan is not fully funded")
+	ErrNotLoanProposer    = errors.New("only the proposing borrower may perform this action")
+	ErrUnknownState       = errors.New("unknown loan state")
+)
+
+// Action is an operation that moves a loan between states
+type Action string
+
+const (
+	ActionApprove  Action = "approve"
+	ActionReject   Action = "reject"
+	ActionInvest   Action = "invest"
+	ActionFund     Action = "fund"
+	ActionDisburse Action = "disburse"
+	ActionEdit     Action = "edit"
+	ActionCancel   Action = "cancel"
+	ActionExpire   Action = "expire"
+	ActionRepay    Action = "repay"
+)
+
+// States lists every loan state known by the engine
+var States = []LoanState{
+	StateProposed,
+	StateApproved,
+	StateInvested,
+	StateRejected,
+	StateDisbursed,
+	StateCancelled,
+	StateExpired,
+}
+
+// Actions lists every action known by the engine
+var Actions = []Action{
+	ActionApprove,
+	ActionReject,
+	ActionInvest,
+	ActionFund,
+	ActionDisburse,
+	ActionEdit,
+	ActionCancel,
+	ActionExpire,
+	ActionRepay,
+}
+
+// Guard validates loan specific preconditions of a transition
+type Guard func(detail *LoanDetail, actor user.Actor) error
+
+// Transition describes a legal move of a loan from one state to another.
+// Transitions without roles can only be fired by the system.
+type Transition struct {
+	Action Action
+	From   LoanState
+	To     LoanState
+	Roles  []user.UserRole
+	Guard  Guard
+}
+
+// approverRoles may sign off an approval stage
+var approverRoles = []user.UserRole{user.RoleFiledValidator, user.RoleCreditOfficer, user.RoleAdmin}
+
+// DefaultTransitions is the loan lifecycle used by the service layer
+var DefaultTransitions = []Transition{
+	{
+		// fired by the final approval stage, earlier stages keep the loan proposed
+		// see ApprovalChain for the role of each stage
+		Action: ActionApprove,
+		From:   StateProposed,
+		To:     StateApproved,
+		Roles:  approverRoles,
+	},
+	{
+		Action: ActionReject,
+		From:   StateProposed,
+		To:     StateRejected,
+		Roles:  approverRoles,
+	},
+	{
+		// partial investments keep the loan approved, see ActionFund
+		Action: ActionInvest,
+		From:   StateApproved,
+		To:     StateApproved,
+		Roles:  []user.UserRole{user.RoleInvestor},
+		Guard:  guardNotFullyFunded,
+	},
+	{
+		// fired by the system once total investment reaches the principal
+		Action: ActionFund,
+		From:   StateApproved,
+		To:     StateInvested,
+		Guard:  guardFullyFunded,
+	},
+	{
+		Action: ActionDisburse,
+		From:   StateInvested,
+		To:     StateDisbursed,
+		Roles:  []user.UserRole{user.RoleFieldOfficer},
+	},
+	{
+		Action: ActionEdit,
+		From:   StateProposed,
+		To:     StateProposed,
+		Roles:  []user.UserRole{user.RoleBorrower},
+		Guard:  guardProposer,
+	},
+	{
+		Action: ActionCancel,
+		From:   StateProposed,
+		To:     StateCancelled,
+		Roles:  []user.UserRole{user.RoleBorrower, user.RoleAdmin},
+		Guard:  guardProposer,
+	},
+	{
+		// existing investments are voided
+		Action: ActionCancel,
+		From:   StateApproved,
+		To:     StateCancelled,
+		Roles:  []user.UserRole{user.RoleAdmin},
+	},
+	{
+		// fired by the system once the funding deadline passed, investments are voided
+		Action: ActionExpire,
+		From:   StateApproved,
+		To:     StateExpired,
+		Guard:  guardNotFullyFunded,
+	},
+	{
+		// service accounts are limited to keys granted repayments:write by the router
+		Action: ActionRepay,
+		From:   StateDisbursed,
+		To:     StateDisbursed,
+		Roles:  []user.UserRole{user.RoleFieldOfficer, user.RoleService},
+	},
+}
+
+// guardProposer restricts borrowers to their own loans
+func guardProposer(detail *LoanDetail, actor user.Actor) error {
+	if actor.Role == user.RoleBorrower && actor.UserId != detail.ProposedBy {
+		return ErrNotLoanProposer
+	}
+	return nil
+}
+
+func guardNotFullyFunded(detail *LoanDetail, _ user.Actor) error {
+	if detail.TotalInvestment >= detail.Amount {
+		return ErrLoanFullyFunded
+	}
+	return nil
+}
+
+func guardFullyFunded(detail *LoanDetail, _ user.Actor) error {
+	if detail.TotalInvestment < detail.Amount {
+		return ErrLoanNotFullyFunded
+	}
+	return nil
+}
+
+// StateMachine resolves which transitions are allowed for a loan
+type StateMachine struct {
+	actions     []Action
+	transitions map[Action]map[LoanState]Transition
+}
+
+// NewStateMachine creates a state machine from a transition table
+func NewStateMachine(transitions []Transition) *StateMachine {
+	m := &StateMachine{transitions: make(map[Action]map[LoanState]Transition)}
+	for _, t := range transitions {
+		if m.transitions[t.Action] == nil {
+			m.actions = append(m.actions, t.Action)
+			m.transitions[t.Action] = make(map[LoanState]Transition)
+		}
+		m.transitions[t.Action][t.From] = t
+	}
+	return m
+}
+
+// DefaultStateMachine creates a state machine from DefaultTransitions
+func DefaultStateMachine() *StateMachine {
+	return NewStateMachine(DefaultTransitions)
+}
+
+// Transition returns the transition for action when it is allowed for the loan and actor
+func (m *StateMachine) Transition(detail *LoanDetail, action Action, actor user.Actor) (Transition, error) {
+	t, ok := m.transitions[action][detail.State]
+	if !ok {
+		return Transition{}, ErrInvalidTransition
+	}
+
+	if !t.permits(actor.Role) {
+		return Transition{}, ErrActionNotPermitted
+	}
+
+	if t.Guard != nil {
+		if err := t.Guard(detail, actor); err != nil {
+			return Transition{}, err
+		}
+	}
+
+	return t, nil
+}
+
+// System returns the transition for an action fired by the engine itself,
+// skipping role checks
+func (m *StateMachine) System(detail *LoanDetail, action Action) (Transition, error) {
+	t, ok := m.transitions[action][detail.State]
+	if !ok {
+		return Transition{}, ErrInvalidTransition
+	}
+
+	if t.Guard != nil {
+		if err := t.Guard(detail, user.Actor{}); err != nil {
+			return Transition{}, err
+		}
+	}
+
+	return t, nil
+}
+
+// Actions returns the actions the actor may perform next on the loan
+func (m *StateMachine) Actions(detail *LoanDetail, actor user.Actor) []Action {
+	actions := []Action{}
+	for _, action := range m.actions {
+		if _, err := m.Transition(detail, action, actor); err == nil {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+func (t Transition) permits(role user.UserRole) bool {
+	for _, r := range t.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package loan
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+)
+
+var allRoles = []user.UserRole{
+	user.RoleAdmin,
+	user.RoleInvestor,
+	user.RoleBorrower,
+	user.RoleFiledValidator,
+	user.RoleFieldOfficer,
+	user.RoleCreditOfficer,
+	"", // system / anonymous
+}
+
+// legal lists the only (state, action, role) combinations allowed by DefaultTransitions
+var legal = map[LoanState]map[Action][]user.UserRole{
+	StateProposed: {
+		ActionApprove: {user.RoleFiledValidator, user.RoleCreditOfficer, user.RoleAdmin},
+		ActionReject:  {user.RoleFiledValidator, user.RoleCreditOfficer, user.RoleAdmin},
+		ActionEdit:    {user.RoleBorrower},
+		ActionCancel:  {user.RoleBorrower, user.RoleAdmin},
+	},
+	StateApproved: {
+		ActionInvest: {user.RoleInvestor},
+		ActionCancel: {user.RoleAdmin},
+	},
+	StateInvested: {
+		ActionDisburse: {user.RoleFieldOfficer},
+	},
+	StateDisbursed: {
+		ActionRepay: {user.RoleFieldOfficer},
+	},
+}
+
+func isLegal(state LoanState, action Action, role user.UserRole) bool {
+	for _, r := range legal[state][action] {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStateMachineTransitions(t *testing.T) {
+	m := DefaultStateMachine()
+
+	for _, state := range States {
+		for _, action := range Actions {
+			for _, role := range allRoles {
+				detail := &LoanDetail{State: state, Amount: 1000, TotalInvestment: 0}
+				tr, err := m.Transition(detail, action, user.Actor{Role: role})
+
+				if isLegal(state, action, role) {
+					assert.NoError(t, err, "%s %s by %q", state, action, role)
+					assert.Equal(t, state, tr.From)
+					continue
+				}
+
+				assert.Error(t, err, "%s %s by %q must be illegal", state, action, role)
+			}
+		}
+	}
+}
+
+func TestStateMachineIllegalErrors(t *testing.T) {
+	m := DefaultStateMachine()
+
+	_, err := m.Transition(&LoanDetail{State: StateDisbursed}, ActionApprove, user.Actor{Role: user.RoleFiledValidator})
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+
+	_, err = m.Transition(&LoanDetail{State: StateProposed}, ActionApprove, user.Actor{Role: user.RoleInvestor})
+	assert.ErrorIs(t, err, ErrActionNotPermitted)
+
+	// system transitions can not be fired by any user
+	for _, role := range allRoles {
+		_, err = m.Transition(&LoanDetail{State: StateApproved, Amount: 10, TotalInvestment: 10}, ActionFund, user.Actor{Role: role})
+		assert.ErrorIs(t, err, ErrActionNotPermitted)
+	}
+}
+
+func TestStateMachineGuards(t *testing.T) {
+	m := DefaultStateMachine()
+	investor := user.Actor{Role: user.RoleInvestor}
+
+	_, err := m.Transition(&LoanDetail{State: StateApproved, Amount: 100, TotalInvestment: 100}, ActionInvest, investor)
+	assert.ErrorIs(t, err, ErrLoanFullyFunded)
+
+	_, err = m.System(&LoanDetail{State: StateApproved, Amount: 100, TotalInvestment: 50}, ActionFund)
+	assert.ErrorIs(t, err, ErrLoanNotFullyFunded)
+
+	tr, err := m.System(&LoanDetail{State: StateApproved, Amount: 100, TotalInvestment: 100}, ActionFund)
+	assert.NoError(t, err)
+	assert.Equal(t, StateInvested, tr.To)
+}
+
+func TestStateMachineProposer(t *testing.T) {
+	m := DefaultStateMachine()
+	proposer := uuid.New()
+	detail := &LoanDetail{State: StateProposed, ProposedBy: proposer}
+
+	actions := m.Actions(detail, user.Actor{UserId: proposer, Role: user.RoleBorrower})
+	assert.Equal(t, []Action{ActionEdit, ActionCancel}, actions)
+
+	_, err := m.Transition(detail, ActionEdit, user.Actor{UserId: uuid.New(), Role: user.RoleBorrower})
+	assert.ErrorIs(t, err, ErrNotLoanProposer)
+
+	_, err = m.Transition(detail, ActionCancel, user.Actor{UserId: uuid.New(), Role: user.RoleBorrower})
+	assert.ErrorIs(t, err, ErrNotLoanProposer)
+
+	// admins are not bound to the proposer
+	_, err = m.Transition(detail, ActionCancel, user.Actor{UserId: uuid.New(), Role: user.RoleAdmin})
+	assert.NoError(t, err)
+}
+
+func TestStateMachineActions(t *testing.T) {
+	m := DefaultStateMachine()
+
+	actions := m.Actions(&LoanDetail{State: StateProposed}, user.Actor{Role: user.RoleFiledValidator})
+	assert.Equal(t, []Action{ActionApprove, ActionReject}, actions)
+
+	actions = m.Actions(&LoanDetail{State: StateProposed}, user.Actor{Role: user.RoleInvestor})
+	assert.Empty(t, actions)
+
+	actions = m.Actions(&LoanDetail{State: StateRejected}, user.Actor{Role: user.RoleAdmin})
+	assert.Empty(t, actions)
+}
+
+func TestStateMachineExpire(t *testing.T) {
+	m := DefaultStateMachine()
+
+	tr, err := m.System(&LoanDetail{State: StateApproved, Amount: 100, TotalInvestment: 50}, ActionExpire)
+	assert.NoError(t, err)
+	assert.Equal(t, StateExpired, tr.To)
+
+	_, err = m.System(&LoanDetail{State: StateApproved, Amount: 100, TotalInvestment: 100}, ActionExpire)
+	assert.ErrorIs(t, err, ErrLoanFullyFunded)
+
+	_, err = m.System(&LoanDetail{State: StateInvested, Amount: 100, TotalInvestment: 100}, ActionExpire)
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+}
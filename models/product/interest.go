@@ -0,0 +1,38 @@
+package product
+
+import "fmt"
+
+// InterestMethod is how the interest of a loan is calculated
+type InterestMethod string
+
+// InterestMethodFlat charges interest on the original principal for the whole duration
+const InterestMethodFlat InterestMethod = "flat"
+
+// Validate checks the interest method is supported
+func (m InterestMethod) Validate() error {
+	switch m {
+	case InterestMethodFlat:
+		return nil
+	}
+	return fmt.Errorf("unsupported interest method: %s", m)
+}
+
+// TotalInterest is the interest owed over the whole duration. Validate rejects
+// unknown methods, the empty method of loans without a product is flat.
+func (m InterestMethod) TotalInterest(principal, rate float64, durationMonth int) float64 {
+	switch m {
+	default: // InterestMethodFlat
+		return principal * rate * float64(durationMonth) / 12
+	}
+}
+
+// SplitPayment splits a borrower payment into its principal and interest part,
+// a flat loan pays both in the same proportion with every installment
+func (m InterestMethod) SplitPayment(amount, principal, rate float64, durationMonth int) (paidPrincipal, paidInterest float64) {
+	interest := m.TotalInterest(principal, rate, durationMonth)
+	if principal+interest <= 0 {
+		return amount, 0
+	}
+	paidInterest = amount * interest / (principal + interest)
+	return amount - paidInterest, paidInterest
+}
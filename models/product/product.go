@@ -0,0 +1,132 @@
+package product
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/libs/fee"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+)
+
+var (
+	ErrProductNotFound = errors.New("loan product not found")
+	ErrProductInactive = errors.New("loan product is not active")
+	ErrNotEligible     = errors.New("loan is not eligible for the product")
+	ErrMissingDocument = errors.New("required documents are missing")
+)
+
+// Product defines the eligibility limits and pricing of a loan type (e.g. micro, SME, seasonal)
+type Product struct {
+	ProductId         uuid.UUID           `json:"product_id,omitempty"`
+	Code              string              `json:"code" binding:"required"`
+	Name              string              `json:"name" binding:"required"`
+	Description       string              `json:"description,omitempty"`
+	MinAmount         float64             `json:"min_amount"`
+	MaxAmount         float64             `json:"max_amount" binding:"required"`
+	Durations         []int               `json:"durations" binding:"required"` // allowed durations in months
+	MinRate           float64             `json:"min_rate"`
+	MaxRate           float64             `json:"max_rate" binding:"required"`
+	InterestMethod    InterestMethod      `json:"interest_method,omitempty"`
+	FeeRule           fee.Rule            `json:"fee_rule"`
+	RequiredDocuments []loan.DocumentType `json:"required_documents,omitempty"` // see CheckDocuments
+	ApprovalChain     loan.ApprovalChain  `json:"approval_chain,omitempty"`     // Defaults to the engine chain when empty
+	Active            bool                `json:"active"`
+	CreatedAt         time.Time           `json:"created_at,omitempty"`
+	UpdatedAt         time.Time           `json:"updated_at,omitempty"`
+}
+
+// Validate checks the product definition is consistent
+func (p *Product) Validate() error {
+	if p.Code == "" || p.Name == "" {
+		return errors.New("code and name are required")
+	}
+	if p.MinAmount < 0 || p.MaxAmount <= 0 || p.MinAmount > p.MaxAmount {
+		return errors.New("amount range is invalid")
+	}
+	if len(p.Durations) == 0 {
+		return errors.New("at least one duration is required")
+	}
+	for _, d := range p.Durations {
+		if d <= 0 {
+			return fmt.Errorf("invalid duration: %d", d)
+		}
+	}
+	if p.MinRate < 0 || p.MaxRate <= 0 || p.MinRate > p.MaxRate {
+		return errors.New("rate range is invalid")
+	}
+	if p.InterestMethod == "" {
+		p.InterestMethod = InterestMethodFlat
+	}
+	if err := p.InterestMethod.Validate(); err != nil {
+		return err
+	}
+	for _, t := range p.RequiredDocuments {
+		if _, err := loan.ParseDocumentType(string(t)); err != nil {
+			return fmt.Errorf("required_documents: %w", err)
+		}
+	}
+	if err := p.FeeRule.Validate(); err != nil {
+		return fmt.Errorf("fee_rule: %w", err)
+	}
+	if len(p.ApprovalChain) > 0 {
+		if err := p.ApprovalChain.Validate(); err != nil {
+			return fmt.Errorf("approval_chain: %w", err)
+		}
+	}
+	return nil
+}
+
+// ValidateLoan checks the loan amount and duration are allowed by the product
+func (p *Product) ValidateLoan(amount float64, durationMonth int) error {
+	if !p.Active {
+		return ErrProductInactive
+	}
+	if amount < p.MinAmount || amount > p.MaxAmount {
+		return fmt.Errorf("%w: amount must be between %.2f and %.2f for product %s", ErrNotEligible, p.MinAmount, p.MaxAmount, p.Code)
+	}
+	for _, d := range p.Durations {
+		if d == durationMonth {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: duration_month %d is not allowed for product %s, allowed: %v", ErrNotEligible, durationMonth, p.Code, p.Durations)
+}
+
+// ValidateRate checks the approved rate is within the product range
+func (p *Product) ValidateRate(rate float64) error {
+	if rate < p.MinRate || rate > p.MaxRate {
+		return fmt.Errorf("%w: rate must be between %v and %v for product %s", ErrNotEligible, p.MinRate, p.MaxRate, p.Code)
+	}
+	return nil
+}
+
+// documentDue is the action a required document must be attached by, the agreement
+// and the disbursement proof only exist once the loan is funded
+func documentDue(t loan.DocumentType) loan.Action {
+	switch t {
+	case loan.DocumentAgreement, loan.DocumentDisbursementProof:
+		return loan.ActionDisburse
+	}
+	return loan.ActionApprove
+}
+
+// CheckDocuments checks the documents required by action are among the loan documents,
+// the final approval requires the documents of the application and the disbursement all of them
+func (p *Product) CheckDocuments(action loan.Action, documents []loan.LoanDocument) error {
+	var missing []string
+	for _, t := range p.RequiredDocuments {
+		if action == loan.ActionApprove && documentDue(t) != loan.ActionApprove {
+			continue
+		}
+		if loan.FirstDocument(documents, t) == uuid.Nil {
+			missing = append(missing, string(t))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w for product %s: %s", ErrMissingDocument, p.Code, strings.Join(missing, ", "))
+	}
+	return nil
+}
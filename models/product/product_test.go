@@ -0,0 +1,110 @@
+package product
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zainulbr/simple-loan-engine/libs/fee"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+)
+
+func microProduct() *Product {
+	return &Product{
+		Code:      "micro",
+		Name:      "Micro",
+		MinAmount: 1000000,
+		MaxAmount: 10000000,
+		Durations: []int{3, 6, 12},
+		MinRate:   0.1,
+		MaxRate:   0.2,
+		FeeRule:   fee.Rule{Type: fee.RuleTypePercentage, Value: 0.2},
+		Active:    true,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	p := microProduct()
+	assert.NoError(t, p.Validate())
+	assert.Equal(t, InterestMethodFlat, p.InterestMethod)
+
+	p = microProduct()
+	p.InterestMethod = "annuity"
+	assert.Error(t, p.Validate())
+
+	p = microProduct()
+	p.MinAmount = 20000000
+	assert.Error(t, p.Validate())
+
+	p = microProduct()
+	p.Durations = nil
+	assert.Error(t, p.Validate())
+
+	p = microProduct()
+	p.MinRate, p.MaxRate = 0.3, 0.2
+	assert.Error(t, p.Validate())
+
+	p = microProduct()
+	p.RequiredDocuments = []loan.DocumentType{"passport"}
+	assert.Error(t, p.Validate())
+
+	p = microProduct()
+	p.FeeRule = fee.Rule{Type: "unknown"}
+	assert.Error(t, p.Validate())
+
+	p = microProduct()
+	p.ApprovalChain = loan.ApprovalChain{{Name: "review", Role: user.RoleBorrower}}
+	assert.Error(t, p.Validate())
+}
+
+func TestValidateLoan(t *testing.T) {
+	p := microProduct()
+
+	assert.NoError(t, p.ValidateLoan(5000000, 6))
+	assert.ErrorIs(t, p.ValidateLoan(500000, 6), ErrNotEligible)
+	assert.Error(t, p.ValidateLoan(50000000, 6))
+	assert.Error(t, p.ValidateLoan(5000000, 24))
+
+	p.Active = false
+	assert.ErrorIs(t, p.ValidateLoan(5000000, 6), ErrProductInactive)
+}
+
+func TestValidateRate(t *testing.T) {
+	p := microProduct()
+
+	assert.NoError(t, p.ValidateRate(0.15))
+	assert.ErrorIs(t, p.ValidateRate(0.05), ErrNotEligible)
+	assert.Error(t, p.ValidateRate(0.25))
+}
+
+func TestCheckDocuments(t *testing.T) {
+	p := microProduct()
+	p.RequiredDocuments = []loan.DocumentType{loan.DocumentSignedForm, loan.DocumentVisitedPhoto, loan.DocumentDisbursementProof}
+	photo := loan.LoanDocument{FileId: uuid.New(), DocumentType: loan.DocumentVisitedPhoto}
+	form := loan.LoanDocument{FileId: uuid.New(), DocumentType: loan.DocumentSignedForm}
+	proof := loan.LoanDocument{FileId: uuid.New(), DocumentType: loan.DocumentDisbursementProof}
+
+	err := p.CheckDocuments(loan.ActionApprove, []loan.LoanDocument{photo})
+	assert.ErrorIs(t, err, ErrMissingDocument)
+	assert.EqualError(t, err, "required documents are missing for product micro: signed_form")
+
+	assert.NoError(t, p.CheckDocuments(loan.ActionApprove, []loan.LoanDocument{photo, form}), "the proof is due at disbursement")
+	assert.EqualError(t, p.CheckDocuments(loan.ActionDisburse, []loan.LoanDocument{photo}),
+		"required documents are missing for product micro: signed_form, disbursement_proof")
+	assert.NoError(t, p.CheckDocuments(loan.ActionDisburse, []loan.LoanDocument{photo, form, proof}))
+}
+
+func TestInterestMethod(t *testing.T) {
+	assert.InDelta(t, 120, InterestMethodFlat.TotalInterest(1000, 0.12, 12), 1e-9)
+	assert.InDelta(t, 60, InterestMethodFlat.TotalInterest(1000, 0.12, 6), 1e-9)
+
+	// every installment of 1120/12 carries the same share of interest
+	principal, interest := InterestMethodFlat.SplitPayment(1120.0/12, 1000, 0.12, 12)
+	assert.InDelta(t, 1000.0/12, principal, 1e-9)
+	assert.InDelta(t, 10, interest, 1e-9)
+
+	principal, interest = InterestMethodFlat.SplitPayment(50, 1000, 0, 12)
+	assert.Equal(t, 50.0, principal)
+	assert.Zero(t, interest)
+}
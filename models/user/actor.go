@@ -0,0 +1,26 @@
+package user
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Actor is the authenticated user performing a request
+type Actor struct {
+	UserId uuid.UUID
+	Role   UserRole
+}
+
+type actorContextKey struct{}
+
+// ContextWithActor returns a copy of ctx carrying the actor
+func ContextWithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored in ctx, if any
+func ActorFromContext(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorContextKey{}).(Actor)
+	return actor, ok
+}
@@ -14,8 +14,30 @@ const (
 	RoleBorrower       UserRole = "borrower"
 	RoleFiledValidator UserRole = "field_validator"
 	RoleFieldOfficer   UserRole = "field_officer"
+	RoleCreditOfficer  UserRole = "credit_officer"
+	RoleService        UserRole = "service" // machine caller authenticated by an API key
 )
 
+// Roles lists every role known by the engine
+var Roles = []UserRole{
+	RoleAdmin,
+	RoleInvestor,
+	RoleBorrower,
+	RoleFiledValidator,
+	RoleFieldOfficer,
+	RoleCreditOfficer,
+	RoleService,
+}
+
+// IsStaff reports whether the role belongs to platform staff rather than a customer
+func (r UserRole) IsStaff() bool {
+	switch r {
+	case RoleAdmin, RoleFiledValidator, RoleFieldOfficer, RoleCreditOfficer:
+		return true
+	}
+	return false
+}
+
 type User struct {
 	UserId    uuid.UUID `json:"user_id,omitempty"`
 	Email     string    `json:"email,omitempty"`
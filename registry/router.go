@@ -2,23 +2,50 @@ package registry
 
 import (
 	"github.com/gin-gonic/gin"
+	libToken "github.com/zainulbr/simple-loan-engine/libs/token"
+	apiKeyService "github.com/zainulbr/simple-loan-engine/services/apikey"
+	fileService "github.com/zainulbr/simple-loan-engine/services/filemanager"
+	loanService "github.com/zainulbr/simple-loan-engine/services/loan"
+	productService "github.com/zainulbr/simple-loan-engine/services/product"
+	"github.com/zainulbr/simple-loan-engine/settings"
 )
 
-// TBD: Inject Serivce Here
+// Dependencies are built once by the application container and injected
+// into every router factory
+type Dependencies struct {
+	Settings *settings.Settings
+
+	Loans    loanService.LoanService
+	Files    fileService.FileService
+	Products productService.ProductService
+
+	Tokens  libToken.TokenService       // verifies the bearer tokens of AuthorizeJWT
+	APIKeys apiKeyService.APIKeyService // authenticates the API keys of service accounts
+}
 
 // Router is an interface to register router handlers to base router
 type Router interface {
 	RegisterRoutes(base *gin.RouterGroup)
 }
 
-var routerFactories []func() Router
+// Factory builds a router from the injected dependencies
+type Factory func(deps *Dependencies) Router
+
+var routerFactories []Factory
 
 // RegisterRouter registers a router to the routers registry
-func RegisterRouter(router func() Router) {
+func RegisterRouter(router Factory) {
 	routerFactories = append(routerFactories, router)
 }
 
 // Routers returns the registered routers from the registry
-func Routers() []func() Router {
+func Routers() []Factory {
 	return routerFactories
 }
+
+// RegisterRoutes builds every registered router and registers its routes to base
+func RegisterRoutes(base *gin.RouterGroup, deps *Dependencies) {
+	for _, factory := range routerFactories {
+		factory(deps).RegisterRoutes(base)
+	}
+}
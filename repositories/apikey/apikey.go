@@ -0,0 +1,27 @@
+package apikey
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *apikey.APIKey) error
+	GetByID(ctx context.Context, keyID uuid.UUID) (*apikey.APIKey, error)
+	GetByPrefix(ctx context.Context, prefix string) (*apikey.APIKey, error)
+	List(ctx context.Context) ([]apikey.APIKey, error)
+	// Revoke marks a key revoked, a key already revoked keeps its revocation time
+	Revoke(ctx context.Context, keyID uuid.UUID, at time.Time) error
+	// Expire moves the expiry of a key to at, unless it expires earlier
+	Expire(ctx context.Context, keyID uuid.UUID, at time.Time) error
+	// Touch records the last use of a key
+	Touch(ctx context.Context, keyID uuid.UUID, at time.Time) error
+}
+
+type apiKeyModelPG struct {
+	tableName struct{} `pg:"user.api_keys"` // Schema "user", Table "api_keys"
+	*apikey.APIKey
+}
@@ -0,0 +1,86 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+)
+
+type apiKeyRepo struct {
+	db pg.DBI
+}
+
+func NewAPIKeyRepository(db pg.DBI) APIKeyRepository {
+	return &apiKeyRepo{db: db}
+}
+
+// Create stores a key, prefixes are unique
+func (r *apiKeyRepo) Create(ctx context.Context, key *apikey.APIKey) error {
+	data := apiKeyModelPG{APIKey: key}
+	_, err := r.db.Model(&data).Context(ctx).Returning("*").Insert()
+	return err
+}
+
+// Get key by ID
+func (r *apiKeyRepo) GetByID(ctx context.Context, keyID uuid.UUID) (*apikey.APIKey, error) {
+	return r.get(ctx, "key_id = ?", keyID)
+}
+
+// Get key by its public prefix
+func (r *apiKeyRepo) GetByPrefix(ctx context.Context, prefix string) (*apikey.APIKey, error) {
+	return r.get(ctx, "prefix = ?", prefix)
+}
+
+func (r *apiKeyRepo) get(ctx context.Context, condition string, param interface{}) (*apikey.APIKey, error) {
+	data := &apiKeyModelPG{APIKey: &apikey.APIKey{}}
+	err := r.db.Model(data).Context(ctx).Where(condition, param).Select()
+	if errors.Is(err, pg.ErrNoRows) {
+		return nil, apikey.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data.APIKey, nil
+}
+
+// List keys, newest first
+func (r *apiKeyRepo) List(ctx context.Context) ([]apikey.APIKey, error) {
+	var keys []apikey.APIKey
+	_, err := r.db.QueryContext(ctx, &keys, `SELECT * FROM "user".api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *apiKeyRepo) Revoke(ctx context.Context, keyID uuid.UUID, at time.Time) error {
+	return r.update(ctx, `
+		UPDATE "user".api_keys SET revoked_at = COALESCE(revoked_at, ?), updated_at = current_timestamp
+		WHERE key_id = ?`, at, keyID)
+}
+
+func (r *apiKeyRepo) Expire(ctx context.Context, keyID uuid.UUID, at time.Time) error {
+	return r.update(ctx, `
+		UPDATE "user".api_keys SET expires_at = LEAST(COALESCE(expires_at, ?), ?), updated_at = current_timestamp
+		WHERE key_id = ?`, at, at, keyID)
+}
+
+// Touch does not change updated_at, it is not a change of the key
+func (r *apiKeyRepo) Touch(ctx context.Context, keyID uuid.UUID, at time.Time) error {
+	return r.update(ctx, `UPDATE "user".api_keys SET last_used_at = ? WHERE key_id = ?`, at, keyID)
+}
+
+func (r *apiKeyRepo) update(ctx context.Context, query string, params ...interface{}) error {
+	res, err := r.db.ExecContext(ctx, query, params...)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return apikey.ErrAPIKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,742 @@
+// Package contract is the behaviour shared by every implementation of the
+// repositories, the in-memory and Postgres implementations both run it
+package contract
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+	"github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	"github.com/zainulbr/simple-loan-engine/repositories/uow"
+)
+
+// Factory returns repositories sharing one database
+type Factory func(t *testing.T) uow.Repositories
+
+// Run runs the contract of the user, API key, file and loan repositories
+func Run(t *testing.T, newRepos Factory) {
+	tests := map[string]func(t *testing.T, repos uow.Repositories){
+		"Users":             testUsers,
+		"Files":             testFiles,
+		"PendingFiles":      testPendingFiles,
+		"FileLinks":         testFileLinks,
+		"LoanNotFound":      testLoanNotFound,
+		"ApprovalStages":    testApprovalStages,
+		"Investments":       testInvestments,
+		"CancelLoan":        testCancelLoan,
+		"UpdateLoan":        testUpdateLoan,
+		"Disbursement":      testDisbursement,
+		"FundingDeadline":   testFundingDeadline,
+		"ForceState":        testForceState,
+		"AgreementFile":     testAgreementFile,
+		"BorrowerLoans":     testBorrowerLoans,
+		"InvestorEmails":    testInvestorEmails,
+		"InvestorProfit":    testInvestorProfit,
+		"InvestorPortfolio": testInvestorPortfolio,
+		"APIKeys":           testAPIKeys,
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test(t, newRepos(t))
+		})
+	}
+}
+
+// newUser creates a user with a unique email
+func newUser(t *testing.T, repos uow.Repositories, role user.UserRole) uuid.UUID {
+	t.Helper()
+	id, err := repos.Users.Create(context.Background(), user.User{Email: uuid.NewString() + "@contract.test", Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// newFile creates a clean pending file
+func newFile(t *testing.T, repos uow.Repositories) uuid.UUID {
+	t.Helper()
+	return newUpload(t, repos, uuid.Nil)
+}
+
+// newUpload creates a pending file uploaded by uploadedBy
+func newUpload(t *testing.T, repos uow.Repositories, uploadedBy uuid.UUID) uuid.UUID {
+	t.Helper()
+	file := &filemanager.File{
+		FileID:       uuid.New(),
+		Label:        "photo.jpg",
+		Location:     "/tmp/" + uuid.NewString() + ".jpg",
+		LocationType: filemanager.LocationTypeLocal,
+		FileType:     ".jpg",
+		Status:       filemanager.StatusPending,
+		Sha256:       uuid.NewString(),
+		ScanStatus:   filemanager.ScanClean,
+		UploadedBy:   uploadedBy,
+	}
+	if err := repos.Files.Create(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	return file.FileID
+}
+
+// newLoan creates a proposed loan of borrower
+func newLoan(t *testing.T, repos uow.Repositories, borrower uuid.UUID, amount float64) uuid.UUID {
+	t.Helper()
+	l := &loan.Loan{
+		LoanId:        uuid.New(),
+		Description:   "contract",
+		ProposedBy:    borrower,
+		Amount:        amount,
+		DurationMonth: 12,
+	}
+	if err := repos.Loans.CreateLoan(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	return l.LoanId
+}
+
+// approve signs off the final stage of a loan with a visit photo
+func approve(t *testing.T, repos uow.Repositories, loanID uuid.UUID, deadline time.Time) uuid.UUID {
+	t.Helper()
+	photo := newFile(t, repos)
+	err := repos.Loans.Approve(context.Background(), &loan.LoanApproval{
+		LoanId:          loanID,
+		Stage:           "field_visit",
+		ApprovedBy:      newUser(t, repos, user.RoleFiledValidator),
+		ApprovalDate:    deadline.Add(-time.Hour),
+		VisitedFile:     photo,
+		Documents:       []loan.LoanDocument{{FileId: photo, DocumentType: loan.DocumentVisitedPhoto}},
+		Rate:            0.12,
+		ROI:             0.1,
+		FundingDeadline: deadline,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return photo
+}
+
+// invest adds an investment of investor
+func invest(t *testing.T, repos uow.Repositories, loanID, investor uuid.UUID, amount float64) {
+	t.Helper()
+	err := repos.Loans.CreateInvestment(context.Background(), &loan.LoanInvestment{
+		LoanId:     loanID,
+		InvestedBy: investor,
+		Amount:     amount,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// state returns the state of a loan
+func state(t *testing.T, repos uow.Repositories, loanID uuid.UUID) loan.LoanState {
+	t.Helper()
+	detail, err := repos.Loans.GetLoanDetail(context.Background(), loanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return detail.State
+}
+
+func testUsers(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	email := uuid.NewString() + "@contract.test"
+
+	id, err := repos.Users.Create(ctx, user.User{Email: email, Role: user.RoleInvestor})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEqual(t, uuid.Nil, id)
+
+	u, err := repos.Users.GetByID(ctx, id)
+	if assert.NoError(t, err) {
+		assert.Equal(t, email, u.Email)
+		assert.Equal(t, user.RoleInvestor, u.Role)
+	}
+
+	u, err = repos.Users.GetByEmail(ctx, email)
+	if assert.NoError(t, err) {
+		assert.Equal(t, id, u.UserId)
+	}
+
+	_, err = repos.Users.Create(ctx, user.User{Email: email, Role: user.RoleBorrower})
+	assert.Error(t, err, "emails are unique")
+
+	_, err = repos.Users.GetByEmail(ctx, uuid.NewString()+"@contract.test")
+	assert.ErrorIs(t, err, pg.ErrNoRows)
+
+	assert.NoError(t, repos.Users.Delete(ctx, id))
+	_, err = repos.Users.GetByID(ctx, id)
+	assert.ErrorIs(t, err, pg.ErrNoRows)
+}
+
+func testFiles(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+
+	_, err := repos.Files.GetByID(ctx, uuid.New())
+	assert.ErrorIs(t, err, pg.ErrNoRows)
+
+	fileID := newFile(t, repos)
+	file, err := repos.Files.GetByID(ctx, fileID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, filemanager.StatusPending, file.Status)
+
+	// pending files are not shared by digest
+	_, err = repos.Files.GetCommittedByHash(ctx, file.Sha256, uuid.Nil)
+	assert.ErrorIs(t, err, pg.ErrNoRows)
+
+	scannedAt := time.Now().UTC().Truncate(time.Second)
+	file.ScanStatus = filemanager.ScanQuarantined
+	file.ScanSignature = "Eicar-Test-Signature"
+	file.ScannedAt = &scannedAt
+	file.Location = "/tmp/quarantine/" + fileID.String()
+	assert.NoError(t, repos.Files.UpdateScan(ctx, file))
+
+	file, err = repos.Files.GetByID(ctx, fileID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, filemanager.ScanQuarantined, file.ScanStatus)
+		assert.Equal(t, "Eicar-Test-Signature", file.ScanSignature)
+		assert.Equal(t, "/tmp/quarantine/"+fileID.String(), file.Location)
+	}
+
+	entry := &filemanager.AccessLog{FileId: fileID, UserId: newUser(t, repos, user.RoleAdmin),
+		Role: user.RoleAdmin, Action: filemanager.AccessPreview, Granted: true}
+	assert.NoError(t, repos.Files.LogAccess(ctx, entry))
+	assert.NotEqual(t, uuid.Nil, entry.LogId)
+
+	assert.NoError(t, repos.Files.Delete(ctx, fileID))
+	_, err = repos.Files.GetByID(ctx, fileID)
+	assert.ErrorIs(t, err, pg.ErrNoRows)
+}
+
+func testPendingFiles(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	borrower := newUser(t, repos, user.RoleBorrower)
+	loanID := newLoan(t, repos, borrower, 1000)
+	pending := newFile(t, repos)
+	committed := newUpload(t, repos, borrower)
+
+	assert.NoError(t, repos.Loans.CreateDocuments(ctx, []loan.LoanDocument{
+		{LoanId: loanID, FileId: committed, DocumentType: loan.DocumentSupporting, UploadedBy: borrower},
+	}))
+
+	file, err := repos.Files.GetByID(ctx, committed)
+	if assert.NoError(t, err) {
+		assert.Equal(t, filemanager.StatusCommitted, file.Status, "attaching a document commits the file")
+
+		shared, err := repos.Files.GetCommittedByHash(ctx, file.Sha256, borrower)
+		if assert.NoError(t, err) {
+			assert.Equal(t, committed, shared.FileID)
+		}
+		_, err = repos.Files.GetCommittedByHash(ctx, file.Sha256, newUser(t, repos, user.RoleBorrower))
+		assert.ErrorIs(t, err, pg.ErrNoRows, "files of other uploaders are not shared")
+	}
+
+	files, err := repos.Files.ListPending(ctx, time.Now().Add(24*time.Hour))
+	if assert.NoError(t, err) {
+		ids := fileIDs(files)
+		assert.Contains(t, ids, pending)
+		assert.NotContains(t, ids, committed)
+	}
+	files, err = repos.Files.ListPending(ctx, time.Now().Add(-24*time.Hour))
+	if assert.NoError(t, err) {
+		assert.NotContains(t, fileIDs(files), pending)
+	}
+
+	deleted, err := repos.Files.DeletePending(ctx, committed)
+	assert.NoError(t, err)
+	assert.False(t, deleted, "committed files are kept")
+
+	deleted, err = repos.Files.DeletePending(ctx, pending)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	_, err = repos.Files.GetByID(ctx, pending)
+	assert.ErrorIs(t, err, pg.ErrNoRows)
+}
+
+func fileIDs(files []filemanager.File) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(files))
+	for _, f := range files {
+		ids = append(ids, f.FileID)
+	}
+	return ids
+}
+
+func testFileLinks(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	borrower := newUser(t, repos, user.RoleBorrower)
+	investor := newUser(t, repos, user.RoleInvestor)
+	loanID := newLoan(t, repos, borrower, 1000)
+	photo := approve(t, repos, loanID, time.Now().Add(time.Hour))
+	invest(t, repos, loanID, investor, 400)
+
+	links, err := repos.Files.GetLinks(ctx, photo, investor)
+	if assert.NoError(t, err) && assert.Len(t, links, 1) {
+		assert.Equal(t, loanID, links[0].LoanId)
+		assert.Equal(t, loan.DocumentVisitedPhoto, links[0].DocumentType)
+		assert.Equal(t, borrower, links[0].ProposedBy)
+		assert.True(t, links[0].Investor)
+	}
+
+	links, err = repos.Files.GetLinks(ctx, photo, borrower)
+	if assert.NoError(t, err) && assert.Len(t, links, 1) {
+		assert.False(t, links[0].Investor)
+	}
+
+	links, err = repos.Files.GetLinks(ctx, newFile(t, repos), investor)
+	assert.NoError(t, err)
+	assert.Empty(t, links)
+}
+
+func testLoanNotFound(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+
+	_, err := repos.Loans.GetLoanDetail(ctx, uuid.New())
+	assert.ErrorIs(t, err, pg.ErrNoRows)
+	_, err = repos.Loans.GetLoanDetailForUpdate(ctx, uuid.New())
+	assert.ErrorIs(t, err, pg.ErrNoRows)
+
+	err = repos.Loans.UpdateState(ctx, uuid.New(), loan.StateProposed, loan.StateRejected)
+	assert.ErrorIs(t, err, loan.ErrInvalidTransition)
+}
+
+func testApprovalStages(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	loanID := newLoan(t, repos, newUser(t, repos, user.RoleBorrower), 1000)
+	validator := newUser(t, repos, user.RoleFiledValidator)
+	officer := newUser(t, repos, user.RoleCreditOfficer)
+
+	detail, err := repos.Loans.GetLoanDetail(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, loan.StateProposed, detail.State)
+		assert.Equal(t, 1000.0, detail.Amount)
+	}
+
+	first := &loan.LoanApproval{LoanId: loanID, Stage: "field_visit", ApprovedBy: validator, ApprovalDate: time.Now()}
+	assert.NoError(t, repos.Loans.CreateApproval(ctx, first))
+	assert.NotEqual(t, uuid.Nil, first.ApprovalId)
+	assert.Equal(t, loan.StateProposed, state(t, repos, loanID), "intermediate stages keep the loan proposed")
+
+	err = repos.Loans.CreateApproval(ctx, &loan.LoanApproval{LoanId: loanID, Stage: "credit_review", ApprovedBy: validator, ApprovalDate: time.Now()})
+	assert.ErrorIs(t, err, loan.ErrDuplicateApprover)
+
+	err = repos.Loans.CreateApproval(ctx, &loan.LoanApproval{LoanId: loanID, Stage: "field_visit", ApprovedBy: officer, ApprovalDate: time.Now()})
+	assert.ErrorIs(t, err, loan.ErrInvalidTransition)
+
+	deadline := time.Now().Add(24 * time.Hour)
+	err = repos.Loans.Approve(ctx, &loan.LoanApproval{LoanId: loanID, Stage: "credit_review", ApprovedBy: officer,
+		ApprovalDate: time.Now(), Rate: 0.12, ROI: 0.1, FundingDeadline: deadline})
+	assert.NoError(t, err)
+
+	detail, err = repos.Loans.GetLoanDetail(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, loan.StateApproved, detail.State)
+		assert.Equal(t, 0.12, detail.Rate)
+		assert.Equal(t, 0.1, detail.ROI)
+	}
+
+	approvals, err := repos.Loans.GetApprovals(ctx, loanID)
+	if assert.NoError(t, err) && assert.Len(t, approvals, 2) {
+		assert.Equal(t, "field_visit", approvals[0].Stage)
+		assert.Equal(t, "credit_review", approvals[1].Stage)
+	}
+
+	err = repos.Loans.Approve(ctx, &loan.LoanApproval{LoanId: loanID, Stage: "again", ApprovedBy: newUser(t, repos, user.RoleAdmin),
+		ApprovalDate: time.Now(), Rate: 0.12, FundingDeadline: deadline})
+	assert.ErrorIs(t, err, loan.ErrInvalidTransition, "only proposed loans are approved")
+}
+
+func testInvestments(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	loanID := newLoan(t, repos, newUser(t, repos, user.RoleBorrower), 1000)
+	photo := approve(t, repos, loanID, time.Now().Add(time.Hour))
+	investor := newUser(t, repos, user.RoleInvestor)
+
+	file, err := repos.Files.GetByID(ctx, photo)
+	if assert.NoError(t, err) {
+		assert.Equal(t, filemanager.StatusCommitted, file.Status, "the approval commits the visit photo")
+	}
+
+	invest(t, repos, loanID, investor, 600)
+	detail, err := repos.Loans.GetLoanDetail(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, loan.StateApproved, detail.State)
+		assert.Equal(t, 600.0, detail.TotalInvestment)
+	}
+
+	err = repos.Loans.CreateInvestment(ctx, &loan.LoanInvestment{LoanId: loanID, InvestedBy: investor, Amount: 500})
+	assert.Error(t, err, "investments can not exceed the loan amount")
+
+	invest(t, repos, loanID, investor, 400)
+	assert.Equal(t, loan.StateInvested, state(t, repos, loanID), "a fully funded loan becomes invested")
+
+	investments, err := repos.Loans.GetInvestments(ctx, loanID)
+	if assert.NoError(t, err) && assert.Len(t, investments, 2) {
+		assert.Equal(t, 600.0, investments[0].Amount)
+		assert.Equal(t, 0.1, investments[0].ROI, "the loan ROI is snapshot on the investment")
+		assert.Nil(t, investments[0].VoidedAt)
+	}
+}
+
+func testCancelLoan(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	loanID := newLoan(t, repos, newUser(t, repos, user.RoleBorrower), 1000)
+	approve(t, repos, loanID, time.Now().Add(time.Hour))
+	invest(t, repos, loanID, newUser(t, repos, user.RoleInvestor), 300)
+	admin := newUser(t, repos, user.RoleAdmin)
+
+	cancellation := &loan.LoanCancellation{LoanId: loanID, CancelledBy: admin, Reason: "fraud"}
+	err := repos.Loans.CancelLoan(ctx, cancellation, loan.StateProposed)
+	assert.ErrorIs(t, err, loan.ErrInvalidTransition)
+
+	assert.NoError(t, repos.Loans.CancelLoan(ctx, cancellation, loan.StateApproved))
+
+	detail, err := repos.Loans.GetLoanDetail(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, loan.StateCancelled, detail.State)
+		assert.Zero(t, detail.TotalInvestment, "voided investments do not count")
+	}
+
+	investments, err := repos.Loans.GetInvestments(ctx, loanID)
+	if assert.NoError(t, err) && assert.Len(t, investments, 1) {
+		assert.NotNil(t, investments[0].VoidedAt)
+	}
+
+	changes, err := repos.Loans.GetLoanChanges(ctx, loanID)
+	if assert.NoError(t, err) && assert.Len(t, changes, 1) {
+		assert.Equal(t, "state", changes[0].Field)
+		assert.Equal(t, "approved", changes[0].OldValue)
+		assert.Equal(t, "cancelled", changes[0].NewValue)
+		assert.Equal(t, "fraud", changes[0].Reason)
+		assert.Equal(t, admin, changes[0].ChangedBy)
+	}
+}
+
+func testUpdateLoan(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	borrower := newUser(t, repos, user.RoleBorrower)
+	loanID := newLoan(t, repos, borrower, 1000)
+
+	amount := 2000.0
+	changes := []loan.LoanChange{{LoanId: loanID, Field: "amount", OldValue: "1000", NewValue: "2000", ChangedBy: borrower}}
+	assert.NoError(t, repos.Loans.UpdateLoan(ctx, loanID, &loan.LoanUpdate{Amount: &amount}, changes))
+
+	detail, err := repos.Loans.GetLoanDetail(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2000.0, detail.Amount)
+		assert.Equal(t, "contract", detail.Description, "fields without update are kept")
+	}
+
+	recorded, err := repos.Loans.GetLoanChanges(ctx, loanID)
+	if assert.NoError(t, err) && assert.Len(t, recorded, 1) {
+		assert.Equal(t, "amount", recorded[0].Field)
+		assert.Empty(t, recorded[0].Reason)
+	}
+
+	assert.NoError(t, repos.Loans.UpdateState(ctx, loanID, loan.StateProposed, loan.StateRejected))
+	err = repos.Loans.UpdateLoan(ctx, loanID, &loan.LoanUpdate{Amount: &amount}, nil)
+	assert.ErrorIs(t, err, loan.ErrInvalidTransition, "only proposed loans are updated")
+}
+
+func testDisbursement(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	loanID := newLoan(t, repos, newUser(t, repos, user.RoleBorrower), 1000)
+	approve(t, repos, loanID, time.Now().Add(time.Hour))
+	invest(t, repos, loanID, newUser(t, repos, user.RoleInvestor), 1000)
+	proof := newFile(t, repos)
+	officer := newUser(t, repos, user.RoleFieldOfficer)
+
+	disbursement := &loan.LoanDisbursement{
+		LoanId:          loanID,
+		DisbursementBy:  officer,
+		DisbursedFile:   proof,
+		DisbursmentDate: time.Now(),
+		Documents:       []loan.LoanDocument{{FileId: proof, DocumentType: loan.DocumentDisbursementProof}},
+	}
+	assert.NoError(t, repos.Loans.CreateDisbursement(ctx, disbursement))
+	assert.NotEqual(t, uuid.Nil, disbursement.DisbursmentId)
+	assert.Equal(t, loan.StateDisbursed, state(t, repos, loanID))
+
+	documents, err := repos.Loans.GetLoanDocuments(ctx, loanID)
+	if assert.NoError(t, err) && assert.Len(t, documents, 2) {
+		assert.Equal(t, loan.DocumentVisitedPhoto, documents[0].DocumentType)
+		assert.Equal(t, loan.DocumentDisbursementProof, documents[1].DocumentType)
+		assert.Equal(t, disbursement.DisbursmentId, documents[1].DisbursementId)
+		assert.Equal(t, officer, documents[1].UploadedBy)
+	}
+
+	file, err := repos.Files.GetByID(ctx, proof)
+	if assert.NoError(t, err) {
+		assert.Equal(t, filemanager.StatusCommitted, file.Status)
+	}
+}
+
+func testFundingDeadline(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	borrower := newUser(t, repos, user.RoleBorrower)
+	past := newLoan(t, repos, borrower, 1000)
+	approve(t, repos, past, time.Now().Add(-time.Hour))
+	open := newLoan(t, repos, borrower, 1000)
+	approve(t, repos, open, time.Now().Add(time.Hour))
+
+	loanIDs, err := repos.Loans.GetLoansPastFundingDeadline(ctx, time.Now())
+	if assert.NoError(t, err) {
+		assert.Contains(t, loanIDs, past)
+		assert.NotContains(t, loanIDs, open)
+	}
+
+	assert.NoError(t, repos.Loans.ExpireLoan(ctx, past, loan.StateApproved))
+	assert.Equal(t, loan.StateExpired, state(t, repos, past))
+	assert.ErrorIs(t, repos.Loans.ExpireLoan(ctx, past, loan.StateApproved), loan.ErrInvalidTransition)
+}
+
+func testForceState(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	loanID := newLoan(t, repos, newUser(t, repos, user.RoleBorrower), 1000)
+	admin := newUser(t, repos, user.RoleAdmin)
+
+	change, err := loan.NewForcedTransition(loanID, loan.StateProposed, loan.StateRejected, "duplicate", admin)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, repos.Loans.ForceState(ctx, change))
+	assert.Equal(t, loan.StateRejected, state(t, repos, loanID))
+	assert.ErrorIs(t, repos.Loans.ForceState(ctx, change), loan.ErrInvalidTransition, "the loan left the old state")
+
+	changes, err := repos.Loans.GetLoanChanges(ctx, loanID)
+	if assert.NoError(t, err) && assert.Len(t, changes, 1) {
+		assert.Equal(t, "duplicate", changes[0].Reason)
+	}
+
+	// a forced cancel voids the investments like a regular one
+	funded := newLoan(t, repos, newUser(t, repos, user.RoleBorrower), 1000)
+	approve(t, repos, funded, time.Now().Add(time.Hour))
+	invest(t, repos, funded, newUser(t, repos, user.RoleInvestor), 400)
+	change, err = loan.NewForcedTransition(funded, loan.StateApproved, loan.StateCancelled, "fraud", admin)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, repos.Loans.ForceState(ctx, change))
+	assert.Equal(t, loan.StateCancelled, state(t, repos, funded))
+
+	investments, err := repos.Loans.GetInvestments(ctx, funded)
+	if assert.NoError(t, err) && assert.Len(t, investments, 1) {
+		assert.NotNil(t, investments[0].VoidedAt)
+	}
+	changes, err = repos.Loans.GetLoanChanges(ctx, funded)
+	if assert.NoError(t, err) && assert.Len(t, changes, 1) {
+		assert.Equal(t, "fraud", changes[0].Reason)
+		assert.Equal(t, admin, changes[0].ChangedBy)
+	}
+}
+
+func testAgreementFile(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	loanID := newLoan(t, repos, newUser(t, repos, user.RoleBorrower), 1000)
+	agreement := newFile(t, repos)
+
+	assert.NoError(t, repos.Loans.SetAgreementFile(ctx, loanID, agreement))
+
+	detail, err := repos.Loans.GetLoanDetail(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, agreement.String(), detail.AggrementFile)
+	}
+	documents, err := repos.Loans.GetLoanDocuments(ctx, loanID)
+	if assert.NoError(t, err) && assert.Len(t, documents, 1) {
+		assert.Equal(t, loan.DocumentAgreement, documents[0].DocumentType)
+		assert.Equal(t, uuid.Nil, documents[0].ReplacedBy)
+	}
+
+	// a regenerated agreement replaces the current one, both stay linked
+	regenerated := newFile(t, repos)
+	assert.NoError(t, repos.Loans.SetAgreementFile(ctx, loanID, regenerated))
+
+	detail, err = repos.Loans.GetLoanDetail(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, regenerated.String(), detail.AggrementFile)
+	}
+	documents, err = repos.Loans.GetLoanDocuments(ctx, loanID)
+	if assert.NoError(t, err) && assert.Len(t, documents, 2) {
+		assert.Equal(t, agreement, documents[0].FileId)
+		assert.Equal(t, regenerated, documents[0].ReplacedBy)
+		assert.Equal(t, regenerated, documents[1].FileId)
+		assert.Equal(t, uuid.Nil, documents[1].ReplacedBy)
+	}
+}
+
+func testBorrowerLoans(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	borrower := newUser(t, repos, user.RoleBorrower)
+	older := newLoan(t, repos, borrower, 1000)
+	photo := approve(t, repos, older, time.Now().Add(time.Hour))
+	invest(t, repos, older, newUser(t, repos, user.RoleInvestor), 250)
+	newer := newLoan(t, repos, borrower, 500)
+	newLoan(t, repos, newUser(t, repos, user.RoleBorrower), 700)
+
+	assert.NoError(t, repos.Loans.CreateRepayment(ctx, &loan.LoanRepayment{LoanId: older, Principal: 100, Interest: 10, PaidAt: time.Now()}))
+
+	loans, err := repos.Loans.GetBorrowerLoans(ctx, borrower)
+	if assert.NoError(t, err) && assert.Len(t, loans, 2) {
+		assert.Equal(t, newer, loans[0].LoanId, "newest first")
+		assert.Equal(t, older, loans[1].LoanId)
+		assert.Equal(t, 250.0, loans[1].TotalInvestment)
+		assert.Equal(t, 110.0, loans[1].TotalPaid)
+		assert.Equal(t, photo, loans[1].VisitedFile)
+	}
+}
+
+func testInvestorEmails(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	borrower := newUser(t, repos, user.RoleBorrower)
+	investor := newUser(t, repos, user.RoleInvestor)
+	loanID := newLoan(t, repos, borrower, 1000)
+	approve(t, repos, loanID, time.Now().Add(time.Hour))
+	invest(t, repos, loanID, investor, 100)
+	invest(t, repos, loanID, investor, 100)
+
+	u, err := repos.Users.GetByID(ctx, investor)
+	if !assert.NoError(t, err) {
+		return
+	}
+	emails, err := repos.Loans.GetInvestorEmailsByLoanID(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{u.Email}, emails, "emails are distinct")
+	}
+
+	b, err := repos.Users.GetByID(ctx, borrower)
+	if !assert.NoError(t, err) {
+		return
+	}
+	email, err := repos.Loans.GetBorrowerEmail(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, b.Email, email)
+	}
+}
+
+func testInvestorProfit(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	loanID := newLoan(t, repos, newUser(t, repos, user.RoleBorrower), 1000)
+	approve(t, repos, loanID, time.Now().Add(time.Hour))
+	invest(t, repos, loanID, newUser(t, repos, user.RoleInvestor), 500)
+
+	profits, err := repos.Loans.GetInvestorProfitList(ctx, loanID.String())
+	if assert.NoError(t, err) && assert.Len(t, profits, 1) {
+		assert.Equal(t, 0.1, profits[0].ROI)
+		assert.InDelta(t, 50.0, profits[0].TotalProfit, 0.001)
+	}
+
+	payment, err := repos.Loans.GetTotalPaymentByLoanID(ctx, loanID.String())
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1000.0, payment.Principal)
+		assert.InDelta(t, 120.0, payment.TotalInterest, 0.001)
+		assert.InDelta(t, 1120.0, payment.TotalPayment, 0.001)
+	}
+}
+
+func testInvestorPortfolio(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	investor := newUser(t, repos, user.RoleInvestor)
+	borrower := newUser(t, repos, user.RoleBorrower)
+
+	active := newLoan(t, repos, borrower, 1000)
+	approve(t, repos, active, time.Now().Add(time.Hour))
+	invest(t, repos, active, investor, 1000)
+	assert.NoError(t, repos.Loans.CreateRepayment(ctx, &loan.LoanRepayment{LoanId: active, Principal: 200, Interest: 20, InvestorInterest: 16, PaidAt: time.Now()}))
+
+	cancelled := newLoan(t, repos, borrower, 1000)
+	approve(t, repos, cancelled, time.Now().Add(time.Hour))
+	invest(t, repos, cancelled, investor, 400)
+	assert.NoError(t, repos.Loans.CancelLoan(ctx, &loan.LoanCancellation{LoanId: cancelled, CancelledBy: borrower}, loan.StateApproved))
+
+	items, err := repos.Loans.GetInvestorPortfolio(ctx, investor, "")
+	if assert.NoError(t, err) && assert.Len(t, items, 2) {
+		assert.Equal(t, cancelled, items[0].LoanId, "newest first")
+		assert.True(t, items[0].Voided)
+		assert.Equal(t, active, items[1].LoanId)
+		assert.InDelta(t, 200.0, items[1].ReceivedPrincipal, 0.001)
+		assert.InDelta(t, 16.0, items[1].ReceivedInterest, 0.001)
+	}
+
+	items, err = repos.Loans.GetInvestorPortfolio(ctx, investor, loan.StateInvested)
+	if assert.NoError(t, err) && assert.Len(t, items, 1) {
+		assert.Equal(t, active, items[0].LoanId)
+	}
+}
+
+func testAPIKeys(t *testing.T, repos uow.Repositories) {
+	ctx := context.Background()
+	service := newUser(t, repos, user.RoleService)
+	admin := newUser(t, repos, user.RoleAdmin)
+
+	_, err := repos.APIKeys.GetByID(ctx, uuid.New())
+	assert.ErrorIs(t, err, apikey.ErrAPIKeyNotFound)
+	_, err = repos.APIKeys.GetByPrefix(ctx, "sle_00000000")
+	assert.ErrorIs(t, err, apikey.ErrAPIKeyNotFound)
+	assert.ErrorIs(t, repos.APIKeys.Revoke(ctx, uuid.New(), time.Now()), apikey.ErrAPIKeyNotFound)
+
+	expiresAt := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Second)
+	key := &apikey.APIKey{
+		KeyId:     uuid.New(),
+		UserId:    service,
+		Name:      "payments",
+		Scopes:    []apikey.Scope{apikey.ScopeRepaymentsWrite, apikey.ScopeLoansRead},
+		ExpiresAt: &expiresAt,
+		CreatedBy: admin,
+	}
+	secret, err := key.Generate()
+	if !assert.NoError(t, err) || !assert.NoError(t, repos.APIKeys.Create(ctx, key)) {
+		return
+	}
+
+	stored, err := repos.APIKeys.GetByPrefix(ctx, key.Prefix)
+	if assert.NoError(t, err) {
+		assert.Equal(t, key.KeyId, stored.KeyId)
+		assert.Equal(t, service, stored.UserId)
+		assert.Equal(t, key.Scopes, stored.Scopes)
+		assert.True(t, stored.Matches(secret))
+		assert.True(t, expiresAt.Equal(*stored.ExpiresAt))
+		assert.Nil(t, stored.RevokedAt)
+		assert.Nil(t, stored.LastUsedAt)
+	}
+
+	duplicate := &apikey.APIKey{KeyId: uuid.New(), UserId: service, Name: "copy", Prefix: key.Prefix, Hash: key.Hash, Scopes: key.Scopes}
+	assert.Error(t, repos.APIKeys.Create(ctx, duplicate), "prefixes are unique")
+
+	// expiry only moves earlier
+	assert.NoError(t, repos.APIKeys.Expire(ctx, key.KeyId, expiresAt.Add(time.Hour)))
+	soon := expiresAt.Add(-time.Hour)
+	assert.NoError(t, repos.APIKeys.Expire(ctx, key.KeyId, soon))
+
+	usedAt := time.Now().UTC().Truncate(time.Second)
+	assert.NoError(t, repos.APIKeys.Touch(ctx, key.KeyId, usedAt))
+
+	// the first revocation is kept
+	revokedAt := time.Now().UTC().Truncate(time.Second)
+	assert.NoError(t, repos.APIKeys.Revoke(ctx, key.KeyId, revokedAt))
+	assert.NoError(t, repos.APIKeys.Revoke(ctx, key.KeyId, revokedAt.Add(time.Hour)))
+
+	stored, err = repos.APIKeys.GetByID(ctx, key.KeyId)
+	if assert.NoError(t, err) {
+		assert.True(t, soon.Equal(*stored.ExpiresAt))
+		assert.True(t, usedAt.Equal(*stored.LastUsedAt))
+		assert.True(t, revokedAt.Equal(*stored.RevokedAt))
+	}
+
+	keys, err := repos.APIKeys.List(ctx)
+	if assert.NoError(t, err) {
+		var ids []uuid.UUID
+		for _, k := range keys {
+			ids = append(ids, k.KeyId)
+		}
+		assert.Contains(t, ids, key.KeyId)
+	}
+}
@@ -2,15 +2,23 @@ package filemanager
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
 )
 
 type FileRepository interface {
 	Create(ctx context.Context, file *filemanager.File) error
 	GetByID(ctx context.Context, fileID uuid.UUID) (*filemanager.File, error)
 	Delete(ctx context.Context, fileID uuid.UUID) error
+	UpdateScan(ctx context.Context, file *filemanager.File) error
+	GetCommittedByHash(ctx context.Context, sha256 string, uploadedBy uuid.UUID) (*filemanager.File, error)
+	GetLinks(ctx context.Context, fileID uuid.UUID, userID uuid.UUID) ([]loan.DocumentLink, error)
+	LogAccess(ctx context.Context, entry *filemanager.AccessLog) error
+	ListPending(ctx context.Context, before time.Time) ([]filemanager.File, error)
+	DeletePending(ctx context.Context, fileID uuid.UUID) (bool, error)
 }
 
 type fileModelPG struct {
@@ -2,17 +2,19 @@ package filemanager
 
 import (
 	"context"
+	"time"
 
 	"github.com/go-pg/pg/v10"
 	"github.com/google/uuid"
 	"github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
 )
 
 type fileRepo struct {
-	db *pg.DB
+	db pg.DBI
 }
 
-func NewFileRepository(db *pg.DB) FileRepository {
+func NewFileRepository(db pg.DBI) FileRepository {
 	return &fileRepo{db: db}
 }
 
@@ -42,3 +44,98 @@ func (r *fileRepo) Delete(ctx context.Context, fileID uuid.UUID) error {
 		Delete()
 	return err
 }
+
+// UpdateScan stores the scan verdict of a file, quarantined files also have a new location
+func (r *fileRepo) UpdateScan(ctx context.Context, file *filemanager.File) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE file.files
+		SET scan_status = ?, scan_signature = ?, scanned_at = ?, location = ?, thumbnail_location = ?, updated_at = now()
+		WHERE file_id = ?
+	`, file.ScanStatus, file.ScanSignature, file.ScannedAt, file.Location, file.ThumbnailLocation, file.FileID)
+	return err
+}
+
+// GetCommittedByHash returns the oldest committed file with the content digest uploaded by uploadedBy
+func (r *fileRepo) GetCommittedByHash(ctx context.Context, sha256 string, uploadedBy uuid.UUID) (*filemanager.File, error) {
+	file := new(fileModelPG)
+	err := r.db.Model(file).Context(ctx).
+		Where("sha256 = ? AND status = ?", sha256, filemanager.StatusCommitted).
+		Where("uploaded_by = ?", uploadedBy).
+		Where("scan_status IS NULL OR scan_status = ?", filemanager.ScanClean).
+		Order("created_at").
+		Limit(1).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return file.File, nil
+}
+
+// GetLinks returns the loans a file is attached to, Investor tells whether
+// userID holds a non voided investment in the loan
+func (r *fileRepo) GetLinks(ctx context.Context, fileID uuid.UUID, userID uuid.UUID) ([]loan.DocumentLink, error) {
+	var links []loan.DocumentLink
+	_, err := r.db.QueryContext(ctx, &links, `
+		SELECT
+			d.loan_id,
+			d.document_type,
+			l.proposed_by,
+			EXISTS (
+				SELECT 1 FROM loan.investments i
+				WHERE i.loan_id = d.loan_id AND i.invested_by = ?1 AND i.voided_at IS NULL
+			) AS investor
+		FROM loan.documents d
+		JOIN loan.loans l ON l.loan_id = d.loan_id
+		WHERE d.file_id = ?0
+	`, fileID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// LogAccess records a file request
+func (r *fileRepo) LogAccess(ctx context.Context, entry *filemanager.AccessLog) error {
+	_, err := r.db.QueryOneContext(ctx, pg.Scan(&entry.LogId, &entry.CreatedAt), `
+		INSERT INTO file.access_logs (file_id, user_id, role, action, granted)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING log_id, created_at
+	`, entry.FileId, nullUUID(entry.UserId), entry.Role, entry.Action, entry.Granted)
+	return err
+}
+
+func nullUUID(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
+
+// ListPending returns pending files uploaded before the given time,
+// quarantined files are kept for review
+func (r *fileRepo) ListPending(ctx context.Context, before time.Time) ([]filemanager.File, error) {
+	var files []filemanager.File
+	_, err := r.db.QueryContext(ctx, &files, `
+		SELECT file_id, label, location, location_type, file_type, status, sha256, thumbnail_location, created_at, updated_at
+		FROM file.files
+		WHERE status = ? AND created_at < ? AND scan_status IS DISTINCT FROM ?
+		ORDER BY created_at
+	`, filemanager.StatusPending, before, filemanager.ScanQuarantined)
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// DeletePending deletes a file record only while it is still pending,
+// it reports false when the file was committed in the meantime
+func (r *fileRepo) DeletePending(ctx context.Context, fileID uuid.UUID) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM file.files
+		WHERE file_id = ? AND status = ?
+	`, fileID, filemanager.StatusPending)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
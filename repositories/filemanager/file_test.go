@@ -3,6 +3,9 @@ package filemanager
 import (
 	"context"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/zainulbr/simple-loan-engine/libs/db/pgsql"
@@ -63,3 +66,45 @@ func TestFile(t *testing.T) {
 
 	t.Log("Data deleted successfully")
 }
+
+func TestPendingFile(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	svc := NewFileRepository(db)
+
+	pending := &filemanager.File{
+		Label:        "pending",
+		Location:     "testlocation",
+		LocationType: filemanager.LocationTypeLocal,
+		Status:       filemanager.StatusPending,
+	}
+	committed := &filemanager.File{
+		Label:        "committed",
+		Location:     "testlocation",
+		LocationType: filemanager.LocationTypeLocal,
+		Status:       filemanager.StatusCommitted,
+	}
+	assert.NoError(t, svc.Create(context.Background(), pending))
+	assert.NoError(t, svc.Create(context.Background(), committed))
+	defer svc.Delete(context.Background(), committed.FileID)
+
+	files, err := svc.ListPending(context.Background(), time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+
+	ids := map[uuid.UUID]bool{}
+	for _, f := range files {
+		ids[f.FileID] = true
+	}
+	assert.True(t, ids[pending.FileID])
+	assert.False(t, ids[committed.FileID])
+
+	// committed files are never collected
+	deleted, err := svc.DeletePending(context.Background(), committed.FileID)
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+
+	deleted, err = svc.DeletePending(context.Background(), pending.FileID)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+}
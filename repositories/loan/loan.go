@@ -2,6 +2,7 @@ package loan
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/zainulbr/simple-loan-engine/models/loan"
@@ -10,12 +11,33 @@ import (
 type LoanRepository interface {
 	CreateLoan(ctx context.Context, loan *loan.Loan) error
 	Approve(ctx context.Context, approval *loan.LoanApproval) error
+	CreateApproval(ctx context.Context, approval *loan.LoanApproval) error
+	GetApprovals(ctx context.Context, loanID uuid.UUID) ([]loan.LoanApproval, error)
+	CreateDocuments(ctx context.Context, documents []loan.LoanDocument) error
+	GetLoanDocuments(ctx context.Context, loanID uuid.UUID) ([]loan.LoanDocument, error)
 	GetLoanDetail(ctx context.Context, loanID uuid.UUID) (*loan.LoanDetail, error)
+	// GetLoanDetailForUpdate locks the loan row until the transaction ends, use it in a unit of work
+	// before checks a concurrent write of the loan could invalidate (e.g. the funded amount)
+	GetLoanDetailForUpdate(ctx context.Context, loanID uuid.UUID) (*loan.LoanDetail, error)
 	CreateInvestment(ctx context.Context, investment *loan.LoanInvestment) error
+	GetInvestments(ctx context.Context, loanID uuid.UUID) ([]loan.LoanInvestment, error)
 	CreateDisbursement(ctx context.Context, disbursement *loan.LoanDisbursement) error
+	UpdateState(ctx context.Context, loanID uuid.UUID, from, to loan.LoanState) error
+	UpdateLoan(ctx context.Context, loanID uuid.UUID, update *loan.LoanUpdate, changes []loan.LoanChange) error
+	GetLoanChanges(ctx context.Context, loanID uuid.UUID) ([]loan.LoanChange, error)
+	CancelLoan(ctx context.Context, cancellation *loan.LoanCancellation, from loan.LoanState) error
+	ExpireLoan(ctx context.Context, loanID uuid.UUID, from loan.LoanState) error
+	ForceState(ctx context.Context, change *loan.LoanChange) error
+	GetLoansPastFundingDeadline(ctx context.Context, now time.Time) ([]uuid.UUID, error)
+	GetBorrowerEmail(ctx context.Context, loanID uuid.UUID) (string, error)
 	GetInvestorEmailsByLoanID(ctx context.Context, loanID uuid.UUID) ([]string, error)
 	GetInvestorProfitList(ctx context.Context, loanID string) ([]loan.InvestorProfit, error)
 	GetTotalPaymentByLoanID(ctx context.Context, loanID string) (*loan.BorrowerPayment, error)
+	GetBorrowerLoans(ctx context.Context, borrowerID uuid.UUID) ([]loan.BorrowerLoan, error)
+	// SetAgreementFile makes fileID the agreement of the loan, a previous agreement stays linked as replaced
+	SetAgreementFile(ctx context.Context, loanID uuid.UUID, fileID uuid.UUID) error
+	CreateRepayment(ctx context.Context, repayment *loan.LoanRepayment) error
+	GetInvestorPortfolio(ctx context.Context, investorID uuid.UUID, state loan.LoanState) ([]loan.PortfolioItem, error)
 }
 
 type loanModelPG struct {
@@ -2,19 +2,23 @@ package loan
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/libs/db/pgsql"
+	"github.com/zainulbr/simple-loan-engine/models/filemanager"
 	"github.com/zainulbr/simple-loan-engine/models/loan"
 
 	"github.com/go-pg/pg/v10"
 )
 
 type loanRepo struct {
-	db *pg.DB
+	db pg.DBI
 }
 
-func NewLoanRepository(db *pg.DB) LoanRepository {
+func NewLoanRepository(db pg.DBI) LoanRepository {
 	return &loanRepo{db: db}
 }
 
@@ -25,20 +29,152 @@ func (r *loanRepo) CreateLoan(ctx context.Context, loan *loan.Loan) error {
 	return err
 }
 
-// Approval is Approve & Update Loan Status
+// Approve records the final approval stage & Update Loan Status
 func (r *loanRepo) Approve(ctx context.Context, approval *loan.LoanApproval) error {
-	_, err := r.db.ExecContext(ctx, `
-		WITH inserted_approval AS (
-			INSERT INTO loan.approvals (loan_id, visited_file, approved_by)
-			VALUES ( ?, ?, ?)
-			RETURNING loan_id
-		)
-		UPDATE loan.loans
-		SET state = 'approved', approval_date = ?, rate = ?
-		WHERE loan_id = (SELECT loan_id FROM inserted_approval);
-	`, approval.LoanId, approval.VisitedFile, approval.ApprovedBy,
-		approval.ApprovalDate, approval.Rate)
-	return err
+	return pgsql.RunInTransaction(ctx, r.db, func(tx *pg.Tx) error {
+		if err := insertApproval(ctx, tx, approval); err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			UPDATE loan.loans
+			SET state = ?, approval_date = ?, rate = ?, funding_deadline = ?, roi = ?, fee_rule = ?,
+				updated_at = current_timestamp
+			WHERE loan_id = ? AND state = ?
+		`, loan.StateApproved, approval.ApprovalDate, approval.Rate, approval.FundingDeadline,
+			approval.ROI, approval.FeeRule, approval.LoanId, loan.StateProposed)
+		if err != nil {
+			return err
+		}
+
+		if res.RowsAffected() == 0 {
+			return loan.ErrInvalidTransition
+		}
+		return nil
+	})
+}
+
+// CreateApproval records an intermediate approval stage, the loan stays proposed
+func (r *loanRepo) CreateApproval(ctx context.Context, approval *loan.LoanApproval) error {
+	return pgsql.RunInTransaction(ctx, r.db, func(tx *pg.Tx) error {
+		return insertApproval(ctx, tx, approval)
+	})
+}
+
+// GetApprovals returns the approval stages of a loan in the order they were signed off
+func (r *loanRepo) GetApprovals(ctx context.Context, loanID uuid.UUID) ([]loan.LoanApproval, error) {
+	var approvals []loan.LoanApproval
+	_, err := r.db.QueryContext(ctx, &approvals, `
+		SELECT approval_id, loan_id, stage, approved_by, approval_date, visited_file,
+			comment, warnings, rate, created_at
+		FROM loan.approvals
+		WHERE loan_id = ?
+		ORDER BY created_at, approval_id
+	`, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := r.GetLoanDocuments(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range approvals {
+		for _, d := range documents {
+			if d.ApprovalId == approvals[i].ApprovalId {
+				approvals[i].Documents = append(approvals[i].Documents, d)
+			}
+		}
+	}
+	return approvals, nil
+}
+
+// insertApproval stores a stage sign-off, unique indexes reject a second
+// sign-off of the stage or by the same user
+func insertApproval(ctx context.Context, tx *pg.Tx, approval *loan.LoanApproval) error {
+	_, err := tx.QueryOneContext(ctx, pg.Scan(&approval.ApprovalId, &approval.CreatedAt), `
+		INSERT INTO loan.approvals (loan_id, stage, visited_file, approved_by, approval_date, comment, warnings, rate)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING approval_id, created_at
+	`, approval.LoanId, approval.Stage, nullUUID(approval.VisitedFile), approval.ApprovedBy,
+		approval.ApprovalDate, approval.Comment, approval.Warnings, approval.Rate)
+
+	var pgErr pg.Error
+	if errors.As(err, &pgErr) && pgErr.IntegrityViolation() {
+		switch pgErr.Field('n') {
+		case "approvals_loan_approver_key":
+			return loan.ErrDuplicateApprover
+		case "approvals_loan_stage_key":
+			return loan.ErrInvalidTransition
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := range approval.Documents {
+		approval.Documents[i].LoanId = approval.LoanId
+		approval.Documents[i].ApprovalId = approval.ApprovalId
+		approval.Documents[i].UploadedBy = approval.ApprovedBy
+	}
+	return insertDocuments(ctx, tx, approval.Documents)
+}
+
+// CreateDocuments attaches files to a loan
+func (r *loanRepo) CreateDocuments(ctx context.Context, documents []loan.LoanDocument) error {
+	return pgsql.RunInTransaction(ctx, r.db, func(tx *pg.Tx) error {
+		return insertDocuments(ctx, tx, documents)
+	})
+}
+
+// GetLoanDocuments returns the documents attached to a loan, oldest first
+func (r *loanRepo) GetLoanDocuments(ctx context.Context, loanID uuid.UUID) ([]loan.LoanDocument, error) {
+	var documents []loan.LoanDocument
+	_, err := r.db.QueryContext(ctx, &documents, `
+		SELECT document_id, loan_id, file_id, document_type, approval_id, disbursement_id, uploaded_by, replaced_by, created_at
+		FROM loan.documents
+		WHERE loan_id = ?
+		ORDER BY created_at, document_id
+	`, loanID)
+	if err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// insertDocuments links files to a loan and commits their pending upload
+// in the same transaction as the loan action
+func insertDocuments(ctx context.Context, tx *pg.Tx, documents []loan.LoanDocument) error {
+	if len(documents) == 0 {
+		return nil
+	}
+
+	fileIDs := make([]uuid.UUID, 0, len(documents))
+	for _, d := range documents {
+		fileIDs = append(fileIDs, d.FileId)
+	}
+	_, err := tx.ExecContext(ctx, `
+		UPDATE file.files
+		SET status = ?, updated_at = current_timestamp
+		WHERE file_id IN (?) AND status = ?
+	`, filemanager.StatusCommitted, pg.In(fileIDs), filemanager.StatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to commit files: %w", err)
+	}
+
+	for i := range documents {
+		d := &documents[i]
+		_, err := tx.QueryOneContext(ctx, pg.Scan(&d.DocumentId, &d.CreatedAt), `
+			INSERT INTO loan.documents (loan_id, file_id, document_type, approval_id, disbursement_id, uploaded_by)
+			VALUES (?, ?, ?, ?, ?, ?)
+			RETURNING document_id, created_at
+		`, d.LoanId, d.FileId, d.DocumentType, nullUUID(d.ApprovalId), nullUUID(d.DisbursementId), nullUUID(d.UploadedBy))
+		if err != nil {
+			return fmt.Errorf("failed to attach document: %w", err)
+		}
+	}
+	return nil
 }
 
 func (r *loanRepo) GetLoanDetail(ctx context.Context, loanID uuid.UUID) (*loan.LoanDetail, error) {
@@ -47,19 +183,24 @@ func (r *loanRepo) GetLoanDetail(ctx context.Context, loanID uuid.UUID) (*loan.L
 	_, err := r.db.QueryOneContext(ctx, loanDetail, `
 		SELECT 
 			l.loan_id, 
+			l.product_id, 
 			l.description, 
 			l.proposed_by, 
 			l.amount, 
 			l.duration_month, 
 			l.rate, 
+			l.roi, 
+			l.fee_rule, 
+			l.approval_chain, 
 			l.state, 
 			l.approval_date, 
+			l.funding_deadline, 
 			l.aggrement_file, 
 			l.created_at, 
 			l.updated_at,
 			COALESCE(SUM(i.amount), 0) AS total_investment
 		FROM loan.loans l
-		LEFT JOIN loan.investments i ON l.loan_id = i.loan_id
+		LEFT JOIN loan.investments i ON l.loan_id = i.loan_id AND i.voided_at IS NULL
 		WHERE l.loan_id = ?
 		GROUP BY l.loan_id
 	`, loanID)
@@ -70,11 +211,21 @@ func (r *loanRepo) GetLoanDetail(ctx context.Context, loanID uuid.UUID) (*loan.L
 	return loanDetail, nil
 }
 
+// GetLoanDetailForUpdate locks the loan row, then reads the detail. FOR UPDATE
+// is not allowed with the investment total, so the lock is taken first.
+func (r *loanRepo) GetLoanDetailForUpdate(ctx context.Context, loanID uuid.UUID) (*loan.LoanDetail, error) {
+	_, err := r.db.ExecOneContext(ctx, `SELECT 1 FROM loan.loans WHERE loan_id = ? FOR UPDATE`, loanID)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetLoanDetail(ctx, loanID)
+}
+
 // Create Loan Investment
 func (r *loanRepo) CreateInvestment(ctx context.Context, investment *loan.LoanInvestment) error {
 	_, err := r.db.ExecContext(ctx, `
-			INSERT INTO loan.investments (loan_id, amount, invested_by)
-			VALUES (?, ?, ?)
+			INSERT INTO loan.investments (loan_id, amount, invested_by, roi)
+			VALUES (?0, ?1, ?2, (SELECT roi FROM loan.loans WHERE loan_id = ?0))
 	`, investment.LoanId, investment.Amount, investment.InvestedBy)
 	// on create/update row of table loan.investments will check constraint function check_total_investment
 
@@ -84,19 +235,220 @@ func (r *loanRepo) CreateInvestment(ctx context.Context, investment *loan.LoanIn
 	return nil
 }
 
+// GetInvestments returns the investments of a loan including voided ones
+func (r *loanRepo) GetInvestments(ctx context.Context, loanID uuid.UUID) ([]loan.LoanInvestment, error) {
+	var investments []loan.LoanInvestment
+	_, err := r.db.QueryContext(ctx, &investments, `
+		SELECT investment_id, loan_id, invested_by, amount, COALESCE(roi, 0) AS roi, voided_at, created_at
+		FROM loan.investments
+		WHERE loan_id = ?
+		ORDER BY created_at
+	`, loanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch investments: %w", err)
+	}
+	return investments, nil
+}
+
 // Create Loan Disbursement
 func (r *loanRepo) CreateDisbursement(ctx context.Context, disbursement *loan.LoanDisbursement) error {
-	_, err := r.db.ExecContext(ctx, `
-		WITH inserted_disbursement AS (
-			INSERT INTO loan.disbursments (disbursment_id, loan_id, disbursment_date, disbursment_by)
-			VALUES (gen_random_uuid(), ?, ?, ?)
-			RETURNING loan_id
-		)
+	return pgsql.RunInTransaction(ctx, r.db, func(tx *pg.Tx) error {
+		_, err := tx.QueryOneContext(ctx, pg.Scan(&disbursement.DisbursmentId), `
+			INSERT INTO loan.disbursments (disbursment_id, loan_id, disbursment_date, disbursment_by, disbursed_file)
+			VALUES (gen_random_uuid(), ?, ?, ?, ?)
+			RETURNING disbursment_id
+		`, disbursement.LoanId, disbursement.DisbursmentDate, disbursement.DisbursementBy, nullUUID(disbursement.DisbursedFile))
+		if err != nil {
+			return err
+		}
+
+		for i := range disbursement.Documents {
+			disbursement.Documents[i].LoanId = disbursement.LoanId
+			disbursement.Documents[i].DisbursementId = disbursement.DisbursmentId
+			disbursement.Documents[i].UploadedBy = disbursement.DisbursementBy
+		}
+		if err := insertDocuments(ctx, tx, disbursement.Documents); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE loan.loans
+			SET state = 'disbursed'
+			WHERE loan_id = ?
+		`, disbursement.LoanId)
+		return err
+	})
+}
+
+// UpdateState moves a loan to another state, only when it is still in the expected state
+func (r *loanRepo) UpdateState(ctx context.Context, loanID uuid.UUID, from, to loan.LoanState) error {
+	res, err := r.db.ExecContext(ctx, `
 		UPDATE loan.loans
-		SET state = 'disbursed'
-		WHERE loan_id = (SELECT loan_id FROM inserted_disbursement);
-	`, disbursement.LoanId, disbursement.DisbursmentDate, disbursement.DisbursementBy)
-	return err
+		SET state = ?, updated_at = current_timestamp
+		WHERE loan_id = ? AND state = ?
+	`, to, loanID, from)
+	if err != nil {
+		return fmt.Errorf("failed to update loan state: %w", err)
+	}
+
+	if res.RowsAffected() == 0 {
+		return loan.ErrInvalidTransition
+	}
+	return nil
+}
+
+// UpdateLoan updates the proposed loan fields and records the change history
+func (r *loanRepo) UpdateLoan(ctx context.Context, loanID uuid.UUID, update *loan.LoanUpdate, changes []loan.LoanChange) error {
+	return pgsql.RunInTransaction(ctx, r.db, func(tx *pg.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE loan.loans
+			SET description = COALESCE(?, description),
+				amount = COALESCE(?, amount),
+				duration_month = COALESCE(?, duration_month),
+				updated_at = current_timestamp
+			WHERE loan_id = ? AND state = ?
+		`, update.Description, update.Amount, update.DurationMonth, loanID, loan.StateProposed)
+		if err != nil {
+			return fmt.Errorf("failed to update loan: %w", err)
+		}
+
+		if res.RowsAffected() == 0 {
+			return loan.ErrInvalidTransition
+		}
+
+		return insertLoanChanges(ctx, tx, changes)
+	})
+}
+
+// GetLoanChanges returns the change history of a loan, oldest first
+func (r *loanRepo) GetLoanChanges(ctx context.Context, loanID uuid.UUID) ([]loan.LoanChange, error) {
+	var changes []loan.LoanChange
+	_, err := r.db.QueryContext(ctx, &changes, `
+		SELECT change_id, loan_id, field, old_value, new_value, COALESCE(reason, '') AS reason, changed_by, created_at
+		FROM loan.loan_changes
+		WHERE loan_id = ?
+		ORDER BY created_at
+	`, loanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch loan changes: %w", err)
+	}
+	return changes, nil
+}
+
+// CancelLoan cancels the loan and voids its investments
+func (r *loanRepo) CancelLoan(ctx context.Context, cancellation *loan.LoanCancellation, from loan.LoanState) error {
+	return r.closeLoan(ctx, loan.LoanChange{
+		LoanId:    cancellation.LoanId,
+		OldValue:  string(from),
+		NewValue:  string(loan.StateCancelled),
+		Reason:    cancellation.Reason,
+		ChangedBy: cancellation.CancelledBy,
+	})
+}
+
+// ExpireLoan expires an unfunded loan and voids its investments
+func (r *loanRepo) ExpireLoan(ctx context.Context, loanID uuid.UUID, from loan.LoanState) error {
+	return r.closeLoan(ctx, loan.LoanChange{
+		LoanId:   loanID,
+		OldValue: string(from),
+		NewValue: string(loan.StateExpired),
+		Reason:   "funding deadline passed",
+	})
+}
+
+// ForceState moves the loan from change.OldValue to change.NewValue and records the change,
+// investments are voided as by CancelLoan and ExpireLoan when the new state voids them
+func (r *loanRepo) ForceState(ctx context.Context, change *loan.LoanChange) error {
+	if loan.LoanState(change.NewValue).VoidsInvestments() {
+		return r.closeLoan(ctx, *change)
+	}
+	return pgsql.RunInTransaction(ctx, r.db, func(tx *pg.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE loan.loans
+			SET state = ?, updated_at = current_timestamp
+			WHERE loan_id = ? AND state = ?
+		`, change.NewValue, change.LoanId, change.OldValue)
+		if err != nil {
+			return fmt.Errorf("failed to update loan state: %w", err)
+		}
+
+		if res.RowsAffected() == 0 {
+			return loan.ErrInvalidTransition
+		}
+		return insertLoanChanges(ctx, tx, []loan.LoanChange{*change})
+	})
+}
+
+// closeLoan moves the loan to a final state, voids its investments and records the state change
+func (r *loanRepo) closeLoan(ctx context.Context, change loan.LoanChange) error {
+	change.Field = "state"
+	return pgsql.RunInTransaction(ctx, r.db, func(tx *pg.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE loan.loans
+			SET state = ?, updated_at = current_timestamp
+			WHERE loan_id = ? AND state = ?
+		`, change.NewValue, change.LoanId, change.OldValue)
+		if err != nil {
+			return fmt.Errorf("failed to update loan state: %w", err)
+		}
+
+		if res.RowsAffected() == 0 {
+			return loan.ErrInvalidTransition
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE loan.investments
+			SET voided_at = current_timestamp, updated_at = current_timestamp
+			WHERE loan_id = ? AND voided_at IS NULL
+		`, change.LoanId)
+		if err != nil {
+			return fmt.Errorf("failed to void investments: %w", err)
+		}
+
+		return insertLoanChanges(ctx, tx, []loan.LoanChange{change})
+	})
+}
+
+// GetLoansPastFundingDeadline returns approved loans whose funding deadline is before now
+func (r *loanRepo) GetLoansPastFundingDeadline(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+	var loanIDs []uuid.UUID
+	_, err := r.db.QueryContext(ctx, &loanIDs, `
+		SELECT loan_id
+		FROM loan.loans
+		WHERE state = ? AND funding_deadline < ?
+	`, loan.StateApproved, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch expired loans: %w", err)
+	}
+	return loanIDs, nil
+}
+
+// GetBorrowerEmail returns the email of the borrower who proposed the loan
+func (r *loanRepo) GetBorrowerEmail(ctx context.Context, loanID uuid.UUID) (string, error) {
+	var email string
+	_, err := r.db.QueryOneContext(ctx, pg.Scan(&email), `
+		SELECT u.email
+		FROM loan.loans l
+		JOIN "user".users u ON l.proposed_by = u.user_id
+		WHERE l.loan_id = ?
+	`, loanID)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch borrower email: %w", err)
+	}
+	return email, nil
+}
+
+func insertLoanChanges(ctx context.Context, tx *pg.Tx, changes []loan.LoanChange) error {
+	for _, change := range changes {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO loan.loan_changes (loan_id, field, old_value, new_value, reason, changed_by)
+			VALUES (?, ?, ?, ?, NULLIF(?, ''), ?)
+		`, change.LoanId, change.Field, change.OldValue, change.NewValue, change.Reason, nullUUID(change.ChangedBy))
+		if err != nil {
+			return fmt.Errorf("failed to record loan change: %w", err)
+		}
+	}
+	return nil
 }
 
 // GetInvestorEmailsByLoanID retrieves a list of investor emails for a given loan_id
@@ -107,7 +459,7 @@ func (r *loanRepo) GetInvestorEmailsByLoanID(ctx context.Context, loanID uuid.UU
 		SELECT DISTINCT u.email
 		FROM loan.investments i
 		JOIN "user".users u ON i.invested_by = u.user_id
-		WHERE i.loan_id = ?
+		WHERE i.loan_id = ? AND i.voided_at IS NULL
 	`
 
 	_, err := r.db.QueryContext(ctx, &emails, query, loanID)
@@ -124,7 +476,7 @@ func (r *loanRepo) GetTotalPaymentByLoanID(ctx context.Context, loanID string) (
 		SELECT 
 			l.loan_id,
 			l.amount AS principal,
-			((l.amount * l.rate) * (l.duration_month/12)) AS total_interest
+			((l.amount * l.rate) * (l.duration_month/12.0)) AS total_interest
 		FROM loan.loans l
 		WHERE l.loan_id = ?
 	`
@@ -139,17 +491,17 @@ func (r *loanRepo) GetTotalPaymentByLoanID(ctx context.Context, loanID string) (
 
 func (r *loanRepo) GetInvestorProfitList(ctx context.Context, loanID string) ([]loan.InvestorProfit, error) {
 	var results []loan.InvestorProfit
-	// TBD need to store ROI
-	// Replace reate to roi
+	// ROI is snapshot on the investment, older investments fall back to the loan
 	query := `
 		SELECT 
 			i.loan_id,
-			u.email,
-			((i.amount * l.rate) * (l.duration_month/12)) AS total_profit
-		FROM loan.investment i
+			u.email AS email_investor,
+			COALESCE(i.roi, l.roi, l.rate) AS roi,
+			((i.amount * COALESCE(i.roi, l.roi, l.rate)) * (l.duration_month/12.0)) AS total_profit
+		FROM loan.investments i
 		JOIN "user".users u ON i.invested_by = u.user_id
 		JOIN loan.loans l ON i.loan_id = l.loan_id
-		WHERE i.loan_id = ?
+		WHERE i.loan_id = ? AND i.voided_at IS NULL
 	`
 	_, err := r.db.QueryContext(ctx, &results, query, loanID)
 	if err != nil {
@@ -157,3 +509,131 @@ func (r *loanRepo) GetInvestorProfitList(ctx context.Context, loanID string) ([]
 	}
 	return results, nil
 }
+
+// GetBorrowerLoans lists the loans proposed by a borrower with funding, repayment and document data
+func (r *loanRepo) GetBorrowerLoans(ctx context.Context, borrowerID uuid.UUID) ([]loan.BorrowerLoan, error) {
+	var loans []loan.BorrowerLoan
+	_, err := r.db.QueryContext(ctx, &loans, `
+		SELECT
+			l.loan_id,
+			l.description,
+			l.amount,
+			COALESCE(l.rate, 0) AS rate,
+			l.duration_month,
+			l.state,
+			l.aggrement_file,
+			l.created_at,
+			(
+				SELECT COALESCE(SUM(i.amount), 0)
+				FROM loan.investments i
+				WHERE i.loan_id = l.loan_id AND i.voided_at IS NULL
+			) AS total_investment,
+			(
+				SELECT COALESCE(SUM(p.principal + p.interest), 0)
+				FROM loan.repayments p
+				WHERE p.loan_id = l.loan_id
+			) AS total_paid,
+			a.visited_file,
+			d.disbursment_date AS disbursement_date,
+			d.disbursed_file
+		FROM loan.loans l
+		LEFT JOIN LATERAL (
+			SELECT visited_file FROM loan.approvals
+			WHERE loan_id = l.loan_id
+			ORDER BY created_at DESC LIMIT 1
+		) a ON true
+		LEFT JOIN LATERAL (
+			SELECT disbursment_date, disbursed_file FROM loan.disbursments
+			WHERE loan_id = l.loan_id
+			ORDER BY created_at DESC LIMIT 1
+		) d ON true
+		WHERE l.proposed_by = ?
+		ORDER BY l.created_at DESC
+	`, borrowerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch borrower loans: %w", err)
+	}
+	return loans, nil
+}
+
+// SetAgreementFile links the generated agreement file to the loan, the current agreement is marked replaced by it
+func (r *loanRepo) SetAgreementFile(ctx context.Context, loanID uuid.UUID, fileID uuid.UUID) error {
+	return pgsql.RunInTransaction(ctx, r.db, func(tx *pg.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE loan.documents
+			SET replaced_by = ?
+			WHERE loan_id = ? AND document_type = ? AND replaced_by IS NULL
+		`, fileID, loanID, loan.DocumentAgreement)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE loan.loans
+			SET aggrement_file = ?, updated_at = current_timestamp
+			WHERE loan_id = ?
+		`, fileID, loanID)
+		if err != nil {
+			return err
+		}
+
+		return insertDocuments(ctx, tx, []loan.LoanDocument{
+			{LoanId: loanID, FileId: fileID, DocumentType: loan.DocumentAgreement},
+		})
+	})
+}
+
+// CreateRepayment records a borrower repayment and its interest split
+func (r *loanRepo) CreateRepayment(ctx context.Context, repayment *loan.LoanRepayment) error {
+	_, err := r.db.QueryOneContext(ctx, pg.Scan(&repayment.RepaymentId), `
+		INSERT INTO loan.repayments (loan_id, principal, interest, investor_interest, platform_fee, paid_at, recorded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING repayment_id
+	`, repayment.LoanId, repayment.Principal, repayment.Interest,
+		repayment.InvestorInterest, repayment.PlatformFee, repayment.PaidAt, nullUUID(repayment.RecordedBy))
+	if err != nil {
+		return fmt.Errorf("failed to create repayment: %w", err)
+	}
+	return nil
+}
+
+// GetInvestorPortfolio lists the investments of an investor, received payouts are
+// the loan repayments pro rata of the investment share. Empty state lists all.
+func (r *loanRepo) GetInvestorPortfolio(ctx context.Context, investorID uuid.UUID, state loan.LoanState) ([]loan.PortfolioItem, error) {
+	var items []loan.PortfolioItem
+	query := `
+		SELECT
+			i.investment_id,
+			i.loan_id,
+			l.state AS loan_state,
+			i.amount,
+			COALESCE(i.roi, l.roi, l.rate) AS roi,
+			l.duration_month,
+			COALESCE(r.principal, 0) * i.amount / NULLIF(l.amount, 0) AS received_principal,
+			COALESCE(r.interest, 0) * i.amount / NULLIF(l.amount, 0) AS received_interest,
+			i.voided_at IS NOT NULL AS voided,
+			i.created_at AS invested_at
+		FROM loan.investments i
+		JOIN loan.loans l ON i.loan_id = l.loan_id
+		LEFT JOIN (
+			SELECT loan_id, SUM(principal) AS principal, SUM(COALESCE(investor_interest, interest)) AS interest
+			FROM loan.repayments
+			GROUP BY loan_id
+		) r ON r.loan_id = i.loan_id
+		WHERE i.invested_by = ?0 AND (?1 = '' OR l.state::varchar = ?1)
+		ORDER BY i.created_at DESC
+	`
+	_, err := r.db.QueryContext(ctx, &items, query, investorID, string(state))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch investor portfolio: %w", err)
+	}
+	return items, nil
+}
+
+// nullUUID stores uuid.Nil as NULL
+func nullUUID(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
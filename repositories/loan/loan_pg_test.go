@@ -190,3 +190,54 @@ func TestLoanMultiInvestor(t *testing.T) {
 	assert.NoError(t, err)
 
 }
+
+func TestLoanUpdateAndCancel(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	proposedby, _ := uuid.Parse("f4fcbdce-d833-48d1-bc98-af05aa29ad1d")
+
+	data := &loan.Loan{
+		Amount:        1000000,
+		ProposedBy:    proposedby,
+		DurationMonth: 12,
+		Description:   "Test Loan",
+	}
+	svc := NewLoanRepository(db)
+
+	err := svc.CreateLoan(context.Background(), data)
+	assert.NoError(t, err)
+
+	amount := 2000000.0
+	err = svc.UpdateLoan(context.Background(), data.LoanId,
+		&loan.LoanUpdate{Amount: &amount},
+		[]loan.LoanChange{{
+			LoanId:    data.LoanId,
+			Field:     "amount",
+			OldValue:  "1000000",
+			NewValue:  "2000000",
+			ChangedBy: proposedby,
+		}})
+	assert.NoError(t, err)
+
+	resp, err := svc.GetLoanDetail(context.Background(), data.LoanId)
+	assert.NoError(t, err)
+	assert.Equal(t, amount, resp.Amount)
+	assert.Equal(t, data.Description, resp.Description)
+
+	err = svc.CancelLoan(context.Background(),
+		&loan.LoanCancellation{
+			LoanId:      data.LoanId,
+			CancelledBy: proposedby,
+			Reason:      "Test cancel",
+		}, loan.StateProposed)
+	assert.NoError(t, err)
+
+	changes, err := svc.GetLoanChanges(context.Background(), data.LoanId)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+
+	// Test edit after cancel should be error
+	err = svc.UpdateLoan(context.Background(), data.LoanId, &loan.LoanUpdate{Amount: &amount}, nil)
+	assert.ErrorIs(t, err, loan.ErrInvalidTransition)
+}
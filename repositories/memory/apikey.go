@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+)
+
+type apiKeyRepo struct {
+	s *Store
+}
+
+// Create stores a key, prefixes are unique
+func (r *apiKeyRepo) Create(_ context.Context, key *apikey.APIKey) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.apiKeys {
+		if existing.Prefix == key.Prefix {
+			return fmt.Errorf("duplicate api key prefix: %s", key.Prefix)
+		}
+	}
+	if _, ok := r.s.users[key.UserId]; !ok {
+		return fmt.Errorf("api key user %s does not exist", key.UserId)
+	}
+
+	if key.KeyId == uuid.Nil {
+		key.KeyId = uuid.New()
+	}
+	key.CreatedAt = r.s.now()
+	key.UpdatedAt = key.CreatedAt
+	r.s.apiKeys[key.KeyId] = *key
+	return nil
+}
+
+func (r *apiKeyRepo) GetByID(_ context.Context, keyID uuid.UUID) (*apikey.APIKey, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	key, ok := r.s.apiKeys[keyID]
+	if !ok {
+		return nil, apikey.ErrAPIKeyNotFound
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepo) GetByPrefix(_ context.Context, prefix string) (*apikey.APIKey, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, key := range r.s.apiKeys {
+		if key.Prefix == prefix {
+			return &key, nil
+		}
+	}
+	return nil, apikey.ErrAPIKeyNotFound
+}
+
+// List keys, newest first
+func (r *apiKeyRepo) List(_ context.Context) ([]apikey.APIKey, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var keys []apikey.APIKey
+	for _, key := range r.s.apiKeys {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b apikey.APIKey) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return keys, nil
+}
+
+func (r *apiKeyRepo) Revoke(_ context.Context, keyID uuid.UUID, at time.Time) error {
+	return r.update(keyID, true, func(key *apikey.APIKey) {
+		if key.RevokedAt == nil {
+			key.RevokedAt = &at
+		}
+	})
+}
+
+func (r *apiKeyRepo) Expire(_ context.Context, keyID uuid.UUID, at time.Time) error {
+	return r.update(keyID, true, func(key *apikey.APIKey) {
+		if key.ExpiresAt == nil || at.Before(*key.ExpiresAt) {
+			key.ExpiresAt = &at
+		}
+	})
+}
+
+// Touch does not change updated_at, it is not a change of the key
+func (r *apiKeyRepo) Touch(_ context.Context, keyID uuid.UUID, at time.Time) error {
+	return r.update(keyID, false, func(key *apikey.APIKey) {
+		key.LastUsedAt = &at
+	})
+}
+
+// update replaces the row of a key with its modified copy
+func (r *apiKeyRepo) update(keyID uuid.UUID, changed bool, modify func(key *apikey.APIKey)) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	key, ok := r.s.apiKeys[keyID]
+	if !ok {
+		return apikey.ErrAPIKeyNotFound
+	}
+	modify(&key)
+	if changed {
+		key.UpdatedAt = r.s.now()
+	}
+	r.s.apiKeys[keyID] = key
+	return nil
+}
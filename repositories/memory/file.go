@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+)
+
+type fileRepo struct {
+	s *Store
+}
+
+func (r *fileRepo) Create(_ context.Context, file *filemanager.File) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if file.FileID == uuid.Nil {
+		file.FileID = uuid.New()
+	}
+	file.CreatedAt = r.s.now()
+	file.UpdatedAt = file.CreatedAt
+	r.s.files[file.FileID] = *file
+	return nil
+}
+
+func (r *fileRepo) GetByID(_ context.Context, fileID uuid.UUID) (*filemanager.File, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	file, ok := r.s.files[fileID]
+	if !ok {
+		return nil, pg.ErrNoRows
+	}
+	return &file, nil
+}
+
+func (r *fileRepo) Delete(_ context.Context, fileID uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.files, fileID)
+	return nil
+}
+
+// UpdateScan stores the scan verdict of a file, quarantined files also have a new location
+func (r *fileRepo) UpdateScan(_ context.Context, file *filemanager.File) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.files[file.FileID]
+	if !ok {
+		return nil
+	}
+	stored.ScanStatus = file.ScanStatus
+	stored.ScanSignature = file.ScanSignature
+	stored.ScannedAt = file.ScannedAt
+	stored.Location = file.Location
+	stored.ThumbnailLocation = file.ThumbnailLocation
+	stored.UpdatedAt = r.s.now()
+	r.s.files[file.FileID] = stored
+	return nil
+}
+
+// GetCommittedByHash returns the oldest committed file with the content digest uploaded by uploadedBy
+func (r *fileRepo) GetCommittedByHash(_ context.Context, sha256 string, uploadedBy uuid.UUID) (*filemanager.File, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var found *filemanager.File
+	for _, file := range r.s.files {
+		if file.Sha256 != sha256 || file.UploadedBy != uploadedBy ||
+			file.Status != filemanager.StatusCommitted || !file.ScanStatus.Servable() {
+			continue
+		}
+		if found == nil || file.CreatedAt.Before(found.CreatedAt) {
+			found = &file
+		}
+	}
+	if found == nil {
+		return nil, pg.ErrNoRows
+	}
+	return found, nil
+}
+
+// GetLinks returns the loans a file is attached to, Investor tells whether
+// userID holds a non voided investment in the loan
+func (r *fileRepo) GetLinks(_ context.Context, fileID uuid.UUID, userID uuid.UUID) ([]loan.DocumentLink, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var links []loan.DocumentLink
+	for _, d := range r.s.documents {
+		if d.FileId != fileID {
+			continue
+		}
+		l, ok := r.s.loans[d.LoanId]
+		if !ok {
+			continue
+		}
+		links = append(links, loan.DocumentLink{
+			LoanId:       d.LoanId,
+			DocumentType: d.DocumentType,
+			ProposedBy:   l.ProposedBy,
+			Investor: slices.ContainsFunc(r.s.investments, func(i loan.LoanInvestment) bool {
+				return i.LoanId == d.LoanId && i.InvestedBy == userID && i.VoidedAt == nil
+			}),
+		})
+	}
+	return links, nil
+}
+
+// LogAccess records a file request
+func (r *fileRepo) LogAccess(_ context.Context, entry *filemanager.AccessLog) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	entry.LogId = uuid.New()
+	entry.CreatedAt = r.s.now()
+	r.s.accessLogs = append(r.s.accessLogs, *entry)
+	return nil
+}
+
+// ListPending returns pending files uploaded before the given time,
+// quarantined files are kept for review
+func (r *fileRepo) ListPending(_ context.Context, before time.Time) ([]filemanager.File, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var files []filemanager.File
+	for _, file := range r.s.files {
+		if file.Status == filemanager.StatusPending && file.CreatedAt.Before(before) &&
+			file.ScanStatus != filemanager.ScanQuarantined {
+			files = append(files, file)
+		}
+	}
+	slices.SortFunc(files, func(a, b filemanager.File) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return files, nil
+}
+
+// DeletePending deletes a file record only while it is still pending,
+// it reports false when the file was committed in the meantime
+func (r *fileRepo) DeletePending(_ context.Context, fileID uuid.UUID) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	file, ok := r.s.files[fileID]
+	if !ok || file.Status != filemanager.StatusPending {
+		return false, nil
+	}
+	delete(r.s.files, fileID)
+	return true, nil
+}
@@ -0,0 +1,639 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+)
+
+var errTotalInvestment = errors.New("total investment exceeds loan amount")
+
+type loanRepo struct {
+	s *Store
+}
+
+func (r *loanRepo) CreateLoan(_ context.Context, l *loan.Loan) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if l.LoanId == uuid.Nil {
+		l.LoanId = uuid.New()
+	}
+	if l.State == "" {
+		l.State = string(loan.StateProposed)
+	}
+	l.CreatedAt = r.s.now()
+	l.UpdatedAt = l.CreatedAt
+	r.s.loans[l.LoanId] = *l
+	return nil
+}
+
+// Approve records the final approval stage & Update Loan Status
+func (r *loanRepo) Approve(_ context.Context, approval *loan.LoanApproval) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	l, ok := r.s.loans[approval.LoanId]
+	if !ok || l.State != string(loan.StateProposed) {
+		return loan.ErrInvalidTransition
+	}
+	if err := r.insertApproval(approval); err != nil {
+		return err
+	}
+
+	l.State = string(loan.StateApproved)
+	l.ApprovalDate = approval.ApprovalDate
+	l.Rate = approval.Rate
+	l.FundingDeadline = approval.FundingDeadline
+	l.ROI = approval.ROI
+	l.FeeRule = approval.FeeRule
+	l.UpdatedAt = r.s.now()
+	r.s.loans[l.LoanId] = l
+	return nil
+}
+
+// CreateApproval records an intermediate approval stage, the loan stays proposed
+func (r *loanRepo) CreateApproval(_ context.Context, approval *loan.LoanApproval) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.insertApproval(approval)
+}
+
+// insertApproval stores a stage sign-off, a second sign-off of the stage
+// or by the same user is rejected like by the unique indexes
+func (r *loanRepo) insertApproval(approval *loan.LoanApproval) error {
+	for _, a := range r.s.approvals {
+		if a.LoanId != approval.LoanId {
+			continue
+		}
+		if a.ApprovedBy == approval.ApprovedBy {
+			return loan.ErrDuplicateApprover
+		}
+		if a.Stage == approval.Stage {
+			return loan.ErrInvalidTransition
+		}
+	}
+
+	approval.ApprovalId = uuid.New()
+	approval.CreatedAt = r.s.now()
+	for i := range approval.Documents {
+		approval.Documents[i].LoanId = approval.LoanId
+		approval.Documents[i].ApprovalId = approval.ApprovalId
+		approval.Documents[i].UploadedBy = approval.ApprovedBy
+	}
+	r.insertDocuments(approval.Documents)
+
+	// only the columns of loan.approvals are kept
+	stored := *approval
+	stored.Documents = nil
+	stored.FundingDeadline = time.Time{}
+	stored.ROI = 0
+	stored.FeeRule = nil
+	r.s.approvals = append(r.s.approvals, stored)
+	return nil
+}
+
+// GetApprovals returns the approval stages of a loan in the order they were signed off
+func (r *loanRepo) GetApprovals(_ context.Context, loanID uuid.UUID) ([]loan.LoanApproval, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var approvals []loan.LoanApproval
+	for _, a := range r.s.approvals {
+		if a.LoanId != loanID {
+			continue
+		}
+		for _, d := range r.s.documents {
+			if d.ApprovalId == a.ApprovalId {
+				a.Documents = append(a.Documents, d)
+			}
+		}
+		approvals = append(approvals, a)
+	}
+	return approvals, nil
+}
+
+// CreateDocuments attaches files to a loan
+func (r *loanRepo) CreateDocuments(_ context.Context, documents []loan.LoanDocument) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.insertDocuments(documents)
+	return nil
+}
+
+// insertDocuments links files to a loan and commits their pending upload
+func (r *loanRepo) insertDocuments(documents []loan.LoanDocument) {
+	for i := range documents {
+		d := &documents[i]
+		if file, ok := r.s.files[d.FileId]; ok && file.Status == filemanager.StatusPending {
+			file.Status = filemanager.StatusCommitted
+			file.UpdatedAt = r.s.now()
+			r.s.files[d.FileId] = file
+		}
+
+		d.DocumentId = uuid.New()
+		d.CreatedAt = r.s.now()
+		r.s.documents = append(r.s.documents, *d)
+	}
+}
+
+// GetLoanDocuments returns the documents attached to a loan, oldest first
+func (r *loanRepo) GetLoanDocuments(_ context.Context, loanID uuid.UUID) ([]loan.LoanDocument, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var documents []loan.LoanDocument
+	for _, d := range r.s.documents {
+		if d.LoanId == loanID {
+			documents = append(documents, d)
+		}
+	}
+	return documents, nil
+}
+
+func (r *loanRepo) GetLoanDetail(_ context.Context, loanID uuid.UUID) (*loan.LoanDetail, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	l, ok := r.s.loans[loanID]
+	if !ok {
+		return nil, pg.ErrNoRows
+	}
+
+	detail := &loan.LoanDetail{
+		LoanId:          l.LoanId,
+		ProductId:       l.ProductId,
+		Description:     l.Description,
+		ProposedBy:      l.ProposedBy,
+		Amount:          l.Amount,
+		Rate:            l.Rate,
+		ROI:             l.ROI,
+		FeeRule:         l.FeeRule,
+		ApprovalChain:   l.ApprovalChain,
+		DurationMonth:   l.DurationMonth,
+		ApprovalDate:    l.ApprovalDate,
+		FundingDeadline: l.FundingDeadline,
+		State:           loan.LoanState(l.State),
+		TotalInvestment: r.totalInvestment(loanID),
+		CreatedAt:       l.CreatedAt,
+		UpdatedAt:       l.UpdatedAt,
+	}
+	if l.AggrementFile != uuid.Nil {
+		detail.AggrementFile = l.AggrementFile.String()
+	}
+	return detail, nil
+}
+
+// GetLoanDetailForUpdate is GetLoanDetail, units of work of the store already run one at a time
+func (r *loanRepo) GetLoanDetailForUpdate(ctx context.Context, loanID uuid.UUID) (*loan.LoanDetail, error) {
+	return r.GetLoanDetail(ctx, loanID)
+}
+
+// totalInvestment sums the investments of a loan which are not voided
+func (r *loanRepo) totalInvestment(loanID uuid.UUID) float64 {
+	total := 0.0
+	for _, i := range r.s.investments {
+		if i.LoanId == loanID && i.VoidedAt == nil {
+			total += i.Amount
+		}
+	}
+	return total
+}
+
+// CreateInvestment stores an investment with the ROI of the loan, like the
+// database trigger it rejects overfunding and moves a fully funded loan to invested
+func (r *loanRepo) CreateInvestment(_ context.Context, investment *loan.LoanInvestment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	l, ok := r.s.loans[investment.LoanId]
+	if !ok {
+		return fmt.Errorf("failed to create investment: %w", pg.ErrNoRows)
+	}
+
+	total := r.totalInvestment(l.LoanId) + investment.Amount
+	if total > l.Amount {
+		return fmt.Errorf("failed to create investment: %w", errTotalInvestment)
+	}
+	if total == l.Amount {
+		l.State = string(loan.StateInvested)
+		r.s.loans[l.LoanId] = l
+	}
+
+	stored := *investment
+	stored.InvestmentId = uuid.New()
+	stored.ROI = l.ROI
+	stored.VoidedAt = nil
+	stored.CreatedAt = r.s.now()
+	r.s.investments = append(r.s.investments, stored)
+	return nil
+}
+
+// GetInvestments returns the investments of a loan including voided ones
+func (r *loanRepo) GetInvestments(_ context.Context, loanID uuid.UUID) ([]loan.LoanInvestment, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var investments []loan.LoanInvestment
+	for _, i := range r.s.investments {
+		if i.LoanId == loanID {
+			investments = append(investments, i)
+		}
+	}
+	return investments, nil
+}
+
+// Create Loan Disbursement
+func (r *loanRepo) CreateDisbursement(_ context.Context, disbursement *loan.LoanDisbursement) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	l, ok := r.s.loans[disbursement.LoanId]
+	if !ok {
+		return pg.ErrNoRows
+	}
+
+	disbursement.DisbursmentId = uuid.New()
+	disbursement.CreatedAt = r.s.now()
+	for i := range disbursement.Documents {
+		disbursement.Documents[i].LoanId = disbursement.LoanId
+		disbursement.Documents[i].DisbursementId = disbursement.DisbursmentId
+		disbursement.Documents[i].UploadedBy = disbursement.DisbursementBy
+	}
+	r.insertDocuments(disbursement.Documents)
+
+	stored := *disbursement
+	stored.Documents = nil
+	r.s.disbursements = append(r.s.disbursements, stored)
+
+	l.State = string(loan.StateDisbursed)
+	r.s.loans[l.LoanId] = l
+	return nil
+}
+
+// UpdateState moves the loan from one state to another
+func (r *loanRepo) UpdateState(_ context.Context, loanID uuid.UUID, from, to loan.LoanState) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.setState(loanID, from, to)
+}
+
+// setState moves the loan when it still is in state from
+func (r *loanRepo) setState(loanID uuid.UUID, from, to loan.LoanState) error {
+	l, ok := r.s.loans[loanID]
+	if !ok || l.State != string(from) {
+		return loan.ErrInvalidTransition
+	}
+	l.State = string(to)
+	l.UpdatedAt = r.s.now()
+	r.s.loans[loanID] = l
+	return nil
+}
+
+// UpdateLoan updates the proposed loan fields and records the change history
+func (r *loanRepo) UpdateLoan(_ context.Context, loanID uuid.UUID, update *loan.LoanUpdate, changes []loan.LoanChange) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	l, ok := r.s.loans[loanID]
+	if !ok || l.State != string(loan.StateProposed) {
+		return loan.ErrInvalidTransition
+	}
+	if update.Description != nil {
+		l.Description = *update.Description
+	}
+	if update.Amount != nil {
+		l.Amount = *update.Amount
+	}
+	if update.DurationMonth != nil {
+		l.DurationMonth = *update.DurationMonth
+	}
+	l.UpdatedAt = r.s.now()
+	r.s.loans[loanID] = l
+
+	r.insertLoanChanges(changes)
+	return nil
+}
+
+func (r *loanRepo) insertLoanChanges(changes []loan.LoanChange) {
+	for _, change := range changes {
+		change.ChangeId = uuid.New()
+		change.CreatedAt = r.s.now()
+		r.s.changes = append(r.s.changes, change)
+	}
+}
+
+// GetLoanChanges returns the change history of a loan, oldest first
+func (r *loanRepo) GetLoanChanges(_ context.Context, loanID uuid.UUID) ([]loan.LoanChange, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var changes []loan.LoanChange
+	for _, c := range r.s.changes {
+		if c.LoanId == loanID {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// CancelLoan cancels the loan and voids its investments
+func (r *loanRepo) CancelLoan(_ context.Context, cancellation *loan.LoanCancellation, from loan.LoanState) error {
+	return r.closeLoan(loan.LoanChange{
+		LoanId:    cancellation.LoanId,
+		OldValue:  string(from),
+		NewValue:  string(loan.StateCancelled),
+		Reason:    cancellation.Reason,
+		ChangedBy: cancellation.CancelledBy,
+	})
+}
+
+// ExpireLoan expires an unfunded loan and voids its investments
+func (r *loanRepo) ExpireLoan(_ context.Context, loanID uuid.UUID, from loan.LoanState) error {
+	return r.closeLoan(loan.LoanChange{
+		LoanId:   loanID,
+		OldValue: string(from),
+		NewValue: string(loan.StateExpired),
+		Reason:   "funding deadline passed",
+	})
+}
+
+// closeLoan moves the loan to a final state, voids its investments and records the state change
+func (r *loanRepo) closeLoan(change loan.LoanChange) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	change.Field = "state"
+	if err := r.setState(change.LoanId, loan.LoanState(change.OldValue), loan.LoanState(change.NewValue)); err != nil {
+		return err
+	}
+
+	now := r.s.now()
+	for i := range r.s.investments {
+		if r.s.investments[i].LoanId == change.LoanId && r.s.investments[i].VoidedAt == nil {
+			r.s.investments[i].VoidedAt = &now
+		}
+	}
+
+	r.insertLoanChanges([]loan.LoanChange{change})
+	return nil
+}
+
+// ForceState moves the loan from change.OldValue to change.NewValue and records the change,
+// investments are voided as by CancelLoan and ExpireLoan when the new state voids them
+func (r *loanRepo) ForceState(_ context.Context, change *loan.LoanChange) error {
+	if loan.LoanState(change.NewValue).VoidsInvestments() {
+		return r.closeLoan(*change)
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if err := r.setState(change.LoanId, loan.LoanState(change.OldValue), loan.LoanState(change.NewValue)); err != nil {
+		return err
+	}
+	r.insertLoanChanges([]loan.LoanChange{*change})
+	return nil
+}
+
+// GetLoansPastFundingDeadline returns approved loans whose funding deadline is before now
+func (r *loanRepo) GetLoansPastFundingDeadline(_ context.Context, now time.Time) ([]uuid.UUID, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var loanIDs []uuid.UUID
+	for _, l := range r.s.loans {
+		if l.State == string(loan.StateApproved) && l.FundingDeadline.Before(now) {
+			loanIDs = append(loanIDs, l.LoanId)
+		}
+	}
+	return loanIDs, nil
+}
+
+// GetBorrowerEmail returns the email of the borrower who proposed the loan
+func (r *loanRepo) GetBorrowerEmail(_ context.Context, loanID uuid.UUID) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	l, ok := r.s.loans[loanID]
+	if !ok {
+		return "", fmt.Errorf("failed to fetch borrower email: %w", pg.ErrNoRows)
+	}
+	u, ok := r.s.users[l.ProposedBy]
+	if !ok {
+		return "", fmt.Errorf("failed to fetch borrower email: %w", pg.ErrNoRows)
+	}
+	return u.Email, nil
+}
+
+// GetInvestorEmailsByLoanID returns the distinct emails of the investors of a loan
+func (r *loanRepo) GetInvestorEmailsByLoanID(_ context.Context, loanID uuid.UUID) ([]string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var emails []string
+	for _, i := range r.s.investments {
+		if i.LoanId != loanID || i.VoidedAt != nil {
+			continue
+		}
+		if u, ok := r.s.users[i.InvestedBy]; ok && !slices.Contains(emails, u.Email) {
+			emails = append(emails, u.Email)
+		}
+	}
+	return emails, nil
+}
+
+// investmentROI is the ROI snapshot of the investment, older investments fall back to the loan
+func investmentROI(i loan.LoanInvestment, l loan.Loan) float64 {
+	switch {
+	case i.ROI != 0:
+		return i.ROI
+	case l.ROI != 0:
+		return l.ROI
+	}
+	return l.Rate
+}
+
+func (r *loanRepo) GetInvestorProfitList(_ context.Context, loanID string) ([]loan.InvestorProfit, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	id, err := uuid.Parse(loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []loan.InvestorProfit
+	l := r.s.loans[id]
+	for _, i := range r.s.investments {
+		if i.LoanId != id || i.VoidedAt != nil {
+			continue
+		}
+		roi := investmentROI(i, l)
+		results = append(results, loan.InvestorProfit{
+			LoanID:        loanID,
+			EmailInvestor: r.s.users[i.InvestedBy].Email,
+			ROI:           roi,
+			TotalProfit:   i.Amount * roi * float64(l.DurationMonth) / 12,
+		})
+	}
+	return results, nil
+}
+
+func (r *loanRepo) GetTotalPaymentByLoanID(_ context.Context, loanID string) (*loan.BorrowerPayment, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	id, err := uuid.Parse(loanID)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := r.s.loans[id]
+	if !ok {
+		return nil, pg.ErrNoRows
+	}
+
+	result := &loan.BorrowerPayment{
+		LoanID:        loanID,
+		Principal:     l.Amount,
+		TotalInterest: l.Amount * l.Rate * float64(l.DurationMonth) / 12,
+	}
+	result.TotalPayment = result.Principal + result.TotalInterest
+	return result, nil
+}
+
+// GetBorrowerLoans lists the loans proposed by a borrower with funding, repayment and document data
+func (r *loanRepo) GetBorrowerLoans(_ context.Context, borrowerID uuid.UUID) ([]loan.BorrowerLoan, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var loans []loan.BorrowerLoan
+	for _, l := range r.s.loans {
+		if l.ProposedBy != borrowerID {
+			continue
+		}
+
+		item := loan.BorrowerLoan{
+			LoanId:          l.LoanId,
+			Description:     l.Description,
+			Amount:          l.Amount,
+			Rate:            l.Rate,
+			DurationMonth:   l.DurationMonth,
+			State:           loan.LoanState(l.State),
+			AggrementFile:   l.AggrementFile,
+			CreatedAt:       l.CreatedAt,
+			TotalInvestment: r.totalInvestment(l.LoanId),
+		}
+		for _, p := range r.s.repayments {
+			if p.LoanId == l.LoanId {
+				item.TotalPaid += p.Principal + p.Interest
+			}
+		}
+		// latest approval and disbursement
+		for _, a := range r.s.approvals {
+			if a.LoanId == l.LoanId {
+				item.VisitedFile = a.VisitedFile
+			}
+		}
+		for _, d := range r.s.disbursements {
+			if d.LoanId == l.LoanId {
+				item.DisbursementDate = d.DisbursmentDate
+				item.DisbursedFile = d.DisbursedFile
+			}
+		}
+		loans = append(loans, item)
+	}
+	slices.SortFunc(loans, func(a, b loan.BorrowerLoan) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return loans, nil
+}
+
+// SetAgreementFile links the generated agreement file to the loan, the current agreement is marked replaced by it
+func (r *loanRepo) SetAgreementFile(_ context.Context, loanID uuid.UUID, fileID uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if l, ok := r.s.loans[loanID]; ok {
+		l.AggrementFile = fileID
+		l.UpdatedAt = r.s.now()
+		r.s.loans[loanID] = l
+	}
+	for i, d := range r.s.documents {
+		if d.LoanId == loanID && d.DocumentType == loan.DocumentAgreement && d.ReplacedBy == uuid.Nil {
+			r.s.documents[i].ReplacedBy = fileID
+		}
+	}
+	r.insertDocuments([]loan.LoanDocument{
+		{LoanId: loanID, FileId: fileID, DocumentType: loan.DocumentAgreement},
+	})
+	return nil
+}
+
+// CreateRepayment records a borrower repayment and its interest split
+func (r *loanRepo) CreateRepayment(_ context.Context, repayment *loan.LoanRepayment) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.loans[repayment.LoanId]; !ok {
+		return fmt.Errorf("failed to create repayment: %w", pg.ErrNoRows)
+	}
+	repayment.RepaymentId = uuid.New()
+	repayment.CreatedAt = r.s.now()
+	r.s.repayments = append(r.s.repayments, *repayment)
+	return nil
+}
+
+// GetInvestorPortfolio lists the investments of an investor, received payouts are
+// the loan repayments pro rata of the investment share. Empty state lists all.
+func (r *loanRepo) GetInvestorPortfolio(_ context.Context, investorID uuid.UUID, state loan.LoanState) ([]loan.PortfolioItem, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var items []loan.PortfolioItem
+	for _, i := range r.s.investments {
+		l := r.s.loans[i.LoanId]
+		if i.InvestedBy != investorID || (state != "" && l.State != string(state)) {
+			continue
+		}
+
+		principal, interest := 0.0, 0.0
+		for _, p := range r.s.repayments {
+			if p.LoanId != i.LoanId {
+				continue
+			}
+			principal += p.Principal
+			if p.InvestorInterest != 0 {
+				interest += p.InvestorInterest
+			} else {
+				interest += p.Interest
+			}
+		}
+
+		item := loan.PortfolioItem{
+			InvestmentId:  i.InvestmentId,
+			LoanId:        i.LoanId,
+			LoanState:     loan.LoanState(l.State),
+			Amount:        i.Amount,
+			ROI:           investmentROI(i, l),
+			DurationMonth: l.DurationMonth,
+			Voided:        i.VoidedAt != nil,
+			InvestedAt:    i.CreatedAt,
+		}
+		if l.Amount != 0 {
+			item.ReceivedPrincipal = principal * i.Amount / l.Amount
+			item.ReceivedInterest = interest * i.Amount / l.Amount
+		}
+		items = append(items, item)
+	}
+	slices.SortFunc(items, func(a, b loan.PortfolioItem) int { return b.InvestedAt.Compare(a.InvestedAt) })
+	return items, nil
+}
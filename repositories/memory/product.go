@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/product"
+)
+
+type productRepo struct {
+	s *Store
+}
+
+// Create stores a product, codes are unique
+func (r *productRepo) Create(_ context.Context, p *product.Product) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.products {
+		if existing.Code == p.Code {
+			return fmt.Errorf("duplicate product code: %s", p.Code)
+		}
+	}
+
+	if p.ProductId == uuid.Nil {
+		p.ProductId = uuid.New()
+	}
+	p.CreatedAt = r.s.now()
+	p.UpdatedAt = p.CreatedAt
+	r.s.products[p.ProductId] = *p
+	return nil
+}
+
+// Update replaces every field of a product
+func (r *productRepo) Update(_ context.Context, p *product.Product) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.products[p.ProductId]
+	if !ok {
+		return product.ErrProductNotFound
+	}
+	updated := *p
+	updated.CreatedAt = stored.CreatedAt
+	updated.UpdatedAt = r.s.now()
+	r.s.products[p.ProductId] = updated
+	return nil
+}
+
+func (r *productRepo) GetByID(_ context.Context, productID uuid.UUID) (*product.Product, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	p, ok := r.s.products[productID]
+	if !ok {
+		return nil, product.ErrProductNotFound
+	}
+	return &p, nil
+}
+
+// List products ordered by code
+func (r *productRepo) List(_ context.Context, activeOnly bool) ([]product.Product, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var products []product.Product
+	for _, p := range r.s.products {
+		if !activeOnly || p.Active {
+			products = append(products, p)
+		}
+	}
+	slices.SortFunc(products, func(a, b product.Product) int { return strings.Compare(a.Code, b.Code) })
+	return products, nil
+}
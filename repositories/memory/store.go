@@ -0,0 +1,159 @@
+// Package memory implements the repositories in memory for fast service tests.
+// It follows the Postgres implementations, including their triggers and
+// not found errors, see the contract package for the shared test suite.
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+	"github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/product"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	repoAPIKey "github.com/zainulbr/simple-loan-engine/repositories/apikey"
+	repoFile "github.com/zainulbr/simple-loan-engine/repositories/filemanager"
+	repoLoan "github.com/zainulbr/simple-loan-engine/repositories/loan"
+	repoProduct "github.com/zainulbr/simple-loan-engine/repositories/product"
+	"github.com/zainulbr/simple-loan-engine/repositories/uow"
+	repoUser "github.com/zainulbr/simple-loan-engine/repositories/user"
+)
+
+// Store holds the rows of the in-memory repositories, repositories of the same
+// store see each other's rows like the tables of one database
+type Store struct {
+	mu   sync.Mutex
+	txMu sync.Mutex // serializes units of work
+	last time.Time
+
+	tables
+}
+
+// tables are copied as a whole for the rollback of a unit of work,
+// rows are replaced and never modified in place
+type tables struct {
+	users         map[uuid.UUID]user.User
+	files         map[uuid.UUID]filemanager.File
+	accessLogs    []filemanager.AccessLog
+	loans         map[uuid.UUID]loan.Loan
+	approvals     []loan.LoanApproval
+	documents     []loan.LoanDocument
+	investments   []loan.LoanInvestment
+	disbursements []loan.LoanDisbursement
+	changes       []loan.LoanChange
+	repayments    []loan.LoanRepayment
+	products      map[uuid.UUID]product.Product
+	apiKeys       map[uuid.UUID]apikey.APIKey
+}
+
+func NewStore() *Store {
+	return &Store{tables: tables{
+		users: map[uuid.UUID]user.User{},
+		files: map[uuid.UUID]filemanager.File{},
+		loans: map[uuid.UUID]loan.Loan{},
+
+		products: map[uuid.UUID]product.Product{},
+		apiKeys:  map[uuid.UUID]apikey.APIKey{},
+	}}
+}
+
+func (t tables) clone() tables {
+	return tables{
+		users:         maps.Clone(t.users),
+		files:         maps.Clone(t.files),
+		accessLogs:    slices.Clone(t.accessLogs),
+		loans:         maps.Clone(t.loans),
+		approvals:     slices.Clone(t.approvals),
+		documents:     slices.Clone(t.documents),
+		investments:   slices.Clone(t.investments),
+		disbursements: slices.Clone(t.disbursements),
+		changes:       slices.Clone(t.changes),
+		repayments:    slices.Clone(t.repayments),
+		products:      maps.Clone(t.products),
+		apiKeys:       maps.Clone(t.apiKeys),
+	}
+}
+
+// now returns increasing timestamps so rows keep their insertion order
+// when sorted by creation time, like current_timestamp of separate statements
+func (s *Store) now() time.Time {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	if !now.After(s.last) {
+		now = s.last.Add(time.Microsecond)
+	}
+	s.last = now
+	return now
+}
+
+// Users returns the user repository of the store
+func (s *Store) Users() repoUser.UserRepository {
+	return &userRepo{s: s}
+}
+
+// Files returns the file repository of the store
+func (s *Store) Files() repoFile.FileRepository {
+	return &fileRepo{s: s}
+}
+
+// Loans returns the loan repository of the store
+func (s *Store) Loans() repoLoan.LoanRepository {
+	return &loanRepo{s: s}
+}
+
+// Products returns the product repository of the store
+func (s *Store) Products() repoProduct.ProductRepository {
+	return &productRepo{s: s}
+}
+
+// APIKeys returns the API key repository of the store
+func (s *Store) APIKeys() repoAPIKey.APIKeyRepository {
+	return &apiKeyRepo{s: s}
+}
+
+// Repositories returns every repository of the store
+func (s *Store) Repositories() uow.Repositories {
+	return uow.Repositories{Loans: s.Loans(), Files: s.Files(), Users: s.Users(), APIKeys: s.APIKeys()}
+}
+
+// UnitOfWork returns a unit of work restoring the store when it fails. Units
+// of work run one at a time, repository calls outside of them are not isolated.
+func (s *Store) UnitOfWork() uow.UnitOfWork {
+	return &unitOfWork{s: s}
+}
+
+type unitOfWork struct {
+	s *Store
+}
+
+// Do runs fn and restores the rows as they were before when fn returns an error or panics
+func (u *unitOfWork) Do(ctx context.Context, fn func(ctx context.Context, repos uow.Repositories) error) (err error) {
+	u.s.txMu.Lock()
+	defer u.s.txMu.Unlock()
+
+	u.s.mu.Lock()
+	snapshot := u.s.tables.clone()
+	u.s.mu.Unlock()
+
+	rollback := func() {
+		u.s.mu.Lock()
+		u.s.tables = snapshot
+		u.s.mu.Unlock()
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx, u.s.Repositories()); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	"github.com/zainulbr/simple-loan-engine/repositories/uow"
+)
+
+func TestUnitOfWorkCommit(t *testing.T) {
+	s := NewStore()
+	ctx := context.Background()
+
+	var userID uuid.UUID
+	err := s.UnitOfWork().Do(ctx, func(ctx context.Context, repos uow.Repositories) (err error) {
+		userID, err = repos.Users.Create(ctx, user.User{Email: "commit@example.com", Role: user.RoleInvestor})
+		return err
+	})
+	assert.NoError(t, err)
+
+	_, err = s.Users().GetByID(ctx, userID)
+	assert.NoError(t, err)
+}
+
+func TestUnitOfWorkRollback(t *testing.T) {
+	s := NewStore()
+	ctx := context.Background()
+	failed := errors.New("failed")
+
+	var userID uuid.UUID
+	err := s.UnitOfWork().Do(ctx, func(ctx context.Context, repos uow.Repositories) (err error) {
+		userID, err = repos.Users.Create(ctx, user.User{Email: "rollback@example.com", Role: user.RoleInvestor})
+		if err != nil {
+			return err
+		}
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+
+	_, err = s.Users().GetByID(ctx, userID)
+	assert.ErrorIs(t, err, pg.ErrNoRows)
+}
+
+func TestUnitOfWorkRollbackOnPanic(t *testing.T) {
+	s := NewStore()
+	ctx := context.Background()
+
+	var userID uuid.UUID
+	assert.Panics(t, func() {
+		_ = s.UnitOfWork().Do(ctx, func(ctx context.Context, repos uow.Repositories) error {
+			userID, _ = repos.Users.Create(ctx, user.User{Email: "panic@example.com", Role: user.RoleInvestor})
+			panic("boom")
+		})
+	})
+
+	_, err := s.Users().GetByID(ctx, userID)
+	assert.ErrorIs(t, err, pg.ErrNoRows)
+}
@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+)
+
+type userRepo struct {
+	s *Store
+}
+
+// Create stores a user, emails are unique
+func (r *userRepo) Create(_ context.Context, u user.User) (uuid.UUID, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, existing := range r.s.users {
+		if u.Email != "" && existing.Email == u.Email {
+			return uuid.Nil, fmt.Errorf("duplicate email: %s", u.Email)
+		}
+	}
+
+	u.UserId = uuid.New()
+	u.CreatedAt = r.s.now()
+	u.UpdatedAt = u.CreatedAt
+	r.s.users[u.UserId] = u
+	return u.UserId, nil
+}
+
+func (r *userRepo) GetByID(_ context.Context, userID uuid.UUID) (*user.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	u, ok := r.s.users[userID]
+	if !ok {
+		return nil, pg.ErrNoRows
+	}
+	return &u, nil
+}
+
+func (r *userRepo) GetByEmail(_ context.Context, email string) (*user.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, u := range r.s.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, pg.ErrNoRows
+}
+
+func (r *userRepo) Delete(_ context.Context, userID uuid.UUID) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.users, userID)
+	return nil
+}
@@ -0,0 +1,20 @@
+package product
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/product"
+)
+
+type ProductRepository interface {
+	Create(ctx context.Context, product *product.Product) error
+	Update(ctx context.Context, product *product.Product) error
+	GetByID(ctx context.Context, productID uuid.UUID) (*product.Product, error)
+	List(ctx context.Context, activeOnly bool) ([]product.Product, error)
+}
+
+type productModelPG struct {
+	tableName struct{} `pg:"loan.products"` // Schema "loan", Table "products"
+	*product.Product
+}
@@ -0,0 +1,76 @@
+package product
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/product"
+)
+
+type productRepo struct {
+	db *pg.DB
+}
+
+func NewProductRepository(db *pg.DB) ProductRepository {
+	return &productRepo{db: db}
+}
+
+// Create a new product
+func (r *productRepo) Create(ctx context.Context, p *product.Product) error {
+	data := productModelPG{Product: p}
+	_, err := r.db.Model(&data).Context(ctx).Insert()
+	return err
+}
+
+// Update all fields of a product
+func (r *productRepo) Update(ctx context.Context, p *product.Product) error {
+	data := productModelPG{Product: p}
+	res, err := r.db.Model(&data).Context(ctx).
+		Set("code = ?code, name = ?name, description = ?description").
+		Set("min_amount = ?min_amount, max_amount = ?max_amount, durations = ?durations").
+		Set("min_rate = ?min_rate, max_rate = ?max_rate, interest_method = ?interest_method").
+		Set("fee_rule = ?fee_rule, required_documents = ?required_documents, active = ?active").
+		Set("approval_chain = ?approval_chain").
+		Set("updated_at = current_timestamp").
+		Where("product_id = ?product_id").
+		Update()
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return product.ErrProductNotFound
+	}
+	return nil
+}
+
+// Get product by ID
+func (r *productRepo) GetByID(ctx context.Context, productID uuid.UUID) (*product.Product, error) {
+	data := &productModelPG{Product: &product.Product{}}
+	err := r.db.Model(data).Context(ctx).
+		Where("product_id = ?", productID).
+		Select()
+	if errors.Is(err, pg.ErrNoRows) {
+		return nil, product.ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data.Product, nil
+}
+
+// List products ordered by code
+func (r *productRepo) List(ctx context.Context, activeOnly bool) ([]product.Product, error) {
+	var products []product.Product
+	query := `
+		SELECT * FROM loan.products
+		WHERE (NOT ? OR active)
+		ORDER BY code
+	`
+	_, err := r.db.QueryContext(ctx, &products, query, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
@@ -0,0 +1,25 @@
+package uow
+
+import (
+	"context"
+
+	repoAPIKey "github.com/zainulbr/simple-loan-engine/repositories/apikey"
+	repoFile "github.com/zainulbr/simple-loan-engine/repositories/filemanager"
+	repoLoan "github.com/zainulbr/simple-loan-engine/repositories/loan"
+	repoUser "github.com/zainulbr/simple-loan-engine/repositories/user"
+)
+
+// Repositories share the transaction of the unit of work that created them
+type Repositories struct {
+	Loans   repoLoan.LoanRepository
+	Files   repoFile.FileRepository
+	Users   repoUser.UserRepository
+	APIKeys repoAPIKey.APIKeyRepository
+}
+
+// UnitOfWork runs fn with transaction scoped repositories. The transaction
+// commits when fn returns nil and rolls back when it returns an error or panics,
+// the panic is propagated after the rollback.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error
+}
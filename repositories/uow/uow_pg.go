@@ -0,0 +1,31 @@
+package uow
+
+import (
+	"context"
+
+	"github.com/go-pg/pg/v10"
+	repoAPIKey "github.com/zainulbr/simple-loan-engine/repositories/apikey"
+	repoFile "github.com/zainulbr/simple-loan-engine/repositories/filemanager"
+	repoLoan "github.com/zainulbr/simple-loan-engine/repositories/loan"
+	repoUser "github.com/zainulbr/simple-loan-engine/repositories/user"
+)
+
+type unitOfWorkPG struct {
+	db *pg.DB
+}
+
+func NewUnitOfWork(db *pg.DB) UnitOfWork {
+	return &unitOfWorkPG{db: db}
+}
+
+// Do runs fn in a database transaction, pg rolls back on error and panic
+func (u *unitOfWorkPG) Do(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error {
+	return u.db.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		return fn(ctx, Repositories{
+			Loans:   repoLoan.NewLoanRepository(tx),
+			Files:   repoFile.NewFileRepository(tx),
+			Users:   repoUser.NewuserRepository(tx),
+			APIKeys: repoAPIKey.NewAPIKeyRepository(tx),
+		})
+	})
+}
@@ -10,5 +10,6 @@ import (
 type UserRepository interface {
 	Create(ctx context.Context, user user.User) (uuid.UUID, error)
 	GetByID(ctx context.Context, userID uuid.UUID) (*user.User, error)
+	GetByEmail(ctx context.Context, email string) (*user.User, error)
 	Delete(ctx context.Context, userID uuid.UUID) error
 }
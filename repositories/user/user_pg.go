@@ -10,10 +10,10 @@ import (
 )
 
 type userRepository struct {
-	db *pg.DB
+	db pg.DBI
 }
 
-func NewuserRepository(db *pg.DB) UserRepository {
+func NewuserRepository(db pg.DBI) UserRepository {
 	return &userRepository{db: db}
 }
 
@@ -44,6 +44,19 @@ func (r *userRepository) GetByID(ctx context.Context, userID uuid.UUID) (*user.U
 	return user, nil
 }
 
+// Get User by email
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*user.User, error) {
+	user := new(user.User)
+	_, err := r.db.QueryOneContext(ctx,
+		user,
+		`SELECT user_id, email, role, created_at, updated_at FROM "user".users WHERE email = ?`,
+		email)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 // Delete User
 func (r *userRepository) Delete(ctx context.Context, userID uuid.UUID) error {
 	_, err := r.db.ExecContext(ctx,
@@ -0,0 +1,136 @@
+package apikey
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	models "github.com/zainulbr/simple-loan-engine/models/apikey"
+	services "github.com/zainulbr/simple-loan-engine/services/apikey"
+)
+
+type apiKeyController struct {
+	apiKeyService services.APIKeyService
+	authorize     gin.HandlerFunc
+}
+
+type createKeyRequest struct {
+	UserId    uuid.UUID      `json:"user_id" binding:"required"`
+	Name      string         `json:"name" binding:"required"`
+	Scopes    []models.Scope `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time     `json:"expires_at"`
+}
+
+type rotateKeyRequest struct {
+	GracePeriod string `json:"grace_period"` // e.g. 24h, the old key is revoked at once when empty
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrAPIKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrAPIKeyRevoked), errors.Is(err, models.ErrAPIKeyExpired):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// Create API Key (POST /api-keys), the secret is only returned in this response
+func (c *apiKeyController) CreateKey(ctx *gin.Context) {
+	var req createKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	issued, err := c.apiKeyService.CreateKey(ctx.Request.Context(), &models.APIKey{
+		UserId:    req.UserId,
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, issued)
+}
+
+// List API Keys (GET /api-keys)
+func (c *apiKeyController) ListKeys(ctx *gin.Context) {
+	keys, err := c.apiKeyService.ListKeys(ctx.Request.Context())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": keys})
+}
+
+// Get API Key (GET /api-keys/:id)
+func (c *apiKeyController) GetKey(ctx *gin.Context) {
+	keyID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key ID"})
+		return
+	}
+
+	key, err := c.apiKeyService.GetKey(ctx.Request.Context(), keyID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, key)
+}
+
+// Rotate API Key (POST /api-keys/:id/rotate), returns the replacement with its secret
+func (c *apiKeyController) RotateKey(ctx *gin.Context) {
+	keyID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key ID"})
+		return
+	}
+
+	var req rotateKeyRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var grace time.Duration
+	if req.GracePeriod != "" {
+		if grace, err = time.ParseDuration(req.GracePeriod); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid grace period"})
+			return
+		}
+	}
+
+	issued, err := c.apiKeyService.RotateKey(ctx.Request.Context(), keyID, grace)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, issued)
+}
+
+// Revoke API Key (POST /api-keys/:id/revoke)
+func (c *apiKeyController) RevokeKey(ctx *gin.Context) {
+	keyID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key ID"})
+		return
+	}
+
+	if err := c.apiKeyService.RevokeKey(ctx.Request.Context(), keyID); err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
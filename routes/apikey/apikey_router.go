@@ -0,0 +1,40 @@
+package apikey
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zainulbr/simple-loan-engine/middlewares"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	"github.com/zainulbr/simple-loan-engine/registry"
+)
+
+func NewAPIKey(deps *registry.Dependencies) registry.Router {
+	return &apiKeyController{apiKeyService: deps.APIKeys, authorize: middlewares.Authorize(deps.Tokens, deps.APIKeys)}
+}
+
+func (c *apiKeyController) RegisterRoutes(router *gin.RouterGroup) {
+
+	// keys are issued to service accounts by admins only
+	group := router.Group("/api-keys")
+	group.Use(c.authorize, middlewares.RolePermission(user.RoleAdmin))
+
+	group.POST("",
+		c.CreateKey)
+
+	group.GET("",
+		c.ListKeys)
+
+	group.GET("/:id",
+		c.GetKey)
+
+	group.POST("/:id/rotate",
+		c.RotateKey)
+
+	group.POST("/:id/revoke",
+		c.RevokeKey)
+
+}
+
+func init() {
+	registry.RegisterRouter(NewAPIKey)
+
+}
@@ -0,0 +1,19 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	libToken "github.com/zainulbr/simple-loan-engine/libs/token"
+)
+
+type authController struct {
+	tokens libToken.TokenService
+}
+
+// GetJWKS lists the public token signing keys (GET /.well-known/jwks.json),
+// empty when tokens are signed with HMAC secrets only
+func (c *authController) GetJWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, c.tokens.JWKS())
+}
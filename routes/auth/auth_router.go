@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zainulbr/simple-loan-engine/registry"
+)
+
+func NewAuth(deps *registry.Dependencies) registry.Router {
+	return &authController{tokens: deps.Tokens}
+}
+
+func (c *authController) RegisterRoutes(router *gin.RouterGroup) {
+
+	// public, other services verify the tokens of this one
+	router.GET("/.well-known/jwks.json",
+		c.GetJWKS)
+
+}
+
+func init() {
+	registry.RegisterRouter(NewAuth)
+
+}
@@ -0,0 +1,45 @@
+package borrower
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/middlewares"
+	services "github.com/zainulbr/simple-loan-engine/services/loan"
+)
+
+type borrowerController struct {
+	loanService services.LoanService
+	authorize   gin.HandlerFunc
+}
+
+func (c *borrowerController) getUserId(ctx *gin.Context) (uuid.UUID, bool) {
+	userIdString, ok := middlewares.GetClaim(ctx)["loan.user_id"].(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	userId, err := uuid.Parse(userIdString)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userId, true
+}
+
+// GetLoans (GET /borrowers/me/loans)
+func (c *borrowerController) GetLoans(ctx *gin.Context) {
+	userId, ok := c.getUserId(ctx)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	loans, err := c.loanService.GetBorrowerLoans(ctx.Request.Context(), userId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": loans})
+}
@@ -0,0 +1,29 @@
+package borrower
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zainulbr/simple-loan-engine/middlewares"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	"github.com/zainulbr/simple-loan-engine/registry"
+)
+
+func NewBorrower(deps *registry.Dependencies) registry.Router {
+	return &borrowerController{loanService: deps.Loans, authorize: middlewares.Authorize(deps.Tokens, deps.APIKeys)}
+}
+
+func (c *borrowerController) RegisterRoutes(router *gin.RouterGroup) {
+
+	group := router.Group("/borrowers")
+	group.Use(c.authorize)
+
+	// borrower mobile app dashboard
+	group.GET("/me/loans",
+		middlewares.RolePermission(user.RoleBorrower),
+		c.GetLoans)
+
+}
+
+func init() {
+	registry.RegisterRouter(NewBorrower)
+
+}
@@ -1,15 +1,25 @@
 package file
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/libs/imaging"
+	"github.com/zainulbr/simple-loan-engine/models/user"
 	"github.com/zainulbr/simple-loan-engine/services/filemanager"
 )
 
 type fileHandler struct {
 	fileService filemanager.FileService
+	authorize   gin.HandlerFunc
 }
 
 // Get serves file
@@ -23,22 +33,107 @@ func (h *fileHandler) Get(c *gin.Context) {
 		return
 	}
 
-	// Get file path & MIME type
-	filePath, mimeType, err := h.fileService.PreviewFile(c.Request.Context(), fileID)
+	// Get file path & MIME type, thumbnails are requested with size=thumb
+	preview := h.fileService.PreviewFile
+	if c.Query("size") == "thumb" {
+		preview = h.fileService.PreviewThumbnail
+	}
+
+	content, err := preview(c.Request.Context(), fileID)
+	if errors.Is(err, filemanager.ErrFileAccessDenied) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, filemanager.ErrFileTampered) ||
+		errors.Is(err, filemanager.ErrFileNotScanned) ||
+		errors.Is(err, filemanager.ErrFileQuarantined) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Serve inline by default, download=true saves it under its original name
+	disposition := "inline"
 	if c.Query("download") == "true" {
-		// TBD: Serve file as attachment (force download)
-		// c.Header("Content-Disposition", "attachment; filename="+path.Base(filePath))
-		// c.Header("Content-Type", "application/octet-stream") // Force download
-		// c.FileAttachment(filePath, path.Base(filePath))
-		// return
+		disposition = "attachment"
+	}
+	if header := mime.FormatMediaType(disposition, map[string]string{"filename": content.Name}); header != "" {
+		disposition = header
+	}
+	c.Header("Content-Disposition", disposition)
+
+	// Photos keep their location metadata for staff only
+	actor, _ := user.ActorFromContext(c.Request.Context())
+	strip := content.MimeType == "image/jpeg" && !actor.Role.IsStaff()
+	h.serve(c, content, strip)
+}
+
+// serve writes the file with Range and conditional request support, strip
+// serves a JPEG copy without EXIF metadata
+func (h *fileHandler) serve(c *gin.Context, content *filemanager.Preview, strip bool) {
+	f, err := os.Open(content.Path)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var body io.ReadSeeker = f
+	etag := content.ETag
+	if strip {
+		var stripped bytes.Buffer
+		if err := imaging.StripEXIF(&stripped, f); err != nil {
+			log.Printf("failed to serve %s: %s", content.Path, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read image"})
+			return
+		}
+		body = bytes.NewReader(stripped.Bytes())
+		if etag != "" {
+			etag = strings.TrimSuffix(etag, `"`) + `-stripped"`
+		}
+	}
+
+	// ServeContent answers If-None-Match and Range requests from these headers
+	if etag != "" {
+		c.Header("ETag", etag)
+	}
+	c.Header("Content-Type", content.MimeType)
+	http.ServeContent(c.Writer, c.Request, content.Name, info.ModTime(), body)
+}
+
+// Verify checks a SHA-256 digest against the one recorded for the file,
+// so holders of a loan agreement PDF can confirm it was issued by us
+func (h *fileHandler) Verify(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		return
+	}
+
+	sum := c.Query("sha256")
+	if sum == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sha256 is required"})
+		return
+	}
+
+	verification, err := h.fileService.VerifyFile(c.Request.Context(), fileID, sum)
+	if errors.Is(err, filemanager.ErrNoChecksum) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
 	}
 
-	// Set MIME type and serve the file
-	c.Header("Content-Type", mimeType)
-	c.File(filePath)
+	c.JSON(http.StatusOK, gin.H{"data": verification})
 }
@@ -0,0 +1,126 @@
+package file
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	models "github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/services/filemanager"
+)
+
+// previewService serves a single stored file, other methods are not used by Get
+type previewService struct {
+	filemanager.FileService
+	preview *filemanager.Preview
+}
+
+func (s *previewService) PreviewFile(ctx context.Context, fileID uuid.UUID) (*filemanager.Preview, error) {
+	return s.preview, nil
+}
+
+// verifyService answers VerifyFile with a fixed error
+type verifyService struct {
+	filemanager.FileService
+	err error
+}
+
+func (s *verifyService) VerifyFile(ctx context.Context, fileID uuid.UUID, sha256 string) (*models.Verification, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.Verification{FileID: fileID, Match: true, Intact: true}, nil
+}
+
+func newTestRouter(t *testing.T) *gin.Engine {
+	path := filepath.Join(t.TempDir(), uuid.NewString()+".pdf")
+	assert.NoError(t, os.WriteFile(path, []byte("%PDF-1.4 loan agreement"), 0o644))
+
+	h := &fileHandler{fileService: &previewService{preview: &filemanager.Preview{
+		Path:     path,
+		MimeType: "application/pdf",
+		Name:     "perjanjian pinjaman.pdf",
+		ETag:     `"abc123"`,
+	}}}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/files/:id", h.Get)
+	return r
+}
+
+func get(r *gin.Engine, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGetFile(t *testing.T) {
+	r := newTestRouter(t)
+	target := "/files/" + uuid.NewString()
+
+	rec := get(r, target, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "%PDF-1.4 loan agreement", rec.Body.String())
+	assert.Equal(t, "application/pdf", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `"abc123"`, rec.Header().Get("ETag"))
+	assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+	assert.Equal(t, `inline; filename="perjanjian pinjaman.pdf"`, rec.Header().Get("Content-Disposition"))
+
+	rec = get(r, target+"?download=true", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `attachment; filename="perjanjian pinjaman.pdf"`, rec.Header().Get("Content-Disposition"))
+}
+
+func TestGetFilePartialContent(t *testing.T) {
+	r := newTestRouter(t)
+	target := "/files/" + uuid.NewString()
+
+	rec := get(r, target, map[string]string{"Range": "bytes=9-12"})
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "loan", rec.Body.String())
+	assert.Equal(t, "bytes 9-12/23", rec.Header().Get("Content-Range"))
+
+	// ranges are ignored once the file changed
+	rec = get(r, target, map[string]string{"Range": "bytes=9-12", "If-Range": `"other"`})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = get(r, target, map[string]string{"Range": "bytes=100-"})
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, rec.Code)
+}
+
+func TestGetFileNotModified(t *testing.T) {
+	r := newTestRouter(t)
+	target := "/files/" + uuid.NewString()
+
+	rec := get(r, target, map[string]string{"If-None-Match": `"abc123"`})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	rec = get(r, target, map[string]string{"If-None-Match": `"stale"`})
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestVerify(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for err, status := range map[error]int{
+		nil:                         http.StatusOK,
+		filemanager.ErrNoChecksum:   http.StatusConflict,
+		filemanager.ErrNotAgreement: http.StatusNotFound,
+	} {
+		r := gin.New()
+		r.GET("/files/:id/verify", (&fileHandler{fileService: &verifyService{err: err}}).Verify)
+		rec := get(r, "/files/"+uuid.NewString()+"/verify?sha256=abc", nil)
+		assert.Equal(t, status, rec.Code, err)
+	}
+}
@@ -2,26 +2,22 @@ package file
 
 import (
 	"github.com/gin-gonic/gin"
-	"github.com/zainulbr/simple-loan-engine/libs/db/pgsql"
 	"github.com/zainulbr/simple-loan-engine/middlewares"
 	"github.com/zainulbr/simple-loan-engine/registry"
-	"github.com/zainulbr/simple-loan-engine/repositories/filemanager"
-	fileService "github.com/zainulbr/simple-loan-engine/services/filemanager"
 )
 
-func NewFile() registry.Router {
-	// Initialize Repositories
-	fileRepo := filemanager.NewFileRepository(pgsql.DB())
-	// Initialize Services
-	fileManagerService := fileService.NewFileService(fileRepo, "./uploads")
-
-	return &fileHandler{fileService: fileManagerService}
+func NewFile(deps *registry.Dependencies) registry.Router {
+	return &fileHandler{fileService: deps.Files, authorize: middlewares.Authorize(deps.Tokens, deps.APIKeys)}
 }
 
 func (h *fileHandler) RegisterRoutes(router *gin.RouterGroup) {
 
+	// public, third parties verify documents they were given
+	router.GET("/files/:id/verify",
+		h.Verify)
+
 	group := router.Group("/files")
-	group.Use(middlewares.AuthorizeJWT())
+	group.Use(h.authorize)
 
 	// TBD: need one time token for email
 	group.GET("/:id",
@@ -0,0 +1,95 @@
+package investor
+
+import (
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/middlewares"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+	services "github.com/zainulbr/simple-loan-engine/services/loan"
+)
+
+type investorController struct {
+	loanService services.LoanService
+	authorize   gin.HandlerFunc
+}
+
+// errorStatus maps service errors to http status code
+func errorStatus(err error) int {
+	if errors.Is(err, loan.ErrUnknownState) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (c *investorController) getUserId(ctx *gin.Context) (uuid.UUID, bool) {
+	userIdString, ok := middlewares.GetClaim(ctx)["loan.user_id"].(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	userId, err := uuid.Parse(userIdString)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userId, true
+}
+
+// GetPortfolio (GET /investors/me/portfolio?state=&format=csv)
+func (c *investorController) GetPortfolio(ctx *gin.Context) {
+	userId, ok := c.getUserId(ctx)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	state := loan.LoanState(ctx.Query("state"))
+	portfolio, err := c.loanService.GetInvestorPortfolio(ctx.Request.Context(), userId, state)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if ctx.Query("format") == "csv" {
+		writePortfolioCSV(ctx, portfolio)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": portfolio})
+}
+
+// writePortfolioCSV writes one row per investment
+func writePortfolioCSV(ctx *gin.Context, portfolio *loan.Portfolio) {
+	ctx.Header("Content-Type", "text/csv")
+	ctx.Header("Content-Disposition", "attachment; filename=portfolio.csv")
+	ctx.Status(http.StatusOK)
+
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+	w := csv.NewWriter(ctx.Writer)
+	w.Write([]string{
+		"investment_id", "loan_id", "loan_state", "amount", "roi", "duration_month",
+		"expected_return", "received_payout", "outstanding_principal", "voided", "invested_at",
+	})
+	for _, item := range portfolio.Items {
+		w.Write([]string{
+			item.InvestmentId.String(),
+			item.LoanId.String(),
+			string(item.LoanState),
+			money(item.Amount),
+			strconv.FormatFloat(item.ROI, 'f', -1, 64),
+			strconv.Itoa(item.DurationMonth),
+			money(item.ExpectedReturn),
+			money(item.ReceivedPayout),
+			money(item.OutstandingPrincipal),
+			strconv.FormatBool(item.Voided),
+			item.InvestedAt.Format(time.RFC3339),
+		})
+	}
+	w.Flush()
+}
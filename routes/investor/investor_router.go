@@ -0,0 +1,28 @@
+package investor
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zainulbr/simple-loan-engine/middlewares"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	"github.com/zainulbr/simple-loan-engine/registry"
+)
+
+func NewInvestor(deps *registry.Dependencies) registry.Router {
+	return &investorController{loanService: deps.Loans, authorize: middlewares.Authorize(deps.Tokens, deps.APIKeys)}
+}
+
+func (c *investorController) RegisterRoutes(router *gin.RouterGroup) {
+
+	group := router.Group("/investors")
+	group.Use(c.authorize)
+
+	group.GET("/me/portfolio",
+		middlewares.RolePermission(user.RoleInvestor),
+		c.GetPortfolio)
+
+}
+
+func init() {
+	registry.RegisterRouter(NewInvestor)
+
+}
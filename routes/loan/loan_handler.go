@@ -2,6 +2,9 @@ package loan
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"time"
@@ -12,17 +15,44 @@ import (
 	"github.com/zainulbr/simple-loan-engine/models/filemanager"
 	"github.com/zainulbr/simple-loan-engine/models/loan"
 	models "github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/product"
 	fmServices "github.com/zainulbr/simple-loan-engine/services/filemanager"
 	services "github.com/zainulbr/simple-loan-engine/services/loan"
+	"github.com/zainulbr/simple-loan-engine/settings"
 )
 
 // loanController struct
 type loanController struct {
 	loanService        services.LoanService
 	fileManagerService fmServices.FileService
+	uploadLimits       settings.FileOptions
+	authorize          gin.HandlerFunc
 }
 
-
+// errorStatus maps service errors to http status code
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, loan.ErrActionNotPermitted),
+		errors.Is(err, loan.ErrNotLoanProposer),
+		errors.Is(err, loan.ErrDuplicateApprover):
+		return http.StatusForbidden
+	case errors.Is(err, product.ErrProductNotFound),
+		errors.Is(err, product.ErrProductInactive),
+		errors.Is(err, product.ErrNotEligible),
+		errors.Is(err, product.ErrMissingDocument),
+		errors.Is(err, loan.ErrVisitRequired),
+		errors.Is(err, loan.ErrRateRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, loan.ErrInvalidTransition),
+		errors.Is(err, loan.ErrLoanFullyFunded),
+		errors.Is(err, loan.ErrLoanNotFullyFunded),
+		errors.Is(err, loan.ErrApprovalComplete),
+		errors.Is(err, loan.ErrApprovalStarted):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
 
 func (c *loanController) getUserId(ctx *gin.Context) (uuid.UUID, bool) {
 	userIdString, ok := middlewares.GetClaim(ctx)["loan.user_id"].(string)
@@ -55,7 +85,7 @@ func (c *loanController) CreateLoan(ctx *gin.Context) {
 	loan.ProposedBy = userId
 	createdLoan, err := c.loanService.CreateLoan(ctx.Request.Context(), &loan)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -77,10 +107,8 @@ func (c *loanController) ApproveLoan(ctx *gin.Context) {
 	}
 
 	approvedDateStr := ctx.PostForm("approval_date")
-	approvedRateStr := ctx.PostForm("rate")
-
-	if approvedDateStr == "" || approvedRateStr == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "approval_date & rate are required"})
+	if approvedDateStr == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "approval_date is required"})
 		return
 	}
 
@@ -91,53 +119,305 @@ func (c *loanController) ApproveLoan(ctx *gin.Context) {
 		return
 	}
 
-	// Parse approved_date (menggunakan format ISO 8601 atau RFC3339)
-	approvalRate, err := strconv.ParseFloat(approvedRateStr, 64)
+	// Rate is optional on each stage, the final stage applies the latest one
+	var approvalRate float64
+	if approvedRateStr := ctx.PostForm("rate"); approvedRateStr != "" {
+		approvalRate, err = strconv.ParseFloat(approvedRateStr, 64)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid rate format, expected float (e.g., 0.1)"})
+			return
+		}
+	}
+
+	// Optional override of the default funding window
+	var fundingDeadline time.Time
+	if fundingDeadlineStr := ctx.PostForm("funding_deadline"); fundingDeadlineStr != "" {
+		fundingDeadline, err = time.Parse(time.RFC3339, fundingDeadlineStr)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid funding_deadline format, expected RFC3339 (e.g., 2024-03-13T15:04:05Z)"})
+			return
+		}
+	}
+
+	// Handle file upload, visited_file is required by field visit stages only
+	documents, status, err := c.uploadDocuments(ctx, approvalDocumentFields...)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid rate format, expected float (e.g., 0.1)"})
+		ctx.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Handle file upload
-	file, header, err := ctx.Request.FormFile("visited_file")
+	request := loan.LoanApproval{LoanId: loanID}
+	request.VisitedFile = loan.FirstDocument(documents, loan.DocumentVisitedPhoto)
+	request.Documents = documents
+	request.ApprovedBy = userId
+	request.ApprovalDate = approvedDate
+	request.FundingDeadline = fundingDeadline
+	request.Rate = approvalRate
+	request.Comment = ctx.PostForm("comment")
+	err = c.loanService.ApproveLoan(ctx.Request.Context(), &request)
+	if err != nil {
+		// uploads are still pending, the file gc collects them if this cleanup is lost
+		c.deleteDocuments(documents)
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	loanDetail, err := c.loanService.GetLoanDetail(ctx.Request.Context(), loanID)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "visited_file is required"})
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if loanDetail.State != loan.StateApproved {
+		ctx.JSON(http.StatusOK, gin.H{"message": "Approval stage " + request.Stage + " recorded", "data": request})
 		return
 	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Loan approved successfully", "data": request})
+}
+
+// uploadFormFile validates and stores an uploaded form file
+func (c *loanController) uploadFormFile(ctx *gin.Context, header *multipart.FileHeader) (uuid.UUID, int, error) {
+	file, err := header.Open()
+	if err != nil {
+		return uuid.Nil, http.StatusBadRequest, err
+	}
 	defer file.Close()
 
 	// Validate file format
 	if err := c.fileManagerService.ValidateFileFormat(file, header); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return uuid.Nil, http.StatusBadRequest, err
 	}
 
 	// Save file to disk and detail on db
-	// TBD: Need rollback delete when approval loan failed
 	fileDetail, err := c.fileManagerService.UploadFile(ctx.Request.Context(),
 		file,
 		header,
 		filemanager.LocationTypeLocal,
 	)
+	if errors.Is(err, fmServices.ErrFileTooLarge) {
+		return uuid.Nil, http.StatusRequestEntityTooLarge, err
+	}
+	if errors.Is(err, fmServices.ErrFileInfected) {
+		return uuid.Nil, http.StatusUnprocessableEntity, err
+	}
+	if errors.Is(err, fmServices.ErrScanUnavailable) {
+		return uuid.Nil, http.StatusServiceUnavailable, err
+	}
+	if err != nil {
+		return uuid.Nil, http.StatusInternalServerError, err
+	}
+	return fileDetail.FileID, http.StatusOK, nil
+}
 
+// documentField is a multipart field whose files are attached to the loan as documentType
+type documentField struct {
+	name         string
+	documentType loan.DocumentType
+}
+
+var approvalDocumentFields = []documentField{
+	{"visited_file", loan.DocumentVisitedPhoto},
+	{"signed_form", loan.DocumentSignedForm},
+	{"documents", loan.DocumentSupporting},
+}
+
+var disbursementDocumentFields = []documentField{
+	{"disbursed_file", loan.DocumentDisbursementProof},
+	{"documents", loan.DocumentSupporting},
+}
+
+// uploadDocuments stores every file of the fields, files already stored are
+// removed again when one of them fails
+func (c *loanController) uploadDocuments(ctx *gin.Context, fields ...documentField) ([]loan.LoanDocument, int, error) {
+	documents := []loan.LoanDocument{}
+
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		// no files posted
+		return documents, http.StatusOK, nil
+	}
+
+	for _, field := range fields {
+		for _, header := range form.File[field.name] {
+			fileID, status, err := c.uploadFormFile(ctx, header)
+			if err != nil {
+				c.deleteDocuments(documents)
+				return nil, status, fmt.Errorf("%s: %w", field.name, err)
+			}
+			documents = append(documents, loan.LoanDocument{FileId: fileID, DocumentType: field.documentType})
+		}
+	}
+	return documents, http.StatusOK, nil
+}
+
+// deleteDocuments removes files uploaded for a request that failed
+func (c *loanController) deleteDocuments(documents []loan.LoanDocument) {
+	for _, d := range documents {
+		go c.fileManagerService.DiscardFile(context.Background(), d.FileId)
+	}
+}
+
+// Add Loan Documents (POST /loans/:id/documents)
+func (c *loanController) AddLoanDocuments(ctx *gin.Context) {
+	loanID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid loan ID"})
+		return
+	}
+
+	documentType := loan.DocumentSupporting
+	if documentTypeStr := ctx.PostForm("document_type"); documentTypeStr != "" {
+		documentType, err = loan.ParseDocumentType(documentTypeStr)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	documents, status, err := c.uploadDocuments(ctx, documentField{"files", documentType})
+	if err != nil {
+		ctx.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if len(documents) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "files are required"})
+		return
+	}
+
+	attached, err := c.loanService.AddLoanDocuments(ctx.Request.Context(), loanID, documents)
+	if err != nil {
+		c.deleteDocuments(documents)
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": attached})
+}
+
+// Get Loan Approvals (GET /loans/:id/approvals)
+func (c *loanController) GetLoanApprovals(ctx *gin.Context) {
+	loanID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid loan ID"})
+		return
+	}
+
+	progress, err := c.loanService.GetLoanApprovals(ctx.Request.Context(), loanID)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	request := loan.LoanApproval{LoanId: loanID}
-	request.ApprovedBy = userId
-	request.ApprovalDate = approvedDate
-	request.VisitedFile = fileDetail.FileID
-	request.Rate = approvalRate
-	err = c.loanService.ApproveLoan(ctx.Request.Context(), &request)
+
+	ctx.JSON(http.StatusOK, gin.H{"data": progress})
+}
+
+// Update Loan (PATCH /loans/:id)
+func (c *loanController) UpdateLoan(ctx *gin.Context) {
+	loanID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid loan ID"})
+		return
+	}
+
+	var update loan.LoanUpdate
+	if err := ctx.ShouldBindJSON(&update); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loanDetail, err := c.loanService.UpdateLoan(ctx.Request.Context(), loanID, &update)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, loanDetail)
+}
+
+// Cancel Loan (POST /loans/:id/cancel)
+func (c *loanController) CancelLoan(ctx *gin.Context) {
+	loanID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid loan ID"})
+		return
+	}
+
+	userId, ok := c.getUserId(ctx)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var cancellation loan.LoanCancellation
+	// reason is optional
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&cancellation); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	cancellation.LoanId = loanID
+	cancellation.CancelledBy = userId
+
+	err = c.loanService.CancelLoan(ctx.Request.Context(), &cancellation)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Loan cancelled successfully"})
+}
+
+// Get Loan Changes (GET /loans/:id/changes)
+func (c *loanController) GetLoanChanges(ctx *gin.Context) {
+	loanID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid loan ID"})
+		return
+	}
+
+	changes, err := c.loanService.GetLoanChanges(ctx.Request.Context(), loanID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": changes})
+}
+
+// Reject Loan (POST /loans/:id/reject)
+func (c *loanController) RejectLoan(ctx *gin.Context) {
+	loanID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid loan ID"})
+		return
+	}
+
+	err = c.loanService.RejectLoan(ctx.Request.Context(), loanID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Loan rejected successfully"})
+}
+
+// Get Loan Actions (GET /loans/:id/actions)
+func (c *loanController) GetLoanActions(ctx *gin.Context) {
+	loanID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid loan ID"})
+		return
+	}
+
+	actions, err := c.loanService.GetLoanActions(ctx.Request.Context(), loanID)
 	if err != nil {
-		// TBD: refactore validate status first
-		go c.fileManagerService.DeleteFile(context.Background(), fileDetail.FileID)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "Loan approved successfully"})
+	ctx.JSON(http.StatusOK, gin.H{"data": actions})
 }
 
 // Get Loan Detail (GET /loans/:id)
@@ -182,7 +462,7 @@ func (c *loanController) CreateInvestment(ctx *gin.Context) {
 
 	err = c.loanService.CreateInvestment(ctx.Request.Context(), &investment)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -217,47 +497,65 @@ func (c *loanController) CreateDisbursement(ctx *gin.Context) {
 		return
 	}
 
-	// Handle file upload
-	file, header, err := ctx.Request.FormFile("disbursed_file")
+	// Handle file upload, several disbursement proofs and supporting documents may be posted
+	documents, status, err := c.uploadDocuments(ctx, disbursementDocumentFields...)
 	if err != nil {
+		ctx.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	disbursement := loan.LoanDisbursement{LoanId: loanID}
+	disbursement.DisbursementBy = userId
+	disbursement.DisbursmentDate = disbursmentDate
+	disbursement.DisbursedFile = loan.FirstDocument(documents, loan.DocumentDisbursementProof)
+	disbursement.Documents = documents
+
+	if disbursement.DisbursedFile == uuid.Nil {
+		c.deleteDocuments(documents)
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "disbursed_file is required"})
 		return
 	}
-	defer file.Close()
 
-	// Validate file format
-	if err := c.fileManagerService.ValidateFileFormat(file, header); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	err = c.loanService.CreateDisbursement(ctx.Request.Context(), &disbursement)
+	if err != nil {
+		// uploads are still pending, the file gc collects them if this cleanup is lost
+		c.deleteDocuments(documents)
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	// Save file to disk and detail on db
-	// TBD: Need rollback delete when approval loan failed
-	fileDetail, err := c.fileManagerService.UploadFile(ctx.Request.Context(),
-		file,
-		header,
-		filemanager.LocationTypeLocal,
-	)
+	ctx.JSON(http.StatusOK, gin.H{"message": "Loan disbursed successfully"})
+}
 
+// Record Repayment (POST /loans/:id/repayments)
+func (c *loanController) RecordRepayment(ctx *gin.Context) {
+	loanID, err := uuid.Parse(ctx.Param("id"))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid loan ID"})
 		return
 	}
 
-	disbursement := loan.LoanDisbursement{LoanId: loanID}
-	disbursement.DisbursementBy = userId
-	disbursement.DisbursmentDate = disbursmentDate
-	disbursement.DisbursedFile = fileDetail.FileID
+	userId, ok := c.getUserId(ctx)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
 
-	err = c.loanService.CreateDisbursement(ctx.Request.Context(), &disbursement)
+	var repayment loan.LoanRepayment
+	if err := ctx.ShouldBindJSON(&repayment); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	repayment.LoanId = loanID
+	repayment.RecordedBy = userId
+
+	err = c.loanService.RecordRepayment(ctx.Request.Context(), &repayment)
 	if err != nil {
-		// TBD: refactore validate status first
-		go c.fileManagerService.DeleteFile(context.Background(), fileDetail.FileID)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "Loan disbursed successfully"})
+	ctx.JSON(http.StatusOK, gin.H{"data": repayment})
 }
 
 // GetTotalPaymentHandler (GET /loans/:id/total-interest)
@@ -2,34 +2,26 @@ package loan
 
 import (
 	"github.com/gin-gonic/gin"
-	"github.com/zainulbr/simple-loan-engine/libs/db/pgsql"
 	"github.com/zainulbr/simple-loan-engine/middlewares"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
 	"github.com/zainulbr/simple-loan-engine/models/user"
 	"github.com/zainulbr/simple-loan-engine/registry"
-	"github.com/zainulbr/simple-loan-engine/repositories/filemanager"
-	"github.com/zainulbr/simple-loan-engine/repositories/loan"
-	fileService "github.com/zainulbr/simple-loan-engine/services/filemanager"
-	loanService "github.com/zainulbr/simple-loan-engine/services/loan"
 )
 
-func NewLoan() registry.Router {
-	// Initialize Repositories
-	loanRepo := loan.NewLoanRepository(pgsql.DB())
-	fileRepo := filemanager.NewFileRepository(pgsql.DB())
-	// Initialize Services
-	loanService := loanService.NewLoanService(loanRepo, fileRepo)
-	fileManagerService := fileService.NewFileService(fileRepo, "./uploads")
-
+func NewLoan(deps *registry.Dependencies) registry.Router {
 	return &loanController{
-		loanService:        loanService,
-		fileManagerService: fileManagerService,
+		loanService:        deps.Loans,
+		fileManagerService: deps.Files,
+		uploadLimits:       deps.Settings.App.File,
+		authorize:          middlewares.Authorize(deps.Tokens, deps.APIKeys),
 	}
 }
 
 func (c *loanController) RegisterRoutes(router *gin.RouterGroup) {
 
+	// API keys only reach the routes gated by ScopePermission
 	group := router.Group("/loans")
-	group.Use(middlewares.AuthorizeJWT())
+	group.Use(c.authorize)
 
 	group.POST("",
 		middlewares.RolePermission(user.RoleBorrower),
@@ -37,21 +29,57 @@ func (c *loanController) RegisterRoutes(router *gin.RouterGroup) {
 	)
 
 	group.GET("/:id",
+		middlewares.ScopePermission(apikey.ScopeLoansRead),
 		c.GetLoanDetail)
 
+	group.PATCH("/:id",
+		middlewares.RolePermission(user.RoleBorrower),
+		c.UpdateLoan)
+
+	group.POST("/:id/cancel",
+		middlewares.RolePermission(user.RoleBorrower, user.RoleAdmin),
+		c.CancelLoan)
+
+	// borrowers may only attach documents to their own loans
+	group.POST("/:id/documents",
+		middlewares.RolePermission(user.RoleBorrower, user.RoleFiledValidator, user.RoleCreditOfficer,
+			user.RoleFieldOfficer, user.RoleAdmin),
+		middlewares.MaxBodySize(c.uploadLimits.MaxDocumentsSize),
+		c.AddLoanDocuments)
+
+	// the proposing borrower and staff, the service checks the borrower
+	group.GET("/:id/changes",
+		middlewares.RolePermission(user.RoleBorrower, user.RoleFiledValidator, user.RoleCreditOfficer,
+			user.RoleFieldOfficer, user.RoleAdmin),
+		c.GetLoanChanges)
+
+	// actions the caller may perform next
+	group.GET("/:id/actions",
+		middlewares.ScopePermission(apikey.ScopeLoansRead),
+		c.GetLoanActions)
+
 	group.GET("/:id/total-interest",
-		middlewares.RolePermission(user.RoleFieldOfficer),
+		middlewares.ScopePermission(apikey.ScopeLoansRead, user.RoleFieldOfficer),
 		c.GetTotalPayment)
 
 	group.GET("/:id/profit-investor",
-		middlewares.RolePermission(user.RoleFieldOfficer),
+		middlewares.ScopePermission(apikey.ScopeLoansRead, user.RoleFieldOfficer),
 		c.GetInvestorProfitList)
 
-	// TBD: Chanege permission to Field Validator
+	// each approval stage is signed off by its own role, see loan.ApprovalChain
+	group.GET("/:id/approvals",
+		middlewares.ScopePermission(apikey.ScopeLoansRead),
+		c.GetLoanApprovals)
+
 	group.POST("/:id/approve",
-		middlewares.RolePermission(user.RoleFiledValidator),
+		middlewares.RolePermission(user.RoleFiledValidator, user.RoleCreditOfficer, user.RoleAdmin),
+		middlewares.MaxBodySize(c.uploadLimits.MaxApprovalSize),
 		c.ApproveLoan)
 
+	group.POST("/:id/reject",
+		middlewares.RolePermission(user.RoleFiledValidator, user.RoleCreditOfficer, user.RoleAdmin),
+		c.RejectLoan)
+
 	// TBD: Change permission to investor
 	group.POST("/:id/invest",
 		middlewares.RolePermission(user.RoleInvestor),
@@ -59,8 +87,14 @@ func (c *loanController) RegisterRoutes(router *gin.RouterGroup) {
 	// TBD: Change permission to Field Officer
 	group.POST("/:id/disburse",
 		middlewares.RolePermission(user.RoleFieldOfficer),
+		middlewares.MaxBodySize(c.uploadLimits.MaxDisbursementSize),
 		c.CreateDisbursement)
 
+	// recorded by field officers or by the payment gateway with a repayments:write key
+	group.POST("/:id/repayments",
+		middlewares.ScopePermission(apikey.ScopeRepaymentsWrite, user.RoleFieldOfficer),
+		c.RecordRepayment)
+
 }
 
 func init() {
@@ -0,0 +1,114 @@
+package product
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/middlewares"
+	models "github.com/zainulbr/simple-loan-engine/models/product"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	services "github.com/zainulbr/simple-loan-engine/services/product"
+)
+
+type productController struct {
+	productService services.ProductService
+	authorize      gin.HandlerFunc
+}
+
+func errorStatus(err error) int {
+	if errors.Is(err, models.ErrProductNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// Create Product (POST /products)
+func (c *productController) CreateProduct(ctx *gin.Context) {
+	var product models.Product
+	if err := ctx.ShouldBindJSON(&product); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := c.productService.CreateProduct(ctx.Request.Context(), &product)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, created)
+}
+
+// Update Product (PUT /products/:id)
+func (c *productController) UpdateProduct(ctx *gin.Context) {
+	productID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+
+	var product models.Product
+	if err := ctx.ShouldBindJSON(&product); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	product.ProductId = productID
+
+	updated, err := c.productService.UpdateProduct(ctx.Request.Context(), &product)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, updated)
+}
+
+// Deactivate Product (DELETE /products/:id)
+func (c *productController) DeactivateProduct(ctx *gin.Context) {
+	productID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+
+	err = c.productService.DeactivateProduct(ctx.Request.Context(), productID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Product deactivated successfully"})
+}
+
+// Get Product (GET /products/:id)
+func (c *productController) GetProduct(ctx *gin.Context) {
+	productID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+
+	product, err := c.productService.GetProduct(ctx.Request.Context(), productID)
+	if err != nil {
+		ctx.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, product)
+}
+
+// List Products (GET /products), only admins see inactive products
+func (c *productController) ListProducts(ctx *gin.Context) {
+	role, _ := middlewares.GetClaim(ctx)["loan.role"].(string)
+	activeOnly := role != string(user.RoleAdmin) || ctx.Query("all") != "true"
+
+	products, err := c.productService.ListProducts(ctx.Request.Context(), activeOnly)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"data": products})
+}
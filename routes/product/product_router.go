@@ -0,0 +1,45 @@
+package product
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zainulbr/simple-loan-engine/middlewares"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	"github.com/zainulbr/simple-loan-engine/registry"
+)
+
+func NewProduct(deps *registry.Dependencies) registry.Router {
+	return &productController{productService: deps.Products, authorize: middlewares.Authorize(deps.Tokens, deps.APIKeys)}
+}
+
+func (c *productController) RegisterRoutes(router *gin.RouterGroup) {
+
+	group := router.Group("/products")
+	group.Use(c.authorize)
+
+	group.GET("",
+		middlewares.ScopePermission(apikey.ScopeProductsRead),
+		c.ListProducts)
+
+	group.GET("/:id",
+		middlewares.ScopePermission(apikey.ScopeProductsRead),
+		c.GetProduct)
+
+	group.POST("",
+		middlewares.RolePermission(user.RoleAdmin),
+		c.CreateProduct)
+
+	group.PUT("/:id",
+		middlewares.RolePermission(user.RoleAdmin),
+		c.UpdateProduct)
+
+	group.DELETE("/:id",
+		middlewares.RolePermission(user.RoleAdmin),
+		c.DeactivateProduct)
+
+}
+
+func init() {
+	registry.RegisterRouter(NewProduct)
+
+}
@@ -0,0 +1,51 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/libs/clock"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+)
+
+var (
+	ErrNotServiceAccount = errors.New("api keys are only issued to service accounts")
+	ErrNameRequired      = errors.New("api key name is required")
+	ErrExpiryInPast      = errors.New("api key expiry must be in the future")
+	ErrNegativeGrace     = errors.New("grace period must not be negative")
+)
+
+// lastUsedResolution bounds the writes of last use tracking to one per key and interval
+const lastUsedResolution = time.Minute
+
+// Issued is a key with its secret, the secret is only returned once
+type Issued struct {
+	APIKey *apikey.APIKey `json:"api_key"`
+	Secret string         `json:"secret"`
+}
+
+// APIKeyService manages the API keys of service accounts
+type APIKeyService interface {
+	// CreateKey issues a key to a service account, the actor in ctx is recorded as creator
+	CreateKey(ctx context.Context, key *apikey.APIKey) (*Issued, error)
+	GetKey(ctx context.Context, keyID uuid.UUID) (*apikey.APIKey, error)
+	ListKeys(ctx context.Context) ([]apikey.APIKey, error)
+	// RotateKey issues a replacement with the same account, name, scopes and expiry,
+	// the old key keeps working for grace and is revoked at once when grace is zero
+	RotateKey(ctx context.Context, keyID uuid.UUID, grace time.Duration) (*Issued, error)
+	RevokeKey(ctx context.Context, keyID uuid.UUID) error
+	// Authenticate returns the key matching secret when it may be used
+	Authenticate(ctx context.Context, secret string) (*apikey.APIKey, error)
+}
+
+// Option configures the API key service
+type Option func(*apiKeyService)
+
+// WithClock replaces the system clock, for tests
+func WithClock(c clock.Clock) Option {
+	return func(s *apiKeyService) {
+		s.clock = c
+	}
+}
@@ -0,0 +1,171 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/libs/clock"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	apiKeyRepository "github.com/zainulbr/simple-loan-engine/repositories/apikey"
+	"github.com/zainulbr/simple-loan-engine/repositories/uow"
+	userRepository "github.com/zainulbr/simple-loan-engine/repositories/user"
+)
+
+type apiKeyService struct {
+	keyRepo    apiKeyRepository.APIKeyRepository
+	userRepo   userRepository.UserRepository
+	unitOfWork uow.UnitOfWork
+	clock      clock.Clock
+}
+
+// NewAPIKeyService creates a new instance of APIKeyService
+func NewAPIKeyService(keyRepo apiKeyRepository.APIKeyRepository, userRepo userRepository.UserRepository,
+	unitOfWork uow.UnitOfWork, opts ...Option) APIKeyService {
+	s := &apiKeyService{keyRepo: keyRepo, userRepo: userRepo, unitOfWork: unitOfWork, clock: clock.Real()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// CreateKey validates and stores a new key of a service account
+func (s *apiKeyService) CreateKey(ctx context.Context, key *apikey.APIKey) (*Issued, error) {
+	if key.Name == "" {
+		return nil, ErrNameRequired
+	}
+	if err := apikey.ValidateScopes(key.Scopes); err != nil {
+		return nil, err
+	}
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(s.clock.Now()) {
+		return nil, ErrExpiryInPast
+	}
+
+	account, err := s.userRepo.GetByID(ctx, key.UserId)
+	if errors.Is(err, pg.ErrNoRows) || (err == nil && account.Role != user.RoleService) {
+		return nil, ErrNotServiceAccount
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	issued := &apikey.APIKey{
+		KeyId:     uuid.New(),
+		UserId:    key.UserId,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		ExpiresAt: key.ExpiresAt,
+	}
+	if actor, ok := user.ActorFromContext(ctx); ok {
+		issued.CreatedBy = actor.UserId
+	}
+	return s.issue(ctx, s.keyRepo, issued)
+}
+
+// issue generates the secret of key and stores it
+func (s *apiKeyService) issue(ctx context.Context, repo apiKeyRepository.APIKeyRepository, key *apikey.APIKey) (*Issued, error) {
+	secret, err := key.Generate()
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.Create(ctx, key); err != nil {
+		return nil, err
+	}
+	return &Issued{APIKey: key, Secret: secret}, nil
+}
+
+// GetKey returns a key by ID
+func (s *apiKeyService) GetKey(ctx context.Context, keyID uuid.UUID) (*apikey.APIKey, error) {
+	return s.keyRepo.GetByID(ctx, keyID)
+}
+
+// ListKeys returns every key, newest first
+func (s *apiKeyService) ListKeys(ctx context.Context) ([]apikey.APIKey, error) {
+	return s.keyRepo.List(ctx)
+}
+
+// RotateKey replaces a key, both keys are valid during grace so callers switch without downtime
+func (s *apiKeyService) RotateKey(ctx context.Context, keyID uuid.UUID, grace time.Duration) (*Issued, error) {
+	if grace < 0 {
+		return nil, ErrNegativeGrace
+	}
+
+	var issued *Issued
+	err := s.unitOfWork.Do(ctx, func(ctx context.Context, repos uow.Repositories) error {
+		old, err := repos.APIKeys.GetByID(ctx, keyID)
+		if err != nil {
+			return err
+		}
+		now := s.clock.Now()
+		if err := old.Check(now); err != nil {
+			return err
+		}
+
+		replacement := &apikey.APIKey{
+			KeyId:     uuid.New(),
+			UserId:    old.UserId,
+			Name:      old.Name,
+			Scopes:    old.Scopes,
+			ExpiresAt: old.ExpiresAt,
+			CreatedBy: old.CreatedBy,
+		}
+		if actor, ok := user.ActorFromContext(ctx); ok {
+			replacement.CreatedBy = actor.UserId
+		}
+		issued, err = s.issue(ctx, repos.APIKeys, replacement)
+		if err != nil {
+			return err
+		}
+
+		if grace == 0 {
+			return repos.APIKeys.Revoke(ctx, keyID, now)
+		}
+		return repos.APIKeys.Expire(ctx, keyID, now.Add(grace))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+// RevokeKey stops a key at once, revoking a revoked key is a no-op
+func (s *apiKeyService) RevokeKey(ctx context.Context, keyID uuid.UUID) error {
+	return s.keyRepo.Revoke(ctx, keyID, s.clock.Now())
+}
+
+// Authenticate looks the key up by its prefix and compares the hash of the secret
+func (s *apiKeyService) Authenticate(ctx context.Context, secret string) (*apikey.APIKey, error) {
+	prefix, err := apikey.ParsePrefix(secret)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.keyRepo.GetByPrefix(ctx, prefix)
+	if errors.Is(err, apikey.ErrAPIKeyNotFound) {
+		return nil, apikey.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !key.Matches(secret) {
+		return nil, apikey.ErrInvalidAPIKey
+	}
+
+	now := s.clock.Now()
+	if err := key.Check(now); err != nil {
+		return nil, err
+	}
+
+	// last use is informative, a failed write does not refuse the request
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		if err := s.keyRepo.Touch(ctx, key.KeyId, now); err != nil {
+			log.Printf("failed to record use of api key %s: %s", key.Prefix, err)
+		} else {
+			key.LastUsedAt = &now
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,166 @@
+package apikey
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zainulbr/simple-loan-engine/libs/clock"
+	"github.com/zainulbr/simple-loan-engine/models/apikey"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	"github.com/zainulbr/simple-loan-engine/repositories/memory"
+)
+
+func setupService(t *testing.T) (APIKeyService, *memory.Store, *clock.FakeClock) {
+	store := memory.NewStore()
+	now := clock.NewFake(time.Now().UTC().Truncate(time.Second))
+	return NewAPIKeyService(store.APIKeys(), store.Users(), store.UnitOfWork(), WithClock(now)), store, now
+}
+
+func createUser(t *testing.T, store *memory.Store, role user.UserRole) uuid.UUID {
+	id, err := store.Users().Create(context.Background(), user.User{Email: uuid.NewString() + "@example.com", Role: role})
+	require.NoError(t, err)
+	return id
+}
+
+// adminContext returns a context acting as a new admin
+func adminContext(t *testing.T, store *memory.Store) (context.Context, uuid.UUID) {
+	admin := createUser(t, store, user.RoleAdmin)
+	return user.ContextWithActor(context.Background(), user.Actor{UserId: admin, Role: user.RoleAdmin}), admin
+}
+
+func TestCreateKey(t *testing.T) {
+	s, store, now := setupService(t)
+	ctx, admin := adminContext(t, store)
+	service := createUser(t, store, user.RoleService)
+
+	expiresAt := now.Now().Add(24 * time.Hour)
+	issued, err := s.CreateKey(ctx, &apikey.APIKey{
+		UserId: service, Name: "payments", Scopes: []apikey.Scope{apikey.ScopeRepaymentsWrite}, ExpiresAt: &expiresAt,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, admin, issued.APIKey.CreatedBy)
+	assert.True(t, apikey.IsKey(issued.Secret))
+
+	stored, err := s.GetKey(ctx, issued.APIKey.KeyId)
+	require.NoError(t, err)
+	assert.NotContains(t, stored.Hash, issued.Secret, "only the hash is stored")
+	assert.True(t, stored.Matches(issued.Secret))
+
+	for name, key := range map[string]struct {
+		key *apikey.APIKey
+		err error
+	}{
+		"no name":      {&apikey.APIKey{UserId: service, Scopes: []apikey.Scope{apikey.ScopeLoansRead}}, ErrNameRequired},
+		"no scope":     {&apikey.APIKey{UserId: service, Name: "x"}, apikey.ErrNoScopes},
+		"bad scope":    {&apikey.APIKey{UserId: service, Name: "x", Scopes: []apikey.Scope{"loans:delete"}}, apikey.ErrInvalidScope},
+		"expired":      {&apikey.APIKey{UserId: service, Name: "x", Scopes: []apikey.Scope{apikey.ScopeLoansRead}, ExpiresAt: &time.Time{}}, ErrExpiryInPast},
+		"staff":        {&apikey.APIKey{UserId: admin, Name: "x", Scopes: []apikey.Scope{apikey.ScopeLoansRead}}, ErrNotServiceAccount},
+		"unknown user": {&apikey.APIKey{UserId: uuid.New(), Name: "x", Scopes: []apikey.Scope{apikey.ScopeLoansRead}}, ErrNotServiceAccount},
+	} {
+		_, err := s.CreateKey(ctx, key.key)
+		assert.ErrorIs(t, err, key.err, name)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, store, now := setupService(t)
+	ctx, _ := adminContext(t, store)
+	service := createUser(t, store, user.RoleService)
+
+	expiresAt := now.Now().Add(time.Hour)
+	issued, err := s.CreateKey(ctx, &apikey.APIKey{
+		UserId: service, Name: "reports", Scopes: []apikey.Scope{apikey.ScopeLoansRead}, ExpiresAt: &expiresAt,
+	})
+	require.NoError(t, err)
+
+	key, err := s.Authenticate(context.Background(), issued.Secret)
+	require.NoError(t, err)
+	assert.Equal(t, service, key.UserId)
+	firstUse := now.Now()
+
+	// uses within the resolution are not written
+	now.Advance(30 * time.Second)
+	_, err = s.Authenticate(context.Background(), issued.Secret)
+	require.NoError(t, err)
+	stored, _ := s.GetKey(ctx, key.KeyId)
+	assert.True(t, firstUse.Equal(*stored.LastUsedAt))
+
+	now.Advance(time.Minute)
+	_, err = s.Authenticate(context.Background(), issued.Secret)
+	require.NoError(t, err)
+	stored, _ = s.GetKey(ctx, key.KeyId)
+	assert.True(t, now.Now().Equal(*stored.LastUsedAt))
+
+	_, err = s.Authenticate(context.Background(), issued.Secret+"x")
+	assert.ErrorIs(t, err, apikey.ErrInvalidAPIKey)
+	_, err = s.Authenticate(context.Background(), "sle_00000000_secret")
+	assert.ErrorIs(t, err, apikey.ErrInvalidAPIKey)
+
+	now.Advance(time.Hour)
+	_, err = s.Authenticate(context.Background(), issued.Secret)
+	assert.ErrorIs(t, err, apikey.ErrAPIKeyExpired)
+}
+
+func TestRotateKey(t *testing.T) {
+	s, store, now := setupService(t)
+	ctx, _ := adminContext(t, store)
+	service := createUser(t, store, user.RoleService)
+
+	old, err := s.CreateKey(ctx, &apikey.APIKey{UserId: service, Name: "payments", Scopes: []apikey.Scope{apikey.ScopeRepaymentsWrite}})
+	require.NoError(t, err)
+
+	_, err = s.RotateKey(ctx, old.APIKey.KeyId, -time.Minute)
+	assert.ErrorIs(t, err, ErrNegativeGrace)
+
+	rotated, err := s.RotateKey(ctx, old.APIKey.KeyId, time.Hour)
+	require.NoError(t, err)
+	assert.NotEqual(t, old.APIKey.Prefix, rotated.APIKey.Prefix)
+	assert.Equal(t, old.APIKey.Name, rotated.APIKey.Name)
+	assert.Equal(t, old.APIKey.Scopes, rotated.APIKey.Scopes)
+
+	// both keys work during the grace period
+	_, err = s.Authenticate(context.Background(), old.Secret)
+	assert.NoError(t, err)
+	_, err = s.Authenticate(context.Background(), rotated.Secret)
+	assert.NoError(t, err)
+
+	now.Advance(time.Hour)
+	_, err = s.Authenticate(context.Background(), old.Secret)
+	assert.ErrorIs(t, err, apikey.ErrAPIKeyExpired)
+	_, err = s.Authenticate(context.Background(), rotated.Secret)
+	assert.NoError(t, err)
+
+	// without grace the old key is revoked at once
+	again, err := s.RotateKey(ctx, rotated.APIKey.KeyId, 0)
+	require.NoError(t, err)
+	_, err = s.Authenticate(context.Background(), rotated.Secret)
+	assert.ErrorIs(t, err, apikey.ErrAPIKeyRevoked)
+	_, err = s.Authenticate(context.Background(), again.Secret)
+	assert.NoError(t, err)
+
+	_, err = s.RotateKey(ctx, rotated.APIKey.KeyId, 0)
+	assert.ErrorIs(t, err, apikey.ErrAPIKeyRevoked, "a revoked key can not be rotated")
+
+	keys, err := s.ListKeys(ctx)
+	require.NoError(t, err)
+	assert.Len(t, keys, 3)
+}
+
+func TestRevokeKey(t *testing.T) {
+	s, store, _ := setupService(t)
+	ctx, _ := adminContext(t, store)
+	service := createUser(t, store, user.RoleService)
+
+	issued, err := s.CreateKey(ctx, &apikey.APIKey{UserId: service, Name: "reports", Scopes: []apikey.Scope{apikey.ScopeLoansRead}})
+	require.NoError(t, err)
+
+	require.NoError(t, s.RevokeKey(ctx, issued.APIKey.KeyId))
+	_, err = s.Authenticate(context.Background(), issued.Secret)
+	assert.ErrorIs(t, err, apikey.ErrAPIKeyRevoked)
+
+	assert.ErrorIs(t, s.RevokeKey(ctx, uuid.New()), apikey.ErrAPIKeyNotFound)
+}
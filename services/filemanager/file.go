@@ -2,9 +2,12 @@ package filemanager
 
 import (
 	"context"
+	"errors"
 	"mime/multipart"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/libs/scanner"
 	"github.com/zainulbr/simple-loan-engine/models/filemanager"
 )
 
@@ -13,10 +16,70 @@ type FileService interface {
 	UploadFile(ctx context.Context, file multipart.File, fileHeader *multipart.FileHeader, locationType filemanager.LocationType) (*filemanager.File, error)
 	GetFileByID(ctx context.Context, fileID uuid.UUID) (*filemanager.File, error)
 	DeleteFile(ctx context.Context, fileID uuid.UUID) error
+	DiscardFile(ctx context.Context, fileID uuid.UUID) error
+	VerifyFile(ctx context.Context, fileID uuid.UUID, sha256 string) (*filemanager.Verification, error)
 	ValidateFileFormat(file multipart.File, fileHeader *multipart.FileHeader) error
-	PreviewFile(ctx context.Context, fileID uuid.UUID) (string, string, error)
+	PreviewFile(ctx context.Context, fileID uuid.UUID) (*Preview, error)
+	PreviewThumbnail(ctx context.Context, fileID uuid.UUID) (*Preview, error)
+	CollectOrphans(ctx context.Context, before time.Time, dryRun bool) ([]filemanager.File, error)
 }
 
+var (
+	// ErrNoThumbnail is returned for files without a thumbnail, e.g. PDF documents
+	ErrNoThumbnail = errors.New("file has no thumbnail")
+	// ErrNotAgreement is returned when verifying a file that is not a loan agreement
+	ErrNotAgreement = errors.New("file is not a loan agreement")
+	// ErrNoChecksum is returned for files stored before digests were recorded
+	ErrNoChecksum = errors.New("file has no recorded checksum")
+	// ErrFileTampered is returned when the stored content no longer matches its digest
+	ErrFileTampered = errors.New("file content does not match its checksum")
+	// ErrFileAccessDenied is returned when the actor is not related to the file
+	ErrFileAccessDenied = errors.New("not allowed to access this file")
+	// ErrFileTooLarge is returned for uploads above the configured maximum size
+	ErrFileTooLarge = errors.New("file exceeds the maximum upload size")
+	// ErrFileInfected is returned for uploads the malware scanner flagged, they are quarantined
+	ErrFileInfected = errors.New("file is infected and was quarantined")
+	// ErrScanUnavailable is returned for uploads the malware scanner gave no verdict on
+	ErrScanUnavailable = errors.New("malware scan is unavailable, try again later")
+	// ErrFileNotScanned is returned for files without a clean scan verdict yet
+	ErrFileNotScanned = errors.New("file has not passed the malware scan")
+	// ErrFileQuarantined is returned for files the malware scanner flagged
+	ErrFileQuarantined = errors.New("file is quarantined")
+)
+
+// Preview is a stored file ready to be served over HTTP
+type Preview struct {
+	Path     string
+	MimeType string
+	Name     string // original label, used as the download file name
+	ETag     string // quoted entity tag derived from the content digest, empty when unknown
+}
+
+// Option configures the file service
+type Option func(*fileService)
+
+// WithScanner scans every upload for malware before it can be served, nil keeps scanning disabled
+func WithScanner(sc scanner.Scanner) Option {
+	return func(s *fileService) {
+		if sc != nil {
+			s.scanner = sc
+		}
+	}
+}
+
+// WithMaxFileSize rejects uploaded files larger than size bytes, zero disables the limit
+func WithMaxFileSize(size int64) Option {
+	return func(s *fileService) {
+		s.maxFileSize = size
+	}
+}
+
+// quarantineDir is the directory under the upload path infected files are moved to
+const quarantineDir = "quarantine"
+
+// thumbnailSize is the maximum width and height of image thumbnails
+const thumbnailSize = 256
+
 // Allowed file extensions and MIME types
 var allowedExtensions = map[string]string{
 	".jpg":  "image/jpeg",
@@ -2,28 +2,46 @@ package filemanager
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/go-pg/pg/v10"
 	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/libs/checksum"
+	"github.com/zainulbr/simple-loan-engine/libs/imaging"
+	"github.com/zainulbr/simple-loan-engine/libs/scanner"
 	"github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/user"
 	repoFile "github.com/zainulbr/simple-loan-engine/repositories/filemanager"
 )
 
 type fileService struct {
-	fileRepo repoFile.FileRepository
-	basePath string // Directory untuk menyimpan file
+	fileRepo    repoFile.FileRepository
+	basePath    string // Directory untuk menyimpan file
+	maxFileSize int64
+	scanner     scanner.Scanner
 }
 
 // NewFileService creates a new instance of FileService
-func NewFileService(repo repoFile.FileRepository, basePath string) FileService {
-	return &fileService{fileRepo: repo, basePath: basePath}
+func NewFileService(repo repoFile.FileRepository, basePath string, opts ...Option) FileService {
+	s := &fileService{fileRepo: repo, basePath: basePath, scanner: scanner.Noop{}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Validate file extension and MIME type
@@ -36,12 +54,13 @@ func (s *fileService) ValidateFileFormat(file multipart.File, fileHeader *multip
 		return errors.New("invalid file type: only JPG, PNG, PDF are allowed")
 	}
 
-	// Validate MIME type
+	// Validate MIME type, files shorter than the sniffing window are fine
 	buffer := make([]byte, 512)
-	_, err := file.Read(buffer)
-	if err != nil {
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
 		return errors.New("failed to read file header")
 	}
+	buffer = buffer[:n]
 
 	// Reset file pointer
 	_, err = file.Seek(0, 0)
@@ -62,6 +81,10 @@ func (s *fileService) UploadFile(ctx context.Context, file multipart.File,
 	fileHeader *multipart.FileHeader,
 	locationType filemanager.LocationType) (*filemanager.File, error) {
 
+	if s.maxFileSize > 0 && fileHeader.Size > s.maxFileSize {
+		return nil, ErrFileTooLarge
+	}
+
 	// Generate unique filename
 	ext := filepath.Ext(fileHeader.Filename)
 	newFileName := uuid.New().String() + ext
@@ -74,10 +97,41 @@ func (s *fileService) UploadFile(ctx context.Context, file multipart.File,
 	}
 	defer outFile.Close()
 
-	_, err = outFile.ReadFrom(file)
+	// Hash the content while it is written, reading one byte past the limit
+	// tells an oversize file apart from one of exactly the maximum size
+	digest := sha256.New()
+	var src io.Reader = file
+	if s.maxFileSize > 0 {
+		src = io.LimitReader(file, s.maxFileSize+1)
+	}
+	written, err := io.Copy(outFile, io.TeeReader(src, digest))
+	if err == nil && s.maxFileSize > 0 && written > s.maxFileSize {
+		err = ErrFileTooLarge
+	}
 	if err != nil {
+		outFile.Close()
+		os.Remove(filePath)
+		if errors.Is(err, ErrFileTooLarge) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to save file: %w", err)
 	}
+	sum := hex.EncodeToString(digest.Sum(nil))
+
+	// Content the uploader already stored is reused instead of stored twice,
+	// a file of another user must not become accessible through this upload
+	actor, hasActor := user.ActorFromContext(ctx)
+	if hasActor {
+		if existing, err := s.fileRepo.GetCommittedByHash(ctx, sum, actor.UserId); err == nil {
+			if _, err := os.Stat(existing.Location); err == nil {
+				outFile.Close()
+				os.Remove(filePath)
+				return existing, nil
+			}
+		} else if !errors.Is(err, pg.ErrNoRows) {
+			return nil, fmt.Errorf("failed to look up file: %w", err)
+		}
+	}
 
 	// Create file entry in DB
 	newFile := &filemanager.File{
@@ -86,16 +140,101 @@ func (s *fileService) UploadFile(ctx context.Context, file multipart.File,
 		Location:     filePath,
 		FileType:     ext,
 		LocationType: filemanager.LocationTypeLocal,
+		Status:       filemanager.StatusPending, // committed by the loan action using the file
+		Sha256:       sum,
+	}
+	if hasActor {
+		newFile.UploadedBy = actor.UserId
+	}
+
+	// Photo metadata and thumbnail are best effort, the upload itself succeeded
+	if err := s.processImage(newFile); err != nil {
+		log.Printf("failed to process image %s: %s", newFile.Location, err)
 	}
 
+	// The record exists before the verdict, a file stuck in pending is never served
+	newFile.ScanStatus = filemanager.ScanPending
 	err = s.fileRepo.Create(ctx, newFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to save file metadata: %w", err)
 	}
 
+	if err := s.scan(ctx, newFile); err != nil {
+		return nil, err
+	}
+
 	return newFile, nil
 }
 
+// scan runs the malware scanner over a stored upload and records its verdict.
+// Infected files are quarantined, files without a verdict stay pending and
+// are removed by the file gc.
+func (s *fileService) scan(ctx context.Context, file *filemanager.File) error {
+	src, err := os.Open(file.Location)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	result, scanErr := s.scanner.Scan(ctx, src)
+	src.Close()
+
+	now := time.Now()
+	file.ScannedAt = &now
+	switch {
+	case scanErr != nil:
+		log.Printf("failed to scan file %s: %s", file.FileID, scanErr)
+		file.ScanStatus = filemanager.ScanFailed
+	case result.Infected:
+		log.Printf("file %s is infected with %s, quarantined", file.FileID, result.Signature)
+		file.ScanStatus = filemanager.ScanQuarantined
+		file.ScanSignature = result.Signature
+		if err := s.quarantine(file); err != nil {
+			log.Printf("failed to quarantine file %s: %s", file.FileID, err)
+		}
+	default:
+		file.ScanStatus = filemanager.ScanClean
+	}
+
+	if err := s.fileRepo.UpdateScan(ctx, file); err != nil {
+		return fmt.Errorf("failed to save scan result: %w", err)
+	}
+
+	switch file.ScanStatus {
+	case filemanager.ScanFailed:
+		return ErrScanUnavailable
+	case filemanager.ScanQuarantined:
+		return ErrFileInfected
+	}
+	return nil
+}
+
+// quarantine moves an infected file out of the upload directory and drops its thumbnail
+func (s *fileService) quarantine(file *filemanager.File) error {
+	dir := filepath.Join(s.basePath, quarantineDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	removeThumbnail(file)
+	file.ThumbnailLocation = ""
+
+	dest := filepath.Join(dir, filepath.Base(file.Location))
+	if err := os.Rename(file.Location, dest); err != nil {
+		return err
+	}
+	file.Location = dest
+	return os.Chmod(dest, 0o400)
+}
+
+// checkScan refuses files without a clean malware scan verdict
+func checkScan(file *filemanager.File) error {
+	switch {
+	case file.ScanStatus == filemanager.ScanQuarantined:
+		return ErrFileQuarantined
+	case !file.ScanStatus.Servable():
+		return ErrFileNotScanned
+	}
+	return nil
+}
+
 // GetFileByID retrieves a file metadata by ID
 func (s *fileService) GetFileByID(ctx context.Context, fileID uuid.UUID) (*filemanager.File, error) {
 	return s.fileRepo.GetByID(ctx, fileID)
@@ -113,22 +252,34 @@ func (s *fileService) DeleteFile(ctx context.Context, fileID uuid.UUID) error {
 	if err := os.Remove(file.Location); err != nil {
 		return fmt.Errorf("failed to delete file from disk: %w", err)
 	}
+	removeThumbnail(file)
 
 	// Delete from DB
 	return s.fileRepo.Delete(ctx, fileID)
 }
 
-// PreviewFile returns the file path and MIME type for serving as HTTP response
-func (s *fileService) PreviewFile(ctx context.Context, fileID uuid.UUID) (string, string, error) {
+// PreviewFile returns the file path, MIME type and entity tag for serving as HTTP response
+func (s *fileService) PreviewFile(ctx context.Context, fileID uuid.UUID) (*Preview, error) {
 	// Get file metadata from database
 	file, err := s.fileRepo.GetByID(ctx, fileID)
 	if err != nil {
-		return "", "", fmt.Errorf("file not found: %w", err)
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if err := s.authorize(ctx, file, filemanager.AccessPreview); err != nil {
+		return nil, err
+	}
+	if err := checkScan(file); err != nil {
+		return nil, err
 	}
 
 	// Check if file exists
 	if _, err := os.Stat(file.Location); errors.Is(err, os.ErrNotExist) {
-		return "", "", fmt.Errorf("file does not exist: %s", file.Location)
+		return nil, fmt.Errorf("file does not exist: %s", file.Location)
+	}
+
+	// Refuse to serve content changed since it was stored
+	if err := s.checkIntegrity(file); err != nil {
+		return nil, err
 	}
 
 	// Determine MIME type based on extension
@@ -138,5 +289,231 @@ func (s *fileService) PreviewFile(ctx context.Context, fileID uuid.UUID) (string
 		mimeType = "application/octet-stream"
 	}
 
-	return file.Location, mimeType, nil
+	return &Preview{
+		Path:     file.Location,
+		MimeType: mimeType,
+		Name:     file.Label,
+		ETag:     entityTag(file.Sha256, ""),
+	}, nil
+}
+
+// entityTag quotes a content digest, variants of the same file get a suffix
+func entityTag(sum, variant string) string {
+	if sum == "" {
+		return ""
+	}
+	if variant != "" {
+		sum += "-" + variant
+	}
+	return `"` + sum + `"`
+}
+
+// CollectOrphans removes pending uploads created before the given time from
+// storage and the database. With dryRun the orphans are only reported.
+func (s *fileService) CollectOrphans(ctx context.Context, before time.Time, dryRun bool) ([]filemanager.File, error) {
+	files, err := s.fileRepo.ListPending(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return files, nil
+	}
+
+	removed := []filemanager.File{}
+	for _, file := range files {
+		// the record goes first, a file committed meanwhile is kept
+		deleted, err := s.fileRepo.DeletePending(ctx, file.FileID)
+		if err != nil {
+			return removed, err
+		}
+		if !deleted {
+			continue
+		}
+
+		if err := os.Remove(file.Location); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, fmt.Errorf("failed to delete file from disk: %w", err)
+		}
+		removeThumbnail(&file)
+		removed = append(removed, file)
+	}
+	return removed, nil
+}
+
+// DiscardFile removes an upload whose loan action failed. Committed files,
+// e.g. reused by deduplication of the same uploader, are kept.
+func (s *fileService) DiscardFile(ctx context.Context, fileID uuid.UUID) error {
+	file, err := s.fileRepo.GetByID(ctx, fileID)
+	if err != nil {
+		return fmt.Errorf("file not found: %w", err)
+	}
+
+	deleted, err := s.fileRepo.DeletePending(ctx, fileID)
+	if err != nil || !deleted {
+		return err
+	}
+
+	if err := os.Remove(file.Location); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete file from disk: %w", err)
+	}
+	removeThumbnail(file)
+	return nil
+}
+
+// VerifyFile checks a digest against the one recorded for the file and
+// whether the stored content still matches it. Only loan agreements can be
+// verified, other files are reported as not found.
+func (s *fileService) VerifyFile(ctx context.Context, fileID uuid.UUID, sha256 string) (*filemanager.Verification, error) {
+	file, err := s.fileRepo.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+
+	links, err := s.fileRepo.GetLinks(ctx, file.FileID, uuid.Nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up file links: %w", err)
+	}
+	if !slices.ContainsFunc(links, func(link loan.DocumentLink) bool {
+		return link.DocumentType == loan.DocumentAgreement
+	}) {
+		return nil, fmt.Errorf("file not found: %w", ErrNotAgreement)
+	}
+
+	if file.Sha256 == "" {
+		return nil, ErrNoChecksum
+	}
+
+	return &filemanager.Verification{
+		FileID:   file.FileID,
+		Match:    strings.EqualFold(file.Sha256, sha256),
+		Intact:   s.checkIntegrity(file) == nil,
+		IssuedAt: file.CreatedAt,
+	}, nil
+}
+
+// checkIntegrity compares the stored content with the recorded digest,
+// files stored before digests were recorded are not checked
+func (s *fileService) checkIntegrity(file *filemanager.File) error {
+	if file.Sha256 == "" {
+		return nil
+	}
+
+	sum, err := checksum.SHA256File(file.Location)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if sum != file.Sha256 {
+		log.Printf("file %s content does not match its digest", file.FileID)
+		return ErrFileTampered
+	}
+	return nil
+}
+
+// authorize checks the actor in ctx may read the file through one of the loans
+// it is attached to, every decision is recorded in the access log
+func (s *fileService) authorize(ctx context.Context, file *filemanager.File, action filemanager.AccessAction) error {
+	actor, ok := user.ActorFromContext(ctx)
+	if !ok {
+		return ErrFileAccessDenied
+	}
+
+	links, err := s.fileRepo.GetLinks(ctx, file.FileID, actor.UserId)
+	if err != nil {
+		return fmt.Errorf("failed to look up file links: %w", err)
+	}
+	granted := loan.CanAccessFile(file.UploadedBy, links, actor)
+
+	entry := &filemanager.AccessLog{
+		FileId:  file.FileID,
+		UserId:  actor.UserId,
+		Role:    actor.Role,
+		Action:  action,
+		Granted: granted,
+	}
+	if err := s.fileRepo.LogAccess(ctx, entry); err != nil {
+		log.Printf("failed to log access to file %s: %s", file.FileID, err)
+	}
+
+	if !granted {
+		return ErrFileAccessDenied
+	}
+	return nil
+}
+
+// PreviewThumbnail returns the thumbnail path and MIME type of an image
+func (s *fileService) PreviewThumbnail(ctx context.Context, fileID uuid.UUID) (*Preview, error) {
+	file, err := s.fileRepo.GetByID(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("file not found: %w", err)
+	}
+	if err := s.authorize(ctx, file, filemanager.AccessThumbnail); err != nil {
+		return nil, err
+	}
+	if err := checkScan(file); err != nil {
+		return nil, err
+	}
+
+	if file.ThumbnailLocation == "" {
+		return nil, ErrNoThumbnail
+	}
+	if _, err := os.Stat(file.ThumbnailLocation); errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoThumbnail
+	}
+
+	name := strings.TrimSuffix(file.Label, filepath.Ext(file.Label)) + "_thumb.jpg"
+	return &Preview{
+		Path:     file.ThumbnailLocation,
+		MimeType: "image/jpeg",
+		Name:     name,
+		ETag:     entityTag(file.Sha256, "thumb"),
+	}, nil
+}
+
+// processImage reads the EXIF capture time and position of JPEG photos and
+// stores a thumbnail next to the original
+func (s *fileService) processImage(file *filemanager.File) error {
+	ext := strings.ToLower(file.FileType)
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		return nil
+	}
+
+	src, err := os.Open(file.Location)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if ext != ".png" {
+		meta, err := imaging.ReadEXIF(src)
+		if err == nil {
+			if !meta.CapturedAt.IsZero() {
+				file.CapturedAt = &meta.CapturedAt
+			}
+			if meta.HasLocation {
+				file.Latitude, file.Longitude = &meta.Latitude, &meta.Longitude
+			}
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	thumbPath := strings.TrimSuffix(file.Location, filepath.Ext(file.Location)) + "_thumb.jpg"
+	thumb, err := os.Create(thumbPath)
+	if err != nil {
+		return err
+	}
+	defer thumb.Close()
+
+	if err := imaging.WriteThumbnail(thumb, src, thumbnailSize); err != nil {
+		os.Remove(thumbPath)
+		return err
+	}
+	file.ThumbnailLocation = thumbPath
+	return nil
+}
+
+func removeThumbnail(file *filemanager.File) {
+	if file.ThumbnailLocation != "" {
+		os.Remove(file.ThumbnailLocation)
+	}
 }
@@ -0,0 +1,221 @@
+package filemanager
+
+import (
+	"context"
+	"errors"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zainulbr/simple-loan-engine/libs/scanner"
+	"github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	repoFile "github.com/zainulbr/simple-loan-engine/repositories/filemanager"
+)
+
+// scanRepo keeps file records in memory for the upload and preview paths
+type scanRepo struct {
+	repoFile.FileRepository
+	files map[uuid.UUID]filemanager.File
+	links map[uuid.UUID][]loan.DocumentLink
+}
+
+func (r *scanRepo) Create(ctx context.Context, file *filemanager.File) error {
+	r.files[file.FileID] = *file
+	return nil
+}
+
+func (r *scanRepo) UpdateScan(ctx context.Context, file *filemanager.File) error {
+	r.files[file.FileID] = *file
+	return nil
+}
+
+func (r *scanRepo) GetByID(ctx context.Context, fileID uuid.UUID) (*filemanager.File, error) {
+	file, ok := r.files[fileID]
+	if !ok {
+		return nil, pg.ErrNoRows
+	}
+	return &file, nil
+}
+
+func (r *scanRepo) GetCommittedByHash(ctx context.Context, sha256 string, uploadedBy uuid.UUID) (*filemanager.File, error) {
+	for _, file := range r.files {
+		if file.Sha256 == sha256 && file.UploadedBy == uploadedBy && file.Status == filemanager.StatusCommitted {
+			return &file, nil
+		}
+	}
+	return nil, pg.ErrNoRows
+}
+
+func (r *scanRepo) GetLinks(ctx context.Context, fileID uuid.UUID, userID uuid.UUID) ([]loan.DocumentLink, error) {
+	return r.links[fileID], nil
+}
+
+func (r *scanRepo) LogAccess(ctx context.Context, entry *filemanager.AccessLog) error {
+	return nil
+}
+
+func uploadContent(t *testing.T, s FileService, ctx context.Context, content string) (*filemanager.File, error) {
+	src := filepath.Join(t.TempDir(), "statement.pdf")
+	assert.NoError(t, os.WriteFile(src, []byte(content), 0o644))
+	f, err := os.Open(src)
+	assert.NoError(t, err)
+	defer f.Close()
+	return s.UploadFile(ctx, f, &multipart.FileHeader{Filename: "statement.pdf"}, filemanager.LocationTypeLocal)
+}
+
+func TestUploadFileScan(t *testing.T) {
+	dir := t.TempDir()
+	repo := &scanRepo{files: map[uuid.UUID]filemanager.File{}}
+	fake := &scanner.Fake{}
+	s := NewFileService(repo, dir, WithScanner(fake))
+	ctx := user.ContextWithActor(context.Background(), user.Actor{UserId: uuid.New(), Role: user.RoleBorrower})
+
+	clean, err := uploadContent(t, s, ctx, "%PDF-1.4 statement")
+	assert.NoError(t, err)
+	assert.Equal(t, filemanager.ScanClean, clean.ScanStatus)
+	assert.NotNil(t, clean.ScannedAt)
+
+	preview, err := s.PreviewFile(ctx, clean.FileID)
+	assert.NoError(t, err)
+	assert.Equal(t, clean.Location, preview.Path)
+
+	// infected uploads are rejected and moved out of the upload directory
+	_, err = uploadContent(t, s, ctx, "%PDF-1.4 "+scanner.EICAR)
+	assert.ErrorIs(t, err, ErrFileInfected)
+	assert.Equal(t, 2, fake.Scanned())
+
+	var infected filemanager.File
+	for _, file := range repo.files {
+		if file.ScanStatus == filemanager.ScanQuarantined {
+			infected = file
+		}
+	}
+	assert.Equal(t, "Eicar-Test-Signature", infected.ScanSignature)
+	assert.Equal(t, filepath.Join(dir, quarantineDir), filepath.Dir(infected.Location))
+	assert.FileExists(t, infected.Location)
+
+	_, err = s.PreviewFile(ctx, infected.FileID)
+	assert.ErrorIs(t, err, ErrFileQuarantined)
+}
+
+func TestVerifyFile(t *testing.T) {
+	repo := &scanRepo{files: map[uuid.UUID]filemanager.File{}, links: map[uuid.UUID][]loan.DocumentLink{}}
+	s := NewFileService(repo, t.TempDir())
+	ctx := user.ContextWithActor(context.Background(), user.Actor{UserId: uuid.New(), Role: user.RoleBorrower})
+
+	agreement, err := uploadContent(t, s, ctx, "%PDF-1.4 agreement")
+	assert.NoError(t, err)
+	repo.links[agreement.FileID] = []loan.DocumentLink{{LoanId: uuid.New(), DocumentType: loan.DocumentAgreement}}
+
+	verification, err := s.VerifyFile(context.Background(), agreement.FileID, strings.ToUpper(agreement.Sha256))
+	assert.NoError(t, err)
+	assert.True(t, verification.Match)
+	assert.True(t, verification.Intact)
+
+	// other documents are not verifiable, even when their digest is known
+	photo, err := uploadContent(t, s, ctx, "%PDF-1.4 signed form")
+	assert.NoError(t, err)
+	repo.links[photo.FileID] = []loan.DocumentLink{{LoanId: uuid.New(), DocumentType: loan.DocumentSignedForm}}
+	_, err = s.VerifyFile(context.Background(), photo.FileID, photo.Sha256)
+	assert.ErrorIs(t, err, ErrNotAgreement)
+
+	legacy := filemanager.File{FileID: uuid.New()}
+	repo.files[legacy.FileID] = legacy
+	repo.links[legacy.FileID] = []loan.DocumentLink{{LoanId: uuid.New(), DocumentType: loan.DocumentAgreement}}
+	_, err = s.VerifyFile(context.Background(), legacy.FileID, agreement.Sha256)
+	assert.ErrorIs(t, err, ErrNoChecksum)
+}
+
+func TestUploadFileDeduplication(t *testing.T) {
+	repo := &scanRepo{files: map[uuid.UUID]filemanager.File{}}
+	s := NewFileService(repo, t.TempDir())
+	owner := user.ContextWithActor(context.Background(), user.Actor{UserId: uuid.New(), Role: user.RoleBorrower})
+	other := user.ContextWithActor(context.Background(), user.Actor{UserId: uuid.New(), Role: user.RoleBorrower})
+
+	first, err := uploadContent(t, s, owner, "%PDF-1.4 statement")
+	assert.NoError(t, err)
+	first.Status = filemanager.StatusCommitted
+	repo.files[first.FileID] = *first
+
+	again, err := uploadContent(t, s, owner, "%PDF-1.4 statement")
+	assert.NoError(t, err)
+	assert.Equal(t, first.FileID, again.FileID, "the uploader's own committed file is reused")
+
+	// another user gets a file of their own, not the owner's record
+	copied, err := uploadContent(t, s, other, "%PDF-1.4 statement")
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, first.FileID, copied.FileID)
+		assert.NotEqual(t, first.Location, copied.Location)
+		_, err = s.PreviewFile(other, copied.FileID)
+		assert.NoError(t, err)
+	}
+	_, err = s.PreviewFile(other, first.FileID)
+	assert.ErrorIs(t, err, ErrFileAccessDenied)
+}
+
+func TestUploadFileScanUnavailable(t *testing.T) {
+	repo := &scanRepo{files: map[uuid.UUID]filemanager.File{}}
+	s := NewFileService(repo, t.TempDir(), WithScanner(&scanner.Fake{Err: errors.New("clamd is down")}))
+	ctx := user.ContextWithActor(context.Background(), user.Actor{UserId: uuid.New(), Role: user.RoleBorrower})
+
+	_, err := uploadContent(t, s, ctx, "%PDF-1.4 statement")
+	assert.ErrorIs(t, err, ErrScanUnavailable)
+
+	for id, file := range repo.files {
+		assert.Equal(t, filemanager.ScanFailed, file.ScanStatus)
+		_, err := s.PreviewFile(ctx, id)
+		assert.ErrorIs(t, err, ErrFileNotScanned)
+	}
+
+	// a record left pending, e.g. by a crash before the verdict, is not served either
+	pending := filemanager.File{FileID: uuid.New(), ScanStatus: filemanager.ScanPending}
+	actor, _ := user.ActorFromContext(ctx)
+	pending.UploadedBy = actor.UserId
+	repo.files[pending.FileID] = pending
+	_, err = s.PreviewFile(ctx, pending.FileID)
+	assert.ErrorIs(t, err, ErrFileNotScanned)
+}
+
+func TestUploadFileTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(t.TempDir(), "statement.pdf")
+	assert.NoError(t, os.WriteFile(src, []byte("%PDF-1.4\n"+strings.Repeat("x", 2048)), 0o644))
+
+	f, err := os.Open(src)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	// the repository is never reached for oversize files
+	s := NewFileService(nil, dir, WithMaxFileSize(1024))
+
+	// declared size
+	_, err = s.UploadFile(context.Background(), f, &multipart.FileHeader{Filename: "statement.pdf", Size: 2057}, filemanager.LocationTypeLocal)
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+
+	// unknown size, rejected while copying and the partial file removed
+	_, err = s.UploadFile(context.Background(), f, &multipart.FileHeader{Filename: "statement.pdf"}, filemanager.LocationTypeLocal)
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestValidateFileFormatShortFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "tiny.pdf")
+	assert.NoError(t, os.WriteFile(src, []byte("%PDF-1.4\n"), 0o644))
+
+	f, err := os.Open(src)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	s := NewFileService(nil, t.TempDir())
+	assert.NoError(t, s.ValidateFileFormat(f, &multipart.FileHeader{Filename: "tiny.pdf"}))
+}
@@ -2,8 +2,11 @@ package loan
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/libs/fee"
+	"github.com/zainulbr/simple-loan-engine/libs/notification/mail"
 	"github.com/zainulbr/simple-loan-engine/models/loan"
 )
 
@@ -11,9 +14,70 @@ import (
 type LoanService interface {
 	CreateLoan(ctx context.Context, loan *loan.Loan) (*loan.Loan, error)
 	ApproveLoan(ctx context.Context, approval *loan.LoanApproval) error
+	AddLoanDocuments(ctx context.Context, loanID uuid.UUID, documents []loan.LoanDocument) ([]loan.LoanDocument, error)
+	GetLoanApprovals(ctx context.Context, loanID uuid.UUID) (*loan.ApprovalProgress, error)
+	RejectLoan(ctx context.Context, loanID uuid.UUID) error
+	UpdateLoan(ctx context.Context, loanID uuid.UUID, update *loan.LoanUpdate) (*loan.LoanDetail, error)
+	CancelLoan(ctx context.Context, cancellation *loan.LoanCancellation) error
+	GetLoanChanges(ctx context.Context, loanID uuid.UUID) ([]loan.LoanChange, error)
+	GetLoanActions(ctx context.Context, loanID uuid.UUID) ([]loan.Action, error)
 	GetLoanDetail(ctx context.Context, loanID uuid.UUID) (*loan.LoanDetail, error)
 	CreateInvestment(ctx context.Context, investment *loan.LoanInvestment) error
 	CreateDisbursement(ctx context.Context, disbursement *loan.LoanDisbursement) error
 	TotalPayment(ctx context.Context, loanID string) (*loan.BorrowerPayment, error)
 	GetInvestorProfit(ctx context.Context, loanID string) ([]loan.InvestorProfit, error)
+	ExpireLoans(ctx context.Context, now time.Time) (int, error)
+	GetInvestorPortfolio(ctx context.Context, investorID uuid.UUID, state loan.LoanState) (*loan.Portfolio, error)
+	GetBorrowerLoans(ctx context.Context, borrowerID uuid.UUID) ([]loan.BorrowerLoan, error)
+	RecordRepayment(ctx context.Context, repayment *loan.LoanRepayment) error
+	InspectLoan(ctx context.Context, loanID uuid.UUID) (*loan.LoanInspection, error)
+	ForceTransition(ctx context.Context, loanID uuid.UUID, to loan.LoanState, reason string) (*loan.LoanChange, error)
+	ResendAgreement(ctx context.Context, loanID uuid.UUID) ([]string, error)
+	RegenerateAgreement(ctx context.Context, loanID uuid.UUID) (uuid.UUID, error)
+}
+
+// Option configures the loan service
+type Option func(*loanService)
+
+// WithFeeRule sets the platform fee rule of loans without their own rule
+func WithFeeRule(rule fee.Rule) Option {
+	return func(s *loanService) {
+		if rule.Validate() == nil {
+			s.feeRule = rule
+		}
+	}
+}
+
+// WithFundingWindow sets the default time an approved loan stays open for investment
+func WithFundingWindow(window time.Duration) Option {
+	return func(s *loanService) {
+		if window > 0 {
+			s.fundingWindow = window
+		}
+	}
+}
+
+// WithVisitMaxDrift sets how far the capture time of a visit photo may be from the approval date
+func WithVisitMaxDrift(drift time.Duration) Option {
+	return func(s *loanService) {
+		if drift > 0 {
+			s.visitMaxDrift = drift
+		}
+	}
+}
+
+// WithMailer sets the mailer of the loan notifications, the default mail connection when not set
+func WithMailer(mailer mail.MailService) Option {
+	return func(s *loanService) {
+		s.mailer = mailer
+	}
+}
+
+// WithReportDir sets the directory the generated agreements are stored in
+func WithReportDir(dir string) Option {
+	return func(s *loanService) {
+		if dir != "" {
+			s.basePath = dir
+		}
+	}
 }
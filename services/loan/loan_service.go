@@ -4,122 +4,658 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/libs/checksum"
+	"github.com/zainulbr/simple-loan-engine/libs/fee"
 	"github.com/zainulbr/simple-loan-engine/libs/notification/mail"
 	"github.com/zainulbr/simple-loan-engine/libs/report/pdf"
 	"github.com/zainulbr/simple-loan-engine/libs/template"
 	"github.com/zainulbr/simple-loan-engine/models/filemanager"
 	"github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/product"
+	"github.com/zainulbr/simple-loan-engine/models/user"
 	repoFile "github.com/zainulbr/simple-loan-engine/repositories/filemanager"
 	loanRepository "github.com/zainulbr/simple-loan-engine/repositories/loan"
+	productRepository "github.com/zainulbr/simple-loan-engine/repositories/product"
+	"github.com/zainulbr/simple-loan-engine/repositories/uow"
 )
 
 // Implementation
 type loanService struct {
-	loanRepo loanRepository.LoanRepository
-	fileRepo repoFile.FileRepository
-	basePath string // Directory untuk menyimpan file
+	loanRepo    loanRepository.LoanRepository
+	fileRepo    repoFile.FileRepository
+	productRepo productRepository.ProductRepository
+	uow         uow.UnitOfWork // Transaction scoped repositories of multi step writes
+	machine     *loan.StateMachine
+	basePath    string // Directory untuk menyimpan file
+	mailer      mail.MailService
+
+	fundingWindow time.Duration
+	feeRule       fee.Rule
+	approvalChain loan.ApprovalChain
+	visitMaxDrift time.Duration
 }
 
+const defaultFundingWindow = 30 * 24 * time.Hour
+
+const defaultVisitMaxDrift = 48 * time.Hour
+
+var defaultFeeRule = fee.Rule{Type: fee.RuleTypePercentage, Value: 0.2}
+
 // Constructor
-func NewLoanService(loanRepo loanRepository.LoanRepository, fileRepo repoFile.FileRepository) LoanService {
-	return &loanService{
-		loanRepo: loanRepo,
-		fileRepo: fileRepo,
-		basePath: "./reports",
+func NewLoanService(loanRepo loanRepository.LoanRepository, fileRepo repoFile.FileRepository,
+	productRepo productRepository.ProductRepository, unitOfWork uow.UnitOfWork, opts ...Option) LoanService {
+	s := &loanService{
+		loanRepo:      loanRepo,
+		fileRepo:      fileRepo,
+		productRepo:   productRepo,
+		uow:           unitOfWork,
+		machine:       loan.DefaultStateMachine(),
+		basePath:      "./reports",
+		fundingWindow: defaultFundingWindow,
+		feeRule:       defaultFeeRule,
+		approvalChain: loan.DefaultApprovalChain,
+		visitMaxDrift: defaultVisitMaxDrift,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // Create Loan
 func (s *loanService) CreateLoan(ctx context.Context, loan *loan.Loan) (*loan.Loan, error) {
-	err := s.loanRepo.CreateLoan(ctx, loan)
+	product, err := s.productRepo.GetByID(ctx, loan.ProductId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := product.ValidateLoan(loan.Amount, loan.DurationMonth); err != nil {
+		return nil, err
+	}
+
+	// fee rule and approval chain of the product at the time of the proposal
+	loan.FeeRule = &product.FeeRule
+	loan.ApprovalChain = product.ApprovalChain
+
+	err = s.loanRepo.CreateLoan(ctx, loan)
 	if err != nil {
 		return nil, err
 	}
 	return loan, nil
 }
 
-// Approve Loan
+// Approve Loan signs off the next approval stage of the actor,
+// the loan becomes approved once the final stage passes
 func (s *loanService) ApproveLoan(ctx context.Context, approval *loan.LoanApproval) error {
-	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, approval.LoanId)
+	return s.uow.Do(ctx, func(ctx context.Context, repos uow.Repositories) error {
+		// locked, a concurrent edit or approval must not pass the checks below alongside
+		loanDetail, err := repos.Loans.GetLoanDetailForUpdate(ctx, approval.LoanId)
+		if err != nil {
+			return err
+		}
+
+		// Check if loan is in valid state for approval
+		if _, err := s.transition(ctx, loanDetail, loan.ActionApprove); err != nil {
+			return err
+		}
+
+		approvals, err := repos.Loans.GetApprovals(ctx, approval.LoanId)
+		if err != nil {
+			return err
+		}
+
+		actor, _ := user.ActorFromContext(ctx)
+		stage, final, err := s.loanApprovalChain(loanDetail).Check(loanDetail.Amount, approvals, actor)
+		if err != nil {
+			return err
+		}
+		approval.Stage = stage.Name
+
+		if stage.RequireVisit && approval.VisitedFile == uuid.Nil {
+			return loan.ErrVisitRequired
+		}
+
+		// Managers review approvals whose photos do not prove the visit
+		approval.Warnings, err = s.visitWarnings(ctx, repos.Files, approval)
+		if err != nil {
+			return err
+		}
+		if len(approval.Warnings) > 0 {
+			log.Printf("loan %s approval stage %s: %v", approval.LoanId, approval.Stage, approval.Warnings)
+		}
+
+		if approval.Rate > 0 {
+			if err := s.validateProductRate(ctx, loanDetail, approval.Rate); err != nil {
+				return err
+			}
+		}
+
+		if !final {
+			return repos.Loans.CreateApproval(ctx, approval)
+		}
+
+		if err := s.checkProductDocuments(ctx, repos.Loans, loanDetail, loan.ActionApprove, approval.Documents); err != nil {
+			return err
+		}
+
+		// Rate of the final stage, or the latest one proposed by an earlier stage
+		if approval.Rate == 0 {
+			approval.Rate = loan.LatestRate(approvals)
+		}
+		if approval.Rate == 0 {
+			return loan.ErrRateRequired
+		}
+
+		// Funding window, can be overridden per loan at approval
+		if approval.FundingDeadline.IsZero() {
+			approval.FundingDeadline = approval.ApprovalDate.Add(s.fundingWindow)
+		}
+		if !approval.FundingDeadline.After(approval.ApprovalDate) {
+			return errors.New("funding_deadline must be after approval_date")
+		}
+
+		// Investor ROI is the borrower rate minus the platform margin
+		rule := s.loanFeeRule(loanDetail)
+		approval.FeeRule = &rule
+		approval.ROI = rule.ROI(loanDetail.Amount, approval.Rate)
+
+		// Create approval & Update loan state to approved
+		return repos.Loans.Approve(ctx, approval)
+	})
+}
+
+// visitWarnings checks the capture time and position of the visit photos of an approval
+func (s *loanService) visitWarnings(ctx context.Context, fileRepo repoFile.FileRepository, approval *loan.LoanApproval) ([]string, error) {
+	photos := []filemanager.File{}
+	for _, d := range approval.Documents {
+		if d.DocumentType != loan.DocumentVisitedPhoto {
+			continue
+		}
+		file, err := fileRepo.GetByID(ctx, d.FileId)
+		if err != nil {
+			return nil, err
+		}
+		// only photos carry EXIF metadata
+		if strings.EqualFold(file.FileType, ".pdf") {
+			continue
+		}
+		photos = append(photos, *file)
+	}
+	return loan.VisitWarnings(photos, approval.ApprovalDate, s.visitMaxDrift), nil
+}
+
+// GetLoanApprovals returns the approval stages of a loan and the signed off ones
+func (s *loanService) GetLoanApprovals(ctx context.Context, loanID uuid.UUID) (*loan.ApprovalProgress, error) {
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	approvals, err := s.loanRepo.GetApprovals(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range approvals {
+		s.setDocumentLinks(approvals[i].Documents)
+	}
+	return loan.NewApprovalProgress(s.loanApprovalChain(loanDetail), loanDetail.Amount, approvals), nil
+}
+
+// Reject Loan
+func (s *loanService) RejectLoan(ctx context.Context, loanID uuid.UUID) error {
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, loanID)
+	if err != nil {
+		return err
+	}
+
+	t, err := s.transition(ctx, loanDetail, loan.ActionReject)
 	if err != nil {
 		return err
 	}
 
-	// Check if loan is in valid state for approval
-	if loanDetail.State != loan.StateProposed {
-		return errors.New("loan is not in a valid state for approval")
+	return s.loanRepo.UpdateState(ctx, loanID, t.From, t.To)
+}
+
+// UpdateLoan lets the proposing borrower correct a loan while it is proposed and no approval stage is signed off
+func (s *loanService) UpdateLoan(ctx context.Context, loanID uuid.UUID, update *loan.LoanUpdate) (*loan.LoanDetail, error) {
+	if err := validateLoanUpdate(update); err != nil {
+		return nil, err
+	}
+
+	var loanDetail *loan.LoanDetail
+	err := s.uow.Do(ctx, func(ctx context.Context, repos uow.Repositories) error {
+		// locked, an approval must not sign off while the numbers change
+		current, err := repos.Loans.GetLoanDetailForUpdate(ctx, loanID)
+		if err != nil {
+			return err
+		}
+		loanDetail = current
+
+		if _, err := s.transition(ctx, current, loan.ActionEdit); err != nil {
+			return err
+		}
+
+		// signed off stages approved the current numbers, later stages must not see different ones
+		approvals, err := repos.Loans.GetApprovals(ctx, loanID)
+		if err != nil {
+			return err
+		}
+		if len(approvals) > 0 {
+			return loan.ErrApprovalStarted
+		}
+
+		if err := s.validateProductLoan(ctx, current, update); err != nil {
+			return err
+		}
+
+		actor, _ := user.ActorFromContext(ctx)
+		changes := diffLoanUpdate(current, update, actor.UserId)
+		if len(changes) == 0 {
+			return nil
+		}
+		if err := repos.Loans.UpdateLoan(ctx, loanID, update, changes); err != nil {
+			return err
+		}
+
+		loanDetail, err = repos.Loans.GetLoanDetail(ctx, loanID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loanDetail, nil
+}
+
+// CancelLoan withdraws a loan, investments of an approved loan are voided and investors notified
+func (s *loanService) CancelLoan(ctx context.Context, cancellation *loan.LoanCancellation) error {
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, cancellation.LoanId)
+	if err != nil {
+		return err
 	}
 
-	// Create approval & Update loan state to approved
-	err = s.loanRepo.Approve(ctx, approval)
+	t, err := s.transition(ctx, loanDetail, loan.ActionCancel)
 	if err != nil {
 		return err
 	}
 
+	// collect investors before their investments are voided
+	emails, err := s.getEmailInvestors(ctx, cancellation.LoanId)
+	if err != nil {
+		return err
+	}
+
+	err = s.loanRepo.CancelLoan(ctx, cancellation, t.From)
+	if err != nil {
+		return err
+	}
+
+	if len(emails) > 0 {
+		// async no blocking
+		go s.publishCancellation(cancellation, emails)
+	}
+
 	return nil
 }
 
-// Get Loan Detail
-func (s *loanService) GetLoanDetail(ctx context.Context, loanID uuid.UUID) (*loan.LoanDetail, error) {
-	return s.loanRepo.GetLoanDetail(ctx, loanID)
+// GetLoanChanges returns the field level change history of a loan to staff and the proposing borrower
+func (s *loanService) GetLoanChanges(ctx context.Context, loanID uuid.UUID) ([]loan.LoanChange, error) {
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	actor, ok := user.ActorFromContext(ctx)
+	if !ok {
+		return nil, loan.ErrActionNotPermitted
+	}
+	switch {
+	case actor.Role.IsStaff(), actor.UserId == loanDetail.ProposedBy:
+	case actor.Role == user.RoleBorrower:
+		return nil, loan.ErrNotLoanProposer
+	default:
+		// investors and service accounts only see the current loan
+		return nil, loan.ErrActionNotPermitted
+	}
+
+	return s.loanRepo.GetLoanChanges(ctx, loanID)
 }
 
-// Create Investment
-func (s *loanService) CreateInvestment(ctx context.Context, investment *loan.LoanInvestment) error {
-	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, investment.LoanId)
+// validateProductLoan checks the updated amount and duration against the loan product
+func (s *loanService) validateProductLoan(ctx context.Context, loanDetail *loan.LoanDetail, update *loan.LoanUpdate) error {
+	if loanDetail.ProductId == uuid.Nil {
+		return nil
+	}
+
+	product, err := s.productRepo.GetByID(ctx, loanDetail.ProductId)
 	if err != nil {
 		return err
 	}
 
-	// Check if loan is in valid state for insvestment
-	if loanDetail.State != loan.StateApproved {
-		return errors.New("loan is not in a valid state for investment")
+	amount, durationMonth := loanDetail.Amount, loanDetail.DurationMonth
+	if update.Amount != nil {
+		amount = *update.Amount
+	}
+	if update.DurationMonth != nil {
+		durationMonth = *update.DurationMonth
+	}
+	return product.ValidateLoan(amount, durationMonth)
+}
+
+// validateProductRate checks the approved rate against the loan product
+func (s *loanService) validateProductRate(ctx context.Context, loanDetail *loan.LoanDetail, rate float64) error {
+	// loans proposed before the product catalog have no product
+	if loanDetail.ProductId == uuid.Nil {
+		return nil
+	}
+
+	product, err := s.productRepo.GetByID(ctx, loanDetail.ProductId)
+	if err != nil {
+		return err
 	}
+	return product.ValidateRate(rate)
+}
 
-	// Check if total investment matches loan amount
-	if (loanDetail.TotalInvestment + investment.Amount) > investment.Amount {
-		return errors.New("investment amount exceeds loan amount")
+// checkProductDocuments checks the loan documents and the ones attached by action
+// include the documents its product requires for action
+func (s *loanService) checkProductDocuments(ctx context.Context, loans loanRepository.LoanRepository,
+	loanDetail *loan.LoanDetail, action loan.Action, attached []loan.LoanDocument) error {
+	// loans proposed before the product catalog have no product
+	if loanDetail.ProductId == uuid.Nil {
+		return nil
 	}
 
-	err = s.loanRepo.CreateInvestment(ctx, investment)
+	product, err := s.productRepo.GetByID(ctx, loanDetail.ProductId)
 	if err != nil {
 		return err
 	}
+	if len(product.RequiredDocuments) == 0 {
+		return nil
+	}
 
-	// Check if principal == total all investment
-	if (loanDetail.TotalInvestment + investment.Amount) == investment.Amount {
-		// async no blocking
-		go s.publishAggrementLatter(context.Background(), investment.LoanId)
+	documents, err := loans.GetLoanDocuments(ctx, loanDetail.LoanId)
+	if err != nil {
+		return err
 	}
+	return product.CheckDocuments(action, append(documents, attached...))
+}
 
+func validateLoanUpdate(update *loan.LoanUpdate) error {
+	if update.Description == nil && update.Amount == nil && update.DurationMonth == nil {
+		return errors.New("at least one of description, amount or duration_month is required")
+	}
+	if update.Description != nil && *update.Description == "" {
+		return errors.New("description must not be empty")
+	}
+	if update.Amount != nil && *update.Amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+	if update.DurationMonth != nil && *update.DurationMonth <= 0 {
+		return errors.New("duration_month must be greater than zero")
+	}
 	return nil
 }
 
-// Create Disbursement
-func (s *loanService) CreateDisbursement(ctx context.Context, disbursement *loan.LoanDisbursement) error {
+// diffLoanUpdate returns a change entry for every field that differs from the current loan
+func diffLoanUpdate(current *loan.LoanDetail, update *loan.LoanUpdate, changedBy uuid.UUID) []loan.LoanChange {
+	changes := []loan.LoanChange{}
+	add := func(field, oldValue, newValue string) {
+		if oldValue == newValue {
+			return
+		}
+		changes = append(changes, loan.LoanChange{
+			LoanId:    current.LoanId,
+			Field:     field,
+			OldValue:  oldValue,
+			NewValue:  newValue,
+			ChangedBy: changedBy,
+		})
+	}
+
+	if update.Description != nil {
+		add("description", current.Description, *update.Description)
+	}
+	if update.Amount != nil {
+		add("amount", strconv.FormatFloat(current.Amount, 'f', -1, 64), strconv.FormatFloat(*update.Amount, 'f', -1, 64))
+	}
+	if update.DurationMonth != nil {
+		add("duration_month", strconv.Itoa(current.DurationMonth), strconv.Itoa(*update.DurationMonth))
+	}
+	return changes
+}
 
-	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, disbursement.LoanId)
+// RecordRepayment records a borrower payment, splitting the interest into investor return and platform revenue.
+// A payment given as amount is split into principal and interest by the interest method of the loan product.
+func (s *loanService) RecordRepayment(ctx context.Context, repayment *loan.LoanRepayment) error {
+	if repayment.Amount < 0 || (repayment.Amount > 0 && repayment.Principal+repayment.Interest != 0) {
+		return errors.New("either amount or principal and interest must be given")
+	}
+
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, repayment.LoanId)
 	if err != nil {
 		return err
 	}
 
-	// Check if loan is in valid state for disbursement
-	if loanDetail.State != loan.StateInvested {
-		return errors.New("loan is not in a valid state for disbursement")
+	if repayment.Amount > 0 {
+		method, err := s.loanInterestMethod(ctx, loanDetail)
+		if err != nil {
+			return err
+		}
+		repayment.Principal, repayment.Interest = method.SplitPayment(repayment.Amount, loanDetail.Amount, loanDetail.Rate, loanDetail.DurationMonth)
+	}
+	if repayment.Principal < 0 || repayment.Interest < 0 || repayment.Principal+repayment.Interest <= 0 {
+		return errors.New("principal and interest must not be negative and at least one must be positive")
+	}
+
+	if _, err := s.transition(ctx, loanDetail, loan.ActionRepay); err != nil {
+		return err
+	}
+
+	split := s.loanFeeRule(loanDetail).Split(repayment.Interest)
+	repayment.InvestorInterest = split.InvestorReturn
+	repayment.PlatformFee = split.PlatformRevenue
+
+	return s.loanRepo.CreateRepayment(ctx, repayment)
+}
+
+// loanInterestMethod is the interest method of the loan product, loans without a product are flat
+func (s *loanService) loanInterestMethod(ctx context.Context, loanDetail *loan.LoanDetail) (product.InterestMethod, error) {
+	if loanDetail.ProductId == uuid.Nil {
+		return product.InterestMethodFlat, nil
+	}
+
+	p, err := s.productRepo.GetByID(ctx, loanDetail.ProductId)
+	if err != nil {
+		return "", err
+	}
+	return p.InterestMethod, nil
+}
+
+// loanFeeRule returns the fee rule stored on the loan or the service default
+func (s *loanService) loanFeeRule(loanDetail *loan.LoanDetail) fee.Rule {
+	if loanDetail.FeeRule != nil {
+		return *loanDetail.FeeRule
+	}
+	return s.feeRule
+}
+
+// loanApprovalChain is the chain snapshot of the loan, falling back to the engine chain
+func (s *loanService) loanApprovalChain(loanDetail *loan.LoanDetail) loan.ApprovalChain {
+	if len(loanDetail.ApprovalChain) > 0 {
+		return loanDetail.ApprovalChain
 	}
+	return s.approvalChain
+}
 
-	// create disbursement and 	Update loan state after disbursement
-	err = s.loanRepo.CreateDisbursement(ctx, disbursement)
+// GetLoanActions returns the actions the current user may perform next on the loan
+func (s *loanService) GetLoanActions(ctx context.Context, loanID uuid.UUID) ([]loan.Action, error) {
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	actor, _ := user.ActorFromContext(ctx)
+	actions := s.machine.Actions(loanDetail, actor)
+
+	// approve is only offered to the approver of the next stage
+	for i, action := range actions {
+		if action != loan.ActionApprove {
+			continue
+		}
+
+		approvals, err := s.loanRepo.GetApprovals(ctx, loanID)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, err := s.loanApprovalChain(loanDetail).Check(loanDetail.Amount, approvals, actor); err != nil {
+			actions = append(actions[:i], actions[i+1:]...)
+		}
+		break
+	}
+
+	// edit is only offered until the first approval stage is signed off
+	if i := slices.Index(actions, loan.ActionEdit); i >= 0 {
+		approvals, err := s.loanRepo.GetApprovals(ctx, loanID)
+		if err != nil {
+			return nil, err
+		}
+		if len(approvals) > 0 {
+			actions = slices.Delete(actions, i, i+1)
+		}
+	}
+	return actions, nil
+}
+
+// transition validates action against the state machine for the user in ctx
+func (s *loanService) transition(ctx context.Context, loanDetail *loan.LoanDetail, action loan.Action) (loan.Transition, error) {
+	actor, ok := user.ActorFromContext(ctx)
+	if !ok {
+		return loan.Transition{}, loan.ErrActionNotPermitted
+	}
+	return s.machine.Transition(loanDetail, action, actor)
+}
+
+// Get Loan Detail
+func (s *loanService) GetLoanDetail(ctx context.Context, loanID uuid.UUID) (*loan.LoanDetail, error) {
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	loanDetail.Documents, err = s.loanRepo.GetLoanDocuments(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	s.setDocumentLinks(loanDetail.Documents)
+	return loanDetail, nil
+}
+
+// AddLoanDocuments attaches uploaded files to a loan outside of an approval or disbursement
+func (s *loanService) AddLoanDocuments(ctx context.Context, loanID uuid.UUID, documents []loan.LoanDocument) ([]loan.LoanDocument, error) {
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	actor, ok := user.ActorFromContext(ctx)
+	if !ok {
+		return nil, loan.ErrActionNotPermitted
+	}
+	if actor.Role == user.RoleBorrower && actor.UserId != loanDetail.ProposedBy {
+		return nil, loan.ErrNotLoanProposer
+	}
+
+	for i := range documents {
+		documents[i].LoanId = loanID
+		documents[i].UploadedBy = actor.UserId
+	}
+
+	if err := s.loanRepo.CreateDocuments(ctx, documents); err != nil {
+		return nil, err
+	}
+	s.setDocumentLinks(documents)
+	return documents, nil
+}
+
+func (s *loanService) setDocumentLinks(documents []loan.LoanDocument) {
+	for i := range documents {
+		documents[i].URL = s.genReportLink(documents[i].FileId.String())
+	}
+}
+
+// Create Investment
+func (s *loanService) CreateInvestment(ctx context.Context, investment *loan.LoanInvestment) error {
+	funded := false
+	err := s.uow.Do(ctx, func(ctx context.Context, repos uow.Repositories) error {
+		// locked, concurrent investments must not both fit in the remaining amount
+		loanDetail, err := repos.Loans.GetLoanDetailForUpdate(ctx, investment.LoanId)
+		if err != nil {
+			return err
+		}
+
+		// Check if loan is in valid state for insvestment
+		if _, err := s.transition(ctx, loanDetail, loan.ActionInvest); err != nil {
+			return err
+		}
+
+		// Check if total investment matches loan amount
+		if (loanDetail.TotalInvestment + investment.Amount) > loanDetail.Amount {
+			return errors.New("investment amount exceeds loan amount")
+		}
+
+		err = repos.Loans.CreateInvestment(ctx, investment)
+		if err != nil {
+			return err
+		}
+
+		// Check if principal == total all investment,
+		// state is moved to invested by the database trigger
+		loanDetail.TotalInvestment += investment.Amount
+		_, err = s.machine.System(loanDetail, loan.ActionFund)
+		funded = err == nil
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
+	if funded {
+		// async no blocking, once the investment is committed
+		go s.publishAggrementLatter(context.Background(), investment.LoanId)
+	}
 	return nil
 }
 
+// Create Disbursement
+func (s *loanService) CreateDisbursement(ctx context.Context, disbursement *loan.LoanDisbursement) error {
+	return s.uow.Do(ctx, func(ctx context.Context, repos uow.Repositories) error {
+		loanDetail, err := repos.Loans.GetLoanDetailForUpdate(ctx, disbursement.LoanId)
+		if err != nil {
+			return err
+		}
+
+		// Check if loan is in valid state for disbursement
+		if _, err := s.transition(ctx, loanDetail, loan.ActionDisburse); err != nil {
+			return err
+		}
+
+		if err := s.checkProductDocuments(ctx, repos.Loans, loanDetail, loan.ActionDisburse, disbursement.Documents); err != nil {
+			return err
+		}
+
+		// create disbursement and 	Update loan state after disbursement
+		return repos.Loans.CreateDisbursement(ctx, disbursement)
+	})
+}
+
 func (s *loanService) getEmailInvestors(ctx context.Context, loanId uuid.UUID) ([]string, error) {
 	emails, err := s.loanRepo.GetInvestorEmailsByLoanID(ctx, loanId)
 	if err != nil {
@@ -128,26 +664,50 @@ func (s *loanService) getEmailInvestors(ctx context.Context, loanId uuid.UUID) (
 	return emails, nil
 }
 
-func (s *loanService) genReport(ctx context.Context, loanId uuid.UUID) (string, error) {
-	pathFile := path.Join(s.basePath, loanId.String()+".pdf")
+// genReport writes the agreement PDF of a loan and links it as its agreement. A regenerated
+// agreement, one replacing an issued agreement, gets its own file so the issued one stays verifiable.
+func (s *loanService) genReport(ctx context.Context, loanId uuid.UUID, regenerated bool) (string, error) {
+	fileId := uuid.New()
+	name := loanId.String() + ".pdf"
+	if regenerated {
+		name = loanId.String() + "-" + fileId.String() + ".pdf"
+	}
+	pathFile := path.Join(s.basePath, name)
 
-	pdf.NewService().GeneratePDF(pdf.ReportParam{
+	err := pdf.NewService().GeneratePDF(pdf.ReportParam{
 		FilePath: pathFile,
 		// TBD: add detail data each of investor
 		Data: pdf.Data{},
 	})
+	if err != nil {
+		return "", err
+	}
+
+	// Digest lets holders of the agreement verify it was issued by us
+	sum, err := checksum.SHA256File(pathFile)
+	if err != nil {
+		return "", err
+	}
 
 	fileDetail := &filemanager.File{
+		FileID:       fileId,
+		Sha256:       sum,
 		FileType:     ".pdf",
-		Label:        loanId.String() + ".pdf",
+		Label:        name,
 		Location:     pathFile,
 		LocationType: filemanager.LocationTypeLocal,
+		Status:       filemanager.StatusCommitted,
 	}
-	err := s.fileRepo.Create(ctx, fileDetail)
+	err = s.fileRepo.Create(ctx, fileDetail)
 	if err != nil {
 		return "", err
 
 	}
+
+	err = s.loanRepo.SetAgreementFile(ctx, loanId, fileDetail.FileID)
+	if err != nil {
+		return "", err
+	}
 	return fileDetail.FileID.String(), nil
 }
 
@@ -156,19 +716,37 @@ func (s *loanService) genReportLink(id string) string {
 	return "http://localhost:8080/api/files/" + id
 }
 
+// mail returns the injected mailer or the default mail connection
+func (s *loanService) mail() mail.MailService {
+	if s.mailer != nil {
+		return s.mailer
+	}
+	return mail.Mail()
+}
+
 func (s *loanService) publishAggrementLatter(ctx context.Context, loanId uuid.UUID) error {
-	emails, err := s.getEmailInvestors(ctx, loanId)
+	// call gen report
+	fileId, err := s.genReport(ctx, loanId, false)
 	if err != nil {
 		return err
 	}
 
-	// call gen report
-	fileId, err := s.genReport(ctx, loanId)
+	_, err = s.sendAgreement(ctx, loanId, fileId)
+	return err
+}
+
+// sendAgreement mails the agreement link to every investor of the loan,
+// returns the investors it was sent to
+func (s *loanService) sendAgreement(ctx context.Context, loanId uuid.UUID, fileId string) ([]string, error) {
+	emails, err := s.getEmailInvestors(ctx, loanId)
 	if err != nil {
-		return err
+		return nil, err
 	}
+
 	// get file link
 	link := s.genReportLink(fileId)
+	sent := []string{}
+	var errs []error
 	for _, v := range emails {
 		emailBody, err := template.TemplateEmailAgreement(template.EmailData{
 			LoanID:       loanId.String(),
@@ -176,27 +754,170 @@ func (s *loanService) publishAggrementLatter(ctx context.Context, loanId uuid.UU
 			AgreementURL: link,
 		})
 		if err != nil {
-			// TBD: Handle error on go routine
-			fmt.Println(err)
-			break
+			return sent, err
+		}
+		if err := s.mail().Send([]string{v}, "Investment Agreement", emailBody); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", v, err))
+			continue
+		}
+		sent = append(sent, v)
+	}
+	return sent, errors.Join(errs...)
+}
+
+// ExpireLoans expires approved loans whose funding deadline passed before now,
+// returns the number of expired loans
+func (s *loanService) ExpireLoans(ctx context.Context, now time.Time) (int, error) {
+	loanIDs, err := s.loanRepo.GetLoansPastFundingDeadline(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, loanID := range loanIDs {
+		if err := s.expireLoan(ctx, loanID); err != nil {
+			log.Printf("expire loan %s: %s", loanID, err)
+			continue
 		}
-		mail.Mail().Send([]string{v}, "Investment Agreement", emailBody)
+		expired++
+	}
+	return expired, nil
+}
+
+func (s *loanService) expireLoan(ctx context.Context, loanID uuid.UUID) error {
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, loanID)
+	if err != nil {
+		return err
+	}
+
+	t, err := s.machine.System(loanDetail, loan.ActionExpire)
+	if err != nil {
+		return err
+	}
+
+	// collect investors before their investments are voided
+	emails, err := s.getEmailInvestors(ctx, loanID)
+	if err != nil {
+		return err
+	}
+	borrower, err := s.loanRepo.GetBorrowerEmail(ctx, loanID)
+	if err != nil {
+		return err
 	}
+
+	err = s.loanRepo.ExpireLoan(ctx, loanID, t.From)
+	if err != nil {
+		return err
+	}
+
+	go s.publishExpiry(loanID, borrower, emails)
 	return nil
 }
 
+func (s *loanService) publishExpiry(loanId uuid.UUID, borrower string, investors []string) {
+	recipients := map[string]bool{borrower: true}
+	for _, v := range investors {
+		recipients[v] = false
+	}
+
+	for v, isBorrower := range recipients {
+		emailBody, err := template.TemplateEmailLoanExpired(template.ExpiryData{
+			RecipientName: v,
+			LoanID:        loanId.String(),
+			IsBorrower:    isBorrower,
+		})
+		if err != nil {
+			log.Printf("loan %s expiry notice to %s: %s", loanId, v, err)
+			continue
+		}
+		if err := s.mail().Send([]string{v}, "Loan Expired", emailBody); err != nil {
+			log.Printf("loan %s expiry notice to %s: %s", loanId, v, err)
+		}
+	}
+}
+
+func (s *loanService) publishCancellation(cancellation *loan.LoanCancellation, emails []string) {
+	for _, v := range emails {
+		emailBody, err := template.TemplateEmailLoanCancelled(template.CancellationData{
+			LoanID:       cancellation.LoanId.String(),
+			InvestorName: v,
+			Reason:       cancellation.Reason,
+		})
+		if err != nil {
+			log.Printf("loan %s cancellation notice to %s: %s", cancellation.LoanId, v, err)
+			continue
+		}
+		if err := s.mail().Send([]string{v}, "Loan Cancelled", emailBody); err != nil {
+			log.Printf("loan %s cancellation notice to %s: %s", cancellation.LoanId, v, err)
+		}
+	}
+}
+
 func (s *loanService) TotalPayment(ctx context.Context, loanID string) (*loan.BorrowerPayment, error) {
 	if loanID == "" {
 		return nil, errors.New("loan_id is required")
 	}
+	id, err := uuid.Parse(loanID)
+	if err != nil {
+		return nil, errors.New("invalid loan_id")
+	}
 
 	totalPayment, err := s.loanRepo.GetTotalPaymentByLoanID(ctx, loanID)
 	if err != nil {
 		return nil, err
 	}
+
+	// the repository charges flat interest, the product decides the method
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	method, err := s.loanInterestMethod(ctx, loanDetail)
+	if err != nil {
+		return nil, err
+	}
+	totalPayment.TotalInterest = method.TotalInterest(totalPayment.Principal, loanDetail.Rate, loanDetail.DurationMonth)
+	totalPayment.TotalPayment = totalPayment.Principal + totalPayment.TotalInterest
 	return totalPayment, nil
 }
 
+// GetInvestorPortfolio returns the investments of an investor with totals, filtered by loan state when set
+func (s *loanService) GetInvestorPortfolio(ctx context.Context, investorID uuid.UUID, state loan.LoanState) (*loan.Portfolio, error) {
+	if state != "" && !isKnownState(state) {
+		return nil, fmt.Errorf("%w: %s", loan.ErrUnknownState, state)
+	}
+
+	items, err := s.loanRepo.GetInvestorPortfolio(ctx, investorID, state)
+	if err != nil {
+		return nil, err
+	}
+	return loan.NewPortfolio(items), nil
+}
+
+// GetBorrowerLoans returns the loans of a borrower with funding progress, schedule and documents
+func (s *loanService) GetBorrowerLoans(ctx context.Context, borrowerID uuid.UUID) ([]loan.BorrowerLoan, error) {
+	loans, err := s.loanRepo.GetBorrowerLoans(ctx, borrowerID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range loans {
+		loans[i].Compute()
+		loans[i].Documents = loans[i].DocumentFiles()
+		s.setDocumentLinks(loans[i].Documents)
+	}
+	return loans, nil
+}
+
+func isKnownState(state loan.LoanState) bool {
+	for _, v := range loan.States {
+		if v == state {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *loanService) GetInvestorProfit(ctx context.Context, loanID string) ([]loan.InvestorProfit, error) {
 	if loanID == "" {
 		return nil, errors.New("loan_id is required")
@@ -208,3 +929,77 @@ func (s *loanService) GetInvestorProfit(ctx context.Context, loanID string) ([]l
 	}
 	return listInvestors, nil
 }
+
+// InspectLoan returns the loan with its approvals, investments and change history
+func (s *loanService) InspectLoan(ctx context.Context, loanID uuid.UUID) (*loan.LoanInspection, error) {
+	detail, err := s.GetLoanDetail(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	inspection := &loan.LoanInspection{Detail: detail}
+	if inspection.Approvals, err = s.loanRepo.GetApprovals(ctx, loanID); err != nil {
+		return nil, err
+	}
+	if inspection.Investments, err = s.loanRepo.GetInvestments(ctx, loanID); err != nil {
+		return nil, err
+	}
+	if inspection.Changes, err = s.loanRepo.GetLoanChanges(ctx, loanID); err != nil {
+		return nil, err
+	}
+	return inspection, nil
+}
+
+// ForceTransition moves the loan to any state bypassing the lifecycle, only
+// admins may do so and the reason is recorded in the change history
+func (s *loanService) ForceTransition(ctx context.Context, loanID uuid.UUID, to loan.LoanState, reason string) (*loan.LoanChange, error) {
+	actor, ok := user.ActorFromContext(ctx)
+	if !ok || actor.Role != user.RoleAdmin {
+		return nil, loan.ErrActionNotPermitted
+	}
+
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := loan.NewForcedTransition(loanID, loanDetail.State, to, reason, actor.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loanRepo.ForceState(ctx, change); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// ResendAgreement mails the current agreement to the investors again
+func (s *loanService) ResendAgreement(ctx context.Context, loanID uuid.UUID) ([]string, error) {
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if loanDetail.AggrementFile == "" {
+		return nil, loan.ErrNoAgreement
+	}
+	return s.sendAgreement(ctx, loanID, loanDetail.AggrementFile)
+}
+
+// RegenerateAgreement issues a new agreement PDF of a funded loan, the replaced agreement
+// keeps its file and stays verifiable, investors are not notified
+func (s *loanService) RegenerateAgreement(ctx context.Context, loanID uuid.UUID) (uuid.UUID, error) {
+	loanDetail, err := s.loanRepo.GetLoanDetail(ctx, loanID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if loanDetail.State != loan.StateInvested && loanDetail.State != loan.StateDisbursed {
+		return uuid.Nil, loan.ErrLoanNotFullyFunded
+	}
+
+	fileId, err := s.genReport(ctx, loanID, loanDetail.AggrementFile != "")
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(fileId)
+}
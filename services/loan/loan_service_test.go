@@ -0,0 +1,427 @@
+package loan
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/zainulbr/simple-loan-engine/libs/checksum"
+	"github.com/zainulbr/simple-loan-engine/libs/fee"
+	"github.com/zainulbr/simple-loan-engine/libs/notification/mail"
+	"github.com/zainulbr/simple-loan-engine/models/filemanager"
+	"github.com/zainulbr/simple-loan-engine/models/loan"
+	"github.com/zainulbr/simple-loan-engine/models/product"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	"github.com/zainulbr/simple-loan-engine/repositories/memory"
+)
+
+func setupService(t *testing.T) (LoanService, *memory.Store) {
+	store := memory.NewStore()
+	return NewLoanService(store.Loans(), store.Files(), nil, store.UnitOfWork()), store
+}
+
+func actorContext(t *testing.T, store *memory.Store, role user.UserRole) (context.Context, uuid.UUID) {
+	userID, err := store.Users().Create(context.Background(), user.User{Email: uuid.NewString() + "@example.com", Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ContextWithActor(context.Background(), user.Actor{UserId: userID, Role: role}), userID
+}
+
+func proposeLoan(t *testing.T, store *memory.Store, amount float64) uuid.UUID {
+	_, borrower := actorContext(t, store, user.RoleBorrower)
+	l := &loan.Loan{LoanId: uuid.New(), ProposedBy: borrower, Amount: amount, DurationMonth: 12}
+	if err := store.Loans().CreateLoan(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	return l.LoanId
+}
+
+func visitPhoto(t *testing.T, store *memory.Store) uuid.UUID {
+	file := &filemanager.File{Label: "visit.jpg", FileType: ".jpg", Status: filemanager.StatusPending, ScanStatus: filemanager.ScanClean}
+	if err := store.Files().Create(context.Background(), file); err != nil {
+		t.Fatal(err)
+	}
+	return file.FileID
+}
+
+func approveLoan(t *testing.T, s LoanService, store *memory.Store, loanID uuid.UUID) {
+	ctx, validator := actorContext(t, store, user.RoleFiledValidator)
+	photo := visitPhoto(t, store)
+	err := s.ApproveLoan(ctx, &loan.LoanApproval{
+		LoanId:       loanID,
+		ApprovedBy:   validator,
+		ApprovalDate: time.Now(),
+		VisitedFile:  photo,
+		Documents:    []loan.LoanDocument{{FileId: photo, DocumentType: loan.DocumentVisitedPhoto}},
+		Rate:         0.12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApproveLoan(t *testing.T) {
+	s, store := setupService(t)
+	loanID := proposeLoan(t, store, 1000)
+	ctx, validator := actorContext(t, store, user.RoleFiledValidator)
+	photo := visitPhoto(t, store)
+
+	err := s.ApproveLoan(ctx, &loan.LoanApproval{LoanId: loanID, ApprovedBy: validator, ApprovalDate: time.Now(), Rate: 0.12})
+	assert.ErrorIs(t, err, loan.ErrVisitRequired)
+
+	investorCtx, _ := actorContext(t, store, user.RoleInvestor)
+	err = s.ApproveLoan(investorCtx, &loan.LoanApproval{LoanId: loanID, ApprovalDate: time.Now(), VisitedFile: photo, Rate: 0.12})
+	assert.ErrorIs(t, err, loan.ErrActionNotPermitted)
+
+	approval := &loan.LoanApproval{
+		LoanId:       loanID,
+		ApprovedBy:   validator,
+		ApprovalDate: time.Now(),
+		VisitedFile:  photo,
+		Documents:    []loan.LoanDocument{{FileId: photo, DocumentType: loan.DocumentVisitedPhoto}},
+		Rate:         0.12,
+	}
+	if !assert.NoError(t, s.ApproveLoan(ctx, approval)) {
+		return
+	}
+	assert.Equal(t, "field_visit", approval.Stage)
+	assert.NotEmpty(t, approval.Warnings, "the photo has no capture time nor position")
+	assert.WithinDuration(t, approval.ApprovalDate.Add(defaultFundingWindow), approval.FundingDeadline, time.Second)
+
+	detail, err := s.GetLoanDetail(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, loan.StateApproved, detail.State)
+		assert.Greater(t, detail.ROI, 0.0)
+		assert.Less(t, detail.ROI, detail.Rate, "the platform keeps a margin")
+	}
+
+	file, err := store.Files().GetByID(context.Background(), photo)
+	if assert.NoError(t, err) {
+		assert.Equal(t, filemanager.StatusCommitted, file.Status)
+	}
+}
+
+func TestApproveLoanNotFound(t *testing.T) {
+	s, store := setupService(t)
+	ctx, validator := actorContext(t, store, user.RoleFiledValidator)
+
+	err := s.ApproveLoan(ctx, &loan.LoanApproval{LoanId: uuid.New(), ApprovedBy: validator, ApprovalDate: time.Now()})
+	assert.ErrorIs(t, err, pg.ErrNoRows)
+}
+
+func TestCreateInvestment(t *testing.T) {
+	s, store := setupService(t)
+	loanID := proposeLoan(t, store, 1000)
+	ctx, investor := actorContext(t, store, user.RoleInvestor)
+
+	err := s.CreateInvestment(ctx, &loan.LoanInvestment{LoanId: loanID, InvestedBy: investor, Amount: 100})
+	assert.ErrorIs(t, err, loan.ErrInvalidTransition, "proposed loans are not open for investment")
+
+	approveLoan(t, s, store, loanID)
+
+	assert.NoError(t, s.CreateInvestment(ctx, &loan.LoanInvestment{LoanId: loanID, InvestedBy: investor, Amount: 600}))
+
+	err = s.CreateInvestment(ctx, &loan.LoanInvestment{LoanId: loanID, InvestedBy: investor, Amount: 500})
+	assert.Error(t, err, "investments can not exceed the loan amount")
+
+	detail, err := s.GetLoanDetail(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, loan.StateApproved, detail.State)
+		assert.Equal(t, 600.0, detail.TotalInvestment)
+	}
+}
+
+func TestCreateDisbursement(t *testing.T) {
+	s, store := setupService(t)
+	loanID := proposeLoan(t, store, 1000)
+	approveLoan(t, s, store, loanID)
+	ctx, officer := actorContext(t, store, user.RoleFieldOfficer)
+	proof := visitPhoto(t, store)
+
+	disbursement := &loan.LoanDisbursement{
+		LoanId:          loanID,
+		DisbursementBy:  officer,
+		DisbursedFile:   proof,
+		DisbursmentDate: time.Now(),
+		Documents:       []loan.LoanDocument{{FileId: proof, DocumentType: loan.DocumentDisbursementProof}},
+	}
+	assert.ErrorIs(t, s.CreateDisbursement(ctx, disbursement), loan.ErrInvalidTransition, "the loan is not invested yet")
+
+	detail, err := s.GetLoanDetail(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, loan.StateApproved, detail.State)
+	}
+	file, err := store.Files().GetByID(context.Background(), proof)
+	if assert.NoError(t, err) {
+		assert.Equal(t, filemanager.StatusPending, file.Status, "the proof is not committed")
+	}
+}
+
+func TestRejectLoan(t *testing.T) {
+	s, store := setupService(t)
+	loanID := proposeLoan(t, store, 1000)
+	ctx, _ := actorContext(t, store, user.RoleFiledValidator)
+
+	assert.NoError(t, s.RejectLoan(ctx, loanID))
+	assert.ErrorIs(t, s.RejectLoan(ctx, loanID), loan.ErrInvalidTransition)
+
+	detail, err := s.GetLoanDetail(ctx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, loan.StateRejected, detail.State)
+	}
+}
+
+func TestRegenerateAgreement(t *testing.T) {
+	store := memory.NewStore()
+	dir := t.TempDir()
+	s := NewLoanService(store.Loans(), store.Files(), nil, store.UnitOfWork(), WithReportDir(dir))
+	_, borrower := actorContext(t, store, user.RoleBorrower)
+	l := &loan.Loan{LoanId: uuid.New(), ProposedBy: borrower, Amount: 1000, DurationMonth: 12, State: string(loan.StateInvested)}
+	if err := store.Loans().CreateLoan(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	issued, err := s.RegenerateAgreement(ctx, l.LoanId)
+	if !assert.NoError(t, err) {
+		return
+	}
+	regenerated, err := s.RegenerateAgreement(ctx, l.LoanId)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the issued agreement keeps its bytes and still matches its digest
+	old, err := store.Files().GetByID(ctx, issued)
+	if assert.NoError(t, err) {
+		assert.Equal(t, filepath.Join(dir, l.LoanId.String()+".pdf"), old.Location)
+		sum, err := checksum.SHA256File(old.Location)
+		assert.NoError(t, err)
+		assert.Equal(t, old.Sha256, sum)
+	}
+	current, err := store.Files().GetByID(ctx, regenerated)
+	if assert.NoError(t, err) {
+		assert.Equal(t, filepath.Join(dir, l.LoanId.String()+"-"+regenerated.String()+".pdf"), current.Location)
+	}
+
+	documents, err := store.Loans().GetLoanDocuments(ctx, l.LoanId)
+	if assert.NoError(t, err) && assert.Len(t, documents, 2) {
+		assert.Equal(t, regenerated, documents[0].ReplacedBy)
+		assert.Equal(t, uuid.Nil, documents[1].ReplacedBy)
+	}
+	detail, err := store.Loans().GetLoanDetail(ctx, l.LoanId)
+	if assert.NoError(t, err) {
+		assert.Equal(t, regenerated.String(), detail.AggrementFile)
+	}
+}
+
+func TestGetLoanChanges(t *testing.T) {
+	s, store := setupService(t)
+	loanID := proposeLoan(t, store, 1000)
+	detail, err := store.Loans().GetLoanDetail(context.Background(), loanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposer := user.ContextWithActor(context.Background(), user.Actor{UserId: detail.ProposedBy, Role: user.RoleBorrower})
+	other, _ := actorContext(t, store, user.RoleBorrower)
+	validator, _ := actorContext(t, store, user.RoleFiledValidator)
+	investor, _ := actorContext(t, store, user.RoleInvestor)
+	service, _ := actorContext(t, store, user.RoleService)
+
+	_, err = s.GetLoanChanges(proposer, loanID)
+	assert.NoError(t, err)
+	_, err = s.GetLoanChanges(validator, loanID)
+	assert.NoError(t, err)
+	_, err = s.GetLoanChanges(other, loanID)
+	assert.ErrorIs(t, err, loan.ErrNotLoanProposer)
+	_, err = s.GetLoanChanges(investor, loanID)
+	assert.ErrorIs(t, err, loan.ErrActionNotPermitted)
+	_, err = s.GetLoanChanges(service, loanID)
+	assert.ErrorIs(t, err, loan.ErrActionNotPermitted)
+	_, err = s.GetLoanChanges(context.Background(), loanID)
+	assert.ErrorIs(t, err, loan.ErrActionNotPermitted)
+}
+
+func TestGetInvestorPortfolioUnknownState(t *testing.T) {
+	s, store := setupService(t)
+	ctx, investor := actorContext(t, store, user.RoleInvestor)
+
+	_, err := s.GetInvestorPortfolio(ctx, investor, "paid")
+	assert.ErrorIs(t, err, loan.ErrUnknownState)
+
+	portfolio, err := s.GetInvestorPortfolio(ctx, investor, loan.StateDisbursed)
+	if assert.NoError(t, err) {
+		assert.Empty(t, portfolio.Items)
+	}
+}
+
+func TestProductRequiredDocuments(t *testing.T) {
+	store := memory.NewStore()
+	s := NewLoanService(store.Loans(), store.Files(), store.Products(), store.UnitOfWork())
+	ctx := context.Background()
+	p := &product.Product{
+		Code: "micro", Name: "Micro", MaxAmount: 5000, Durations: []int{12}, MaxRate: 0.2, Active: true,
+		FeeRule:           fee.Rule{Type: fee.RuleTypePercentage, Value: 0.2},
+		RequiredDocuments: []loan.DocumentType{loan.DocumentSignedForm, loan.DocumentDisbursementProof},
+	}
+	if err := store.Products().Create(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	borrowerCtx, borrower := actorContext(t, store, user.RoleBorrower)
+	newLoan := func(state loan.LoanState) uuid.UUID {
+		l := &loan.Loan{LoanId: uuid.New(), ProductId: p.ProductId, ProposedBy: borrower, Amount: 1000, DurationMonth: 12, State: string(state)}
+		if err := store.Loans().CreateLoan(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+		return l.LoanId
+	}
+
+	// the final approval needs the signed form, the proof is due at disbursement
+	proposed := newLoan(loan.StateProposed)
+	validatorCtx, validator := actorContext(t, store, user.RoleFiledValidator)
+	approve := func() error {
+		photo := visitPhoto(t, store)
+		return s.ApproveLoan(validatorCtx, &loan.LoanApproval{
+			LoanId: proposed, ApprovedBy: validator, ApprovalDate: time.Now(), VisitedFile: photo, Rate: 0.12,
+			Documents: []loan.LoanDocument{{FileId: photo, DocumentType: loan.DocumentVisitedPhoto}},
+		})
+	}
+	err := approve()
+	assert.ErrorIs(t, err, product.ErrMissingDocument)
+	assert.ErrorContains(t, err, "signed_form")
+
+	_, err = s.AddLoanDocuments(borrowerCtx, proposed, []loan.LoanDocument{{FileId: visitPhoto(t, store), DocumentType: loan.DocumentSignedForm}})
+	assert.NoError(t, err)
+	assert.NoError(t, approve())
+
+	invested := newLoan(loan.StateInvested)
+	officerCtx, officer := actorContext(t, store, user.RoleFieldOfficer)
+	disburse := func(documents ...loan.LoanDocument) error {
+		return s.CreateDisbursement(officerCtx, &loan.LoanDisbursement{
+			LoanId: invested, DisbursementBy: officer, DisbursmentDate: time.Now(), Documents: documents,
+		})
+	}
+	err = disburse()
+	assert.ErrorIs(t, err, product.ErrMissingDocument)
+	assert.ErrorContains(t, err, "signed_form, disbursement_proof")
+
+	_, err = s.AddLoanDocuments(borrowerCtx, invested, []loan.LoanDocument{{FileId: visitPhoto(t, store), DocumentType: loan.DocumentSignedForm}})
+	assert.NoError(t, err)
+	assert.NoError(t, disburse(loan.LoanDocument{FileId: visitPhoto(t, store), DocumentType: loan.DocumentDisbursementProof}))
+}
+
+func TestRecordRepaymentAmount(t *testing.T) {
+	s, store := setupService(t)
+	ctx, officer := actorContext(t, store, user.RoleFieldOfficer)
+	_, borrower := actorContext(t, store, user.RoleBorrower)
+	l := &loan.Loan{LoanId: uuid.New(), ProposedBy: borrower, Amount: 1000, Rate: 0.12, DurationMonth: 12, State: string(loan.StateDisbursed)}
+	if err := store.Loans().CreateLoan(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+
+	// a flat installment carries its share of the total interest
+	repayment := &loan.LoanRepayment{LoanId: l.LoanId, Amount: 1120.0 / 12, PaidAt: time.Now(), RecordedBy: officer}
+	if assert.NoError(t, s.RecordRepayment(ctx, repayment)) {
+		assert.InDelta(t, 1000.0/12, repayment.Principal, 1e-9)
+		assert.InDelta(t, 10, repayment.Interest, 1e-9)
+		assert.InDelta(t, repayment.Interest, repayment.InvestorInterest+repayment.PlatformFee, 1e-9)
+	}
+
+	err := s.RecordRepayment(ctx, &loan.LoanRepayment{LoanId: l.LoanId, Amount: 100, Principal: 100, PaidAt: time.Now()})
+	assert.Error(t, err, "amount and principal are exclusive")
+
+	payment, err := s.TotalPayment(ctx, l.LoanId.String())
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 120, payment.TotalInterest, 1e-9)
+		assert.InDelta(t, 1120, payment.TotalPayment, 1e-9)
+	}
+}
+
+func TestUpdateLoanAfterFirstStage(t *testing.T) {
+	s, store := setupService(t)
+	borrowerCtx, borrower := actorContext(t, store, user.RoleBorrower)
+	l := &loan.Loan{
+		LoanId: uuid.New(), ProposedBy: borrower, Amount: 1000, DurationMonth: 12,
+		ApprovalChain: loan.ApprovalChain{
+			{Name: "field_visit", Role: user.RoleFiledValidator, RequireVisit: true},
+			{Name: "credit_review", Role: user.RoleCreditOfficer},
+		},
+	}
+	if err := store.Loans().CreateLoan(context.Background(), l); err != nil {
+		t.Fatal(err)
+	}
+
+	amount := 1500.0
+	_, err := s.UpdateLoan(borrowerCtx, l.LoanId, &loan.LoanUpdate{Amount: &amount})
+	assert.NoError(t, err, "no stage is signed off yet")
+
+	approveLoan(t, s, store, l.LoanId)
+	actions, err := s.GetLoanActions(borrowerCtx, l.LoanId)
+	assert.NoError(t, err)
+	assert.NotContains(t, actions, loan.ActionEdit)
+
+	amount = 5000
+	_, err = s.UpdateLoan(borrowerCtx, l.LoanId, &loan.LoanUpdate{Amount: &amount})
+	assert.ErrorIs(t, err, loan.ErrApprovalStarted)
+
+	detail, err := s.GetLoanDetail(borrowerCtx, l.LoanId)
+	if assert.NoError(t, err) {
+		assert.Equal(t, loan.StateProposed, detail.State)
+		assert.Equal(t, 1500.0, detail.Amount)
+	}
+}
+
+func TestForceTransitionVoidsInvestments(t *testing.T) {
+	s, store := setupService(t)
+	loanID := proposeLoan(t, store, 1000)
+	approveLoan(t, s, store, loanID)
+	investorCtx, investor := actorContext(t, store, user.RoleInvestor)
+	assert.NoError(t, s.CreateInvestment(investorCtx, &loan.LoanInvestment{LoanId: loanID, InvestedBy: investor, Amount: 400}))
+
+	adminCtx, _ := actorContext(t, store, user.RoleAdmin)
+	_, err := s.ForceTransition(adminCtx, loanID, loan.StateCancelled, "borrower deceased")
+	assert.NoError(t, err)
+
+	investments, err := store.Loans().GetInvestments(context.Background(), loanID)
+	if assert.NoError(t, err) && assert.Len(t, investments, 1) {
+		assert.NotNil(t, investments[0].VoidedAt, "a forced cancel leaves no live investment")
+	}
+	detail, err := s.GetLoanDetail(adminCtx, loanID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, loan.StateCancelled, detail.State)
+		assert.Zero(t, detail.TotalInvestment)
+	}
+}
+
+// failingMailer fails to deliver to one address and records the others
+type failingMailer struct {
+	mail.Fake
+	fail string
+}
+
+func (m *failingMailer) Send(to []string, subject, body string) error {
+	if slices.Contains(to, m.fail) {
+		return errors.New("mailbox unavailable")
+	}
+	return m.Fake.Send(to, subject, body)
+}
+
+func TestPublishContinuesAfterFailedSend(t *testing.T) {
+	store := memory.NewStore()
+	mailer := &failingMailer{fail: "b@example.com"}
+	s := NewLoanService(store.Loans(), store.Files(), nil, store.UnitOfWork(), WithMailer(mailer)).(*loanService)
+	investors := []string{"a@example.com", "b@example.com", "c@example.com"}
+
+	s.publishCancellation(&loan.LoanCancellation{LoanId: uuid.New(), Reason: "withdrawn"}, investors)
+	assert.Len(t, mailer.Sent(), 2, "the failed recipient does not stop the others")
+
+	s.publishExpiry(uuid.New(), "borrower@example.com", investors)
+	assert.Len(t, mailer.Sent(), 5)
+}
@@ -0,0 +1,17 @@
+package product
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/product"
+)
+
+// ProductService manages the loan product catalog
+type ProductService interface {
+	CreateProduct(ctx context.Context, product *product.Product) (*product.Product, error)
+	UpdateProduct(ctx context.Context, product *product.Product) (*product.Product, error)
+	GetProduct(ctx context.Context, productID uuid.UUID) (*product.Product, error)
+	ListProducts(ctx context.Context, activeOnly bool) ([]product.Product, error)
+	DeactivateProduct(ctx context.Context, productID uuid.UUID) error
+}
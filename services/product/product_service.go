@@ -0,0 +1,64 @@
+package product
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/product"
+	productRepository "github.com/zainulbr/simple-loan-engine/repositories/product"
+)
+
+type productService struct {
+	productRepo productRepository.ProductRepository
+}
+
+// NewProductService creates a new instance of ProductService
+func NewProductService(productRepo productRepository.ProductRepository) ProductService {
+	return &productService{productRepo: productRepo}
+}
+
+// CreateProduct validates and stores a new product, products are created active
+func (s *productService) CreateProduct(ctx context.Context, p *product.Product) (*product.Product, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	p.Active = true
+	if err := s.productRepo.Create(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UpdateProduct validates and replaces a product definition
+func (s *productService) UpdateProduct(ctx context.Context, p *product.Product) (*product.Product, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.productRepo.Update(ctx, p); err != nil {
+		return nil, err
+	}
+	return s.productRepo.GetByID(ctx, p.ProductId)
+}
+
+// GetProduct returns a product by ID
+func (s *productService) GetProduct(ctx context.Context, productID uuid.UUID) (*product.Product, error) {
+	return s.productRepo.GetByID(ctx, productID)
+}
+
+// ListProducts returns the product catalog
+func (s *productService) ListProducts(ctx context.Context, activeOnly bool) ([]product.Product, error) {
+	return s.productRepo.List(ctx, activeOnly)
+}
+
+// DeactivateProduct stops new loans for a product, existing loans are unaffected
+func (s *productService) DeactivateProduct(ctx context.Context, productID uuid.UUID) error {
+	p, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return err
+	}
+
+	p.Active = false
+	return s.productRepo.Update(ctx, p)
+}
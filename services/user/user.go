@@ -0,0 +1,22 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+)
+
+var (
+	ErrInvalidEmail = errors.New("email is invalid")
+	ErrNotStaffRole = errors.New("role is not a staff role")
+	ErrEmailTaken   = errors.New("a user with this email already exists")
+)
+
+// UserService manages platform users
+type UserService interface {
+	CreateStaff(ctx context.Context, email string, role user.UserRole) (*user.User, error)
+	GetUser(ctx context.Context, userID uuid.UUID) (*user.User, error)
+	IssueToken(ctx context.Context, userID uuid.UUID) (string, error)
+}
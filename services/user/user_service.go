@@ -0,0 +1,62 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	libToken "github.com/zainulbr/simple-loan-engine/libs/token"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+	userRepository "github.com/zainulbr/simple-loan-engine/repositories/user"
+)
+
+type userService struct {
+	userRepo userRepository.UserRepository
+	tokens   libToken.TokenService
+}
+
+// NewUserService creates a new instance of UserService
+func NewUserService(userRepo userRepository.UserRepository, tokens libToken.TokenService) UserService {
+	return &userService{userRepo: userRepo, tokens: tokens}
+}
+
+// CreateStaff creates an admin, validator, officer or service account, emails are unique
+func (s *userService) CreateStaff(ctx context.Context, email string, role user.UserRole) (*user.User, error) {
+	if _, err := mail.ParseAddress(email); err != nil {
+		return nil, ErrInvalidEmail
+	}
+	if !role.IsStaff() && role != user.RoleService {
+		return nil, ErrNotStaffRole
+	}
+
+	_, err := s.userRepo.GetByEmail(ctx, email)
+	if err == nil {
+		return nil, ErrEmailTaken
+	}
+	if !errors.Is(err, pg.ErrNoRows) {
+		return nil, err
+	}
+
+	id, err := s.userRepo.Create(ctx, user.User{Email: email, Role: role})
+	if err != nil {
+		return nil, err
+	}
+	return s.userRepo.GetByID(ctx, id)
+}
+
+// GetUser returns a user by ID
+func (s *userService) GetUser(ctx context.Context, userID uuid.UUID) (*user.User, error) {
+	return s.userRepo.GetByID(ctx, userID)
+}
+
+// IssueToken signs an API token carrying the user id and role
+func (s *userService) IssueToken(ctx context.Context, userID uuid.UUID) (string, error) {
+	u, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return s.tokens.GenerateToken(u.UserId.String(), string(u.Role), time.Now()), nil
+}
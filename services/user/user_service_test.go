@@ -0,0 +1,100 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	libToken "github.com/zainulbr/simple-loan-engine/libs/token"
+	"github.com/zainulbr/simple-loan-engine/models/user"
+)
+
+// userRepo keeps users in memory
+type userRepo struct {
+	users map[uuid.UUID]user.User
+}
+
+func (r *userRepo) Create(_ context.Context, u user.User) (uuid.UUID, error) {
+	u.UserId = uuid.New()
+	r.users[u.UserId] = u
+	return u.UserId, nil
+}
+
+func (r *userRepo) GetByID(_ context.Context, userID uuid.UUID) (*user.User, error) {
+	u, ok := r.users[userID]
+	if !ok {
+		return nil, pg.ErrNoRows
+	}
+	return &u, nil
+}
+
+func (r *userRepo) GetByEmail(_ context.Context, email string) (*user.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, pg.ErrNoRows
+}
+
+func (r *userRepo) Delete(_ context.Context, userID uuid.UUID) error {
+	delete(r.users, userID)
+	return nil
+}
+
+func TestCreateStaff(t *testing.T) {
+	ctx := context.Background()
+	tokens, err := libToken.NewService(libToken.HMACKey("test", []byte("secret")))
+	require.NoError(t, err)
+	s := NewUserService(&userRepo{users: map[uuid.UUID]user.User{}}, tokens)
+
+	u, err := s.CreateStaff(ctx, "ops@example.com", user.RoleCreditOfficer)
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, uuid.Nil, u.UserId)
+		assert.Equal(t, user.RoleCreditOfficer, u.Role)
+	}
+
+	_, err = s.CreateStaff(ctx, "ops@example.com", user.RoleAdmin)
+	assert.ErrorIs(t, err, ErrEmailTaken)
+
+	u, err = s.CreateStaff(ctx, "billing@example.com", user.RoleService)
+	if assert.NoError(t, err) {
+		assert.Equal(t, user.RoleService, u.Role)
+	}
+
+	_, err = s.CreateStaff(ctx, "someone@example.com", user.RoleInvestor)
+	assert.ErrorIs(t, err, ErrNotStaffRole)
+
+	_, err = s.CreateStaff(ctx, "not an email", user.RoleAdmin)
+	assert.ErrorIs(t, err, ErrInvalidEmail)
+}
+
+func TestIssueToken(t *testing.T) {
+	ctx := context.Background()
+	tokens, err := libToken.NewService(libToken.HMACKey("test", []byte("secret")))
+	require.NoError(t, err)
+	s := NewUserService(&userRepo{users: map[uuid.UUID]user.User{}}, tokens)
+
+	u, err := s.CreateStaff(ctx, "admin@example.com", user.RoleAdmin)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	signed, err := s.IssueToken(ctx, u.UserId)
+	if !assert.NoError(t, err) {
+		return
+	}
+	token, err := tokens.ValidateToken(signed)
+	if assert.NoError(t, err) {
+		claims := token.Claims.(jwt.MapClaims)
+		assert.Equal(t, u.UserId.String(), claims["loan.user_id"])
+		assert.Equal(t, "admin", claims["loan.role"])
+	}
+
+	_, err = s.IssueToken(ctx, uuid.New())
+	assert.ErrorIs(t, err, pg.ErrNoRows)
+}
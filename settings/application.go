@@ -1,5 +1,7 @@
 package settings
 
+import "time"
+
 type AuthOptions struct {
 	EncryptKeys string
 }
@@ -11,6 +13,34 @@ type ServerOptions struct {
 	CorsWhitelist []string
 }
 
+// LoanOptions configures the loan lifecycle
+type LoanOptions struct {
+	FundingWindow  time.Duration // default time an approved loan may stay open for investment
+	ExpiryInterval time.Duration // how often unfunded loans are checked for expiry
+	VisitMaxDrift  time.Duration // max distance of a visit photo capture time from the approval date
+}
+
+// FeeOptions is the default platform fee rule of a loan
+type FeeOptions struct {
+	Type  string  // percentage, flat
+	Value float64 // share of each interest payment or flat amount
+}
+
+// FileOptions configures upload limits and the cleanup of uploads never committed by a loan action
+type FileOptions struct {
+	PendingTTL time.Duration // age after which a pending upload is an orphan
+	GCInterval time.Duration // how often orphaned uploads are removed
+
+	// maximum sizes in bytes, zero disables a limit
+	MaxFileSize         int64 // a single uploaded file
+	MaxApprovalSize     int64 // request body of POST /loans/:id/approve
+	MaxDisbursementSize int64 // request body of POST /loans/:id/disburse
+	MaxDocumentsSize    int64 // request body of POST /loans/:id/documents
+
+	ScannerAddress string        // clamd address, tcp://host:port or unix:///path, empty disables scanning
+	ScanTimeout    time.Duration // max time a single scan may take
+}
+
 type AppSettings struct {
 	Name        string
 	Version     string
@@ -19,4 +49,7 @@ type AppSettings struct {
 	UploadDir   string
 	Server      ServerOptions
 	Auth        AuthOptions
+	Loan        LoanOptions
+	Fee         FeeOptions
+	File        FileOptions
 }
@@ -1,9 +1,10 @@
 package settings
 
 type PostgresOption struct {
-	Driver  string
-	URI     string
-	Enabled bool
+	Driver      string
+	URI         string
+	Enabled     bool
+	AutoMigrate bool // apply pending migrations on startup, honoured in dev only
 }
 
 type SMTPOption struct {
@@ -1,6 +1,9 @@
 package settings
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"strconv"
@@ -8,6 +11,7 @@ import (
 	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -28,97 +32,358 @@ func Env() string {
 	return env
 }
 
-// Load global application settings, specify altPaths to add alternative config search paths
-func Load() (*Settings, error) {
-	env = getEnv("APP_ENV", EnvUnitTest)
+// fileSuffix reads the value of a key from the file it names, e.g. SMTP_PASS_FILE=/run/secrets/smtp
+const fileSuffix = "_FILE"
 
-	if env == EnvUnitTest {
-		return &Settings{}, nil
+// defaults of every key, a key missing here is unknown
+var defaults = map[string]string{
+	"APP_ENV":         EnvUnitTest,
+	"APP_NAME":        "MyApp",
+	"APP_VERSION":     "1.0.0",
+	"APP_DESCRIPTION": "",
+	"APP_DEBUG":       "false",
+	"UPLOAD_DIR":      "uploads",
+
+	"SERVER_API_BASE":       "/api",
+	"SERVER_DOMAIN":         "localhost",
+	"SERVER_HTTP_ADDRESS":   ":8080",
+	"SERVER_CORS_WHITELIST": "",
+
+	"AUTH_ENCRYPT_KEYS": "",
+
+	"LOAN_FUNDING_WINDOW":  "720h",
+	"LOAN_EXPIRY_INTERVAL": "1h",
+	"LOAN_VISIT_MAX_DRIFT": "48h",
+
+	"FEE_TYPE":  "percentage",
+	"FEE_VALUE": "0.2",
+
+	"FILE_PENDING_TTL":           "24h",
+	"FILE_GC_INTERVAL":           "1h",
+	"FILE_MAX_SIZE":              strconv.Itoa(10 << 20),
+	"FILE_MAX_APPROVAL_SIZE":     strconv.Itoa(32 << 20),
+	"FILE_MAX_DISBURSEMENT_SIZE": strconv.Itoa(32 << 20),
+	"FILE_MAX_DOCUMENTS_SIZE":    strconv.Itoa(64 << 20),
+	"FILE_SCANNER_ADDRESS":       "",
+	"FILE_SCAN_TIMEOUT":          "30s",
+
+	"POSTGRES_DRIVER":       "postgres",
+	"POSTGRES_URI":          "",
+	"POSTGRES_ENABLED":      "true",
+	"POSTGRES_AUTO_MIGRATE": "", // true in dev when empty
+
+	"SMTP_HOST": "smtp.gmail.com",
+	"SMTP_PORT": "465",
+	"SMTP_USER": "",
+	"SMTP_PASS": "",
+	"SMTP_FROM": "smtp@gmail.com",
+}
+
+// loadOptions are the optional sources of Load
+type loadOptions struct {
+	file    string
+	envFile string
+	flags   map[string]string
+}
+
+// LoadOption adds a configuration source to Load
+type LoadOption func(*loadOptions)
+
+// WithFile reads a YAML file, nested keys are joined with an underscore,
+// e.g. smtp: {pass_file: /run/secrets/smtp} is SMTP_PASS_FILE
+func WithFile(path string) LoadOption {
+	return func(o *loadOptions) {
+		o.file = path
 	}
+}
 
-	// Load .env file
-	if err := godotenv.Load(); err != nil {
-		return nil, err
+// WithEnvFile reads a dotenv file instead of .env
+func WithEnvFile(path string) LoadOption {
+	return func(o *loadOptions) {
+		o.envFile = path
 	}
+}
 
-	// Parse environment variables into Settings struct
+// WithFlags sets values given on the command line, they override every other source.
+// Keys are written like environment variables or as dotted YAML paths.
+func WithFlags(values map[string]string) LoadOption {
+	return func(o *loadOptions) {
+		o.flags = values
+	}
+}
+
+// Load global application settings. Each key is read from, in increasing priority,
+// its default, the YAML file, the environment (filled by the .env file) and the flags.
+// A key ending in _FILE is read from the file it names.
+func Load(opts ...LoadOption) (*Settings, error) {
+	o := loadOptions{envFile: ".env"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	values, errs := resolve(o)
+
+	env = values["APP_ENV"]
+	if env == EnvUnitTest {
+		s = &Settings{}
+		return s, nil
+	}
+
+	p := &parser{values: values}
 	settings := &Settings{
 		App: AppSettings{
-			Name:        getEnv("APP_NAME", "MyApp"),
-			Version:     getEnv("APP_VERSION", "1.0.0"),
-			Description: getEnv("APP_DESCRIPTION", ""),
-			Debug:       getEnvAsBool("APP_DEBUG", false),
-			UploadDir:   getEnv("UPLOAD_DIR", "uploads"),
+			Name:        p.string("APP_NAME"),
+			Version:     p.string("APP_VERSION"),
+			Description: p.string("APP_DESCRIPTION"),
+			Debug:       p.bool("APP_DEBUG"),
+			UploadDir:   p.string("UPLOAD_DIR"),
 			Server: ServerOptions{
-				APIBase:       getEnv("SERVER_API_BASE", "/api"),
-				DomainName:    getEnv("SERVER_DOMAIN", "localhost"),
-				HTTPAddress:   getEnv("SERVER_HTTP_ADDRESS", ":8080"),
-				CorsWhitelist: getEnvAsSlice("SERVER_CORS_WHITELIST", ","),
+				APIBase:       p.string("SERVER_API_BASE"),
+				DomainName:    p.string("SERVER_DOMAIN"),
+				HTTPAddress:   p.string("SERVER_HTTP_ADDRESS"),
+				CorsWhitelist: p.slice("SERVER_CORS_WHITELIST", ","),
 			},
 			Auth: AuthOptions{
-				EncryptKeys: getEnv("AUTH_ENCRYPT_KEYS", ""),
+				EncryptKeys: p.string("AUTH_ENCRYPT_KEYS"),
+			},
+			Loan: LoanOptions{
+				FundingWindow:  p.duration("LOAN_FUNDING_WINDOW"),
+				ExpiryInterval: p.duration("LOAN_EXPIRY_INTERVAL"),
+				VisitMaxDrift:  p.duration("LOAN_VISIT_MAX_DRIFT"),
+			},
+			Fee: FeeOptions{
+				Type:  p.string("FEE_TYPE"),
+				Value: p.float("FEE_VALUE"),
+			},
+			File: FileOptions{
+				PendingTTL: p.duration("FILE_PENDING_TTL"),
+				GCInterval: p.duration("FILE_GC_INTERVAL"),
+
+				MaxFileSize:         p.int64("FILE_MAX_SIZE"),
+				MaxApprovalSize:     p.int64("FILE_MAX_APPROVAL_SIZE"),
+				MaxDisbursementSize: p.int64("FILE_MAX_DISBURSEMENT_SIZE"),
+				MaxDocumentsSize:    p.int64("FILE_MAX_DOCUMENTS_SIZE"),
+
+				ScannerAddress: p.string("FILE_SCANNER_ADDRESS"),
+				ScanTimeout:    p.duration("FILE_SCAN_TIMEOUT"),
 			},
 		},
 		Conn: ConnectionSettings{
 			Postgres: PostgresOption{
-				Driver:  getEnv("POSTGRES_DRIVER", "postgres"),
-				URI:     getEnv("POSTGRES_URI", ""),
-				Enabled: getEnvAsBool("POSTGRES_ENABLED", true),
+				Driver:  p.string("POSTGRES_DRIVER"),
+				URI:     p.string("POSTGRES_URI"),
+				Enabled: p.bool("POSTGRES_ENABLED"),
+
+				AutoMigrate: p.boolOr("POSTGRES_AUTO_MIGRATE", env == EnvDev),
 			},
 			SMTP: SMTPOption{
-				Host:     getEnv("SMTP_HOST", "smtp.gmail.com"),
-				Port:     getEnvAsInt("SMTP_PORT", 465),
-				Username: getEnv("SMTP_USER", ""),
-				Password: getEnv("SMTP_PASS", ""),
-				From:     getEnv("SMTP_FROM", "smtp@gmail.com"),
+				Host:     p.string("SMTP_HOST"),
+				Port:     p.int("SMTP_PORT"),
+				Username: p.string("SMTP_USER"),
+				Password: p.string("SMTP_PASS"),
+				From:     p.string("SMTP_FROM"),
 			},
 		},
 	}
 
+	// a malformed value is reported once, not again as out of range
+	errs = append(errs, p.errs...)
+	malformed := map[string]bool{}
+	for _, err := range p.errs {
+		malformed[err.Key] = true
+	}
+	for _, err := range settings.validate(env) {
+		if !malformed[err.Key] {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &ConfigError{Errors: errs}
+	}
+
+	s = settings
 	return settings, nil
 }
 
-// Helper functions to get env variables with default values
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+// resolve merges the sources into one value per key
+func resolve(o loadOptions) (map[string]string, []KeyError) {
+	var errs []KeyError
+	values := make(map[string]string, len(defaults))
+	for k, v := range defaults {
+		values[k] = v
 	}
-	return defaultValue
-}
 
-func getEnvAsBool(key string, defaultValue bool) bool {
-	if value, exists := os.LookupEnv(key); exists {
-		boolValue, err := strconv.ParseBool(value)
-		if err == nil {
-			return boolValue
+	// apply sets the keys of a source, unknown keys are only reported for the sources
+	// of this application since the environment is shared with everything else
+	apply := func(source map[string]string, strict bool) {
+		for k, v := range source {
+			key, fromFile := strings.CutSuffix(k, fileSuffix)
+			if _, known := defaults[key]; !known {
+				if _, known := defaults[k]; known {
+					key, fromFile = k, false
+				} else {
+					if strict {
+						errs = append(errs, KeyError{Key: k, Message: "unknown key"})
+					}
+					continue
+				}
+			}
+			if fromFile {
+				if _, both := source[key]; both {
+					errs = append(errs, KeyError{Key: k, Message: "conflicts with " + key})
+					continue
+				}
+				data, err := os.ReadFile(v)
+				if err != nil {
+					errs = append(errs, KeyError{Key: k, Message: err.Error()})
+					continue
+				}
+				v = strings.TrimRight(string(data), "\r\n")
+			}
+			values[key] = v
 		}
 	}
-	return defaultValue
-}
 
-func getEnvAsInt(key string, defaultValue int) int {
-	if value, exists := os.LookupEnv(key); exists {
-		intValue, err := strconv.Atoi(value)
-		if err == nil {
-			return intValue
+	if o.file != "" {
+		source, err := readYAML(o.file)
+		if err != nil {
+			errs = append(errs, KeyError{Key: o.file, Message: err.Error()})
 		}
+		apply(source, true)
 	}
-	return defaultValue
+
+	// the dotenv file fills the environment without overriding it, a missing file is fine
+	// since the configuration may come from the environment only
+	if err := godotenv.Load(o.envFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		errs = append(errs, KeyError{Key: o.envFile, Message: err.Error()})
+	}
+
+	environ := map[string]string{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			environ[k] = v
+		}
+	}
+	apply(environ, false)
+
+	flags := make(map[string]string, len(o.flags))
+	for k, v := range o.flags {
+		flags[normalizeKey(k)] = v
+	}
+	apply(flags, true)
+
+	return values, errs
 }
 
-func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
-	if value, exists := os.LookupEnv(key); exists {
-		durationValue, err := time.ParseDuration(value)
-		if err == nil {
-			return durationValue
+// normalizeKey turns a dotted YAML path into a key, smtp.pass is SMTP_PASS
+func normalizeKey(key string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// readYAML flattens a YAML document into keys
+func readYAML(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	var flatten func(prefix string, node map[string]interface{})
+	flatten = func(prefix string, node map[string]interface{}) {
+		for k, v := range node {
+			key := normalizeKey(k)
+			if prefix != "" {
+				key = prefix + "_" + key
+			}
+			switch v := v.(type) {
+			case map[string]interface{}:
+				flatten(key, v)
+			case []interface{}:
+				items := make([]string, len(v))
+				for i, item := range v {
+					items[i] = fmt.Sprint(item)
+				}
+				values[key] = strings.Join(items, ",")
+			case nil:
+				values[key] = ""
+			default:
+				values[key] = fmt.Sprint(v)
+			}
 		}
 	}
-	return defaultValue
+	flatten("", doc)
+	return values, nil
+}
+
+// parser converts values and records every malformed one
+type parser struct {
+	values map[string]string
+	errs   []KeyError
+}
+
+func (p *parser) fail(key, kind string) {
+	p.errs = append(p.errs, KeyError{Key: key, Message: fmt.Sprintf("invalid %s %q", kind, p.values[key])})
+}
+
+func (p *parser) string(key string) string {
+	return p.values[key]
+}
+
+func (p *parser) bool(key string) bool {
+	v, err := strconv.ParseBool(p.values[key])
+	if err != nil {
+		p.fail(key, "boolean")
+	}
+	return v
+}
+
+// boolOr returns def when the key is empty
+func (p *parser) boolOr(key string, def bool) bool {
+	if p.values[key] == "" {
+		return def
+	}
+	return p.bool(key)
+}
+
+func (p *parser) int(key string) int {
+	v, err := strconv.Atoi(p.values[key])
+	if err != nil {
+		p.fail(key, "integer")
+	}
+	return v
+}
+
+func (p *parser) int64(key string) int64 {
+	v, err := strconv.ParseInt(p.values[key], 10, 64)
+	if err != nil {
+		p.fail(key, "integer")
+	}
+	return v
+}
+
+func (p *parser) float(key string) float64 {
+	v, err := strconv.ParseFloat(p.values[key], 64)
+	if err != nil {
+		p.fail(key, "number")
+	}
+	return v
+}
+
+func (p *parser) duration(key string) time.Duration {
+	v, err := time.ParseDuration(p.values[key])
+	if err != nil {
+		p.fail(key, "duration")
+	}
+	return v
 }
 
-func getEnvAsSlice(key, sep string) []string {
-	if value, exists := os.LookupEnv(key); exists {
-		return strings.Split(value, sep)
+func (p *parser) slice(key, sep string) []string {
+	if p.values[key] == "" {
+		return []string{}
 	}
-	return []string{}
+	return strings.Split(p.values[key], sep)
 }
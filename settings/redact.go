@@ -0,0 +1,42 @@
+package settings
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// redacted replaces a secret value, an empty secret stays empty so a missing one is visible
+const redacted = "REDACTED"
+
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactURI keeps a connection string readable but hides its password
+func redactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return redact(uri)
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+// Redacted returns a copy of the settings without secrets, safe to print or log
+func (s Settings) Redacted() Settings {
+	s.App.Auth.EncryptKeys = redact(s.App.Auth.EncryptKeys)
+	s.Conn.Postgres.URI = redactURI(s.Conn.Postgres.URI)
+	s.Conn.SMTP.Password = redact(s.Conn.SMTP.Password)
+	return s
+}
+
+// String formats the redacted settings, so printing settings never leaks a secret
+func (s Settings) String() string {
+	type plain Settings // without the String method
+	return fmt.Sprintf("%+v", plain(s.Redacted()))
+}
@@ -0,0 +1,107 @@
+package settings
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// KeyError is an invalid configuration key
+type KeyError struct {
+	Key     string
+	Message string
+}
+
+func (e KeyError) Error() string {
+	return e.Key + ": " + e.Message
+}
+
+// ConfigError lists every invalid key of a configuration
+type ConfigError struct {
+	Errors []KeyError
+}
+
+func (e *ConfigError) Error() string {
+	errs := append([]KeyError(nil), e.Errors...)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Key < errs[j].Key })
+
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = "  " + err.Error()
+	}
+	return fmt.Sprintf("invalid configuration, %d error(s):\n%s", len(errs), strings.Join(lines, "\n"))
+}
+
+// Keys returns the invalid keys
+func (e *ConfigError) Keys() []string {
+	keys := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		keys[i] = err.Key
+	}
+	return keys
+}
+
+// validate returns the keys whose values are out of range in env
+func (s *Settings) validate(env string) []KeyError {
+	var errs []KeyError
+	check := func(ok bool, key, message string) {
+		if !ok {
+			errs = append(errs, KeyError{Key: key, Message: message})
+		}
+	}
+
+	switch env {
+	case EnvDev, EnvTest, EnvProd:
+	default:
+		errs = append(errs, KeyError{Key: "APP_ENV", Message: fmt.Sprintf("unknown environment %q", env)})
+	}
+
+	app := s.App
+	// tokens signed with a random key would not survive a restart
+	if env == EnvProd {
+		check(app.Auth.EncryptKeys != "", "AUTH_ENCRYPT_KEYS", "is required in "+EnvProd)
+	}
+	check(app.Name != "", "APP_NAME", "is required")
+	check(app.UploadDir != "", "UPLOAD_DIR", "is required")
+	check(app.Server.HTTPAddress != "", "SERVER_HTTP_ADDRESS", "is required")
+	check(strings.HasPrefix(app.Server.APIBase, "/"), "SERVER_API_BASE", "must start with /")
+
+	check(app.Loan.FundingWindow > 0, "LOAN_FUNDING_WINDOW", "must be positive")
+	check(app.Loan.ExpiryInterval > 0, "LOAN_EXPIRY_INTERVAL", "must be positive")
+	check(app.Loan.VisitMaxDrift >= 0, "LOAN_VISIT_MAX_DRIFT", "must not be negative")
+
+	switch app.Fee.Type {
+	case "percentage":
+		check(app.Fee.Value >= 0 && app.Fee.Value <= 1, "FEE_VALUE", "must be between 0 and 1 for a percentage fee")
+	case "flat":
+		check(app.Fee.Value >= 0, "FEE_VALUE", "must not be negative")
+	default:
+		errs = append(errs, KeyError{Key: "FEE_TYPE", Message: fmt.Sprintf("must be percentage or flat, got %q", app.Fee.Type)})
+	}
+
+	check(app.File.PendingTTL > 0, "FILE_PENDING_TTL", "must be positive")
+	check(app.File.GCInterval > 0, "FILE_GC_INTERVAL", "must be positive")
+	check(app.File.MaxFileSize >= 0, "FILE_MAX_SIZE", "must not be negative")
+	check(app.File.MaxApprovalSize >= 0, "FILE_MAX_APPROVAL_SIZE", "must not be negative")
+	check(app.File.MaxDisbursementSize >= 0, "FILE_MAX_DISBURSEMENT_SIZE", "must not be negative")
+	check(app.File.MaxDocumentsSize >= 0, "FILE_MAX_DOCUMENTS_SIZE", "must not be negative")
+	check(app.File.ScanTimeout > 0, "FILE_SCAN_TIMEOUT", "must be positive")
+
+	postgres := s.Conn.Postgres
+	if postgres.Enabled {
+		check(postgres.Driver != "", "POSTGRES_DRIVER", "is required")
+		if postgres.URI == "" {
+			errs = append(errs, KeyError{Key: "POSTGRES_URI", Message: "is required when POSTGRES_ENABLED is true"})
+		} else if _, err := url.Parse(postgres.URI); err != nil {
+			errs = append(errs, KeyError{Key: "POSTGRES_URI", Message: "is not a valid URL"})
+		}
+	}
+
+	smtp := s.Conn.SMTP
+	check(smtp.Host != "", "SMTP_HOST", "is required")
+	check(smtp.Port > 0 && smtp.Port <= 65535, "SMTP_PORT", "must be between 1 and 65535")
+	check(smtp.From != "", "SMTP_FROM", "is required")
+
+	return errs
+}